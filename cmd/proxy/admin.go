@@ -0,0 +1,252 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolpin"
+)
+
+// adminCommands are run instead of the proxy when named as the first argument
+var adminCommands = map[string]func(args []string) int{
+	"apps": appsCommand,
+	"pins": pinsCommand,
+}
+
+// runAdminCommand runs the admin command named in args, if any, and reports
+// whether one was run along with its exit code
+func runAdminCommand(args []string) (int, bool) {
+	if len(args) == 0 {
+		return 0, false
+	}
+	cmd, ok := adminCommands[args[0]]
+	if !ok {
+		return 0, false
+	}
+	return cmd(args[1:]), true
+}
+
+// appsCommand lists and purges the Asgardeo applications created by /register
+func appsCommand(args []string) int {
+	fs := flag.NewFlagSet("apps", flag.ContinueOnError)
+	demoMode := fs.Bool("demo", false, "Use the demo Asgardeo organization.")
+	asgardeoMode := fs.Bool("asgardeo", false, "Use the configured Asgardeo organization.")
+	all := fs.Bool("all", false, "With purge, delete all tracked applications instead of only stale ones.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: openmcpauthproxy apps [-demo|-asgardeo] [-all] list|purge")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	apps, err := loadAsgardeoApps(*demoMode, *asgardeoMode)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+
+	switch fs.Arg(0) {
+	case "list":
+		list, err := apps.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing applications: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "CLIENT ID\tNAME\tAPP ID\tCREATED\tLAST USED\tSTALE")
+		for _, app := range list {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%v\n", app.ClientID, app.Name, app.AppID,
+				app.CreatedAt.Format(time.RFC3339), app.LastUsed.Format(time.RFC3339), apps.Stale(app))
+		}
+		tw.Flush()
+	case "purge":
+		deleted, err := apps.Purge(*all)
+		fmt.Printf("Deleted %d application(s)\n", deleted)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error purging applications: %v\n", err)
+			return 1
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+func loadAsgardeoApps(demoMode, asgardeoMode bool) (*authz.AsgardeoApps, error) {
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("loading config: %w", err)
+	}
+	if err := httpclient.Configure(cfg.Outbound); err != nil {
+		return nil, fmt.Errorf("invalid outbound configuration: %w", err)
+	}
+	if !demoMode && !asgardeoMode && cfg.Mode != "demo" && cfg.Mode != "asgardeo" {
+		return nil, fmt.Errorf("apps requires the demo or asgardeo provider")
+	}
+	section, appsCfg := "asgardeo", cfg.Asgardeo.Apps
+	if demoMode || (!asgardeoMode && cfg.Mode == "demo") {
+		section, appsCfg = "demo", cfg.Demo.Apps
+	}
+	if appsCfg.Store.Type != store.TypeFile {
+		// A memory store would start empty and leave the proxy's applications untouched
+		return nil, fmt.Errorf("apps requires %s.apps.store to be a file store", section)
+	}
+
+	provider, err := MakeProvider(context.Background(), cfg, demoMode, asgardeoMode)
+	if err != nil {
+		return nil, err
+	}
+	appsProvider, ok := provider.(interface{ Apps() *authz.AsgardeoApps })
+	if !ok {
+		return nil, fmt.Errorf("provider %s does not track applications", cfg.Mode)
+	}
+	return appsProvider.Apps(), nil
+}
+
+// pinsCommand reviews and approves tool definitions that do not match their pins
+func pinsCommand(args []string) int {
+	fs := flag.NewFlagSet("pins", flag.ContinueOnError)
+	server := fs.String("server", toolpin.DefaultServer, "Gateway server the tool belongs to.")
+	all := fs.Bool("all", false, "With approve, approve all pending definitions of all servers.")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: openmcpauthproxy pins [-server name] [-all] list|show <tool>|approve [<tool>]|revoke <tool>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error loading config: %v\n", err)
+		return 1
+	}
+	if !cfg.ToolPinning.Enabled {
+		fmt.Fprintln(os.Stderr, "Error: tool_pinning is not enabled")
+		return 1
+	}
+	if err := cfg.ToolPinning.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	if cfg.ToolPinning.Store.Type != store.TypeFile {
+		fmt.Fprintln(os.Stderr, "Error: pins requires tool_pinning.store to be a file store")
+		return 1
+	}
+	st, err := store.NewFileStore(cfg.ToolPinning.Store.Path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return 1
+	}
+	pins := toolpin.Open(st)
+
+	tool := fs.Arg(1)
+	switch fs.Arg(0) {
+	case "list":
+		approved, pending, err := pins.List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error listing pins: %v\n", err)
+			return 1
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "SERVER\tTOOL\tSTATUS\tFINGERPRINT\tSINCE")
+		for _, rec := range pending {
+			fmt.Fprintf(tw, "%s\t%s\tpending\t%s\t%s\n", rec.Server, rec.Tool, rec.Fingerprint, rec.Time.Format(time.RFC3339))
+		}
+		for _, rec := range approved {
+			fmt.Fprintf(tw, "%s\t%s\tapproved\t%s\t%s\n", rec.Server, rec.Tool, rec.Fingerprint, rec.Time.Format(time.RFC3339))
+		}
+		tw.Flush()
+	case "show":
+		if tool == "" {
+			fs.Usage()
+			return 2
+		}
+		approved, err := pins.Approved(*server, tool)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		pending, err := pins.Pending(*server, tool)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		if approved == nil && pending == nil {
+			fmt.Fprintf(os.Stderr, "Error: tool %s on server %s has no pins\n", tool, *server)
+			return 1
+		}
+		printPin("Approved", approved)
+		printPin("Pending", pending)
+	case "approve":
+		var targets []toolpin.Record
+		if *all {
+			_, pending, err := pins.List()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error listing pins: %v\n", err)
+				return 1
+			}
+			targets = pending
+		} else if tool != "" {
+			targets = []toolpin.Record{{Server: *server, Tool: tool}}
+		} else {
+			fs.Usage()
+			return 2
+		}
+		for _, target := range targets {
+			rec, err := pins.Approve(target.Server, target.Tool)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				return 1
+			}
+			fmt.Printf("Approved %s on server %s (%s)\n", rec.Tool, rec.Server, rec.Fingerprint)
+		}
+	case "revoke":
+		if tool == "" {
+			fs.Usage()
+			return 2
+		}
+		if err := pins.Revoke(*server, tool); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Revoked the approval of %s on server %s\n", tool, *server)
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
+
+// printPin prints a pinned tool definition for review
+func printPin(label string, rec *toolpin.Record) {
+	if rec == nil {
+		fmt.Printf("%s: none\n\n", label)
+		return
+	}
+	var definition bytes.Buffer
+	if err := json.Indent(&definition, rec.Definition, "", "  "); err != nil {
+		definition.Write(rec.Definition)
+	}
+	fmt.Printf("%s: %s (%s)\n%s\n\n", label, rec.Fingerprint, rec.Time.Format(time.RFC3339), definition.String())
+}
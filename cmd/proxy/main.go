@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
@@ -11,13 +12,20 @@ import (
 
 	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
 	"github.com/wso2/open-mcp-auth-proxy/internal/logging"
 	"github.com/wso2/open-mcp-auth-proxy/internal/proxy"
 	"github.com/wso2/open-mcp-auth-proxy/internal/subprocess"
+	"github.com/wso2/open-mcp-auth-proxy/internal/tlsserver"
 	"github.com/wso2/open-mcp-auth-proxy/internal/util"
 )
 
 func main() {
+	// Admin commands such as "apps list" run instead of the proxy
+	if code, ok := runAdminCommand(os.Args[1:]); ok {
+		os.Exit(code)
+	}
+
 	demoMode := flag.Bool("demo", false, "Use Asgardeo-based provider (demo).")
 	asgardeoMode := flag.Bool("asgardeo", false, "Use Asgardeo-based provider (asgardeo).")
 	debugMode := flag.Bool("debug", false, "Enable debug logging")
@@ -33,6 +41,12 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Outbound clients must be configured before any provider makes calls
+	if err := httpclient.Configure(cfg.Outbound); err != nil {
+		logger.Error("Invalid outbound configuration: %v", err)
+		os.Exit(1)
+	}
+
 	// Override transport mode if stdio flag is set
 	if *stdioMode {
 		cfg.TransportMode = config.StdioTransport
@@ -49,37 +63,61 @@ func main() {
 	logger.Info("Using MCP server base URL: %s", cfg.BaseURL)
 	logger.Info("Using MCP paths: SSE=%s, Messages=%s", cfg.Paths.SSE, cfg.Paths.Messages)
 
-	// 2. Start subprocess if configured and in stdio mode
-	var procManager *subprocess.Manager
-	if cfg.TransportMode == config.StdioTransport && cfg.Stdio.Enabled {
+	// 2. Start a subprocess for each upstream server in stdio mode
+	var procManagers []*subprocess.Manager
+	for _, upstream := range cfg.UpstreamConfigs() {
+		if upstream.TransportMode != config.StdioTransport || !upstream.Stdio.Enabled {
+			continue
+		}
 		// Ensure all required dependencies are available
-		if err := subprocess.EnsureDependenciesAvailable(cfg.Stdio.UserCommand); err != nil {
+		if err := subprocess.EnsureDependenciesAvailable(upstream.Stdio.UserCommand); err != nil {
 			logger.Warn("%v", err)
 			logger.Warn("Subprocess may fail to start due to missing dependencies")
 		}
-    
-		procManager = subprocess.NewManager()
-		if err := procManager.Start(cfg); err != nil {
+		// Per-user subprocesses are started by the router on first use
+		if upstream.Stdio.PerUser {
+			continue
+		}
+
+		procManager := subprocess.NewManager()
+		if err := procManager.Start(upstream); err != nil {
 			logger.Warn("Failed to start subprocess: %v", err)
 		}
-	} else if cfg.TransportMode == config.SSETransport {
+		procManagers = append(procManagers, procManager)
+	}
+	if len(procManagers) == 0 && cfg.TransportMode == config.SSETransport {
 		logger.Info("Using SSE transport mode, not starting subprocess")
 	}
 
-	// 3. Create the chosen provider
-	var provider authz.Provider = MakeProvider(cfg, *demoMode, *asgardeoMode)
+	// Background work such as metadata refreshes stops at shutdown
+	ctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
 
-	// 4. (Optional) Fetch JWKS if you want local JWT validation
-	if err := util.FetchJWKS(cfg.JWKSURL); err != nil {
-		logger.Error("Failed to fetch JWKS: %v", err)
+	// 3. Create the chosen provider
+	provider, err := MakeProvider(ctx, cfg, *demoMode, *asgardeoMode)
+	if err != nil {
+		logger.Error("Error creating provider: %v", err)
 		os.Exit(1)
 	}
+	logger.Info("Using provider mode: %s", cfg.Mode)
+
+	// 4. (Optional) Fetch JWKS if you want local JWT validation.
+	// The embedded authorization server registers its own signing key instead.
+	if cfg.Mode != "embedded" {
+		if err := util.FetchJWKS(cfg.JWKSURL); err != nil {
+			logger.Error("Failed to fetch JWKS: %v", err)
+			os.Exit(1)
+		}
+	}
 
 	// 5. (Optional) Build the access controler
 	accessController := &authz.ScopeValidator{}
+	if mapper, ok := provider.(authz.ScopeMapper); ok {
+		accessController.Mapper = mapper
+	}
 
 	// 6. Build the main router
-	mux := proxy.NewRouter(cfg, provider, accessController)
+	mux := proxy.NewRouter(ctx, cfg, provider, accessController)
 
 	listen_address := fmt.Sprintf(":%d", cfg.ListenPort)
 
@@ -88,10 +126,42 @@ func main() {
 		Addr:    listen_address,
 		Handler: mux,
 	}
+	if cfg.Limits.MaxHeaderBytes > 0 {
+		srv.MaxHeaderBytes = cfg.Limits.MaxHeaderBytes
+	}
+
+	var redirectSrv *http.Server
+	if cfg.TLS.Enabled {
+		tlsConfig, err := tlsserver.NewConfig(cfg.TLS)
+		if err != nil {
+			logger.Error("Invalid TLS configuration: %v", err)
+			os.Exit(1)
+		}
+		srv.TLSConfig = tlsConfig
+
+		if cfg.TLS.RedirectHTTPPort > 0 {
+			redirectSrv = &http.Server{
+				Addr:    fmt.Sprintf(":%d", cfg.TLS.RedirectHTTPPort),
+				Handler: tlsserver.RedirectHandler(cfg.ListenPort),
+			}
+			go func() {
+				logger.Info("Redirecting HTTP on %s to HTTPS", redirectSrv.Addr)
+				if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					logger.Error("HTTP redirect server error: %v", err)
+				}
+			}()
+		}
+	}
 
 	go func() {
 		logger.Info("Server listening on %s", listen_address)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if cfg.TLS.Enabled {
+			err = srv.ListenAndServeTLS("", "")
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error("Server error: %v", err)
 			os.Exit(1)
 		}
@@ -102,10 +172,13 @@ func main() {
 	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
 	<-stop
 	logger.Info("Shutting down...")
+	stopBackground()
 
-	// 9. First terminate subprocess if running
-	if procManager != nil && procManager.IsRunning() {
-		procManager.Shutdown()
+	// 9. First terminate subprocesses if running
+	for _, procManager := range procManagers {
+		if procManager.IsRunning() {
+			procManager.Shutdown()
+		}
 	}
 
 	// 10. Then shutdown the server
@@ -116,5 +189,11 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Error("HTTP server shutdown error: %v", err)
 	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
+
+	// 11. Stop what the router started once no request is left to use it
+	mux.Close()
 	logger.Info("Stopped.")
 }
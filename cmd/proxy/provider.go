@@ -1,20 +1,26 @@
 package main
 
 import (
+	"context"
+	"fmt"
+
 	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
 	"github.com/wso2/open-mcp-auth-proxy/internal/constants"
 )
 
-func MakeProvider(cfg *config.Config, demoMode, asgardeoMode bool) authz.Provider {
-	var mode, orgName string
+// MakeProvider creates the provider for the configured mode. Background refreshes
+// started by the provider stop when ctx is done.
+func MakeProvider(ctx context.Context, cfg *config.Config, demoMode, asgardeoMode bool) (authz.Provider, error) {
+	var mode string
 	switch {
 	case demoMode:
 		mode = "demo"
-		orgName = cfg.Demo.OrgName
 	case asgardeoMode:
 		mode = "asgardeo"
-		orgName = cfg.Asgardeo.OrgName
+	case cfg.Mode != "":
+		// Providers without a command line flag are selected in config.yaml
+		mode = cfg.Mode
 	default:
 		mode = "default"
 	}
@@ -23,6 +29,13 @@ func MakeProvider(cfg *config.Config, demoMode, asgardeoMode bool) authz.Provide
 	switch mode {
 	case "demo", "asgardeo":
 		if len(cfg.ProtectedResourceMetadata.AuthorizationServers) == 0 && cfg.ProtectedResourceMetadata.JwksURI == "" {
+			orgName := cfg.Asgardeo.OrgName
+			if mode == "demo" {
+				orgName = cfg.Demo.OrgName
+			}
+			if orgName == "" {
+				return nil, fmt.Errorf("%s.org_name is required in %s mode", mode, mode)
+			}
 			base := constants.ASGARDEO_BASE_URL + orgName + "/oauth2"
 			cfg.AuthServerBaseURL = base
 			cfg.JWKSURL = base + "/jwks"
@@ -30,9 +43,21 @@ func MakeProvider(cfg *config.Config, demoMode, asgardeoMode bool) authz.Provide
 			cfg.AuthServerBaseURL = cfg.ProtectedResourceMetadata.AuthorizationServers[0]
 			cfg.JWKSURL = cfg.ProtectedResourceMetadata.JwksURI
 		}
-		return authz.NewAsgardeoProvider(cfg)
+		return authz.NewAsgardeoProvider(ctx, cfg)
 
-	default:
+	case "oidc":
+		return authz.NewOIDCProvider(ctx, cfg)
+
+	case "keycloak":
+		return authz.NewKeycloakProvider(ctx, cfg)
+
+	case "auth0":
+		return authz.NewAuth0Provider(ctx, cfg)
+
+	case "embedded":
+		return authz.NewEmbeddedProvider(cfg)
+
+	case "default":
 		if cfg.Default.BaseURL != "" && cfg.Default.JWKSURL != "" {
 			cfg.AuthServerBaseURL = cfg.Default.BaseURL
 			cfg.JWKSURL = cfg.Default.JWKSURL
@@ -40,6 +65,9 @@ func MakeProvider(cfg *config.Config, demoMode, asgardeoMode bool) authz.Provide
 			cfg.AuthServerBaseURL = cfg.ProtectedResourceMetadata.AuthorizationServers[0]
 			cfg.JWKSURL = cfg.ProtectedResourceMetadata.JwksURI
 		}
-		return authz.NewDefaultProvider(cfg)
+		return authz.NewDefaultProvider(cfg), nil
+
+	default:
+		return nil, fmt.Errorf("unknown provider mode: %s", mode)
 	}
 }
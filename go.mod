@@ -4,5 +4,6 @@ go 1.21
 
 require (
 	github.com/golang-jwt/jwt/v4 v4.5.2
+	golang.org/x/crypto v0.31.0
 	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,485 @@
+// Package aggregate presents several MCP servers as a single MCP server. It
+// keeps a session with each upstream, merges their tool, resource and prompt
+// lists under name prefixes, and routes each call to the upstream that owns it.
+package aggregate
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const (
+	// SessionHeader carries the MCP session ID of the streamable HTTP transport
+	SessionHeader = "Mcp-Session-Id"
+	// ProtocolVersionHeader carries the negotiated MCP protocol version
+	ProtocolVersionHeader = "MCP-Protocol-Version"
+
+	sessionTTL     = time.Hour
+	maxMessageSize = 10 << 20
+	// Upstream list pages followed for one list request
+	maxPages = 20
+	// Session limits when the config leaves them unset
+	defaultMaxSessions           = 1000
+	defaultMaxSessionsPerSubject = 10
+)
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// errTooManySessions means the session limit is reached by live sessions
+var errTooManySessions = errors.New("too many aggregate sessions")
+
+// errSessionExpired means an upstream no longer knows its session, so the
+// aggregate session has to be initialized again
+var errSessionExpired = errors.New("upstream session expired")
+
+// Upstream is an MCP server included in the aggregate
+type Upstream struct {
+	Name   string
+	Prefix string
+	URL    string // Streamable HTTP endpoint
+	// Sends the requests to the upstream, applying its own checks; the
+	// outbound upstream client is used when nil
+	Transport http.RoundTripper
+
+	client *http.Client
+}
+
+// PrepareFunc sets the caller's credentials on the headers of an upstream request
+type PrepareFunc func(h http.Header)
+
+// Server is the aggregate MCP server
+type Server struct {
+	upstreams []*Upstream
+	separator string
+	now       func() time.Time
+	// Limits on the sessions kept in total and for one subject
+	maxSessions           int
+	maxSessionsPerSubject int
+
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// session is a client session, made of one session with each upstream
+type session struct {
+	subject   string
+	upstreams map[string]*upstreamSession
+	lastUsed  time.Time
+
+	mu sync.Mutex
+	// Upstream that listed each resource URI
+	resources map[string]string
+}
+
+type upstreamSession struct {
+	id              string
+	protocolVersion string
+	capabilities    map[string]json.RawMessage
+}
+
+// message is a JSON-RPC request, notification or response
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// New creates an aggregate of the upstreams. Prefixes must be unique; names
+// are presented to clients as prefix + cfg.Separator + name.
+func New(upstreams []Upstream, cfg config.AggregateConfig) (*Server, error) {
+	if len(upstreams) == 0 {
+		return nil, fmt.Errorf("aggregate requires at least one upstream")
+	}
+	s := &Server{
+		separator:             cfg.Separator,
+		now:                   time.Now,
+		maxSessions:           cfg.MaxSessions,
+		maxSessionsPerSubject: cfg.MaxSessionsPerSubject,
+		sessions:              make(map[string]*session),
+	}
+	if s.maxSessions <= 0 {
+		s.maxSessions = defaultMaxSessions
+	}
+	if s.maxSessionsPerSubject <= 0 {
+		s.maxSessionsPerSubject = defaultMaxSessionsPerSubject
+	}
+	client := httpclient.Client(httpclient.DestinationUpstream)
+	prefixes := make(map[string]bool)
+	for i := range upstreams {
+		u := upstreams[i]
+		if u.Prefix == "" || u.URL == "" {
+			return nil, fmt.Errorf("aggregate upstream %s requires a prefix and URL", u.Name)
+		}
+		if prefixes[u.Prefix] {
+			return nil, fmt.Errorf("duplicate aggregate prefix %q", u.Prefix)
+		}
+		prefixes[u.Prefix] = true
+		u.client = client
+		if u.Transport != nil {
+			u.client = &http.Client{Transport: u.Transport, Timeout: client.Timeout}
+		}
+		s.upstreams = append(s.upstreams, &u)
+	}
+	return s, nil
+}
+
+// Handle serves one request to the aggregate endpoint on behalf of the
+// authenticated subject. Sessions are bound to the subject that created them.
+func (s *Server) Handle(w http.ResponseWriter, r *http.Request, subject string, prepare PrepareFunc) {
+	switch r.Method {
+	case http.MethodPost:
+	case http.MethodDelete:
+		s.handleDelete(w, r, subject, prepare)
+		return
+	default:
+		// Server-initiated messages are not relayed, so there is no GET stream
+		w.Header().Set("Allow", "POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxMessageSize))
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return
+	}
+	body = []byte(strings.TrimSpace(string(body)))
+	if len(body) > 0 && body[0] == '[' {
+		writeMessage(w, errorResponse(nil, codeInvalidRequest, "Batch requests are not supported"))
+		return
+	}
+	var msg message
+	if err := json.Unmarshal(body, &msg); err != nil {
+		writeMessage(w, errorResponse(nil, codeParseError, "Parse error"))
+		return
+	}
+
+	// Notifications and responses are accepted; the proxy already sent the
+	// upstreams their initialized notifications
+	if msg.ID == nil || msg.Method == "" {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	if msg.Method == "initialize" {
+		s.handleInitialize(r.Context(), w, &msg, subject, prepare)
+		return
+	}
+
+	sessionID := r.Header.Get(SessionHeader)
+	if sessionID == "" {
+		http.Error(w, "Bad request: missing "+SessionHeader, http.StatusBadRequest)
+		return
+	}
+	sess := s.session(sessionID, subject)
+	if sess == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	result, rpcErr, err := s.dispatch(r.Context(), sess, &msg, prepare)
+	if errors.Is(err, errSessionExpired) {
+		s.mu.Lock()
+		delete(s.sessions, sessionID)
+		s.mu.Unlock()
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		logger.Warn("Aggregate %s failed: %v", msg.Method, err)
+		rpcErr = &rpcError{Code: codeInternalError, Message: "Upstream MCP server unavailable"}
+	}
+	if rpcErr != nil {
+		writeMessage(w, &message{JSONRPC: "2.0", ID: msg.ID, Error: rpcErr})
+		return
+	}
+	writeMessage(w, &message{JSONRPC: "2.0", ID: msg.ID, Result: result})
+}
+
+// dispatch serves a request within a session
+func (s *Server) dispatch(ctx context.Context, sess *session, msg *message, prepare PrepareFunc) (json.RawMessage, *rpcError, error) {
+	switch msg.Method {
+	case "ping":
+		return json.RawMessage(`{}`), nil, nil
+	case "tools/list":
+		return s.list(ctx, sess, prepare, msg.Method, "tools", "tools")
+	case "prompts/list":
+		return s.list(ctx, sess, prepare, msg.Method, "prompts", "prompts")
+	case "resources/list":
+		return s.list(ctx, sess, prepare, msg.Method, "resources", "resources")
+	case "resources/templates/list":
+		return s.list(ctx, sess, prepare, msg.Method, "resources", "resourceTemplates")
+	case "tools/call", "prompts/get":
+		return s.callByName(ctx, sess, msg, prepare)
+	case "resources/read":
+		return s.readResource(ctx, sess, msg, prepare)
+	}
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "Method not found: " + msg.Method}, nil
+}
+
+// list merges a list method of every upstream with the capability, prefixing names
+func (s *Server) list(ctx context.Context, sess *session, prepare PrepareFunc, method, capability, key string) (json.RawMessage, *rpcError, error) {
+	items := []map[string]json.RawMessage{}
+	for _, u := range s.upstreams {
+		us := sess.upstreams[u.Name]
+		if us == nil || us.capabilities[capability] == nil {
+			continue
+		}
+
+		cursor := ""
+		for page := 0; page < maxPages; page++ {
+			var params interface{}
+			if cursor != "" {
+				params = map[string]string{"cursor": cursor}
+			}
+			result, rpcErr, err := s.call(ctx, u, us, method, params, prepare)
+			if errors.Is(err, errSessionExpired) {
+				return nil, nil, err
+			}
+			if err != nil || rpcErr != nil {
+				// One failing upstream should not hide the others
+				logger.Warn("Failed to list %s from %s: %v", key, u.Name, firstError(err, rpcErr))
+				break
+			}
+
+			var listed map[string]json.RawMessage
+			if err := json.Unmarshal(result, &listed); err != nil {
+				logger.Warn("Invalid %s result from %s: %v", method, u.Name, err)
+				break
+			}
+			var entries []map[string]json.RawMessage
+			json.Unmarshal(listed[key], &entries)
+			for _, entry := range entries {
+				var name string
+				if json.Unmarshal(entry["name"], &name) == nil && name != "" {
+					entry["name"], _ = json.Marshal(u.Prefix + s.separator + name)
+				}
+				var uri string
+				if key == "resources" && json.Unmarshal(entry["uri"], &uri) == nil {
+					sess.mu.Lock()
+					sess.resources[uri] = u.Name
+					sess.mu.Unlock()
+				}
+				items = append(items, entry)
+			}
+
+			cursor = ""
+			json.Unmarshal(listed["nextCursor"], &cursor)
+			if cursor == "" {
+				break
+			}
+		}
+	}
+
+	result, err := json.Marshal(map[string]interface{}{key: items})
+	return result, nil, err
+}
+
+// callByName routes tools/call and prompts/get to the upstream that owns the prefixed name
+func (s *Server) callByName(ctx context.Context, sess *session, msg *message, prepare PrepareFunc) (json.RawMessage, *rpcError, error) {
+	var params map[string]json.RawMessage
+	var name string
+	if json.Unmarshal(msg.Params, &params) != nil || json.Unmarshal(params["name"], &name) != nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Invalid params: name is required"}, nil
+	}
+	u, original := s.route(name)
+	if u == nil || sess.upstreams[u.Name] == nil {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Unknown name: " + name}, nil
+	}
+	params["name"], _ = json.Marshal(original)
+	return s.call(ctx, u, sess.upstreams[u.Name], msg.Method, params, prepare)
+}
+
+// readResource routes resources/read to the upstream that listed the URI, or
+// tries each upstream with resources for URIs from templates
+func (s *Server) readResource(ctx context.Context, sess *session, msg *message, prepare PrepareFunc) (json.RawMessage, *rpcError, error) {
+	var params struct {
+		URI string `json:"uri"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil || params.URI == "" {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Invalid params: uri is required"}, nil
+	}
+
+	sess.mu.Lock()
+	owner := sess.resources[params.URI]
+	sess.mu.Unlock()
+
+	var lastErr *rpcError
+	for _, u := range s.upstreams {
+		us := sess.upstreams[u.Name]
+		if us == nil || us.capabilities["resources"] == nil || (owner != "" && owner != u.Name) {
+			continue
+		}
+		result, rpcErr, err := s.call(ctx, u, us, msg.Method, msg.Params, prepare)
+		if err != nil {
+			return nil, nil, err
+		}
+		if rpcErr == nil {
+			return result, nil, nil
+		}
+		lastErr = rpcErr
+	}
+	if lastErr == nil {
+		lastErr = &rpcError{Code: codeInvalidParams, Message: "Resource not found: " + params.URI}
+	}
+	return nil, lastErr, nil
+}
+
+// Route returns the upstream that owns a prefixed name and the name that
+// upstream knows it by, or empty strings when no upstream owns it
+func (s *Server) Route(name string) (upstream, original string) {
+	u, original := s.route(name)
+	if u == nil {
+		return "", ""
+	}
+	return u.Name, original
+}
+
+// route finds the upstream whose prefix starts the name, preferring the
+// longest prefix, and returns the name without it
+func (s *Server) route(name string) (*Upstream, string) {
+	var best *Upstream
+	for _, u := range s.upstreams {
+		if strings.HasPrefix(name, u.Prefix+s.separator) && (best == nil || len(u.Prefix) > len(best.Prefix)) {
+			best = u
+		}
+	}
+	if best == nil {
+		return nil, ""
+	}
+	return best, strings.TrimPrefix(name, best.Prefix+s.separator)
+}
+
+// session returns the subject's live session
+func (s *Server) session(id, subject string) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess := s.sessions[id]
+	if sess == nil || sess.subject != subject || s.now().Sub(sess.lastUsed) > sessionTTL {
+		return nil
+	}
+	sess.lastUsed = s.now()
+	return sess
+}
+
+// addSession keeps a new session. Expired sessions are dropped first; a
+// subject at its limit loses its least recently used session, which is
+// returned so that its upstream sessions can be ended. When live sessions of
+// other subjects fill the limit, the new session is refused.
+func (s *Server) addSession(sess *session) (string, *session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	var oldestID string
+	subjectSessions := 0
+	for k, existing := range s.sessions {
+		if now.Sub(existing.lastUsed) > sessionTTL {
+			delete(s.sessions, k)
+			continue
+		}
+		if existing.subject == sess.subject {
+			subjectSessions++
+			if oldestID == "" || existing.lastUsed.Before(s.sessions[oldestID].lastUsed) {
+				oldestID = k
+			}
+		}
+	}
+
+	var evicted *session
+	if subjectSessions >= s.maxSessionsPerSubject {
+		evicted = s.sessions[oldestID]
+		delete(s.sessions, oldestID)
+	} else if len(s.sessions) >= s.maxSessions {
+		return "", nil, errTooManySessions
+	}
+	id := randomID()
+	sess.lastUsed = now
+	s.sessions[id] = sess
+	return id, evicted, nil
+}
+
+// handleDelete ends a session and the upstream sessions behind it
+func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request, subject string, prepare PrepareFunc) {
+	id := r.Header.Get(SessionHeader)
+	sess := s.session(id, subject)
+	if sess == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	s.endSession(r.Context(), sess, prepare)
+	w.WriteHeader(http.StatusOK)
+}
+
+// endSession ends the upstream sessions behind a session
+func (s *Server) endSession(ctx context.Context, sess *session, prepare PrepareFunc) {
+	for _, u := range s.upstreams {
+		if us := sess.upstreams[u.Name]; us != nil && us.id != "" {
+			s.terminate(ctx, u, us, prepare)
+		}
+	}
+}
+
+func firstError(err error, rpcErr *rpcError) error {
+	if err != nil {
+		return err
+	}
+	if rpcErr != nil {
+		return fmt.Errorf("%s (%d)", rpcErr.Message, rpcErr.Code)
+	}
+	return nil
+}
+
+func errorResponse(id json.RawMessage, code int, msg string) *message {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &message{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: msg}}
+}
+
+func writeMessage(w http.ResponseWriter, msg *message) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(msg); err != nil {
+		logger.Error("Failed to encode JSON-RPC response: %v", err)
+	}
+}
+
+func randomID() string {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,284 @@
+package aggregate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// fakeServer is a minimal streamable HTTP MCP server
+type fakeServer struct {
+	name         string
+	sse          bool
+	capabilities string
+
+	mu       sync.Mutex
+	sessions map[string]bool
+	calls    []string
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer client-token" {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	var msg message
+	json.NewDecoder(r.Body).Decode(&msg)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if msg.Method != "initialize" && !f.sessions[r.Header.Get(SessionHeader)] {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if msg.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+
+	var result string
+	switch msg.Method {
+	case "initialize":
+		id := f.name + "-session"
+		f.sessions[id] = true
+		w.Header().Set(SessionHeader, id)
+		result = fmt.Sprintf(`{"protocolVersion":"2025-03-26","capabilities":%s,"serverInfo":{"name":%q}}`, f.capabilities, f.name)
+	case "tools/list":
+		var params struct {
+			Cursor string `json:"cursor"`
+		}
+		json.Unmarshal(msg.Params, &params)
+		if params.Cursor == "" {
+			result = `{"tools":[{"name":"search","inputSchema":{"type":"object"}}],"nextCursor":"2"}`
+		} else {
+			result = `{"tools":[{"name":"fetch","inputSchema":{"type":"object"}}]}`
+		}
+	case "resources/list":
+		result = fmt.Sprintf(`{"resources":[{"uri":"%s://readme","name":"readme"}]}`, f.name)
+	case "resources/read":
+		result = fmt.Sprintf(`{"contents":[{"uri":"%s://readme","text":"from %s"}]}`, f.name, f.name)
+	case "tools/call":
+		f.calls = append(f.calls, string(msg.Params))
+		result = fmt.Sprintf(`{"content":[{"type":"text","text":"called %s"}]}`, f.name)
+	default:
+		result = `{}`
+	}
+
+	reply := fmt.Sprintf(`{"jsonrpc":"2.0","id":%s,"result":%s}`, msg.ID, result)
+	if f.sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\",\"params\":{}}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, reply)
+}
+
+func newTestAggregate(t *testing.T) (*Server, *fakeServer, *fakeServer) {
+	t.Helper()
+	github := &fakeServer{name: "github", capabilities: `{"tools":{"listChanged":true}}`, sessions: map[string]bool{}}
+	jira := &fakeServer{name: "jira", sse: true, capabilities: `{"tools":{},"resources":{}}`, sessions: map[string]bool{}}
+	githubServer := httptest.NewServer(github)
+	jiraServer := httptest.NewServer(jira)
+	t.Cleanup(githubServer.Close)
+	t.Cleanup(jiraServer.Close)
+
+	s, err := New([]Upstream{
+		{Name: "github", Prefix: "gh", URL: githubServer.URL + "/mcp"},
+		{Name: "jira", Prefix: "jira", URL: jiraServer.URL + "/mcp"},
+	}, config.AggregateConfig{Separator: "_"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return s, github, jira
+}
+
+func prepareToken(h http.Header) {
+	h.Set("Authorization", "Bearer client-token")
+}
+
+// rpc sends a request to the aggregate and decodes the response
+func rpc(t *testing.T, s *Server, subject, sessionID, method, params string) (*httptest.ResponseRecorder, *message) {
+	t.Helper()
+	body := fmt.Sprintf(`{"jsonrpc":"2.0","id":7,"method":%q,"params":%s}`, method, params)
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	if sessionID != "" {
+		req.Header.Set(SessionHeader, sessionID)
+	}
+	rec := httptest.NewRecorder()
+	s.Handle(rec, req, subject, prepareToken)
+
+	var reply message
+	if rec.Code == http.StatusOK {
+		if err := json.NewDecoder(rec.Body).Decode(&reply); err != nil {
+			t.Fatalf("Failed to decode %s response: %v", method, err)
+		}
+	}
+	return rec, &reply
+}
+
+func TestInitializeCombinesUpstreams(t *testing.T) {
+	s, _, _ := newTestAggregate(t)
+
+	rec, reply := rpc(t, s, "alice", "", "initialize", `{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test"}}`)
+	if rec.Code != http.StatusOK || reply.Error != nil {
+		t.Fatalf("Initialize failed: %d %+v", rec.Code, reply.Error)
+	}
+	if rec.Header().Get(SessionHeader) == "" {
+		t.Errorf("Expected a session ID")
+	}
+
+	var result struct {
+		ProtocolVersion string                     `json:"protocolVersion"`
+		Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	}
+	json.Unmarshal(reply.Result, &result)
+	if result.ProtocolVersion != "2025-03-26" {
+		t.Errorf("Expected the oldest upstream version, got %s", result.ProtocolVersion)
+	}
+	if result.Capabilities["tools"] == nil || result.Capabilities["resources"] == nil || result.Capabilities["prompts"] != nil {
+		t.Errorf("Unexpected capabilities: %v", result.Capabilities)
+	}
+}
+
+func TestListsAndRoutesCalls(t *testing.T) {
+	s, github, jira := newTestAggregate(t)
+	rec, _ := rpc(t, s, "alice", "", "initialize", `{"protocolVersion":"2025-03-26"}`)
+	sessionID := rec.Header().Get(SessionHeader)
+
+	_, reply := rpc(t, s, "alice", sessionID, "tools/list", `{}`)
+	var tools struct {
+		Tools []struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	json.Unmarshal(reply.Result, &tools)
+	var names []string
+	for _, tool := range tools.Tools {
+		names = append(names, tool.Name)
+	}
+	if got := strings.Join(names, ","); got != "gh_search,gh_fetch,jira_search,jira_fetch" {
+		t.Errorf("Unexpected merged tools: %s", got)
+	}
+
+	_, reply = rpc(t, s, "alice", sessionID, "tools/call", `{"name":"jira_search","arguments":{"q":"bug"}}`)
+	if reply.Error != nil || !strings.Contains(string(reply.Result), "called jira") {
+		t.Fatalf("Expected the call to reach jira, got %s %+v", reply.Result, reply.Error)
+	}
+	if len(github.calls) != 0 || len(jira.calls) != 1 || !strings.Contains(jira.calls[0], `"name":"search"`) {
+		t.Errorf("Expected one call with the original name, got github=%v jira=%v", github.calls, jira.calls)
+	}
+
+	_, reply = rpc(t, s, "alice", sessionID, "tools/call", `{"name":"slack_post"}`)
+	if reply.Error == nil || reply.Error.Code != codeInvalidParams {
+		t.Errorf("Expected an unknown tool to be rejected, got %+v", reply.Error)
+	}
+
+	_, reply = rpc(t, s, "alice", sessionID, "resources/list", `{}`)
+	if !strings.Contains(string(reply.Result), `"name":"jira_readme"`) {
+		t.Errorf("Expected the prefixed jira resource, got %s", reply.Result)
+	}
+	_, reply = rpc(t, s, "alice", sessionID, "resources/read", `{"uri":"jira://readme"}`)
+	if !strings.Contains(string(reply.Result), "from jira") {
+		t.Errorf("Expected the resource read to reach jira, got %s", reply.Result)
+	}
+}
+
+func TestSessionsAreBoundToSubject(t *testing.T) {
+	s, github, _ := newTestAggregate(t)
+	rec, _ := rpc(t, s, "alice", "", "initialize", `{"protocolVersion":"2025-03-26"}`)
+	sessionID := rec.Header().Get(SessionHeader)
+
+	if rec, _ := rpc(t, s, "bob", sessionID, "tools/list", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected another subject's session to be rejected, got %d", rec.Code)
+	}
+	if rec, _ := rpc(t, s, "alice", "", "tools/list", `{}`); rec.Code != http.StatusBadRequest {
+		t.Errorf("Expected a request without a session to be rejected, got %d", rec.Code)
+	}
+
+	// An upstream that lost its session ends the aggregate session
+	github.mu.Lock()
+	github.sessions = map[string]bool{}
+	github.mu.Unlock()
+	if rec, _ := rpc(t, s, "alice", sessionID, "tools/list", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the expired session to be reported, got %d", rec.Code)
+	}
+	if rec, _ := rpc(t, s, "alice", sessionID, "ping", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected the session to be removed, got %d", rec.Code)
+	}
+}
+
+func TestSessionLimits(t *testing.T) {
+	github := &fakeServer{name: "github", capabilities: `{"tools":{}}`, sessions: map[string]bool{}}
+	githubServer := httptest.NewServer(github)
+	t.Cleanup(githubServer.Close)
+	s, err := New([]Upstream{{Name: "github", Prefix: "gh", URL: githubServer.URL + "/mcp"}},
+		config.AggregateConfig{Separator: "_", MaxSessions: 2, MaxSessionsPerSubject: 1})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	initialize := func(subject string) (*httptest.ResponseRecorder, *message) {
+		return rpc(t, s, subject, "", "initialize", `{"protocolVersion":"2025-03-26"}`)
+	}
+
+	rec, _ := initialize("alice")
+	first := rec.Header().Get(SessionHeader)
+	rec, _ = initialize("alice")
+	second := rec.Header().Get(SessionHeader)
+	if rec, _ := rpc(t, s, "alice", first, "ping", `{}`); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected a new session to end the subject's oldest, got %d", rec.Code)
+	}
+	if rec, _ := rpc(t, s, "alice", second, "ping", `{}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected the newest session to be kept, got %d", rec.Code)
+	}
+
+	if rec, reply := initialize("bob"); rec.Header().Get(SessionHeader) == "" || reply.Error != nil {
+		t.Fatalf("Expected bob to get a session, got %+v", reply.Error)
+	}
+	rec, reply := initialize("carol")
+	if rec.Header().Get(SessionHeader) != "" || reply.Error == nil {
+		t.Errorf("Expected a session beyond the limit to be refused, got %s", rec.Header().Get(SessionHeader))
+	}
+	if rec, _ := rpc(t, s, "alice", second, "ping", `{}`); rec.Code != http.StatusOK {
+		t.Errorf("Expected other subjects' sessions to be kept, got %d", rec.Code)
+	}
+}
+
+func TestUpstreamTransport(t *testing.T) {
+	github := &fakeServer{name: "github", capabilities: `{"tools":{}}`, sessions: map[string]bool{}}
+	githubServer := httptest.NewServer(github)
+	t.Cleanup(githubServer.Close)
+
+	var methods []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		var msg message
+		body, _ := io.ReadAll(req.Body)
+		json.Unmarshal(body, &msg)
+		methods = append(methods, msg.Method)
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		return http.DefaultTransport.RoundTrip(req)
+	})
+	s, err := New([]Upstream{{Name: "github", Prefix: "gh", URL: githubServer.URL + "/mcp", Transport: transport}},
+		config.AggregateConfig{Separator: "_"})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	rec, _ := rpc(t, s, "alice", "", "initialize", `{"protocolVersion":"2025-03-26"}`)
+	rpc(t, s, "alice", rec.Header().Get(SessionHeader), "tools/call", `{"name":"gh_search"}`)
+	if got := strings.Join(methods, ","); got != "initialize,notifications/initialized,tools/call" {
+		t.Errorf("Expected upstream requests to go through the transport, got %s", got)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -0,0 +1,274 @@
+package aggregate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+var requestID int64
+
+// initializeResult is the part of an initialize result the aggregate combines
+type initializeResult struct {
+	ProtocolVersion string                     `json:"protocolVersion"`
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	Instructions    string                     `json:"instructions,omitempty"`
+}
+
+// handleInitialize initializes a session with every upstream and answers with
+// their combined capabilities. Upstreams that fail are left out of the session.
+func (s *Server) handleInitialize(ctx context.Context, w http.ResponseWriter, msg *message, subject string, prepare PrepareFunc) {
+	var params struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil || params.ProtocolVersion == "" {
+		writeMessage(w, errorResponse(msg.ID, codeInvalidParams, "Invalid params: protocolVersion is required"))
+		return
+	}
+
+	results := make([]*initializeResult, len(s.upstreams))
+	sessions := make([]*upstreamSession, len(s.upstreams))
+	var wg sync.WaitGroup
+	for i, u := range s.upstreams {
+		wg.Add(1)
+		go func(i int, u *Upstream) {
+			defer wg.Done()
+			us, result, err := s.initializeUpstream(ctx, u, msg.Params, prepare)
+			if err != nil {
+				logger.Warn("Failed to initialize aggregate upstream %s: %v", u.Name, err)
+				return
+			}
+			sessions[i], results[i] = us, result
+		}(i, u)
+	}
+	wg.Wait()
+
+	sess := &session{
+		subject:   subject,
+		upstreams: make(map[string]*upstreamSession),
+		resources: make(map[string]string),
+	}
+	capabilities := map[string]interface{}{}
+	var instructions []string
+	// The client's version is kept if every upstream accepted it, otherwise
+	// the oldest version an upstream answered with is used
+	version := params.ProtocolVersion
+	for i, u := range s.upstreams {
+		result := results[i]
+		if result == nil {
+			continue
+		}
+		sess.upstreams[u.Name] = sessions[i]
+		if result.ProtocolVersion < version {
+			version = result.ProtocolVersion
+		}
+		// Change notifications are not relayed, so listChanged is not advertised
+		for _, c := range []string{"tools", "resources", "prompts"} {
+			if result.Capabilities[c] != nil {
+				capabilities[c] = struct{}{}
+			}
+		}
+		if result.Instructions != "" {
+			instructions = append(instructions, fmt.Sprintf("Names starting with %s%s: %s", u.Prefix, s.separator, result.Instructions))
+		}
+	}
+	if len(sess.upstreams) == 0 {
+		writeMessage(w, errorResponse(msg.ID, codeInternalError, "No upstream MCP server is available"))
+		return
+	}
+
+	result := map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities":    capabilities,
+		"serverInfo": map[string]string{
+			"name":    "open-mcp-auth-proxy",
+			"title":   "Aggregated MCP server",
+			"version": "1.0.0",
+		},
+	}
+	if len(instructions) > 0 {
+		result["instructions"] = strings.Join(instructions, "\n\n")
+	}
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		writeMessage(w, errorResponse(msg.ID, codeInternalError, "Internal error"))
+		return
+	}
+
+	id, evicted, err := s.addSession(sess)
+	if err != nil {
+		logger.Warn("Refused aggregate session for %s: %v", subject, err)
+		s.endSession(ctx, sess, prepare)
+		writeMessage(w, errorResponse(msg.ID, codeInternalError, "Too many sessions"))
+		return
+	}
+	if evicted != nil {
+		logger.Info("Ending the oldest aggregate session of %s", subject)
+		s.endSession(ctx, evicted, prepare)
+	}
+
+	w.Header().Set(SessionHeader, id)
+	writeMessage(w, &message{JSONRPC: "2.0", ID: msg.ID, Result: encoded})
+}
+
+// initializeUpstream runs the initialization handshake with an upstream,
+// forwarding the client's initialize parameters
+func (s *Server) initializeUpstream(ctx context.Context, u *Upstream, params json.RawMessage, prepare PrepareFunc) (*upstreamSession, *initializeResult, error) {
+	reply, header, err := s.exchange(ctx, u, &upstreamSession{}, &message{JSONRPC: "2.0", ID: nextID(), Method: "initialize", Params: params}, prepare)
+	if err != nil {
+		return nil, nil, err
+	}
+	if reply.Error != nil {
+		return nil, nil, firstError(nil, reply.Error)
+	}
+	var result initializeResult
+	if err := json.Unmarshal(reply.Result, &result); err != nil {
+		return nil, nil, fmt.Errorf("invalid initialize result: %w", err)
+	}
+
+	us := &upstreamSession{
+		id:              header.Get(SessionHeader),
+		protocolVersion: result.ProtocolVersion,
+		capabilities:    result.Capabilities,
+	}
+	if _, _, err := s.exchange(ctx, u, us, &message{JSONRPC: "2.0", Method: "notifications/initialized"}, prepare); err != nil {
+		return nil, nil, err
+	}
+	return us, &result, nil
+}
+
+// call sends a request to an upstream and returns its result or error
+func (s *Server) call(ctx context.Context, u *Upstream, us *upstreamSession, method string, params interface{}, prepare PrepareFunc) (json.RawMessage, *rpcError, error) {
+	msg := &message{JSONRPC: "2.0", ID: nextID(), Method: method}
+	if params != nil {
+		encoded, err := json.Marshal(params)
+		if err != nil {
+			return nil, nil, err
+		}
+		msg.Params = encoded
+	}
+	reply, _, err := s.exchange(ctx, u, us, msg, prepare)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply.Result, reply.Error, nil
+}
+
+// exchange posts a message to an upstream and, for requests, reads the
+// response from a JSON body or an event stream
+func (s *Server) exchange(ctx context.Context, u *Upstream, us *upstreamSession, msg *message, prepare PrepareFunc) (*message, http.Header, error) {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	if prepare != nil {
+		prepare(req.Header)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json, text/event-stream")
+	if us.id != "" {
+		req.Header.Set(SessionHeader, us.id)
+	}
+	if us.protocolVersion != "" {
+		req.Header.Set(ProtocolVersionHeader, us.protocolVersion)
+	}
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound && us.id != "" {
+		return nil, nil, errSessionExpired
+	}
+	if msg.ID == nil {
+		if resp.StatusCode != http.StatusAccepted && resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+		}
+		return nil, resp.Header, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	reply, err := readReply(resp, msg.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return reply, resp.Header, nil
+}
+
+// readReply reads the response to the request with the given ID. Other
+// messages in an event stream, such as progress notifications, are skipped.
+func readReply(resp *http.Response, id json.RawMessage) (*message, error) {
+	body := io.LimitReader(resp.Body, maxMessageSize)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		var reply message
+		if err := json.NewDecoder(body).Decode(&reply); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return &reply, nil
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "data:") {
+			data.WriteString(strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+			continue
+		}
+		if line != "" || data.Len() == 0 {
+			continue
+		}
+
+		var reply message
+		err := json.Unmarshal([]byte(data.String()), &reply)
+		data.Reset()
+		if err == nil && reply.Method == "" && bytes.Equal(reply.ID, id) {
+			return &reply, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("event stream ended without a response")
+}
+
+// terminate ends an upstream session; failures are only logged
+func (s *Server) terminate(ctx context.Context, u *Upstream, us *upstreamSession, prepare PrepareFunc) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u.URL, nil)
+	if err != nil {
+		return
+	}
+	if prepare != nil {
+		prepare(req.Header)
+	}
+	req.Header.Set(SessionHeader, us.id)
+	resp, err := u.client.Do(req)
+	if err != nil {
+		logger.Warn("Failed to end session with aggregate upstream %s: %v", u.Name, err)
+		return
+	}
+	resp.Body.Close()
+}
+
+func nextID() json.RawMessage {
+	return json.RawMessage(strconv.FormatInt(atomic.AddInt64(&requestID, 1), 10))
+}
@@ -0,0 +1,110 @@
+package approval
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// Authenticator returns the subject of an approver's access token
+type Authenticator func(r *http.Request) (string, error)
+
+// decisionRequest is the optional body of the approve and reject calls
+type decisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Handler serves the approval API under path:
+//
+//	GET  {path}                 lists pending requests; ?status= selects others, ?status=all lists every request
+//	GET  {path}/{id}            returns a request
+//	POST {path}/{id}/approve    lets the call through
+//	POST {path}/{id}/reject     rejects it
+//
+// All calls require an approver's access token. Unless allowSelf is set,
+// approvers cannot decide their own calls.
+func (q *Queue) Handler(path string, authenticate Authenticator, allowSelf bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		approver, err := authenticate(r)
+		if err != nil || approver == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, path), "/")
+		parts := strings.Split(rest, "/")
+		if rest == "" {
+			parts = nil
+		}
+
+		switch {
+		case len(parts) == 0 && r.Method == http.MethodGet:
+			status := Status(r.URL.Query().Get("status"))
+			switch status {
+			case "":
+				status = Pending
+			case "all":
+				status = ""
+			}
+			writeJSON(w, http.StatusOK, q.List(status))
+		case len(parts) == 1 && r.Method == http.MethodGet:
+			req, ok := q.Get(parts[0])
+			if !ok {
+				http.Error(w, "Unknown approval request", http.StatusNotFound)
+				return
+			}
+			writeJSON(w, http.StatusOK, req)
+		case len(parts) == 2 && (parts[1] == "approve" || parts[1] == "reject"):
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			q.handleDecide(w, r, parts[0], parts[1] == "approve", approver, allowSelf)
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func (q *Queue) handleDecide(w http.ResponseWriter, r *http.Request, id string, approve bool, approver string, allowSelf bool) {
+	var body decisionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64<<10)).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	req, ok := q.Get(id)
+	if !ok {
+		http.Error(w, "Unknown approval request", http.StatusNotFound)
+		return
+	}
+	if !allowSelf && req.Subject != "" && req.Subject == approver {
+		http.Error(w, "Approvers cannot decide their own calls", http.StatusForbidden)
+		return
+	}
+
+	req, err := q.Decide(id, approve, approver, body.Reason)
+	switch {
+	case errors.Is(err, ErrNotFound):
+		http.Error(w, "Unknown approval request", http.StatusNotFound)
+	case errors.Is(err, ErrDecided):
+		writeJSON(w, http.StatusConflict, req)
+	default:
+		writeJSON(w, http.StatusOK, req)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode response: %v", err)
+	}
+}
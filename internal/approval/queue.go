@@ -0,0 +1,254 @@
+// Package approval holds calls to sensitive tools until a person approves or
+// rejects them. Pending calls are listed and decided through an HTTP API, and
+// an optional webhook is told about new and decided calls.
+package approval
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+)
+
+// Decided calls stay visible in the API for this long
+const retention = time.Hour
+
+// Status is where a call is in the approval process
+type Status string
+
+const (
+	Pending  Status = "pending"
+	Approved Status = "approved"
+	Rejected Status = "rejected"
+	Expired  Status = "expired"  // Nobody decided before the timeout
+	Canceled Status = "canceled" // The client gave up waiting
+)
+
+// Errors returned by Decide
+var (
+	ErrNotFound = errors.New("unknown approval request")
+	ErrDecided  = errors.New("approval request is no longer pending")
+)
+
+var approvalOutcomes = metrics.NewCounter(
+	"mcp_proxy_tool_approvals_total",
+	"Tool calls held for approval, by how they ended.",
+	"server", "tool", "status",
+)
+
+// Request is a call waiting for, or given, a decision
+type Request struct {
+	ID        string     `json:"id"`
+	Server    string     `json:"server"`
+	Method    string     `json:"method"`
+	Tool      string     `json:"tool,omitempty"`
+	Arguments any        `json:"arguments,omitempty"`
+	Subject   string     `json:"subject,omitempty"` // Who made the call
+	ClientID  string     `json:"client_id,omitempty"`
+	Status    Status     `json:"status"`
+	Created   time.Time  `json:"created"`
+	Expires   time.Time  `json:"expires"`
+	Approver  string     `json:"approver,omitempty"`
+	Reason    string     `json:"reason,omitempty"`
+	Decided   *time.Time `json:"decided,omitempty"`
+}
+
+// Ticket is the caller's handle on a submitted request. Done is closed when
+// the request is decided, expires or is canceled.
+type Ticket struct {
+	ID   string
+	Done <-chan struct{}
+	q    *Queue
+}
+
+// Request returns the current state of the request
+func (t *Ticket) Request() Request {
+	req, _ := t.q.Get(t.ID)
+	return req
+}
+
+// Cancel withdraws a request whose caller is gone
+func (t *Ticket) Cancel() {
+	t.q.finish(t.ID, Canceled, "", "")
+}
+
+type entry struct {
+	req   Request
+	done  chan struct{}
+	timer *time.Timer
+}
+
+// Queue holds the requests of all MCP servers
+type Queue struct {
+	timeout       time.Duration
+	webhook       string
+	webhookSecret []byte
+	now           func() time.Time
+
+	mu       sync.Mutex
+	requests map[string]*entry
+}
+
+// New creates a queue. Requests expire after the configured timeout.
+func New(cfg config.ApprovalConfig) *Queue {
+	return &Queue{
+		timeout:       time.Duration(cfg.TimeoutSeconds) * time.Second,
+		webhook:       cfg.WebhookURL,
+		webhookSecret: []byte(cfg.WebhookSecret),
+		now:           time.Now,
+		requests:      make(map[string]*entry),
+	}
+}
+
+// Submit adds a call to the queue
+func (q *Queue) Submit(req Request) *Ticket {
+	now := q.now()
+	req.ID = newID()
+	req.Status = Pending
+	req.Created = now
+	req.Expires = now.Add(q.timeout)
+	e := &entry{req: req, done: make(chan struct{})}
+
+	q.mu.Lock()
+	q.sweep(now)
+	q.requests[req.ID] = e
+	e.timer = time.AfterFunc(q.timeout, func() { q.finish(req.ID, Expired, "", "") })
+	q.mu.Unlock()
+
+	logger.Info("Call to %s of server %s by %s awaits approval (%s)", req.Tool, req.Server, req.Subject, req.ID)
+	q.notify("approval.requested", req)
+	return &Ticket{ID: req.ID, Done: e.done, q: q}
+}
+
+// Decide approves or rejects a pending request
+func (q *Queue) Decide(id string, approve bool, approver, reason string) (Request, error) {
+	status := Rejected
+	if approve {
+		status = Approved
+	}
+	return q.finish(id, status, approver, reason)
+}
+
+func (q *Queue) finish(id string, status Status, approver, reason string) (Request, error) {
+	q.mu.Lock()
+	e, ok := q.requests[id]
+	if !ok {
+		q.mu.Unlock()
+		return Request{}, ErrNotFound
+	}
+	if e.req.Status != Pending {
+		req := e.req
+		q.mu.Unlock()
+		return req, ErrDecided
+	}
+	now := q.now()
+	e.req.Status = status
+	e.req.Approver = approver
+	e.req.Reason = reason
+	e.req.Decided = &now
+	e.timer.Stop()
+	close(e.done)
+	req := e.req
+	q.mu.Unlock()
+
+	logger.Info("Approval request %s for %s of server %s: %s", id, req.Tool, req.Server, status)
+	approvalOutcomes.Inc(req.Server, req.Tool, string(status))
+	q.notify("approval.decided", req)
+	return req, nil
+}
+
+// Get returns a request
+func (q *Queue) Get(id string) (Request, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	e, ok := q.requests[id]
+	if !ok {
+		return Request{}, false
+	}
+	return e.req, true
+}
+
+// List returns the requests with the given status, or all of them, oldest first
+func (q *Queue) List(status Status) []Request {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.sweep(q.now())
+	requests := make([]Request, 0, len(q.requests))
+	for _, e := range q.requests {
+		if status == "" || e.req.Status == status {
+			requests = append(requests, e.req)
+		}
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].Created.Before(requests[j].Created) })
+	return requests
+}
+
+// sweep drops requests decided longer ago than the retention. It must be
+// called with the lock held.
+func (q *Queue) sweep(now time.Time) {
+	for id, e := range q.requests {
+		if e.req.Decided != nil && now.Sub(*e.req.Decided) > retention {
+			delete(q.requests, id)
+		}
+	}
+}
+
+// webhookEvent is the body posted to the webhook
+type webhookEvent struct {
+	Event    string  `json:"event"`
+	Approval Request `json:"approval"`
+}
+
+// notify posts an event to the webhook without holding up the caller
+func (q *Queue) notify(event string, req Request) {
+	if q.webhook == "" {
+		return
+	}
+	body, err := json.Marshal(webhookEvent{Event: event, Approval: req})
+	if err != nil {
+		logger.Error("Failed to encode approval webhook event: %v", err)
+		return
+	}
+	go func() {
+		httpReq, err := http.NewRequest(http.MethodPost, q.webhook, bytes.NewReader(body))
+		if err != nil {
+			logger.Error("Invalid approval webhook URL: %v", err)
+			return
+		}
+		httpReq.Header.Set("Content-Type", "application/json")
+		if len(q.webhookSecret) > 0 {
+			mac := hmac.New(sha256.New, q.webhookSecret)
+			mac.Write(body)
+			httpReq.Header.Set("X-Approval-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+		resp, err := httpclient.Client(httpclient.DestinationWebhook).Do(httpReq)
+		if err != nil {
+			logger.Warn("Failed to notify the approval webhook of %s: %v", req.ID, err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusMultipleChoices {
+			logger.Warn("Approval webhook answered %s for %s with status %d", event, req.ID, resp.StatusCode)
+		}
+	}()
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,104 @@
+package approval
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func TestQueueDecisions(t *testing.T) {
+	q := New(config.ApprovalConfig{TimeoutSeconds: 60})
+
+	approved := q.Submit(Request{Server: "github", Tool: "delete_repo", Subject: "alice"})
+	rejected := q.Submit(Request{Server: "github", Tool: "delete_repo", Subject: "alice"})
+	if pending := q.List(Pending); len(pending) != 2 || pending[0].ID != approved.ID {
+		t.Fatalf("Expected two pending requests, oldest first, got %+v", pending)
+	}
+
+	if _, err := q.Decide(approved.ID, true, "bob", ""); err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	if _, err := q.Decide(rejected.ID, false, "bob", "not today"); err != nil {
+		t.Fatalf("Decide failed: %v", err)
+	}
+	for _, ticket := range []*Ticket{approved, rejected} {
+		select {
+		case <-ticket.Done:
+		default:
+			t.Errorf("Expected request %s to be done", ticket.ID)
+		}
+	}
+	if req := rejected.Request(); req.Status != Rejected || req.Approver != "bob" || req.Reason != "not today" {
+		t.Errorf("Unexpected rejected request %+v", req)
+	}
+	if req, err := q.Decide(approved.ID, false, "carol", ""); err != ErrDecided || req.Status != Approved {
+		t.Errorf("Expected a decided request to stay approved, got %s: %v", req.Status, err)
+	}
+	if _, err := q.Decide("missing", true, "bob", ""); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+	if all := q.List(""); len(all) != 2 || len(q.List(Pending)) != 0 {
+		t.Errorf("Expected decided requests to be listed until they are swept, got %+v", all)
+	}
+
+	canceled := q.Submit(Request{Tool: "send_email"})
+	canceled.Cancel()
+	if req := canceled.Request(); req.Status != Canceled {
+		t.Errorf("Expected a canceled request, got %s", req.Status)
+	}
+
+	// Decided requests are dropped after the retention
+	q.now = func() time.Time { return time.Now().Add(retention + time.Minute) }
+	if all := q.List(""); len(all) != 0 {
+		t.Errorf("Expected old requests to be swept, got %+v", all)
+	}
+}
+
+func TestQueueExpiresUndecidedRequests(t *testing.T) {
+	q := New(config.ApprovalConfig{})
+	q.timeout = 20 * time.Millisecond
+	ticket := q.Submit(Request{Tool: "delete_repo"})
+	select {
+	case <-ticket.Done:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the request to expire")
+	}
+	if req := ticket.Request(); req.Status != Expired {
+		t.Errorf("Expected an expired request, got %s", req.Status)
+	}
+}
+
+func TestQueueNotifiesWebhook(t *testing.T) {
+	events := make(chan webhookEvent, 2)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if r.Header.Get("X-Approval-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("Invalid webhook signature %q", r.Header.Get("X-Approval-Signature"))
+		}
+		var event webhookEvent
+		json.Unmarshal(body, &event)
+		events <- event
+	}))
+	defer webhook.Close()
+
+	q := New(config.ApprovalConfig{TimeoutSeconds: 60, WebhookURL: webhook.URL, WebhookSecret: "s3cret"})
+	ticket := q.Submit(Request{Tool: "send_email", Arguments: map[string]any{"to": "team@example.com"}})
+	requested := <-events
+	if requested.Event != "approval.requested" || requested.Approval.ID != ticket.ID || requested.Approval.Arguments == nil {
+		t.Errorf("Unexpected event %+v", requested)
+	}
+	q.Decide(ticket.ID, true, "bob", "")
+	if decided := <-events; decided.Event != "approval.decided" || decided.Approval.Status != Approved {
+		t.Errorf("Unexpected event %+v", decided)
+	}
+}
@@ -12,11 +12,17 @@ type Decision int
 const (
 	DecisionAllow Decision = iota
 	DecisionDeny
+	// The request is allowed once a person approves it
+	DecisionRequireApproval
 )
 
 type AccessControlResult struct {
 	Decision Decision
 	Message  string
+
+	// Structured details about a denial, surfaced to clients in JSON-RPC errors
+	RequiredScopes []string
+	Rule           string
 }
 
 type AccessControl interface {
@@ -2,7 +2,7 @@ package authz
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -13,16 +13,47 @@ import (
 	"time"
 
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
 	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
 )
 
 type asgardeoProvider struct {
-	cfg *config.Config
+	cfg  *config.Config
+	apps *AsgardeoApps
 }
 
-// NewAsgardeoProvider initializes a Provider for Asgardeo.
-func NewAsgardeoProvider(cfg *config.Config) Provider {
-	return &asgardeoProvider{cfg: cfg}
+// NewAsgardeoProvider initializes a Provider for Asgardeo. Applications created
+// by /register are tracked so they can be cleaned up.
+func NewAsgardeoProvider(ctx context.Context, cfg *config.Config) (Provider, error) {
+	orgName, appsCfg := cfg.Demo.OrgName, cfg.Demo.Apps
+	if cfg.Mode == "asgardeo" {
+		orgName, appsCfg = cfg.Asgardeo.OrgName, cfg.Asgardeo.Apps
+	}
+
+	p := &asgardeoProvider{cfg: cfg}
+	apps, err := newAsgardeoApps(appsCfg, orgName, p.getAsgardeoAdminToken)
+	if err != nil {
+		return nil, err
+	}
+	p.apps = apps
+	apps.StartJanitor(ctx, time.Duration(appsCfg.JanitorIntervalMinutes)*time.Minute)
+	return p, nil
+}
+
+// Apps returns the registry of applications created by /register
+func (p *asgardeoProvider) Apps() *AsgardeoApps {
+	return p.apps
+}
+
+// ResolveClient records the use of a client issued by /register. Client IDs
+// are not translated, as Asgardeo knows them directly.
+func (p *asgardeoProvider) ResolveClient(clientID string) (*ResolvedClient, error) {
+	app, err := p.apps.FindByClientID(clientID)
+	if err != nil || app == nil {
+		return nil, err
+	}
+	p.apps.Touch(app)
+	return &ResolvedClient{ClientID: app.ClientID, RedirectURIs: app.RedirectURIs}, nil
 }
 
 func (p *asgardeoProvider) WellKnownHandler() http.HandlerFunc {
@@ -55,6 +86,9 @@ func (p *asgardeoProvider) WellKnownHandler() http.HandlerFunc {
 			"registration_endpoint":                 p.cfg.BaseURL + "/register",
 			"code_challenge_methods_supported":      []string{"plain", "S256"},
 		}
+		if p.cfg.ClientMetadata.Enabled {
+			response["client_id_metadata_document_supported"] = true
+		}
 
 		w.Header().Set("Content-Type", "application/json")
 		w.Header().Set("X-Accel-Buffering", "no")
@@ -92,25 +126,27 @@ func (p *asgardeoProvider) RegisterHandler() http.HandlerFunc {
 			http.Error(w, "redirect_uris is required", http.StatusBadRequest)
 			return
 		}
+		for _, uri := range regReq.RedirectURIs {
+			if !validRedirectURI(uri) {
+				http.Error(w, "invalid redirect URI: "+uri, http.StatusBadRequest)
+				return
+			}
+		}
 
-		// Generate credentials
-		regReq.ClientID = "client-" + randomString(8)
-		regReq.ClientSecret = randomString(16)
-
-		if err := p.createAsgardeoApplication(regReq); err != nil {
+		app, err := p.registerApplication(regReq)
+		if err != nil {
 			logger.Warn("Asgardeo application creation failed: %v", err)
 			http.Error(w, "Failed to create application in Asgardeo", http.StatusInternalServerError)
-			// Optionally http.Error(...) if you want to fail
-			// or continue to return partial data.
+			return
 		}
 
 		resp := RegisterResponse{
-			ClientID:      regReq.ClientID,
-			ClientSecret:  regReq.ClientSecret,
+			ClientID:      app.ClientID,
+			ClientSecret:  app.ClientSecret,
 			ClientName:    regReq.ClientName,
-			RedirectURIs:  regReq.RedirectURIs,
-			GrantTypes:    regReq.GrantTypes,
-			ResponseTypes: regReq.ResponseTypes,
+			RedirectURIs:  app.RedirectURIs,
+			GrantTypes:    app.GrantTypes,
+			ResponseTypes: app.ResponseTypes,
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -145,46 +181,75 @@ type RegisterResponse struct {
 	ResponseTypes []string `json:"response_types"`
 }
 
-func (p *asgardeoProvider) createAsgardeoApplication(regReq RegisterRequest) error {
+// registerApplication creates and records a new application. Registrations are
+// never reused, as that would hand an existing client secret to any caller that
+// repeats the client name and redirect URIs.
+func (p *asgardeoProvider) registerApplication(regReq RegisterRequest) (*AsgardeoApp, error) {
+	p.apps.registerMu.Lock()
+	defer p.apps.registerMu.Unlock()
 
-	orgName := p.cfg.Demo.OrgName
-	if p.cfg.Mode == "asgardeo" {
-		orgName = p.cfg.Asgardeo.OrgName
+	// Generate credentials
+	regReq.ClientID = "client-" + randomString(8)
+	regReq.ClientSecret = randomString(16)
+
+	payload := buildAsgardeoPayload(regReq)
+	appID, err := p.createAsgardeoApplication(payload)
+	if err != nil {
+		return nil, err
 	}
 
-	body := buildAsgardeoPayload(regReq)
+	now := time.Now()
+	app := &AsgardeoApp{
+		Key:           regReq.ClientID,
+		AppID:         appID,
+		Name:          payload["name"].(string),
+		ClientID:      regReq.ClientID,
+		ClientSecret:  regReq.ClientSecret,
+		RedirectURIs:  regReq.RedirectURIs,
+		GrantTypes:    regReq.GrantTypes,
+		ResponseTypes: regReq.ResponseTypes,
+		CreatedAt:     now,
+		LastUsed:      now,
+	}
+	if err := p.apps.Save(app); err != nil {
+		// The application works, but the janitor will not know to clean it up
+		logger.Warn("Failed to record Asgardeo application %s: %v", app.ClientID, err)
+	}
+	return app, nil
+}
+
+// createAsgardeoApplication creates the application and returns its ID
+func (p *asgardeoProvider) createAsgardeoApplication(body map[string]interface{}) (string, error) {
 	reqBytes, err := json.Marshal(body)
 	if err != nil {
-		return fmt.Errorf("failed to marshal Asgardeo request: %w", err)
+		return "", fmt.Errorf("failed to marshal Asgardeo request: %w", err)
 	}
 
-	asgardeoAppURL := "https://api.asgardeo.io/t/" + orgName + "/api/server/v1/applications"
-	req, err := http.NewRequest("POST", asgardeoAppURL, bytes.NewBuffer(reqBytes))
+	req, err := http.NewRequest("POST", p.apps.apiBaseURL+"/applications", bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return fmt.Errorf("failed to create Asgardeo API request: %w", err)
+		return "", fmt.Errorf("failed to create Asgardeo API request: %w", err)
 	}
 
 	token, err := p.getAsgardeoAdminToken()
 	if err != nil {
-		return fmt.Errorf("failed to get Asgardeo admin token: %w", err)
+		return "", fmt.Errorf("failed to get Asgardeo admin token: %w", err)
 	}
 	req.Header.Set("Authorization", "Bearer "+token)
 	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	resp, err := p.apps.client.Do(req)
 	if err != nil {
-		return fmt.Errorf("asgardeo API call failed: %w", err)
+		return "", fmt.Errorf("asgardeo API call failed: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
 		respBody, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("asgardeo creation error (%d): %s", resp.StatusCode, string(respBody))
+		return "", fmt.Errorf("asgardeo creation error (%d): %s", resp.StatusCode, string(respBody))
 	}
 
-	logger.Info("Created Asgardeo application for clientID=%s", regReq.ClientID)
-	return nil
+	logger.Info("Created Asgardeo application %s", body["name"])
+	return appIDFromLocation(resp.Header.Get("Location")), nil
 }
 
 func (p *asgardeoProvider) getAsgardeoAdminToken() (string, error) {
@@ -213,15 +278,7 @@ func (p *asgardeoProvider) getAsgardeoAdminToken() (string, error) {
 
 	logger.Debug("Requesting admin token for Asgardeo with client ID: %s", clientId)
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-	}
-	client := &http.Client{
-		Timeout:   time.Duration(p.cfg.TimeoutSeconds) * time.Second,
-		Transport: tr,
-	}
-
-	resp, err := client.Do(req)
+	resp, err := httpclient.Client(httpclient.DestinationIdP).Do(req)
 	if err != nil {
 		return "", fmt.Errorf("token request failed: %w", err)
 	}
@@ -354,41 +411,7 @@ func (p *asgardeoProvider) ProtectedResourceMetadataHandler() http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		// Extract only the values into a []string
-		var supportedScopes []string
-		var extractStrings func(interface{})
-		extractStrings = func(val interface{}) {
-			switch v := val.(type) {
-			case string:
-				supportedScopes = append(supportedScopes, v)
-			case []any:
-				for _, item := range v {
-					extractStrings(item)
-				}
-			case map[string]any:
-				for _, item := range v {
-					extractStrings(item)
-				}
-			}
-		}
-		for _, m := range p.cfg.ProtectedResourceMetadata.ScopesSupported {
-			for _, v := range m {
-				extractStrings(v)
-			}
-		}
-
-		meta := map[string]interface{}{
-			"resource":              p.cfg.ProtectedResourceMetadata.ResourceIdentifier,
-			"scopes_supported":      supportedScopes,
-			"authorization_servers": p.cfg.ProtectedResourceMetadata.AuthorizationServers,
-		}
-
-		if p.cfg.ProtectedResourceMetadata.JwksURI != "" {
-			meta["jwks_uri"] = p.cfg.ProtectedResourceMetadata.JwksURI
-		}
-		if len(p.cfg.ProtectedResourceMetadata.BearerMethodsSupported) > 0 {
-			meta["bearer_methods_supported"] = p.cfg.ProtectedResourceMetadata.BearerMethodsSupported
-		}
+		meta := buildProtectedResourceMetadata(p.cfg)
 		if err := json.NewEncoder(w).Encode(meta); err != nil {
 			http.Error(w, "failed to encode metadata", http.StatusInternalServerError)
 		}
@@ -0,0 +1,293 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+const (
+	asgardeoAppPrefix    = "asgardeo-app:"
+	asgardeoClientPrefix = "asgardeo-client:"
+
+	defaultAsgardeoAppTTL     = 7 * 24 * time.Hour
+	defaultAsgardeoJanitorRun = time.Hour
+	// last_used is only rewritten when older than this, to limit store writes
+	asgardeoTouchInterval = time.Minute
+)
+
+// AsgardeoApp is an Asgardeo application created through /register
+type AsgardeoApp struct {
+	Key           string    `json:"key"`
+	AppID         string    `json:"app_id,omitempty"`
+	Name          string    `json:"name"`
+	ClientID      string    `json:"client_id"`
+	ClientSecret  string    `json:"-"` // Only returned by the /register call that created it
+	RedirectURIs  []string  `json:"redirect_uris"`
+	GrantTypes    []string  `json:"grant_types,omitempty"`
+	ResponseTypes []string  `json:"response_types,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsed      time.Time `json:"last_used"`
+}
+
+// AsgardeoApps tracks the applications the proxy created in Asgardeo so that
+// stale applications can be deleted
+type AsgardeoApps struct {
+	store      store.Store
+	ttl        time.Duration
+	apiBaseURL string
+	client     *http.Client
+	token      func() (string, error)
+
+	// Serializes registrations and purges
+	registerMu sync.Mutex
+}
+
+func newAsgardeoApps(appsCfg config.AsgardeoAppsConfig, orgName string, token func() (string, error)) (*AsgardeoApps, error) {
+	s, err := store.New(appsCfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open Asgardeo application store: %w", err)
+	}
+
+	ttl := defaultAsgardeoAppTTL
+	if appsCfg.TTLHours > 0 {
+		ttl = time.Duration(appsCfg.TTLHours) * time.Hour
+	}
+	return &AsgardeoApps{
+		store:      s,
+		ttl:        ttl,
+		apiBaseURL: "https://api.asgardeo.io/t/" + orgName + "/api/server/v1",
+		client:     httpclient.Client(httpclient.DestinationIdP),
+		token:      token,
+	}, nil
+}
+
+// reload picks up changes made by the apps admin command, such as a purge,
+// so that the proxy does not write back applications that were deleted
+func (a *AsgardeoApps) reload() {
+	if r, ok := a.store.(interface{ Reload() error }); ok {
+		if err := r.Reload(); err != nil {
+			logger.Warn("Failed to reload the Asgardeo application store: %v", err)
+		}
+	}
+}
+
+// Find returns the application created for a registration, if any
+func (a *AsgardeoApps) Find(key string) (*AsgardeoApp, error) {
+	var app AsgardeoApp
+	found, err := a.store.Get(asgardeoAppPrefix+key, &app)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &app, nil
+}
+
+// FindByClientID returns the application that was issued the client ID, if any
+func (a *AsgardeoApps) FindByClientID(clientID string) (*AsgardeoApp, error) {
+	a.reload()
+	var key string
+	found, err := a.store.Get(asgardeoClientPrefix+clientID, &key)
+	if err != nil || !found {
+		return nil, err
+	}
+	return a.Find(key)
+}
+
+// Save records an application. Entries never expire in the store; the janitor
+// removes them once the application has been deleted in Asgardeo.
+func (a *AsgardeoApps) Save(app *AsgardeoApp) error {
+	a.reload()
+	if err := a.store.Put(asgardeoAppPrefix+app.Key, app, 0); err != nil {
+		return err
+	}
+	return a.store.Put(asgardeoClientPrefix+app.ClientID, app.Key, 0)
+}
+
+// Touch records that the application is in use
+func (a *AsgardeoApps) Touch(app *AsgardeoApp) {
+	now := time.Now()
+	if now.Sub(app.LastUsed) < asgardeoTouchInterval {
+		return
+	}
+	app.LastUsed = now
+	if err := a.Save(app); err != nil {
+		logger.Warn("Failed to update last use of Asgardeo application %s: %v", app.ClientID, err)
+	}
+}
+
+// List returns all tracked applications, least recently used first
+func (a *AsgardeoApps) List() ([]*AsgardeoApp, error) {
+	a.reload()
+	keys, err := a.store.Keys(asgardeoAppPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]*AsgardeoApp, 0, len(keys))
+	for _, k := range keys {
+		app, err := a.Find(strings.TrimPrefix(k, asgardeoAppPrefix))
+		if err != nil {
+			return nil, err
+		}
+		if app != nil {
+			apps = append(apps, app)
+		}
+	}
+	sort.Slice(apps, func(i, j int) bool { return apps[i].LastUsed.Before(apps[j].LastUsed) })
+	return apps, nil
+}
+
+// Stale reports whether the application has not been used within the TTL
+func (a *AsgardeoApps) Stale(app *AsgardeoApp) bool {
+	return time.Since(app.LastUsed) > a.ttl
+}
+
+// Purge deletes stale applications, or all tracked applications when all is
+// set, from Asgardeo and from the store. It returns the number deleted.
+func (a *AsgardeoApps) Purge(all bool) (int, error) {
+	a.registerMu.Lock()
+	defer a.registerMu.Unlock()
+
+	apps, err := a.List()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, app := range apps {
+		if !all && !a.Stale(app) {
+			continue
+		}
+		if err := a.Delete(app); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// Delete removes the application from Asgardeo, then stops tracking it
+func (a *AsgardeoApps) Delete(app *AsgardeoApp) error {
+	token, err := a.token()
+	if err != nil {
+		return fmt.Errorf("failed to get Asgardeo admin token: %w", err)
+	}
+
+	appID := app.AppID
+	if appID == "" {
+		if appID, err = a.lookupAppID(token, app.ClientID); err != nil {
+			return err
+		}
+	}
+
+	if appID != "" {
+		req, err := http.NewRequest(http.MethodDelete, a.apiBaseURL+"/applications/"+url.PathEscape(appID), nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("asgardeo API call failed: %w", err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		// An application that is already gone only needs to be forgotten
+		if resp.StatusCode >= 400 && resp.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("asgardeo deletion error (%d): %s", resp.StatusCode, string(body))
+		}
+	}
+
+	a.reload()
+	if err := a.store.Delete(asgardeoAppPrefix + app.Key); err != nil {
+		return err
+	}
+	if err := a.store.Delete(asgardeoClientPrefix + app.ClientID); err != nil {
+		return err
+	}
+	logger.Info("Deleted Asgardeo application %s (clientID=%s)", app.Name, app.ClientID)
+	return nil
+}
+
+// lookupAppID finds the application ID for a client ID. It returns an empty ID
+// when no such application exists.
+func (a *AsgardeoApps) lookupAppID(token, clientID string) (string, error) {
+	query := url.Values{"filter": {"clientId eq " + clientID}}
+	req, err := http.NewRequest(http.MethodGet, a.apiBaseURL+"/applications?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("asgardeo API call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("asgardeo lookup error (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var list struct {
+		Applications []struct {
+			ID string `json:"id"`
+		} `json:"applications"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return "", fmt.Errorf("failed to parse application list: %w", err)
+	}
+	if len(list.Applications) == 0 {
+		return "", nil
+	}
+	return list.Applications[0].ID, nil
+}
+
+// StartJanitor periodically deletes applications that have gone stale, until ctx is done
+func (a *AsgardeoApps) StartJanitor(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultAsgardeoJanitorRun
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			deleted, err := a.Purge(false)
+			if err != nil {
+				logger.Warn("Asgardeo application cleanup failed: %v", err)
+			}
+			if deleted > 0 {
+				logger.Info("Cleaned up %d stale Asgardeo application(s)", deleted)
+			}
+		}
+	}()
+}
+
+// appIDFromLocation extracts the application ID from the Location header of a create response
+func appIDFromLocation(location string) string {
+	location = strings.TrimSuffix(location, "/")
+	if i := strings.LastIndex(location, "/"); i >= 0 {
+		return location[i+1:]
+	}
+	return location
+}
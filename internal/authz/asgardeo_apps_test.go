@@ -0,0 +1,159 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+// stubAsgardeo serves the admin token endpoint and the application management API
+type stubAsgardeo struct {
+	mu      sync.Mutex
+	created int
+	deleted []string
+}
+
+func (s *stubAsgardeo) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "admin-token", "token_type": "Bearer"})
+	})
+	mux.HandleFunc("/applications", func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.created++
+		id := "app-" + string(rune('0'+s.created))
+		s.mu.Unlock()
+		w.Header().Set("Location", "https://api.asgardeo.io/t/org/api/server/v1/applications/"+id)
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("/applications/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete || r.Header.Get("Authorization") != "Bearer admin-token" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.mu.Lock()
+		s.deleted = append(s.deleted, strings.TrimPrefix(r.URL.Path, "/applications/"))
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func newTestAsgardeoProvider(t *testing.T) (*asgardeoProvider, *stubAsgardeo) {
+	t.Helper()
+	stub := &stubAsgardeo{}
+	server := httptest.NewServer(stub.handler())
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{Mode: "asgardeo", AuthServerBaseURL: server.URL}
+	provider, err := NewAsgardeoProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewAsgardeoProvider failed: %v", err)
+	}
+	p := provider.(*asgardeoProvider)
+	p.apps.apiBaseURL = server.URL
+	return p, stub
+}
+
+func registerAsgardeoClient(t *testing.T, p *asgardeoProvider, body string) RegisterResponse {
+	t.Helper()
+	w := httptest.NewRecorder()
+	p.RegisterHandler()(w, httptest.NewRequest("POST", "/register", strings.NewReader(body)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %v: %s", w.Code, w.Body.String())
+	}
+	var resp RegisterResponse
+	json.NewDecoder(w.Body).Decode(&resp)
+	return resp
+}
+
+func TestAsgardeoRegistrationIssuesNewClients(t *testing.T) {
+	p, stub := newTestAsgardeoProvider(t)
+
+	first := registerAsgardeoClient(t, p, `{"client_name":"inspector","redirect_uris":["http://localhost/a","http://localhost/b"]}`)
+	second := registerAsgardeoClient(t, p, `{"client_name":"inspector","redirect_uris":["http://localhost/b","http://localhost/a"]}`)
+	if first.ClientID == second.ClientID || first.ClientSecret == second.ClientSecret {
+		t.Errorf("Expected a new client for a repeated registration, got %s twice", first.ClientID)
+	}
+	if stub.created != 2 {
+		t.Errorf("Expected 2 applications to be created, got %d", stub.created)
+	}
+
+	app, _ := p.apps.FindByClientID(first.ClientID)
+	if app == nil || app.AppID != "app-1" {
+		t.Fatalf("Expected application app-1 to be tracked, got %+v", app)
+	}
+	if app.ClientSecret != "" {
+		t.Errorf("Expected the client secret not to be stored")
+	}
+}
+
+func TestAsgardeoAppsReloadsExternalPurge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "apps.json")
+	appsCfg := config.AsgardeoAppsConfig{Store: config.StoreConfig{Type: store.TypeFile, Path: path}}
+	proxyApps, err := newAsgardeoApps(appsCfg, "org", nil)
+	if err != nil {
+		t.Fatalf("newAsgardeoApps failed: %v", err)
+	}
+	proxyApps.Save(&AsgardeoApp{Key: "client-a", ClientID: "client-a"})
+	proxyApps.Save(&AsgardeoApp{Key: "client-b", ClientID: "client-b"})
+
+	// The admin command forgets an application in its own process
+	adminApps, err := newAsgardeoApps(appsCfg, "org", nil)
+	if err != nil {
+		t.Fatalf("newAsgardeoApps failed: %v", err)
+	}
+	adminApps.store.Delete(asgardeoAppPrefix + "client-a")
+	adminApps.store.Delete(asgardeoClientPrefix + "client-a")
+
+	// The proxy's next write must not bring it back
+	app, _ := proxyApps.FindByClientID("client-b")
+	proxyApps.Touch(app)
+	if found, _ := proxyApps.FindByClientID("client-a"); found != nil {
+		t.Errorf("Expected the purged application to stay forgotten")
+	}
+	reopened, _ := newAsgardeoApps(appsCfg, "org", nil)
+	if found, _ := reopened.FindByClientID("client-a"); found != nil {
+		t.Errorf("Expected the purged application not to be written back")
+	}
+}
+
+func TestAsgardeoAppsPurge(t *testing.T) {
+	p, stub := newTestAsgardeoProvider(t)
+
+	stale := registerAsgardeoClient(t, p, `{"client_name":"old","redirect_uris":["http://localhost/cb"]}`)
+	fresh := registerAsgardeoClient(t, p, `{"client_name":"new","redirect_uris":["http://localhost/cb"]}`)
+
+	app, _ := p.apps.FindByClientID(stale.ClientID)
+	app.LastUsed = time.Now().Add(-defaultAsgardeoAppTTL - time.Hour)
+	p.apps.Save(app)
+
+	// Using a client through /authorize or /token keeps it alive
+	if client, err := p.ResolveClient(fresh.ClientID); err != nil || client == nil {
+		t.Fatalf("Expected registered client to resolve, got %v", err)
+	}
+
+	deleted, err := p.apps.Purge(false)
+	if err != nil || deleted != 1 {
+		t.Fatalf("Expected 1 stale application to be purged, got %d (%v)", deleted, err)
+	}
+	if len(stub.deleted) != 1 || stub.deleted[0] != app.AppID {
+		t.Errorf("Expected %s to be deleted in Asgardeo, got %v", app.AppID, stub.deleted)
+	}
+	if found, _ := p.apps.FindByClientID(stale.ClientID); found != nil {
+		t.Errorf("Expected purged application to be forgotten")
+	}
+
+	if deleted, _ := p.apps.Purge(true); deleted != 1 {
+		t.Errorf("Expected purge with all to delete the remaining application, got %d", deleted)
+	}
+}
@@ -0,0 +1,106 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+type auth0Provider struct {
+	*oidcProvider
+	auth0 config.Auth0Config
+}
+
+// NewAuth0Provider initializes a Provider for an Auth0 tenant. The configured API
+// audience is added to authorization and token requests so that Auth0 issues JWT
+// access tokens, and /register is proxied to Auth0's dynamic client registration.
+func NewAuth0Provider(ctx context.Context, cfg *config.Config) (Provider, error) {
+	a0 := cfg.Auth0
+	if a0.Domain == "" {
+		return nil, fmt.Errorf("auth0.domain is required")
+	}
+
+	// Auth0 issuers carry a trailing slash
+	issuer := strings.TrimSuffix(a0.Domain, "/") + "/"
+	if !strings.Contains(issuer, "://") {
+		issuer = "https://" + issuer
+	}
+
+	base, err := newOIDCProvider(cfg, config.OIDCConfig{
+		Issuer:                 issuer,
+		RefreshIntervalSeconds: a0.RefreshIntervalSeconds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	audience := a0.Audience
+	if audience == "" {
+		audience = cfg.ProtectedResourceMetadata.Audience
+	}
+	if audience != "" {
+		injectAudience(cfg, audience)
+	}
+
+	p := &auth0Provider{oidcProvider: base, auth0: a0}
+	p.startRefresh(ctx, a0.RefreshIntervalSeconds)
+	return p, nil
+}
+
+// injectAudience configures the request modifiers to add the audience parameter,
+// unless the configuration already sets one explicitly.
+func injectAudience(cfg *config.Config, audience string) {
+	if cfg.Default.Path == nil {
+		cfg.Default.Path = make(map[string]config.PathConfig)
+	}
+
+	authorize := cfg.Default.Path["/authorize"]
+	authorize.AddQueryParams = addParamIfMissing(authorize.AddQueryParams, "audience", audience)
+	cfg.Default.Path["/authorize"] = authorize
+
+	token := cfg.Default.Path["/token"]
+	token.AddBodyParams = addParamIfMissing(token.AddBodyParams, "audience", audience)
+	cfg.Default.Path["/token"] = token
+}
+
+func addParamIfMissing(params []config.ParamConfig, name, value string) []config.ParamConfig {
+	for _, p := range params {
+		if p.Name == name {
+			return params
+		}
+	}
+	return append(params, config.ParamConfig{Name: name, Value: value})
+}
+
+func (p *auth0Provider) WellKnownHandler() http.HandlerFunc {
+	return p.metadataHandler(func(r *http.Request) map[string]interface{} {
+		metadata := p.publishedMetadata(r)
+
+		// MCP clients require PKCE and refresh token support to be advertised
+		if _, ok := metadata["code_challenge_methods_supported"]; !ok {
+			metadata["code_challenge_methods_supported"] = []string{"S256"}
+		}
+		if _, ok := metadata["grant_types_supported"]; !ok {
+			metadata["grant_types_supported"] = []string{"authorization_code", "refresh_token"}
+		}
+		return metadata
+	})
+}
+
+// MapScopes grants the API permissions Auth0 puts in the "permissions" claim
+// when RBAC is enabled for the API.
+func (p *auth0Provider) MapScopes(claims jwt.MapClaims) []string {
+	list, _ := claims["permissions"].([]interface{})
+
+	var scopes []string
+	for _, perm := range list {
+		if s, ok := perm.(string); ok && s != "" {
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
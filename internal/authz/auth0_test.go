@@ -0,0 +1,103 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func newStubAuth0(t *testing.T) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/openid-configuration" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 server.URL + "/",
+			"authorization_endpoint": server.URL + "/authorize",
+			"token_endpoint":         server.URL + "/oauth/token",
+			"registration_endpoint":  server.URL + "/oidc/register",
+			"jwks_uri":               server.URL + "/.well-known/jwks.json",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAuth0Provider(t *testing.T) {
+	tenant := newStubAuth0(t)
+	cfg := &config.Config{
+		ProxyBaseURL: "http://localhost:8080",
+		Auth0:        config.Auth0Config{Domain: tenant.URL, Audience: "mcp_proxy"},
+	}
+
+	provider, err := NewAuth0Provider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewAuth0Provider failed: %v", err)
+	}
+
+	authorize := cfg.Default.Path["/authorize"].AddQueryParams
+	if len(authorize) != 1 || authorize[0].Name != "audience" || authorize[0].Value != "mcp_proxy" {
+		t.Errorf("Expected audience to be added to /authorize, got %v", authorize)
+	}
+	if cfg.PathMapping["/register"] != "/oidc/register" {
+		t.Errorf("Expected /register to map to /oidc/register, got %q", cfg.PathMapping["/register"])
+	}
+	if cfg.PathMapping["/token"] != "/oauth/token" {
+		t.Errorf("Expected /token to map to /oauth/token, got %q", cfg.PathMapping["/token"])
+	}
+
+	w := httptest.NewRecorder()
+	provider.WellKnownHandler()(w, httptest.NewRequest("GET", "/.well-known/oauth-authorization-server", nil))
+	var metadata map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&metadata); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	if metadata["issuer"] != tenant.URL+"/" {
+		t.Errorf("Expected Auth0 issuer, got %v", metadata["issuer"])
+	}
+	if metadata["registration_endpoint"] != "http://localhost:8080/register" {
+		t.Errorf("Expected registration endpoint on the proxy, got %v", metadata["registration_endpoint"])
+	}
+	if methods, _ := metadata["code_challenge_methods_supported"].([]interface{}); len(methods) == 0 {
+		t.Errorf("Expected PKCE methods to be advertised")
+	}
+}
+
+func TestAuth0ExistingAudienceParamKept(t *testing.T) {
+	tenant := newStubAuth0(t)
+	cfg := &config.Config{
+		Auth0: config.Auth0Config{Domain: tenant.URL, Audience: "mcp_proxy"},
+		Default: config.DefaultConfig{Path: map[string]config.PathConfig{
+			"/authorize": {AddQueryParams: []config.ParamConfig{{Name: "audience", Value: "custom"}}},
+		}},
+	}
+	if _, err := NewAuth0Provider(context.Background(), cfg); err != nil {
+		t.Fatalf("NewAuth0Provider failed: %v", err)
+	}
+	if params := cfg.Default.Path["/authorize"].AddQueryParams; len(params) != 1 || params[0].Value != "custom" {
+		t.Errorf("Expected configured audience to be kept, got %v", params)
+	}
+}
+
+func TestAuth0MapScopes(t *testing.T) {
+	tenant := newStubAuth0(t)
+	provider, err := NewAuth0Provider(context.Background(), &config.Config{Auth0: config.Auth0Config{Domain: tenant.URL}})
+	if err != nil {
+		t.Fatalf("NewAuth0Provider failed: %v", err)
+	}
+
+	claims := jwt.MapClaims{"permissions": []interface{}{"mcp_init", "mcp_echo_tool"}}
+	scopes := provider.(ScopeMapper).MapScopes(claims)
+	if strings.Join(scopes, " ") != "mcp_init mcp_echo_tool" {
+		t.Errorf("Expected permissions as scopes, got %v", scopes)
+	}
+}
@@ -0,0 +1,290 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const (
+	defaultClientMetadataCacheTTL = 5 * time.Minute
+	maxClientMetadataSize         = 5 * 1024
+	maxClientMetadataCacheEntries = 1024
+)
+
+var errPrivateAddress = errors.New("client metadata host resolves to a non-public address")
+
+// ClientResolvers tries each resolver in turn and returns the first match
+type ClientResolvers []ClientResolver
+
+func (rs ClientResolvers) ResolveClient(clientID string) (*ResolvedClient, error) {
+	for _, r := range rs {
+		client, err := r.ResolveClient(clientID)
+		if err != nil || client != nil {
+			return client, err
+		}
+	}
+	return nil, nil
+}
+
+type cachedClientMetadata struct {
+	client    *ResolvedClient
+	expiresAt time.Time
+}
+
+// ClientMetadataResolver resolves client IDs that are HTTPS URLs by fetching
+// the client metadata document they point to
+type ClientMetadataResolver struct {
+	cfg    config.ClientMetadataConfig
+	ttl    time.Duration
+	client *http.Client
+	// URL schemes accepted for client IDs
+	schemes []string
+
+	mu    sync.Mutex
+	cache map[string]cachedClientMetadata
+}
+
+// NewClientMetadataResolver creates a resolver that fetches documents through
+// a client that refuses to connect to loopback, private and link-local addresses.
+// The outbound proxy setting is not used, as it would bypass that check.
+func NewClientMetadataResolver(cfg config.ClientMetadataConfig) *ClientMetadataResolver {
+	return newClientMetadataResolver(cfg, newClientMetadataClient(), "https")
+}
+
+// newClientMetadataResolver creates a resolver using the given client and client ID
+// schemes; tests use it to fetch documents from a local stand-in over plain HTTP
+func newClientMetadataResolver(cfg config.ClientMetadataConfig, client *http.Client, schemes ...string) *ClientMetadataResolver {
+	ttl := defaultClientMetadataCacheTTL
+	if cfg.CacheTTLSeconds > 0 {
+		ttl = time.Duration(cfg.CacheTTLSeconds) * time.Second
+	}
+	return &ClientMetadataResolver{
+		cfg:     cfg,
+		ttl:     ttl,
+		client:  client,
+		schemes: schemes,
+		cache:   make(map[string]cachedClientMetadata),
+	}
+}
+
+// newClientMetadataClient creates the client that refuses to connect to
+// non-public addresses
+func newClientMetadataClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		// Checked after DNS resolution so that rebinding cannot bypass it
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return errPrivateAddress
+			}
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: httpclient.Timeout(httpclient.DestinationClientMetadata),
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSClientConfig:     httpclient.TLSConfig(httpclient.DestinationClientMetadata),
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// ResolveClient returns nil for client IDs that are not URLs. For URL client
+// IDs it returns an error when the client is not allowed or its document is invalid.
+func (m *ClientMetadataResolver) ResolveClient(clientID string) (*ResolvedClient, error) {
+	if !strings.HasPrefix(clientID, "https://") && !strings.HasPrefix(clientID, "http://") {
+		return nil, nil
+	}
+
+	u, err := m.validateClientIDURL(clientID)
+	if err != nil {
+		return nil, err
+	}
+	if !m.domainAllowed(u.Hostname()) {
+		return nil, fmt.Errorf("client %s is not from an allowed domain", clientID)
+	}
+
+	m.mu.Lock()
+	cached, ok := m.cache[clientID]
+	m.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.client, nil
+	}
+
+	client, err := m.fetch(clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.evict()
+	m.cache[clientID] = cachedClientMetadata{client: client, expiresAt: time.Now().Add(m.ttl)}
+	m.mu.Unlock()
+	return client, nil
+}
+
+// evict makes room in a full cache by dropping expired documents, or else the
+// one closest to expiry; callers must hold the lock
+func (m *ClientMetadataResolver) evict() {
+	if len(m.cache) < maxClientMetadataCacheEntries {
+		return
+	}
+	now := time.Now()
+	oldest := ""
+	for id, cached := range m.cache {
+		if now.After(cached.expiresAt) {
+			delete(m.cache, id)
+		} else if oldest == "" || cached.expiresAt.Before(m.cache[oldest].expiresAt) {
+			oldest = id
+		}
+	}
+	if len(m.cache) >= maxClientMetadataCacheEntries {
+		delete(m.cache, oldest)
+	}
+}
+
+// validateClientIDURL applies the URL requirements for client identifiers:
+// HTTPS, a path component, and no fragment or credentials
+func (m *ClientMetadataResolver) validateClientIDURL(clientID string) (*url.URL, error) {
+	u, err := url.Parse(clientID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client_id URL: %w", err)
+	}
+	if !containsString(m.schemes, u.Scheme) {
+		return nil, fmt.Errorf("client_id URL %s must use https", clientID)
+	}
+	if u.Host == "" || u.Path == "" || u.Path == "/" {
+		return nil, fmt.Errorf("client_id URL %s must have a host and a path", clientID)
+	}
+	if u.Fragment != "" || u.User != nil {
+		return nil, fmt.Errorf("client_id URL %s must not contain a fragment or credentials", clientID)
+	}
+	return u, nil
+}
+
+// domainAllowed applies the deny list first, then the allow list
+func (m *ClientMetadataResolver) domainAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range m.cfg.DeniedDomains {
+		if matchDomain(pattern, host) {
+			return false
+		}
+	}
+	if len(m.cfg.AllowedDomains) == 0 {
+		return true
+	}
+	for _, pattern := range m.cfg.AllowedDomains {
+		if matchDomain(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain matches a host against "example.com" or "*.example.com"
+func matchDomain(pattern, host string) bool {
+	pattern = strings.ToLower(pattern)
+	if strings.HasPrefix(pattern, "*.") {
+		return strings.HasSuffix(host, pattern[1:])
+	}
+	return host == pattern
+}
+
+func (m *ClientMetadataResolver) fetch(clientID string) (*ResolvedClient, error) {
+	req, err := http.NewRequest(http.MethodGet, clientID, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch client metadata from %s: %w", clientID, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("client metadata at %s returned status %d", clientID, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxClientMetadataSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client metadata from %s: %w", clientID, err)
+	}
+	if len(body) > maxClientMetadataSize {
+		return nil, fmt.Errorf("client metadata at %s exceeds %d bytes", clientID, maxClientMetadataSize)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid client metadata at %s: %w", clientID, err)
+	}
+	return m.buildClient(clientID, doc)
+}
+
+// buildClient validates the metadata document and maps the client onto an upstream client
+func (m *ClientMetadataResolver) buildClient(clientID string, doc map[string]interface{}) (*ResolvedClient, error) {
+	if id, _ := doc["client_id"].(string); id != clientID {
+		return nil, fmt.Errorf("client_id %q in metadata document does not match %s", id, clientID)
+	}
+	if _, ok := doc["client_secret"]; ok {
+		return nil, fmt.Errorf("client metadata at %s must not contain a client_secret", clientID)
+	}
+	if method, _ := doc["token_endpoint_auth_method"].(string); method != "" && method != "none" {
+		return nil, fmt.Errorf("unsupported token_endpoint_auth_method %q for %s", method, clientID)
+	}
+
+	redirectURIs := stringList(doc["redirect_uris"])
+	if len(redirectURIs) == 0 {
+		return nil, fmt.Errorf("client metadata at %s has no redirect_uris", clientID)
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, fmt.Errorf("client metadata at %s has an invalid redirect URI %q", clientID, uri)
+		}
+	}
+
+	client := &ResolvedClient{ClientID: clientID, RedirectURIs: redirectURIs}
+	if len(m.cfg.UpstreamClients) > 0 {
+		upstream := selectUpstream(m.cfg.UpstreamClients, redirectURIs, true)
+		if upstream == nil {
+			return nil, fmt.Errorf("no upstream client allows the redirect_uris of %s", clientID)
+		}
+		client.UpstreamClientID = upstream.ClientID
+	}
+
+	name, _ := doc["client_name"].(string)
+	logger.Info("Resolved client metadata document %s (%s)", clientID, name)
+	return client, nil
+}
+
+// Carrier-grade NAT space, not covered by net.IP.IsPrivate
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// isPublicIP reports whether an address is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	return !(sharedAddressSpace.Contains(ip) || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified())
+}
@@ -0,0 +1,161 @@
+package authz
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// newClientMetadataServer serves a metadata document at /client.json whose
+// client_id is its own URL
+func newClientMetadataServer(t *testing.T, doc map[string]interface{}) (*httptest.Server, *int32) {
+	t.Helper()
+	var hits int32
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		body := map[string]interface{}{"client_id": server.URL + "/client.json"}
+		for k, v := range doc {
+			body[k] = v
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &hits
+}
+
+// newTestMetadataResolver allows plain HTTP and loopback so a local stand-in can be used
+func newTestMetadataResolver(cfg config.ClientMetadataConfig, server *httptest.Server) *ClientMetadataResolver {
+	return newClientMetadataResolver(cfg, server.Client(), "https", "http")
+}
+
+func TestClientMetadataResolver(t *testing.T) {
+	server, hits := newClientMetadataServer(t, map[string]interface{}{
+		"client_name":   "Example MCP Client",
+		"redirect_uris": []string{"http://localhost:3000/callback"},
+	})
+	m := newTestMetadataResolver(config.ClientMetadataConfig{
+		UpstreamClients: []config.UpstreamClient{{ClientID: "confidential-id", ClientSecret: "s"}, {ClientID: "upstream-id"}},
+	}, server)
+
+	clientID := server.URL + "/client.json"
+	client, err := m.ResolveClient(clientID)
+	if err != nil {
+		t.Fatalf("ResolveClient failed: %v", err)
+	}
+	if !client.AllowsRedirect("http://localhost:3000/callback") || client.AllowsRedirect("http://localhost:3000/other") {
+		t.Errorf("Expected only the documented redirect URI to be allowed, got %v", client.RedirectURIs)
+	}
+	// Public clients are not mapped onto confidential upstream clients
+	if client.UpstreamClientID != "upstream-id" || client.UpstreamClientSecret != "" {
+		t.Errorf("Expected mapping to upstream-id, got %+v", client)
+	}
+
+	// The document is cached
+	if _, err := m.ResolveClient(clientID); err != nil || atomic.LoadInt32(hits) != 1 {
+		t.Errorf("Expected cached document to be reused, got %d fetches (%v)", atomic.LoadInt32(hits), err)
+	}
+
+	// Non-URL client IDs are left to other resolvers
+	if client, err := m.ResolveClient("client-abc"); client != nil || err != nil {
+		t.Errorf("Expected non-URL client_id to be ignored, got %v, %v", client, err)
+	}
+}
+
+func TestClientMetadataResolverRejectsInvalidDocuments(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no redirect_uris": {"client_name": "x"},
+		"client secret":    {"redirect_uris": []string{"http://localhost/cb"}, "client_secret": "s"},
+		"confidential":     {"redirect_uris": []string{"http://localhost/cb"}, "token_endpoint_auth_method": "client_secret_basic"},
+		"mismatched id":    {"redirect_uris": []string{"http://localhost/cb"}, "client_id": "https://other.example.com/client.json"},
+		"oversized":        {"redirect_uris": []string{"http://localhost/cb"}, "padding": strings.Repeat("x", maxClientMetadataSize)},
+	}
+	for name, doc := range tests {
+		server, _ := newClientMetadataServer(t, doc)
+		m := newTestMetadataResolver(config.ClientMetadataConfig{}, server)
+		if _, err := m.ResolveClient(server.URL + "/client.json"); err == nil {
+			t.Errorf("%s: expected document to be rejected", name)
+		}
+	}
+}
+
+func TestClientMetadataResolverDomainLists(t *testing.T) {
+	m := NewClientMetadataResolver(config.ClientMetadataConfig{
+		AllowedDomains: []string{"*.example.com"},
+		DeniedDomains:  []string{"evil.example.com"},
+	})
+
+	tests := map[string]bool{
+		"app.example.com":  true,
+		"evil.example.com": false,
+		"example.org":      false,
+	}
+	for host, allowed := range tests {
+		if got := m.domainAllowed(host); got != allowed {
+			t.Errorf("domainAllowed(%s) = %v, expected %v", host, got, allowed)
+		}
+	}
+
+	if _, err := m.ResolveClient("https://example.org/client.json"); err == nil {
+		t.Errorf("Expected client from a domain outside the allow list to be rejected")
+	}
+	if _, err := m.ResolveClient("http://app.example.com/client.json"); err == nil {
+		t.Errorf("Expected non-https client_id to be rejected")
+	}
+}
+
+func TestClientMetadataResolverBlocksPrivateAddresses(t *testing.T) {
+	server, hits := newClientMetadataServer(t, map[string]interface{}{
+		"redirect_uris": []string{"http://localhost/cb"},
+	})
+	// Keep the SSRF-guarded transport
+	m := newClientMetadataResolver(config.ClientMetadataConfig{}, newClientMetadataClient(), "https", "http")
+
+	_, err := m.ResolveClient(server.URL + "/client.json")
+	if !errors.Is(err, errPrivateAddress) {
+		t.Errorf("Expected loopback fetch to be blocked, got %v", err)
+	}
+	if atomic.LoadInt32(hits) != 0 {
+		t.Errorf("Expected no request to reach the server")
+	}
+
+	for ip, public := range map[string]bool{"8.8.8.8": true, "10.1.2.3": false, "169.254.169.254": false, "100.64.0.1": false, "::1": false} {
+		if got := isPublicIP(net.ParseIP(ip)); got != public {
+			t.Errorf("isPublicIP(%s) = %v, expected %v", ip, got, public)
+		}
+	}
+}
+
+func TestClientMetadataCacheIsBounded(t *testing.T) {
+	server, _ := newClientMetadataServer(t, map[string]interface{}{
+		"redirect_uris": []string{"http://localhost/cb"},
+	})
+	m := newTestMetadataResolver(config.ClientMetadataConfig{}, server)
+
+	now := time.Now()
+	for i := 0; i < maxClientMetadataCacheEntries; i++ {
+		m.cache[fmt.Sprintf("https://app%d.example.com/client.json", i)] = cachedClientMetadata{
+			client:    &ResolvedClient{},
+			expiresAt: now.Add(time.Duration(i+1) * time.Minute),
+		}
+	}
+	if _, err := m.ResolveClient(server.URL + "/client.json"); err != nil {
+		t.Fatalf("ResolveClient failed: %v", err)
+	}
+	if len(m.cache) != maxClientMetadataCacheEntries {
+		t.Errorf("Expected the cache to stay at %d entries, got %d", maxClientMetadataCacheEntries, len(m.cache))
+	}
+	if _, ok := m.cache["https://app0.example.com/client.json"]; ok {
+		t.Errorf("Expected the entry closest to expiry to be evicted")
+	}
+}
@@ -40,17 +40,18 @@ func (p *defaultProvider) WellKnownHandler() http.HandlerFunc {
 				// Use configured response values
 				responseConfig := pathConfig.Response
 
+				baseURL := p.cfg.PublicBaseURL()
 				authorizationEndpoint := responseConfig.AuthorizationEndpoint
 				if authorizationEndpoint == "" {
-					authorizationEndpoint = p.cfg.BaseURL + "/authorize"
+					authorizationEndpoint = baseURL + "/authorize"
 				}
 				tokenEndpoint := responseConfig.TokenEndpoint
 				if tokenEndpoint == "" {
-					tokenEndpoint = p.cfg.BaseURL + "/token"
+					tokenEndpoint = baseURL + "/token"
 				}
 				registrationEndpoint := responseConfig.RegistrationEndpoint
 				if registrationEndpoint == "" {
-					registrationEndpoint = p.cfg.BaseURL + "/register"
+					registrationEndpoint = baseURL + "/register"
 				}
 
 				// Build response from config
@@ -65,6 +66,9 @@ func (p *defaultProvider) WellKnownHandler() http.HandlerFunc {
 					"registration_endpoint":                 registrationEndpoint,
 					"code_challenge_methods_supported":      responseConfig.CodeChallengeMethodsSupported,
 				}
+				if p.cfg.ClientMetadata.Enabled {
+					response["client_id_metadata_document_supported"] = true
+				}
 
 				w.Header().Set("Content-Type", "application/json")
 				if err := json.NewEncoder(w).Encode(response); err != nil {
@@ -89,14 +93,7 @@ func (p *defaultProvider) ProtectedResourceMetadataHandler() http.HandlerFunc {
 			"scopes_supported":      p.cfg.ProtectedResourceMetadata.ScopesSupported,
 			"authorization_servers": p.cfg.ProtectedResourceMetadata.AuthorizationServers,
 		}
-
-		if p.cfg.ProtectedResourceMetadata.JwksURI != "" {
-			meta["jwks_uri"] = p.cfg.ProtectedResourceMetadata.JwksURI
-		}
-
-		if len(p.cfg.ProtectedResourceMetadata.BearerMethodsSupported) > 0 {
-			meta["bearer_methods_supported"] = p.cfg.ProtectedResourceMetadata.BearerMethodsSupported
-		}
+		addOptionalResourceMetadata(meta, p.cfg)
 
 		if err := json.NewEncoder(w).Encode(meta); err != nil {
 			http.Error(w, "failed to encode metadata", http.StatusInternalServerError)
@@ -24,6 +24,7 @@ func TestNewDefaultProvider(t *testing.T) {
 func TestDefaultProviderWellKnownHandler(t *testing.T) {
 	// Create a config with a custom well-known response
 	cfg := &config.Config{
+		ProxyBaseURL: "https://test-host.com",
 		Default: config.DefaultConfig{
 			Path: map[string]config.PathConfig{
 				"/.well-known/oauth-authorization-server": {
@@ -82,6 +83,32 @@ func TestDefaultProviderWellKnownHandler(t *testing.T) {
 	}
 }
 
+func TestDefaultProviderIgnoresRequestHost(t *testing.T) {
+	cfg := &config.Config{
+		ListenPort: 8080,
+		Default: config.DefaultConfig{
+			Path: map[string]config.PathConfig{
+				"/.well-known/oauth-authorization-server": {Response: &config.ResponseConfig{}},
+			},
+		},
+	}
+	handler := NewDefaultProvider(cfg).WellKnownHandler()
+
+	req := httptest.NewRequest("GET", "/.well-known/oauth-authorization-server", nil)
+	req.Host = "attacker.example"
+	req.Header.Set("X-Forwarded-Proto", "https")
+	w := httptest.NewRecorder()
+	handler(w, req)
+
+	var response map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&response); err != nil {
+		t.Fatalf("Failed to decode response JSON: %v", err)
+	}
+	if response["token_endpoint"] != "http://localhost:8080/token" {
+		t.Errorf("Expected the token endpoint on the local listener, got %v", response["token_endpoint"])
+	}
+}
+
 func TestDefaultProviderHandleOPTIONS(t *testing.T) {
 	provider := NewDefaultProvider(&config.Config{})
 	handler := provider.WellKnownHandler()
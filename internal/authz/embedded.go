@@ -0,0 +1,883 @@
+package authz
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/ratelimit"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultAccessTokenTTL  = time.Hour
+	defaultRefreshTokenTTL = 24 * time.Hour
+	authorizationCodeTTL   = time.Minute
+)
+
+// Sign-in is refused for loginLockout after maxLoginFailures failed attempts
+// for a user or from an address within that time
+const (
+	maxLoginFailures = 5
+	loginLockout     = 15 * time.Minute
+	// maxLoginFailureKeys bounds the users and addresses tracked
+	maxLoginFailureKeys = 10000
+)
+
+type embeddedUser struct {
+	verify func(password string) bool
+	scopes []string
+}
+
+type embeddedClient struct {
+	ClientID     string   `json:"client_id"`
+	ClientName   string   `json:"client_name,omitempty"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types"`
+	IssuedAt     int64    `json:"client_id_issued_at"`
+
+	used bool // A code was issued to the client
+}
+
+type authCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	subject       string
+	scope         string
+	expiresAt     time.Time
+}
+
+type refreshGrant struct {
+	clientID  string
+	subject   string
+	scope     string
+	jkt       string
+	expiresAt time.Time
+}
+
+type embeddedProvider struct {
+	cfg        *config.Config
+	issuer     string
+	key        *rsa.PrivateKey
+	kid        string
+	users      map[string]*embeddedUser
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+	dpop       *dpop.Verifier
+
+	registrations *ratelimit.Limiter // Registrations per address
+	maxClients    int
+	logins        *loginThrottle
+
+	mu            sync.Mutex
+	clients       map[string]*embeddedClient
+	codes         map[string]*authCode
+	refreshTokens map[string]*refreshGrant
+}
+
+// loginThrottle counts failed sign-ins per user and per address
+type loginThrottle struct {
+	now func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*loginFailures
+}
+
+type loginFailures struct {
+	count int
+	reset time.Time
+}
+
+// blocked returns how long sign-in stays refused for any of the keys
+func (t *loginThrottle) blocked(keys ...string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	var wait time.Duration
+	for _, key := range keys {
+		if f := t.failures[key]; f != nil && f.count >= maxLoginFailures && now.Before(f.reset) {
+			wait = max(wait, f.reset.Sub(now))
+		}
+	}
+	return wait
+}
+
+// fail records a failed sign-in for the keys
+func (t *loginThrottle) fail(keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	for _, key := range keys {
+		f := t.failures[key]
+		if f == nil || !now.Before(f.reset) {
+			if len(t.failures) >= maxLoginFailureKeys {
+				pruneExpired(t.failures, func(f *loginFailures) time.Time { return f.reset })
+			}
+			if len(t.failures) >= maxLoginFailureKeys {
+				continue
+			}
+			f = &loginFailures{reset: now.Add(loginLockout)}
+			t.failures[key] = f
+		}
+		f.count++
+	}
+}
+
+// succeed forgets the failed sign-ins of a key
+func (t *loginThrottle) succeed(key string) {
+	t.mu.Lock()
+	delete(t.failures, key)
+	t.mu.Unlock()
+}
+
+// NewEmbeddedProvider initializes a Provider in which the proxy is its own
+// authorization server. Users come from the config or an htpasswd file, clients
+// register dynamically, and tokens are signed with a locally held key that is
+// registered for validation.
+func NewEmbeddedProvider(cfg *config.Config) (Provider, error) {
+	ec := cfg.Embedded
+
+	issuer := strings.TrimSuffix(ec.Issuer, "/")
+	if issuer == "" {
+		issuer = strings.TrimSuffix(cfg.ProxyBaseURL, "/")
+	}
+	if issuer == "" {
+		return nil, fmt.Errorf("embedded.issuer or proxy_base_url is required")
+	}
+
+	key, err := loadOrGenerateSigningKey(ec.SigningKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	registrations, err := newRegistrationLimiter()
+	if err != nil {
+		return nil, err
+	}
+
+	p := &embeddedProvider{
+		cfg:           cfg,
+		issuer:        issuer,
+		key:           key,
+		kid:           keyID(&key.PublicKey),
+		users:         make(map[string]*embeddedUser),
+		accessTTL:     defaultAccessTokenTTL,
+		refreshTTL:    defaultRefreshTokenTTL,
+		registrations: registrations,
+		maxClients:    maxRegisteredClients,
+		logins:        &loginThrottle{now: time.Now, failures: make(map[string]*loginFailures)},
+		clients:       make(map[string]*embeddedClient),
+		codes:         make(map[string]*authCode),
+		refreshTokens: make(map[string]*refreshGrant),
+	}
+	if ec.AccessTokenTTLSeconds > 0 {
+		p.accessTTL = time.Duration(ec.AccessTokenTTLSeconds) * time.Second
+	}
+	if ec.RefreshTokenTTLSeconds > 0 {
+		p.refreshTTL = time.Duration(ec.RefreshTokenTTLSeconds) * time.Second
+	}
+
+	if cfg.DPoP.Enabled {
+		// Token requests carrying a DPoP proof get tokens bound to its key
+		if p.dpop, err = dpop.New(cfg.DPoP, issuer); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := p.loadUsers(ec); err != nil {
+		return nil, err
+	}
+	if len(p.users) == 0 {
+		return nil, fmt.Errorf("embedded provider has no users; configure embedded.users or embedded.htpasswd_file")
+	}
+
+	cfg.AuthServerBaseURL = issuer
+	cfg.JWKSURL = issuer + "/jwks"
+	util.AddPublicKey(p.kid, &key.PublicKey)
+
+	logger.Info("Embedded authorization server ready with %d user(s), issuer %s", len(p.users), issuer)
+	return p, nil
+}
+
+func (p *embeddedProvider) loadUsers(ec config.EmbeddedConfig) error {
+	for _, u := range ec.Users {
+		scopes := u.Scopes
+		if len(scopes) == 0 {
+			scopes = ec.DefaultScopes
+		}
+		user := &embeddedUser{scopes: scopes}
+
+		switch {
+		case u.PasswordHash != "":
+			user.verify = passwordVerifier(u.PasswordHash)
+			if user.verify == nil {
+				return fmt.Errorf("unsupported password hash for user %s", u.Username)
+			}
+		case u.Password != "":
+			logger.Warn("User %s has a plain text password; use password_hash outside development", u.Username)
+			password := u.Password
+			user.verify = func(candidate string) bool {
+				return subtle.ConstantTimeCompare([]byte(candidate), []byte(password)) == 1
+			}
+		default:
+			return fmt.Errorf("user %s has no password", u.Username)
+		}
+		p.users[u.Username] = user
+	}
+
+	if ec.HtpasswdFile == "" {
+		return nil
+	}
+	f, err := os.Open(ec.HtpasswdFile)
+	if err != nil {
+		return fmt.Errorf("failed to open htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		username, hash, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		verify := passwordVerifier(hash)
+		if verify == nil {
+			logger.Warn("Skipping htpasswd user %s: only bcrypt and {SHA} hashes are supported", username)
+			continue
+		}
+		p.users[username] = &embeddedUser{verify: verify, scopes: ec.DefaultScopes}
+	}
+	return scanner.Err()
+}
+
+// passwordVerifier returns a checker for a bcrypt or {SHA} password hash
+func passwordVerifier(hash string) func(string) bool {
+	switch {
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return func(candidate string) bool {
+			return bcrypt.CompareHashAndPassword([]byte(hash), []byte(candidate)) == nil
+		}
+	case strings.HasPrefix(hash, "{SHA}"):
+		expected := strings.TrimPrefix(hash, "{SHA}")
+		return func(candidate string) bool {
+			sum := sha1.Sum([]byte(candidate))
+			actual := base64.StdEncoding.EncodeToString(sum[:])
+			return subtle.ConstantTimeCompare([]byte(actual), []byte(expected)) == 1
+		}
+	}
+	return nil
+}
+
+// loadOrGenerateSigningKey reads an RSA key from path, creating it if it does not
+// exist. Without a path an ephemeral key is generated, invalidating tokens on restart.
+func loadOrGenerateSigningKey(path string) (*rsa.PrivateKey, error) {
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			block, _ := pem.Decode(data)
+			if block == nil {
+				return nil, fmt.Errorf("no PEM data in signing key file %s", path)
+			}
+			if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				return key, nil
+			}
+			parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse signing key: %w", err)
+			}
+			key, ok := parsed.(*rsa.PrivateKey)
+			if !ok {
+				return nil, fmt.Errorf("signing key in %s is not an RSA key", path)
+			}
+			return key, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read signing key: %w", err)
+		}
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+	if path != "" {
+		data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write signing key: %w", err)
+		}
+		logger.Info("Generated signing key at %s", path)
+	} else {
+		logger.Warn("Using an ephemeral signing key; issued tokens will not survive a restart")
+	}
+	return key, nil
+}
+
+// keyID derives a stable key id from the public key
+func keyID(pub *rsa.PublicKey) string {
+	sum := sha256.Sum256(pub.N.Bytes())
+	return base64.RawURLEncoding.EncodeToString(sum[:12])
+}
+
+func (p *embeddedProvider) Endpoints() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/authorize":                        p.authorizeHandler(),
+		"/token":                            p.tokenHandler(),
+		"/jwks":                             p.jwksHandler(),
+		"/.well-known/openid-configuration": p.WellKnownHandler(),
+	}
+}
+
+func (p *embeddedProvider) WellKnownHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowCORS(w, r, "GET, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		response := map[string]interface{}{
+			"issuer":                                p.issuer,
+			"authorization_endpoint":                p.issuer + "/authorize",
+			"token_endpoint":                        p.issuer + "/token",
+			"registration_endpoint":                 p.issuer + "/register",
+			"jwks_uri":                              p.issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+			"token_endpoint_auth_methods_supported": []string{"none"},
+			"code_challenge_methods_supported":      []string{"S256"},
+			"scopes_supported":                      p.allScopes(),
+		}
+		if p.cfg.TLS.CertificateBoundTokens {
+			response["tls_client_certificate_bound_access_tokens"] = true
+		}
+		if p.dpop != nil {
+			response["dpop_signing_alg_values_supported"] = p.dpop.Algorithms()
+		}
+		writeJSON(w, http.StatusOK, response)
+	}
+}
+
+func (p *embeddedProvider) ProtectedResourceMetadataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		meta := buildProtectedResourceMetadata(p.cfg)
+		if len(p.cfg.ProtectedResourceMetadata.AuthorizationServers) == 0 {
+			meta["authorization_servers"] = []string{p.issuer}
+		}
+		writeJSON(w, http.StatusOK, meta)
+	}
+}
+
+func (p *embeddedProvider) jwksHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowCORS(w, r, "GET, OPTIONS") {
+			return
+		}
+		pub := p.key.PublicKey
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": p.kid,
+				"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			}},
+		})
+	}
+}
+
+// RegisterHandler implements RFC 7591 registration for public PKCE clients
+func (p *embeddedProvider) RegisterHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowCORS(w, r, "POST, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !allowRegistration(w, r, p.registrations) {
+			return
+		}
+
+		var regReq RegisterRequest
+		if err := json.NewDecoder(r.Body).Decode(&regReq); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "invalid request body")
+			return
+		}
+		if len(regReq.RedirectURIs) == 0 {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", "redirect_uris is required")
+			return
+		}
+		for _, uri := range regReq.RedirectURIs {
+			if !validRedirectURI(uri) {
+				writeOAuthError(w, http.StatusBadRequest, "invalid_redirect_uri", "invalid redirect URI: "+uri)
+				return
+			}
+		}
+
+		client := &embeddedClient{
+			ClientID:     "client-" + randomToken(12),
+			ClientName:   regReq.ClientName,
+			RedirectURIs: regReq.RedirectURIs,
+			GrantTypes:   []string{"authorization_code", "refresh_token"},
+			IssuedAt:     time.Now().Unix(),
+		}
+		p.mu.Lock()
+		if len(p.clients) >= p.maxClients && !p.evictUnusedClient() {
+			p.mu.Unlock()
+			logger.Warn("Refused a registration: %d clients are registered", p.maxClients)
+			writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "no more clients can be registered")
+			return
+		}
+		p.clients[client.ClientID] = client
+		p.mu.Unlock()
+
+		logger.Info("Registered embedded client %s (%s)", client.ClientID, client.ClientName)
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"client_id":                  client.ClientID,
+			"client_id_issued_at":        client.IssuedAt,
+			"client_name":                client.ClientName,
+			"redirect_uris":              client.RedirectURIs,
+			"grant_types":                client.GrantTypes,
+			"response_types":             []string{"code"},
+			"token_endpoint_auth_method": "none",
+		})
+	}
+}
+
+// evictUnusedClient drops the oldest client that was never issued a code,
+// and reports whether there was one. It must be called with the lock held.
+func (p *embeddedProvider) evictUnusedClient() bool {
+	var oldest *embeddedClient
+	for _, c := range p.clients {
+		if !c.used && (oldest == nil || c.IssuedAt < oldest.IssuedAt) {
+			oldest = c
+		}
+	}
+	if oldest == nil {
+		return false
+	}
+	delete(p.clients, oldest.ClientID)
+	return true
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Sign in</title></head>
+<body>
+<h1>Sign in to {{.ClientName}}</h1>
+{{if .Error}}<p style="color:red">{{.Error}}</p>{{end}}
+<form method="POST" action="authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end}}<label>Username <input name="username" autocomplete="username" required></label><br>
+<label>Password <input name="password" type="password" autocomplete="current-password" required></label><br>
+<button type="submit">Sign in</button>
+</form>
+</body>
+</html>
+`))
+
+// authorizeHandler implements the authorization code flow with mandatory S256 PKCE.
+// GET shows a login form; POST checks the credentials and redirects with a code.
+func (p *embeddedProvider) authorizeHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+
+		clientID := r.Form.Get("client_id")
+		redirectURI := r.Form.Get("redirect_uri")
+		p.mu.Lock()
+		client := p.clients[clientID]
+		p.mu.Unlock()
+
+		// Errors about the client or redirect URI must not be redirected
+		if client == nil {
+			http.Error(w, "Unknown client_id", http.StatusBadRequest)
+			return
+		}
+		if redirectURI == "" && len(client.RedirectURIs) == 1 {
+			redirectURI = client.RedirectURIs[0]
+		}
+		if !containsString(client.RedirectURIs, redirectURI) {
+			http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+			return
+		}
+
+		state := r.Form.Get("state")
+		if r.Form.Get("response_type") != "code" {
+			redirectWithError(w, r, redirectURI, state, "unsupported_response_type", "only the code response type is supported")
+			return
+		}
+		challenge := r.Form.Get("code_challenge")
+		if challenge == "" || r.Form.Get("code_challenge_method") != "S256" {
+			redirectWithError(w, r, redirectURI, state, "invalid_request", "PKCE with code_challenge_method=S256 is required")
+			return
+		}
+
+		params := map[string]string{
+			"client_id":             clientID,
+			"redirect_uri":          redirectURI,
+			"response_type":         "code",
+			"state":                 state,
+			"scope":                 r.Form.Get("scope"),
+			"code_challenge":        challenge,
+			"code_challenge_method": "S256",
+		}
+		page := struct {
+			ClientName string
+			Error      string
+			Params     map[string]string
+		}{ClientName: client.ClientName, Params: params}
+		if page.ClientName == "" {
+			page.ClientName = clientID
+		}
+
+		if r.Method == http.MethodGet {
+			writeLoginPage(w, http.StatusOK, page)
+			return
+		}
+
+		username := r.PostForm.Get("username")
+		userKey, ipKey := "user:"+username, "ip:"+ratelimit.ClientIP(r)
+		if wait := p.logins.blocked(userKey, ipKey); wait > 0 {
+			logger.Warn("Refused embedded login for user %q from %s after repeated failures", username, ratelimit.ClientIP(r))
+			page.Error = "Too many failed sign-ins. Try again later."
+			w.Header().Set("Retry-After", fmt.Sprintf("%d", int(wait.Seconds())+1))
+			writeLoginPage(w, http.StatusTooManyRequests, page)
+			return
+		}
+		user := p.users[username]
+		if user == nil || !user.verify(r.PostForm.Get("password")) {
+			logger.Warn("Failed embedded login for user %q", username)
+			p.logins.fail(userKey, ipKey)
+			page.Error = "Invalid username or password"
+			writeLoginPage(w, http.StatusUnauthorized, page)
+			return
+		}
+		p.logins.succeed(userKey)
+
+		code := randomToken(32)
+		p.mu.Lock()
+		client.used = true
+		pruneExpired(p.codes, func(c *authCode) time.Time { return c.expiresAt })
+		p.codes[code] = &authCode{
+			clientID:      clientID,
+			redirectURI:   redirectURI,
+			codeChallenge: challenge,
+			subject:       username,
+			scope:         grantScopes(r.Form.Get("scope"), user.scopes),
+			expiresAt:     time.Now().Add(authorizationCodeTTL),
+		}
+		p.mu.Unlock()
+
+		target, _ := url.Parse(redirectURI)
+		q := target.Query()
+		q.Set("code", code)
+		if state != "" {
+			q.Set("state", state)
+		}
+		q.Set("iss", p.issuer)
+		target.RawQuery = q.Encode()
+		http.Redirect(w, r, target.String(), http.StatusFound)
+	}
+}
+
+// writeLoginPage renders the login form, which must not be framed by other
+// sites that could trick users into signing in
+func writeLoginPage(w http.ResponseWriter, status int, page interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(status)
+	loginPage.Execute(w, page)
+}
+
+func (p *embeddedProvider) tokenHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowCORS(w, r, "POST, OPTIONS") {
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_request", "invalid form body")
+			return
+		}
+
+		var jkt string
+		if p.dpop != nil && r.Header.Get(dpop.HeaderName) != "" {
+			var err error
+			if jkt, err = p.dpop.VerifyProof(r, ""); err != nil {
+				writeOAuthError(w, http.StatusBadRequest, dpop.ErrorInvalidProof, err.Error())
+				return
+			}
+		}
+
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			p.exchangeCode(w, r, jkt)
+		case "refresh_token":
+			p.refreshToken(w, r, jkt)
+		default:
+			writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+		}
+	}
+}
+
+func (p *embeddedProvider) exchangeCode(w http.ResponseWriter, r *http.Request, jkt string) {
+	code := r.PostForm.Get("code")
+
+	p.mu.Lock()
+	grant := p.codes[code]
+	delete(p.codes, code) // Codes are single use
+	p.mu.Unlock()
+
+	if grant == nil || time.Now().After(grant.expiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired authorization code")
+		return
+	}
+	if r.PostForm.Get("client_id") != grant.clientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "code was issued to another client")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != grant.redirectURI {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.codeChallenge {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	p.issueTokens(w, r, grant.clientID, grant.subject, grant.scope, jkt)
+}
+
+func (p *embeddedProvider) refreshToken(w http.ResponseWriter, r *http.Request, jkt string) {
+	token := r.PostForm.Get("refresh_token")
+
+	p.mu.Lock()
+	grant := p.refreshTokens[token]
+	delete(p.refreshTokens, token) // Refresh tokens are rotated on use
+	p.mu.Unlock()
+
+	if grant == nil || time.Now().After(grant.expiresAt) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "unknown or expired refresh token")
+		return
+	}
+	if r.PostForm.Get("client_id") != grant.clientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token was issued to another client")
+		return
+	}
+	if grant.jkt != "" && grant.jkt != jkt {
+		// Refresh tokens of DPoP clients are bound to the same key
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "refresh token is bound to a different DPoP key")
+		return
+	}
+
+	scope := grant.scope
+	if requested := r.PostForm.Get("scope"); requested != "" {
+		// A refresh may only narrow the original grant
+		scope = grantScopes(requested, strings.Fields(grant.scope))
+	}
+	p.issueTokens(w, r, grant.clientID, grant.subject, scope, jkt)
+}
+
+// issueTokens signs an access token and stores a refresh token. Tokens requested
+// over mutual TLS are bound to the client certificate (RFC 8705), and tokens
+// requested with a DPoP proof to the proof key jkt (RFC 9449).
+func (p *embeddedProvider) issueTokens(w http.ResponseWriter, r *http.Request, clientID, subject, scope, jkt string) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":       p.issuer,
+		"sub":       subject,
+		"aud":       p.cfg.ProtectedResourceMetadata.Audience,
+		"client_id": clientID,
+		"scope":     scope,
+		"iat":       now.Unix(),
+		"exp":       now.Add(p.accessTTL).Unix(),
+		"jti":       randomToken(16),
+	}
+	cnf := map[string]string{}
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		cnf["x5t#S256"] = util.CertificateThumbprint(r.TLS.PeerCertificates[0])
+	}
+	tokenType := "Bearer"
+	if jkt != "" {
+		cnf["jkt"] = jkt
+		tokenType = "DPoP"
+	}
+	if len(cnf) > 0 {
+		claims["cnf"] = cnf
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = p.kid
+	token.Header["typ"] = "at+jwt"
+	accessToken, err := token.SignedString(p.key)
+	if err != nil {
+		logger.Error("Failed to sign access token: %v", err)
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "")
+		return
+	}
+
+	refresh := randomToken(32)
+	p.mu.Lock()
+	pruneExpired(p.refreshTokens, func(g *refreshGrant) time.Time { return g.expiresAt })
+	p.refreshTokens[refresh] = &refreshGrant{
+		clientID:  clientID,
+		subject:   subject,
+		scope:     scope,
+		jkt:       jkt,
+		expiresAt: now.Add(p.refreshTTL),
+	}
+	p.mu.Unlock()
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    tokenType,
+		"expires_in":    int(p.accessTTL.Seconds()),
+		"refresh_token": refresh,
+		"scope":         scope,
+	})
+}
+
+// allScopes lists every scope any user may be granted
+func (p *embeddedProvider) allScopes() []string {
+	seen := make(map[string]bool)
+	scopes := []string{}
+	for _, u := range p.users {
+		for _, s := range u.scopes {
+			if !seen[s] {
+				seen[s] = true
+				scopes = append(scopes, s)
+			}
+		}
+	}
+	return scopes
+}
+
+// grantScopes intersects the requested scopes with the allowed ones; an empty
+// request grants everything allowed.
+func grantScopes(requested string, allowed []string) string {
+	if strings.TrimSpace(requested) == "" {
+		return strings.Join(allowed, " ")
+	}
+	var granted []string
+	for _, s := range strings.Fields(requested) {
+		if containsString(allowed, s) {
+			granted = append(granted, s)
+		}
+	}
+	return strings.Join(granted, " ")
+}
+
+func pruneExpired[T any](m map[string]T, expiry func(T) time.Time) {
+	now := time.Now()
+	for k, v := range m {
+		if now.After(expiry(v)) {
+			delete(m, k)
+		}
+	}
+}
+
+func redirectWithError(w http.ResponseWriter, r *http.Request, redirectURI, state, code, description string) {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, description, http.StatusBadRequest)
+		return
+	}
+	q := target.Query()
+	q.Set("error", code)
+	q.Set("error_description", description)
+	if state != "" {
+		q.Set("state", state)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+// allowCORS sets permissive CORS headers for OAuth endpoints used by browser-based
+// clients and answers preflight requests. It returns false when the request is done.
+func allowCORS(w http.ResponseWriter, r *http.Request, methods string) bool {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Allow-Methods", methods)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Error encoding JSON response: %v", err)
+	}
+}
+
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	body := map[string]string{"error": code}
+	if description != "" {
+		body["error_description"] = description
+	}
+	writeJSON(w, status, body)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// randomToken returns n random bytes encoded as base64url
+func randomToken(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(errors.New("crypto/rand unavailable: " + err.Error()))
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,277 @@
+package authz
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newTestEmbeddedProvider(t *testing.T) *embeddedProvider {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("Failed to hash password: %v", err)
+	}
+	cfg := &config.Config{
+		ProxyBaseURL: "http://localhost:8080",
+		Embedded: config.EmbeddedConfig{
+			Users: []config.EmbeddedUser{
+				{Username: "alice", PasswordHash: string(hash), Scopes: []string{"mcp_init", "mcp_echo_tool"}},
+			},
+		},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp-audience"},
+	}
+	provider, err := NewEmbeddedProvider(cfg)
+	if err != nil {
+		t.Fatalf("NewEmbeddedProvider failed: %v", err)
+	}
+	return provider.(*embeddedProvider)
+}
+
+func postForm(handler http.HandlerFunc, path string, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestEmbeddedAuthorizationCodeFlow(t *testing.T) {
+	p := newTestEmbeddedProvider(t)
+	endpoints := p.Endpoints()
+
+	// Register a client
+	w := httptest.NewRecorder()
+	p.RegisterHandler()(w, httptest.NewRequest("POST", "/register",
+		strings.NewReader(`{"client_name":"test","redirect_uris":["http://localhost:6274/callback"]}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected registration to succeed, got %v: %s", w.Code, w.Body.String())
+	}
+	var client map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&client)
+	clientID := client["client_id"].(string)
+
+	verifier := "a-very-long-code-verifier-for-the-embedded-server-test"
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := url.Values{
+		"client_id":             {clientID},
+		"redirect_uri":          {"http://localhost:6274/callback"},
+		"response_type":         {"code"},
+		"state":                 {"xyz"},
+		"scope":                 {"mcp_init"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+
+	// The login form is shown first
+	w = httptest.NewRecorder()
+	endpoints["/authorize"](w, httptest.NewRequest("GET", "/authorize?"+authorize.Encode(), nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="password"`) {
+		t.Fatalf("Expected login form, got %v", w.Code)
+	}
+
+	// Wrong password is rejected
+	bad := url.Values{"username": {"alice"}, "password": {"wrong"}}
+	for k, v := range authorize {
+		bad[k] = v
+	}
+	if w := postForm(endpoints["/authorize"], "/authorize", bad); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected wrong password to be rejected, got %v", w.Code)
+	}
+
+	login := url.Values{"username": {"alice"}, "password": {"secret"}}
+	for k, v := range authorize {
+		login[k] = v
+	}
+	w = postForm(endpoints["/authorize"], "/authorize", login)
+	if w.Code != http.StatusFound {
+		t.Fatalf("Expected redirect after login, got %v: %s", w.Code, w.Body.String())
+	}
+	location, _ := url.Parse(w.Header().Get("Location"))
+	code := location.Query().Get("code")
+	if code == "" || location.Query().Get("state") != "xyz" {
+		t.Fatalf("Expected code and state in redirect, got %s", location)
+	}
+
+	tokenReq := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {clientID},
+		"redirect_uri":  {"http://localhost:6274/callback"},
+		"code_verifier": {verifier},
+	}
+	w = postForm(endpoints["/token"], "/token", tokenReq)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected token response, got %v: %s", w.Code, w.Body.String())
+	}
+	var tokens map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&tokens)
+	if tokens["scope"] != "mcp_init" {
+		t.Errorf("Expected granted scope mcp_init, got %v", tokens["scope"])
+	}
+
+	// Tokens pass the regular validation path
+	accessToken := tokens["access_token"].(string)
+	if err := util.ValidateJWT(true, accessToken, "mcp-audience"); err != nil {
+		t.Errorf("Expected embedded token to validate: %v", err)
+	}
+
+	// Codes are single use
+	if w := postForm(endpoints["/token"], "/token", tokenReq); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected code reuse to fail, got %v", w.Code)
+	}
+
+	// A wrong verifier fails PKCE
+	w = postForm(endpoints["/authorize"], "/authorize", login)
+	location, _ = url.Parse(w.Header().Get("Location"))
+	tokenReq.Set("code", location.Query().Get("code"))
+	tokenReq.Set("code_verifier", "not-the-verifier-that-was-used-for-the-challenge")
+	if w := postForm(endpoints["/token"], "/token", tokenReq); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected wrong code_verifier to fail, got %v", w.Code)
+	}
+
+	// Refresh tokens are rotated
+	refresh := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens["refresh_token"].(string)},
+		"client_id":     {clientID},
+	}
+	if w := postForm(endpoints["/token"], "/token", refresh); w.Code != http.StatusOK {
+		t.Fatalf("Expected refresh to succeed, got %v: %s", w.Code, w.Body.String())
+	}
+	if w := postForm(endpoints["/token"], "/token", refresh); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected refresh token reuse to fail, got %v", w.Code)
+	}
+}
+
+func TestEmbeddedAuthorizeRequiresPKCE(t *testing.T) {
+	p := newTestEmbeddedProvider(t)
+	p.clients["c1"] = &embeddedClient{ClientID: "c1", RedirectURIs: []string{"http://localhost/cb"}}
+
+	q := url.Values{
+		"client_id":     {"c1"},
+		"redirect_uri":  {"http://localhost/cb"},
+		"response_type": {"code"},
+	}
+	w := httptest.NewRecorder()
+	p.Endpoints()["/authorize"](w, httptest.NewRequest("GET", "/authorize?"+q.Encode(), nil))
+	if w.Code != http.StatusFound || !strings.Contains(w.Header().Get("Location"), "error=invalid_request") {
+		t.Errorf("Expected invalid_request redirect without PKCE, got %v %s", w.Code, w.Header().Get("Location"))
+	}
+
+	q.Set("redirect_uri", "http://evil.example.com/cb")
+	w = httptest.NewRecorder()
+	p.Endpoints()["/authorize"](w, httptest.NewRequest("GET", "/authorize?"+q.Encode(), nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected unregistered redirect_uri to be rejected without redirect, got %v", w.Code)
+	}
+}
+
+func TestEmbeddedRegisterRedirectSchemes(t *testing.T) {
+	p := newTestEmbeddedProvider(t)
+
+	for uri, allowed := range map[string]bool{
+		"https://app.example.com/cb":      true,
+		"http://localhost:6274/callback":  true,
+		"http://127.0.0.1:8000/cb":        true,
+		"http://[::1]/cb":                 true,
+		"com.example.app:/oauth2redirect": true,
+		"http://app.example.com/cb":       false,
+		"javascript:alert(1)":             false,
+		"data:text/html,hi":               false,
+		"myapp://cb":                      false,
+	} {
+		body, _ := json.Marshal(map[string]interface{}{"redirect_uris": []string{uri}})
+		w := httptest.NewRecorder()
+		p.RegisterHandler()(w, httptest.NewRequest("POST", "/register", strings.NewReader(string(body))))
+		if got := w.Code == http.StatusCreated; got != allowed {
+			t.Errorf("Redirect URI %q: expected allowed=%v, got status %d", uri, allowed, w.Code)
+		}
+	}
+}
+
+func TestEmbeddedLoginIsThrottledAndNotFramed(t *testing.T) {
+	p := newTestEmbeddedProvider(t)
+	p.clients["c1"] = &embeddedClient{ClientID: "c1", RedirectURIs: []string{"http://localhost/cb"}}
+	form := url.Values{
+		"client_id":             {"c1"},
+		"redirect_uri":          {"http://localhost/cb"},
+		"response_type":         {"code"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+		"username":              {"alice"},
+	}
+	login := func(password string) *httptest.ResponseRecorder {
+		form.Set("password", password)
+		return postForm(p.Endpoints()["/authorize"], "/authorize", form)
+	}
+
+	w := httptest.NewRecorder()
+	p.Endpoints()["/authorize"](w, httptest.NewRequest("GET", "/authorize?"+form.Encode(), nil))
+	if w.Header().Get("X-Frame-Options") != "DENY" || w.Header().Get("Content-Security-Policy") != "frame-ancestors 'none'" {
+		t.Errorf("Expected the login page to forbid framing, got %v", w.Header())
+	}
+
+	for i := 0; i < maxLoginFailures; i++ {
+		if w := login("wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected failed sign-in %d to be rejected, got %v", i+1, w.Code)
+		}
+	}
+	// Even the right password is refused until the lockout ends
+	if w := login("secret"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected sign-in to be refused after repeated failures, got %v", w.Code)
+	}
+
+	now := time.Now().Add(loginLockout)
+	p.logins.now = func() time.Time { return now }
+	if w := login("secret"); w.Code != http.StatusFound {
+		t.Errorf("Expected sign-in after the lockout, got %v", w.Code)
+	}
+}
+
+func TestEmbeddedRegistrationIsBounded(t *testing.T) {
+	p := newTestEmbeddedProvider(t)
+	p.maxClients = 2
+	register := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/register", strings.NewReader(`{"redirect_uris":["http://localhost/cb"]}`))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		p.RegisterHandler()(w, req)
+		return w
+	}
+
+	// Clients that were never used make room for new ones
+	for i := 0; i < 3; i++ {
+		if w := register("198.51.100.1:1234"); w.Code != http.StatusCreated {
+			t.Fatalf("Expected registration %d to succeed, got %v", i+1, w.Code)
+		}
+	}
+	if len(p.clients) != 2 {
+		t.Fatalf("Expected 2 clients, got %d", len(p.clients))
+	}
+	for _, c := range p.clients {
+		c.used = true
+	}
+	if w := register("198.51.100.2:1234"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected registration to be refused when all clients are in use, got %v", w.Code)
+	}
+
+	// Each address gets a burst of registrations
+	p.maxClients = maxRegisteredClients
+	for i := 3; i < registrationBurst; i++ {
+		register("198.51.100.1:1234")
+	}
+	if w := register("198.51.100.1:1234"); w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expected the address to be throttled, got %v", w.Code)
+	}
+}
@@ -0,0 +1,214 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// Grant types that Keycloak accepts through OIDC client registration
+var keycloakGrantTypes = map[string]bool{
+	"authorization_code": true,
+	"refresh_token":      true,
+	"client_credentials": true,
+}
+
+type keycloakProvider struct {
+	*oidcProvider
+	kc config.KeycloakConfig
+}
+
+// NewKeycloakProvider initializes a Provider for a Keycloak realm. Metadata is
+// discovered from the realm, and /register uses Keycloak's client registration service.
+func NewKeycloakProvider(ctx context.Context, cfg *config.Config) (Provider, error) {
+	kc := cfg.Keycloak
+	if kc.BaseURL == "" || kc.Realm == "" {
+		return nil, fmt.Errorf("keycloak.base_url and keycloak.realm are required")
+	}
+
+	issuer := strings.TrimSuffix(kc.BaseURL, "/") + "/realms/" + kc.Realm
+	base, err := newOIDCProvider(cfg, config.OIDCConfig{
+		Issuer:                 issuer,
+		RefreshIntervalSeconds: kc.RefreshIntervalSeconds,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	p := &keycloakProvider{oidcProvider: base, kc: kc}
+	p.startRefresh(ctx, kc.RefreshIntervalSeconds)
+	return p, nil
+}
+
+// registrationEndpoint returns the realm's OIDC client registration endpoint
+func (p *keycloakProvider) registrationEndpoint() string {
+	p.mu.RLock()
+	endpoint, _ := p.metadata["registration_endpoint"].(string)
+	p.mu.RUnlock()
+	if endpoint == "" {
+		endpoint = strings.TrimSuffix(p.kc.BaseURL, "/") + "/realms/" + p.kc.Realm + "/clients-registrations/openid-connect"
+	}
+	return endpoint
+}
+
+func (p *keycloakProvider) RegisterHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var regReq map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&regReq); err != nil {
+			logger.Error("Reading register request: %v", err)
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if uris, _ := regReq["redirect_uris"].([]interface{}); len(uris) == 0 {
+			http.Error(w, "redirect_uris is required", http.StatusBadRequest)
+			return
+		}
+
+		status, body, err := p.registerClient(buildKeycloakPayload(regReq))
+		if err != nil {
+			logger.Warn("Keycloak client registration failed: %v", err)
+			http.Error(w, "Failed to register client in Keycloak", http.StatusBadGateway)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+	}
+}
+
+// registerClient posts the registration to Keycloak and returns its response.
+// Keycloak's responses are RFC 7591 compliant, so they are relayed unchanged.
+func (p *keycloakProvider) registerClient(payload map[string]interface{}) (int, []byte, error) {
+	reqBytes, err := json.Marshal(payload)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to marshal registration request: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, p.registrationEndpoint(), bytes.NewReader(reqBytes))
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create registration request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.kc.InitialAccessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+p.kc.InitialAccessToken)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("keycloak registration call failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read registration response: %w", err)
+	}
+	if resp.StatusCode >= 500 {
+		return 0, nil, fmt.Errorf("keycloak registration error (%d): %s", resp.StatusCode, string(body))
+	}
+	if resp.StatusCode < 300 {
+		logger.Info("Registered Keycloak client in realm %s", p.kc.Realm)
+	}
+	return resp.StatusCode, body, nil
+}
+
+// buildKeycloakPayload maps an RFC 7591 registration request onto the subset of
+// client metadata Keycloak's OIDC registration endpoint supports.
+func buildKeycloakPayload(regReq map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{
+		"redirect_uris": regReq["redirect_uris"],
+	}
+
+	for _, field := range []string{"client_name", "response_types", "token_endpoint_auth_method", "client_uri", "logo_uri"} {
+		if v, ok := regReq[field]; ok {
+			payload[field] = v
+		}
+	}
+
+	grantTypes := []string{}
+	if requested, ok := regReq["grant_types"].([]interface{}); ok {
+		for _, gt := range requested {
+			if s, ok := gt.(string); ok && keycloakGrantTypes[s] {
+				grantTypes = append(grantTypes, s)
+			}
+		}
+	}
+	if len(grantTypes) == 0 {
+		grantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	payload["grant_types"] = grantTypes
+
+	// Keycloak expects a space-separated scope string
+	switch scope := regReq["scope"].(type) {
+	case string:
+		payload["scope"] = scope
+	case []interface{}:
+		var scopes []string
+		for _, s := range scope {
+			if str, ok := s.(string); ok {
+				scopes = append(scopes, str)
+			}
+		}
+		payload["scope"] = strings.Join(scopes, " ")
+	}
+
+	// MCP clients are typically public clients using PKCE
+	if _, ok := payload["token_endpoint_auth_method"]; !ok {
+		payload["token_endpoint_auth_method"] = "none"
+	}
+	return payload
+}
+
+// MapScopes grants the realm roles and the roles of the configured client (or of
+// the audience client by default) from realm_access and resource_access.
+func (p *keycloakProvider) MapScopes(claims jwt.MapClaims) []string {
+	roles := rolesFrom(claims["realm_access"])
+
+	clientID := p.kc.RolesClientID
+	if clientID == "" {
+		clientID = p.cfg.ProtectedResourceMetadata.Audience
+	}
+	if resourceAccess, ok := claims["resource_access"].(map[string]interface{}); ok && clientID != "" {
+		roles = append(roles, rolesFrom(resourceAccess[clientID])...)
+	}
+	return roles
+}
+
+// rolesFrom reads the "roles" array of a Keycloak access claim
+func rolesFrom(access interface{}) []string {
+	m, ok := access.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	list, _ := m["roles"].([]interface{})
+
+	var roles []string
+	for _, role := range list {
+		if s, ok := role.(string); ok && s != "" {
+			roles = append(roles, s)
+		}
+	}
+	return roles
+}
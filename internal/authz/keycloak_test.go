@@ -0,0 +1,136 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// newStubKeycloak serves realm discovery and the OIDC client registration service
+func newStubKeycloak(t *testing.T, registrations *[]map[string]interface{}) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/realms/mcp/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer := server.URL + "/realms/mcp"
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                 issuer,
+			"authorization_endpoint": issuer + "/protocol/openid-connect/auth",
+			"token_endpoint":         issuer + "/protocol/openid-connect/token",
+			"registration_endpoint":  issuer + "/clients-registrations/openid-connect",
+			"jwks_uri":               issuer + "/protocol/openid-connect/certs",
+		})
+	})
+	mux.HandleFunc("/realms/mcp/clients-registrations/openid-connect", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer initial-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_token"})
+			return
+		}
+		var payload map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&payload)
+		*registrations = append(*registrations, payload)
+
+		payload["client_id"] = "kc-client-1"
+		payload["registration_access_token"] = "rat"
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(payload)
+	})
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestKeycloakProviderRegister(t *testing.T) {
+	var registrations []map[string]interface{}
+	kc := newStubKeycloak(t, &registrations)
+
+	cfg := &config.Config{
+		Keycloak: config.KeycloakConfig{BaseURL: kc.URL, Realm: "mcp", InitialAccessToken: "initial-token"},
+	}
+	provider, err := NewKeycloakProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewKeycloakProvider failed: %v", err)
+	}
+
+	body := `{"client_name":"inspector","redirect_uris":["http://localhost:6274/callback"],` +
+		`"grant_types":["authorization_code","refresh_token","implicit"],"scope":["openid","mcp_init"]}`
+	w := httptest.NewRecorder()
+	provider.RegisterHandler()(w, httptest.NewRequest("POST", "/register", strings.NewReader(body)))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected status Created, got %v: %s", w.Code, w.Body.String())
+	}
+	var resp map[string]interface{}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp["client_id"] != "kc-client-1" {
+		t.Errorf("Expected client_id from Keycloak, got %v", resp["client_id"])
+	}
+
+	if len(registrations) != 1 {
+		t.Fatalf("Expected 1 registration at Keycloak, got %d", len(registrations))
+	}
+	sent := registrations[0]
+	if sent["scope"] != "openid mcp_init" {
+		t.Errorf("Expected space-separated scope, got %v", sent["scope"])
+	}
+	if grants, _ := sent["grant_types"].([]interface{}); len(grants) != 2 {
+		t.Errorf("Expected unsupported grant types to be dropped, got %v", sent["grant_types"])
+	}
+	if sent["token_endpoint_auth_method"] != "none" {
+		t.Errorf("Expected public client by default, got %v", sent["token_endpoint_auth_method"])
+	}
+}
+
+func TestKeycloakProviderRegisterRequiresRedirectURIs(t *testing.T) {
+	var registrations []map[string]interface{}
+	kc := newStubKeycloak(t, &registrations)
+
+	provider, err := NewKeycloakProvider(context.Background(), &config.Config{
+		Keycloak: config.KeycloakConfig{BaseURL: kc.URL, Realm: "mcp"},
+	})
+	if err != nil {
+		t.Fatalf("NewKeycloakProvider failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	provider.RegisterHandler()(w, httptest.NewRequest("POST", "/register", strings.NewReader(`{"client_name":"x"}`)))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected status BadRequest, got %v", w.Code)
+	}
+}
+
+func TestKeycloakMapScopes(t *testing.T) {
+	var registrations []map[string]interface{}
+	kc := newStubKeycloak(t, &registrations)
+
+	cfg := &config.Config{
+		Keycloak:                  config.KeycloakConfig{BaseURL: kc.URL, Realm: "mcp"},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp-server"},
+	}
+	provider, err := NewKeycloakProvider(context.Background(), cfg)
+	if err != nil {
+		t.Fatalf("NewKeycloakProvider failed: %v", err)
+	}
+
+	claims := jwt.MapClaims{
+		"realm_access": map[string]interface{}{"roles": []interface{}{"mcp_init"}},
+		"resource_access": map[string]interface{}{
+			"mcp-server": map[string]interface{}{"roles": []interface{}{"mcp_echo_tool"}},
+			"other":      map[string]interface{}{"roles": []interface{}{"admin"}},
+		},
+	}
+	scopes := provider.(ScopeMapper).MapScopes(claims)
+	if strings.Join(scopes, " ") != "mcp_init mcp_echo_tool" {
+		t.Errorf("Expected realm and audience client roles, got %v", scopes)
+	}
+}
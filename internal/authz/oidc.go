@@ -0,0 +1,338 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+const defaultMetadataRefreshInterval = time.Hour
+
+// Endpoints of the authorization server that the proxy fronts, mapped from the
+// proxy path to the metadata field that locates them upstream.
+var proxiedEndpoints = map[string]string{
+	"/authorize": "authorization_endpoint",
+	"/token":     "token_endpoint",
+	"/register":  "registration_endpoint",
+}
+
+type oidcProvider struct {
+	cfg    *config.Config
+	oidc   config.OIDCConfig
+	client *http.Client
+
+	mu       sync.RWMutex
+	metadata map[string]interface{}
+	// Proxy paths whose upstream endpoint shares the issuer host and can be proxied
+	proxied map[string]bool
+	// Upstream paths of the proxied endpoints
+	paths map[string]string
+	// Proxy paths mapped in config.yaml, which take precedence over discovery
+	configured map[string]bool
+}
+
+// NewOIDCProvider initializes a Provider for any OpenID Connect or RFC 8414
+// compliant authorization server, configured through metadata discovery.
+func NewOIDCProvider(ctx context.Context, cfg *config.Config) (Provider, error) {
+	p, err := newOIDCProvider(cfg, cfg.OIDC)
+	if err != nil {
+		return nil, err
+	}
+	p.startRefresh(ctx, cfg.OIDC.RefreshIntervalSeconds)
+	return p, nil
+}
+
+// newOIDCProvider discovers the authorization server and points the proxy at it.
+// IdP-specific providers build on it without starting the refresh loop twice.
+func newOIDCProvider(cfg *config.Config, oidcCfg config.OIDCConfig) (*oidcProvider, error) {
+	if oidcCfg.Issuer == "" && oidcCfg.DiscoveryURL == "" {
+		return nil, fmt.Errorf("oidc.issuer is required")
+	}
+
+	p := &oidcProvider{
+		cfg:    cfg,
+		oidc:   oidcCfg,
+		client: httpclient.Client(httpclient.DestinationIdP),
+	}
+
+	metadata, err := p.discover(oidcCfg)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.apply(metadata); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// discover fetches the authorization server metadata, trying OpenID Connect
+// discovery first and RFC 8414 metadata second.
+func (p *oidcProvider) discover(oidcCfg config.OIDCConfig) (map[string]interface{}, error) {
+	var candidates []string
+	if oidcCfg.DiscoveryURL != "" {
+		candidates = []string{oidcCfg.DiscoveryURL}
+	} else {
+		candidates = discoveryURLs(oidcCfg.Issuer)
+	}
+
+	var lastErr error
+	for _, u := range candidates {
+		metadata, err := p.fetchMetadata(u)
+		if err != nil {
+			logger.Debug("Metadata discovery at %s failed: %v", u, err)
+			lastErr = err
+			continue
+		}
+
+		issuer, _ := metadata["issuer"].(string)
+		if oidcCfg.Issuer != "" && strings.TrimSuffix(issuer, "/") != strings.TrimSuffix(oidcCfg.Issuer, "/") {
+			lastErr = fmt.Errorf("issuer %q in %s does not match configured issuer %q", issuer, u, oidcCfg.Issuer)
+			continue
+		}
+		logger.Info("Discovered authorization server metadata at %s", u)
+		return metadata, nil
+	}
+	return nil, fmt.Errorf("authorization server metadata discovery failed: %w", lastErr)
+}
+
+// discoveryURLs lists the well-known metadata locations for an issuer
+func discoveryURLs(issuer string) []string {
+	issuer = strings.TrimSuffix(issuer, "/")
+	urls := []string{issuer + "/.well-known/openid-configuration"}
+
+	// RFC 8414 inserts the well-known segment between the host and the issuer path
+	if u, err := url.Parse(issuer); err == nil && u.Path != "" {
+		urls = append(urls, u.Scheme+"://"+u.Host+"/.well-known/oauth-authorization-server"+u.Path)
+	}
+	return append(urls, issuer+"/.well-known/oauth-authorization-server")
+}
+
+func (p *oidcProvider) fetchMetadata(metadataURL string) (map[string]interface{}, error) {
+	resp, err := p.client.Get(metadataURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var metadata map[string]interface{}
+	if err := json.NewDecoder(resp.Body).Decode(&metadata); err != nil {
+		return nil, fmt.Errorf("invalid metadata document: %w", err)
+	}
+	if _, ok := metadata["issuer"].(string); !ok {
+		return nil, fmt.Errorf("metadata document has no issuer")
+	}
+	return metadata, nil
+}
+
+// apply points the proxy at the discovered endpoints. Endpoints on the issuer
+// host are proxied through path mappings; the JWKS URI is used for validation.
+func (p *oidcProvider) apply(metadata map[string]interface{}) error {
+	issuerURL, jwksURI, err := p.update(metadata)
+	if err != nil {
+		return err
+	}
+
+	p.cfg.AuthServerBaseURL = issuerURL.Scheme + "://" + issuerURL.Host
+	p.cfg.JWKSURL = jwksURI
+	if p.cfg.ProtectedResourceMetadata.JwksURI == "" {
+		p.cfg.ProtectedResourceMetadata.JwksURI = jwksURI
+	}
+
+	// The mappings register the proxy routes; later changes are served through MapPath
+	if p.cfg.PathMapping == nil {
+		p.cfg.PathMapping = make(map[string]string)
+	}
+	p.configured = make(map[string]bool)
+	for path := range p.cfg.PathMapping {
+		p.configured[path] = true
+	}
+	for path, upstream := range p.paths {
+		if !p.configured[path] {
+			p.cfg.PathMapping[path] = upstream
+		}
+	}
+	return nil
+}
+
+// update records the discovered metadata and the endpoints it locates on the
+// issuer host, and returns the issuer and JWKS URI
+func (p *oidcProvider) update(metadata map[string]interface{}) (*url.URL, string, error) {
+	issuer, _ := metadata["issuer"].(string)
+	issuerURL, err := url.Parse(issuer)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid issuer %q: %w", issuer, err)
+	}
+
+	jwksURI, _ := metadata["jwks_uri"].(string)
+	if jwksURI == "" {
+		return nil, "", fmt.Errorf("metadata for %s has no jwks_uri", issuer)
+	}
+
+	proxied := make(map[string]bool)
+	paths := make(map[string]string)
+	for path, field := range proxiedEndpoints {
+		endpoint, _ := metadata[field].(string)
+		if endpoint == "" {
+			continue
+		}
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Host != issuerURL.Host {
+			// Endpoints on other hosts are published as-is
+			continue
+		}
+		proxied[path] = true
+		paths[path] = u.Path
+	}
+
+	p.mu.Lock()
+	p.metadata = metadata
+	p.proxied = proxied
+	p.paths = paths
+	p.mu.Unlock()
+	return issuerURL, jwksURI, nil
+}
+
+// MapPath returns the upstream path of a proxied endpoint as last discovered
+func (p *oidcProvider) MapPath(path string) (string, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.configured[path] {
+		return "", false
+	}
+	upstream, ok := p.paths[path]
+	return upstream, ok
+}
+
+// TokenEndpoint returns the token endpoint as last discovered
+func (p *oidcProvider) TokenEndpoint() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	endpoint, _ := p.metadata["token_endpoint"].(string)
+	return endpoint
+}
+
+// startRefresh periodically re-fetches metadata and signing keys so that
+// key rotation and endpoint changes at the IdP are picked up, until ctx is done.
+func (p *oidcProvider) startRefresh(ctx context.Context, seconds int) {
+	interval := defaultMetadataRefreshInterval
+	if seconds > 0 {
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				p.refresh()
+			}
+		}
+	}()
+}
+
+func (p *oidcProvider) refresh() {
+	metadata, err := p.discover(p.oidc)
+	if err != nil {
+		logger.Warn("Failed to refresh authorization server metadata: %v", err)
+		return
+	}
+
+	_, jwksURI, err := p.update(metadata)
+	if err != nil {
+		logger.Warn("Ignoring refreshed authorization server metadata: %v", err)
+		return
+	}
+	if err := util.FetchJWKS(jwksURI); err != nil {
+		logger.Warn("Failed to refresh JWKS from %s: %v", jwksURI, err)
+	}
+}
+
+// publishedMetadata returns the discovered metadata with proxied endpoints
+// rewritten to point at the proxy.
+func (p *oidcProvider) publishedMetadata(r *http.Request) map[string]interface{} {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	baseURL := p.cfg.PublicBaseURL()
+	published := make(map[string]interface{}, len(p.metadata))
+	for k, v := range p.metadata {
+		published[k] = v
+	}
+	for path, field := range proxiedEndpoints {
+		if p.proxied[path] {
+			published[field] = baseURL + path
+		}
+	}
+	if p.cfg.ClientMetadata.Enabled && p.proxied["/authorize"] {
+		published["client_id_metadata_document_supported"] = true
+	}
+	return published
+}
+
+func (p *oidcProvider) WellKnownHandler() http.HandlerFunc {
+	return p.metadataHandler(p.publishedMetadata)
+}
+
+// metadataHandler serves an authorization server metadata document
+func (p *oidcProvider) metadataHandler(build func(r *http.Request) map[string]interface{}) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(build(r)); err != nil {
+			logger.Error("Error encoding well-known response: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
+
+// RegisterHandler returns nil; /register is proxied to the discovered
+// registration endpoint when the IdP supports dynamic client registration.
+func (p *oidcProvider) RegisterHandler() http.HandlerFunc {
+	return nil
+}
+
+func (p *oidcProvider) ProtectedResourceMetadataHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		meta := buildProtectedResourceMetadata(p.cfg)
+		if len(p.cfg.ProtectedResourceMetadata.AuthorizationServers) == 0 {
+			// The proxy republishes the authorization server metadata itself
+			meta["authorization_servers"] = []string{p.cfg.PublicBaseURL()}
+		}
+		if err := json.NewEncoder(w).Encode(meta); err != nil {
+			http.Error(w, "failed to encode metadata", http.StatusInternalServerError)
+		}
+	}
+}
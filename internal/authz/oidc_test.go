@@ -0,0 +1,140 @@
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// newStubIdP serves OpenID Connect discovery for an issuer with a path, the way Keycloak does
+func newStubIdP(t *testing.T, openIDConfiguration bool) *httptest.Server {
+	t.Helper()
+	var server *httptest.Server
+	mux := http.NewServeMux()
+	metadata := func(w http.ResponseWriter, r *http.Request) {
+		issuer := server.URL + "/realms/mcp"
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                           issuer,
+			"authorization_endpoint":           issuer + "/protocol/openid-connect/auth",
+			"token_endpoint":                   issuer + "/protocol/openid-connect/token",
+			"registration_endpoint":            issuer + "/clients-registrations/openid-connect",
+			"jwks_uri":                         issuer + "/protocol/openid-connect/certs",
+			"code_challenge_methods_supported": []string{"S256"},
+		})
+	}
+	if openIDConfiguration {
+		mux.HandleFunc("/realms/mcp/.well-known/openid-configuration", metadata)
+	} else {
+		mux.HandleFunc("/.well-known/oauth-authorization-server/realms/mcp", metadata)
+	}
+	server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestOIDCProviderDiscovery(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		openIDConf bool
+	}{
+		{"OpenID Connect discovery", true},
+		{"RFC 8414 metadata", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			idp := newStubIdP(t, tc.openIDConf)
+			cfg := &config.Config{
+				ProxyBaseURL: "https://proxy.example.com",
+				OIDC:         config.OIDCConfig{Issuer: idp.URL + "/realms/mcp"},
+			}
+
+			provider, err := NewOIDCProvider(context.Background(), cfg)
+			if err != nil {
+				t.Fatalf("NewOIDCProvider failed: %v", err)
+			}
+
+			if cfg.AuthServerBaseURL != idp.URL {
+				t.Errorf("Expected AuthServerBaseURL=%s, got %s", idp.URL, cfg.AuthServerBaseURL)
+			}
+			if cfg.JWKSURL != idp.URL+"/realms/mcp/protocol/openid-connect/certs" {
+				t.Errorf("Unexpected JWKSURL %s", cfg.JWKSURL)
+			}
+			if cfg.PathMapping["/token"] != "/realms/mcp/protocol/openid-connect/token" {
+				t.Errorf("Unexpected /token mapping %q", cfg.PathMapping["/token"])
+			}
+
+			w := httptest.NewRecorder()
+			provider.WellKnownHandler()(w, httptest.NewRequest("GET", "/.well-known/oauth-authorization-server", nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("Expected status OK, got %v", w.Code)
+			}
+			var published map[string]interface{}
+			if err := json.NewDecoder(w.Body).Decode(&published); err != nil {
+				t.Fatalf("Failed to decode metadata: %v", err)
+			}
+			if published["authorization_endpoint"] != "https://proxy.example.com/authorize" {
+				t.Errorf("Expected authorization endpoint on the proxy, got %v", published["authorization_endpoint"])
+			}
+			if published["registration_endpoint"] != "https://proxy.example.com/register" {
+				t.Errorf("Expected registration endpoint on the proxy, got %v", published["registration_endpoint"])
+			}
+			if published["jwks_uri"] != cfg.JWKSURL {
+				t.Errorf("Expected upstream jwks_uri, got %v", published["jwks_uri"])
+			}
+		})
+	}
+}
+
+func TestOIDCProviderIssuerMismatch(t *testing.T) {
+	idp := newStubIdP(t, true)
+	cfg := &config.Config{
+		OIDC: config.OIDCConfig{
+			Issuer:       "https://other.example.com/realms/mcp",
+			DiscoveryURL: idp.URL + "/realms/mcp/.well-known/openid-configuration",
+		},
+	}
+	if _, err := NewOIDCProvider(context.Background(), cfg); err == nil {
+		t.Errorf("Expected issuer mismatch to fail discovery")
+	}
+}
+
+func TestOIDCProviderRefreshAppliesEndpoints(t *testing.T) {
+	tokenPath := "/oauth2/token"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":         server.URL,
+			"token_endpoint": server.URL + tokenPath,
+			"jwks_uri":       server.URL + "/jwks",
+		})
+	}))
+	defer server.Close()
+
+	cfg := &config.Config{
+		OIDC:        config.OIDCConfig{Issuer: server.URL},
+		PathMapping: map[string]string{"/authorize": "/custom/authorize"},
+	}
+	p, err := newOIDCProvider(cfg, cfg.OIDC)
+	if err != nil {
+		t.Fatalf("newOIDCProvider failed: %v", err)
+	}
+	if cfg.PathMapping["/token"] != "/oauth2/token" {
+		t.Errorf("Expected the discovered token path to be mapped, got %q", cfg.PathMapping["/token"])
+	}
+
+	tokenPath = "/v2/token"
+	p.refresh()
+	if path, ok := p.MapPath("/token"); !ok || path != "/v2/token" {
+		t.Errorf("Expected the refreshed token path, got %q (%v)", path, ok)
+	}
+	if _, ok := p.MapPath("/authorize"); ok {
+		t.Errorf("Expected configured path mappings to take precedence")
+	}
+	if endpoint := p.TokenEndpoint(); endpoint != server.URL+"/v2/token" {
+		t.Errorf("Expected the refreshed token endpoint, got %q", endpoint)
+	}
+}
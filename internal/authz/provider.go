@@ -1,6 +1,16 @@
 package authz
 
-import "net/http"
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+)
 
 // Provider is an interface describing how each auth provider
 // will handle /.well-known/oauth-authorization-server and /register
@@ -9,3 +19,126 @@ type Provider interface {
 	RegisterHandler() http.HandlerFunc
 	ProtectedResourceMetadataHandler() http.HandlerFunc
 }
+
+// EndpointProvider is implemented by providers that serve OAuth endpoints such as
+// /authorize and /token themselves instead of proxying them to an IdP.
+type EndpointProvider interface {
+	Endpoints() map[string]http.HandlerFunc
+}
+
+// PathMapper is implemented by providers whose upstream endpoint paths can change
+// while the proxy runs, for example when metadata discovery is repeated.
+type PathMapper interface {
+	MapPath(path string) (string, bool)
+}
+
+// TokenEndpointer is implemented by providers that discover the token endpoint
+// of the authorization server, which other paths than /token may use.
+type TokenEndpointer interface {
+	TokenEndpoint() string
+}
+
+// ScopeMapper is implemented by providers whose tokens carry permissions in
+// claims other than "scope". The mapped values are treated as granted scopes.
+type ScopeMapper interface {
+	MapScopes(claims jwt.MapClaims) []string
+}
+
+// ClientResolver translates client IDs issued by the proxy into the upstream
+// IdP clients they map onto. It returns nil for client IDs it does not manage.
+type ClientResolver interface {
+	ResolveClient(clientID string) (*ResolvedClient, error)
+}
+
+// validRedirectURI reports whether a client may register the redirect URI. Following
+// RFC 8252, it must be an https URL, an http URL on a loopback address for native
+// apps, or use a private-use scheme named after a reverse domain such as com.example.app.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Fragment != "" {
+		return false
+	}
+	switch scheme := strings.ToLower(u.Scheme); scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	default:
+		return strings.Contains(scheme, ".")
+	}
+}
+
+// buildProtectedResourceMetadata builds the RFC 9728 protected resource metadata document
+func buildProtectedResourceMetadata(cfg *config.Config) map[string]interface{} {
+	// Extract only the values into a []string
+	var supportedScopes []string
+	var extractStrings func(interface{})
+	extractStrings = func(val interface{}) {
+		switch v := val.(type) {
+		case string:
+			supportedScopes = append(supportedScopes, v)
+		case []any:
+			for _, item := range v {
+				extractStrings(item)
+			}
+		case map[string]any:
+			for _, item := range v {
+				extractStrings(item)
+			}
+		case map[interface{}]interface{}:
+			for _, item := range v {
+				extractStrings(item)
+			}
+		}
+	}
+	for _, m := range cfg.ProtectedResourceMetadata.ScopesSupported {
+		for _, v := range m {
+			extractStrings(v)
+		}
+	}
+
+	meta := map[string]interface{}{
+		"resource":              cfg.ProtectedResourceMetadata.ResourceIdentifier,
+		"scopes_supported":      supportedScopes,
+		"authorization_servers": cfg.ProtectedResourceMetadata.AuthorizationServers,
+	}
+
+	addOptionalResourceMetadata(meta, cfg)
+	return meta
+}
+
+// addOptionalResourceMetadata adds the protected resource metadata fields that
+// are only published when configured, including the sender-constrained tokens
+// the proxy accepts: certificate-bound (RFC 8705) and DPoP-bound (RFC 9449)
+func addOptionalResourceMetadata(meta map[string]interface{}, cfg *config.Config) {
+	if cfg.ProtectedResourceMetadata.JwksURI != "" {
+		meta["jwks_uri"] = cfg.ProtectedResourceMetadata.JwksURI
+	}
+	if len(cfg.ProtectedResourceMetadata.BearerMethodsSupported) > 0 {
+		meta["bearer_methods_supported"] = cfg.ProtectedResourceMetadata.BearerMethodsSupported
+	}
+	if cfg.TLS.CertificateBoundTokens {
+		meta["tls_client_certificate_bound_access_tokens"] = true
+	}
+	if cfg.DPoP.Enabled {
+		meta["dpop_signing_alg_values_supported"] = dpop.Algorithms(cfg.DPoP)
+		meta["dpop_bound_access_tokens_required"] = cfg.DPoP.Required
+	}
+}
+
+// ProtectedResourceMetadataHandler serves the protected resource metadata of
+// cfg. It is used for servers mounted in gateway mode, which are resources of
+// their own rather than the provider's.
+func ProtectedResourceMetadataHandler(cfg *config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(buildProtectedResourceMetadata(cfg)); err != nil {
+			http.Error(w, "failed to encode metadata", http.StatusInternalServerError)
+		}
+	}
+}
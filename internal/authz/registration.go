@@ -0,0 +1,479 @@
+package authz
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/ratelimit"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+const registeredClientPrefix = "client:"
+
+// Registration is open, so the registered clients are bounded: each address
+// can register a burst of clients and then one a minute, clients that are
+// never used are dropped after a day, and others after 90 days without use.
+const (
+	maxRegisteredClients = 10000
+	registrationBurst    = 10
+	unusedClientTTL      = 24 * time.Hour
+	idleClientTTL        = 90 * 24 * time.Hour
+	// clientUseInterval limits how often the last use of a client is saved
+	clientUseInterval = 24 * time.Hour
+)
+
+// Client authentication methods accepted for proxy-issued clients
+var registrationAuthMethods = map[string]bool{
+	"none":                true,
+	"client_secret_post":  true,
+	"client_secret_basic": true,
+}
+
+// ResolvedClient is a client known to the proxy, together with the upstream
+// IdP client that requests on its behalf are sent as
+type ResolvedClient struct {
+	ClientID             string
+	RedirectURIs         []string
+	SecretHash           string // Empty for public clients
+	UpstreamClientID     string // Empty when the client ID is forwarded unchanged
+	UpstreamClientSecret string
+	UpstreamAuthMethod   string
+}
+
+// AllowsRedirect reports whether the redirect URI was registered for the client
+func (c *ResolvedClient) AllowsRedirect(redirectURI string) bool {
+	return containsString(c.RedirectURIs, redirectURI)
+}
+
+// VerifySecret checks a client secret presented at the token endpoint.
+// Public clients need no secret.
+func (c *ResolvedClient) VerifySecret(secret string) bool {
+	if c.SecretHash == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(c.SecretHash)) == 1
+}
+
+// RegisteredClient is a client registered at the proxy through RFC 7591
+type RegisteredClient struct {
+	ClientID                string   `json:"client_id"`
+	ClientName              string   `json:"client_name,omitempty"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope,omitempty"`
+	ClientURI               string   `json:"client_uri,omitempty"`
+	LogoURI                 string   `json:"logo_uri,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+
+	SecretHash            string `json:"secret_hash,omitempty"`
+	RegistrationTokenHash string `json:"registration_token_hash"`
+	UpstreamClientID      string `json:"upstream_client_id,omitempty"`
+	LastUsedAt            int64  `json:"last_used_at,omitempty"`
+}
+
+// ClientRegistry implements RFC 7591 dynamic client registration and RFC 7592
+// client management at the proxy. Registered clients are mapped onto clients
+// pre-provisioned at the upstream IdP.
+type ClientRegistry struct {
+	cfg        *config.Config
+	upstream   []config.UpstreamClient
+	store      store.Store
+	limiter    *ratelimit.Limiter // Registrations per address
+	maxClients int
+	unusedTTL  time.Duration
+	idleTTL    time.Duration
+}
+
+// NewClientRegistry creates a registry backed by the configured store
+func NewClientRegistry(cfg *config.Config) (*ClientRegistry, error) {
+	reg := cfg.Default.Registration
+	for _, uc := range reg.UpstreamClients {
+		if uc.ClientID == "" {
+			return nil, fmt.Errorf("upstream_clients entries require a client_id")
+		}
+		if uc.AuthMethod != "" && uc.AuthMethod != "client_secret_post" && uc.AuthMethod != "client_secret_basic" {
+			return nil, fmt.Errorf("unsupported auth_method %q for upstream client %s", uc.AuthMethod, uc.ClientID)
+		}
+	}
+
+	s, err := store.New(reg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open client registration store: %w", err)
+	}
+	limiter, err := newRegistrationLimiter()
+	if err != nil {
+		return nil, err
+	}
+	return &ClientRegistry{
+		cfg:        cfg,
+		upstream:   reg.UpstreamClients,
+		store:      s,
+		limiter:    limiter,
+		maxClients: maxRegisteredClients,
+		unusedTTL:  unusedClientTTL,
+		idleTTL:    idleClientTTL,
+	}, nil
+}
+
+// ResolveClient returns the client registered under the client ID, or nil
+// when the proxy did not issue it. Resolving a client counts as a use.
+func (c *ClientRegistry) ResolveClient(clientID string) (*ResolvedClient, error) {
+	client, err := c.load(clientID)
+	if err != nil || client == nil {
+		return nil, err
+	}
+	if now := time.Now(); now.Sub(time.Unix(client.LastUsedAt, 0)) >= clientUseInterval {
+		client.LastUsedAt = now.Unix()
+		if err := c.save(client); err != nil {
+			logger.Warn("Failed to record the use of client %s: %v", client.ClientID, err)
+		}
+	}
+
+	resolved := &ResolvedClient{
+		ClientID:     client.ClientID,
+		RedirectURIs: client.RedirectURIs,
+		SecretHash:   client.SecretHash,
+	}
+	if uc := c.upstreamClient(client.UpstreamClientID); uc != nil {
+		// Registrations made before public clients were kept off
+		// confidential upstream clients must not get their secret
+		if client.SecretHash == "" && uc.ClientSecret != "" {
+			return nil, fmt.Errorf("public client %s is mapped onto confidential upstream client %s", client.ClientID, uc.ClientID)
+		}
+		resolved.UpstreamClientID = uc.ClientID
+		resolved.UpstreamClientSecret = uc.ClientSecret
+		resolved.UpstreamAuthMethod = uc.AuthMethod
+	}
+	return resolved, nil
+}
+
+// Handler serves POST /register and GET, PUT and DELETE /register/{client_id}
+func (c *ClientRegistry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allowCORS(w, r, "GET, POST, PUT, DELETE, OPTIONS") {
+			return
+		}
+
+		clientID := strings.TrimPrefix(strings.TrimPrefix(r.URL.Path, "/register"), "/")
+		if clientID == "" {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			c.register(w, r)
+			return
+		}
+
+		client, ok := c.authenticate(w, r, clientID)
+		if !ok {
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, c.clientResponse(r, client, "", ""))
+		case http.MethodPut:
+			c.update(w, r, client)
+		case http.MethodDelete:
+			if err := c.store.Delete(registeredClientPrefix + client.ClientID); err != nil {
+				logger.Error("Failed to delete client %s: %v", client.ClientID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			logger.Info("Deleted registered client %s", client.ClientID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+func (c *ClientRegistry) register(w http.ResponseWriter, r *http.Request) {
+	if !allowRegistration(w, r, c.limiter) {
+		return
+	}
+	if keys, err := c.store.Keys(registeredClientPrefix); err != nil || len(keys) >= c.maxClients {
+		if err != nil {
+			logger.Error("Failed to count registered clients: %v", err)
+		} else {
+			logger.Warn("Refused a registration: %d clients are registered", len(keys))
+		}
+		writeOAuthError(w, http.StatusServiceUnavailable, "temporarily_unavailable", "no more clients can be registered")
+		return
+	}
+
+	var regReq map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&regReq); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "request body must be a JSON object")
+		return
+	}
+
+	client := &RegisteredClient{
+		ClientID:         "client-" + randomToken(16),
+		ClientIDIssuedAt: time.Now().Unix(),
+	}
+	if errCode, err := c.applyMetadata(client, regReq); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errCode, err.Error())
+		return
+	}
+
+	var secret string
+	if client.TokenEndpointAuthMethod != "none" {
+		secret = randomToken(32)
+		client.SecretHash = hashSecret(secret)
+	}
+	registrationToken := randomToken(32)
+	client.RegistrationTokenHash = hashSecret(registrationToken)
+
+	if err := c.save(client); err != nil {
+		logger.Error("Failed to store client %s: %v", client.ClientID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	logger.Info("Registered client %s (%s), mapped to upstream client %q", client.ClientID, client.ClientName, client.UpstreamClientID)
+	writeJSON(w, http.StatusCreated, c.clientResponse(r, client, secret, registrationToken))
+}
+
+// newRegistrationLimiter throttles open registration per client address
+func newRegistrationLimiter() (*ratelimit.Limiter, error) {
+	return ratelimit.New(config.RateLimitConfig{Rules: []config.RateLimitRule{
+		{Name: "register", Keys: []string{ratelimit.KeyIP}, RequestsPerMinute: 1, Burst: registrationBurst},
+	}})
+}
+
+// allowRegistration returns false, after writing a 429 response, when the
+// client's address has registered too many clients
+func allowRegistration(w http.ResponseWriter, r *http.Request, limiter *ratelimit.Limiter) bool {
+	res := limiter.Allow(ratelimit.Request{IP: ratelimit.ClientIP(r)})
+	if res.Allowed {
+		return true
+	}
+	logger.Warn("Throttled client registration from %s", ratelimit.ClientIP(r))
+	w.Header().Set("Retry-After", fmt.Sprintf("%d", int(res.RetryAfter.Seconds())))
+	writeOAuthError(w, http.StatusTooManyRequests, "temporarily_unavailable", "too many registrations, try again later")
+	return false
+}
+
+// update replaces the client metadata as described in RFC 7592 section 2.2.
+// Credentials are kept unchanged.
+func (c *ClientRegistry) update(w http.ResponseWriter, r *http.Request, client *RegisteredClient) {
+	var regReq map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&regReq); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "request body must be a JSON object")
+		return
+	}
+	if id, _ := regReq["client_id"].(string); id != client.ClientID {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "client_id does not match")
+		return
+	}
+
+	updated := *client
+	if errCode, err := c.applyMetadata(&updated, regReq); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, errCode, err.Error())
+		return
+	}
+	if (updated.TokenEndpointAuthMethod == "none") != (client.SecretHash == "") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_client_metadata", "token_endpoint_auth_method cannot switch between public and confidential")
+		return
+	}
+
+	if err := c.save(&updated); err != nil {
+		logger.Error("Failed to store client %s: %v", client.ClientID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.clientResponse(r, &updated, "", ""))
+}
+
+// applyMetadata validates the requested client metadata, fills in defaults and
+// selects the upstream client. It returns the RFC 7591 error code on failure.
+func (c *ClientRegistry) applyMetadata(client *RegisteredClient, regReq map[string]interface{}) (string, error) {
+	redirectURIs := stringList(regReq["redirect_uris"])
+	if len(redirectURIs) == 0 {
+		return "invalid_redirect_uri", fmt.Errorf("redirect_uris is required")
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return "invalid_redirect_uri", fmt.Errorf("invalid redirect URI %q", uri)
+		}
+	}
+
+	authMethod, _ := regReq["token_endpoint_auth_method"].(string)
+	if authMethod == "" {
+		// MCP clients are typically public clients using PKCE
+		authMethod = "none"
+	}
+	if !registrationAuthMethods[authMethod] {
+		return "invalid_client_metadata", fmt.Errorf("unsupported token_endpoint_auth_method %q", authMethod)
+	}
+
+	grantTypes := stringList(regReq["grant_types"])
+	if len(grantTypes) == 0 {
+		grantTypes = []string{"authorization_code", "refresh_token"}
+	}
+	responseTypes := stringList(regReq["response_types"])
+	if len(responseTypes) == 0 {
+		responseTypes = []string{"code"}
+	}
+
+	upstream := selectUpstream(c.upstream, redirectURIs, authMethod == "none")
+	if len(c.upstream) > 0 && upstream == nil {
+		return "invalid_redirect_uri", fmt.Errorf("no upstream client allows the requested redirect_uris")
+	}
+
+	client.RedirectURIs = redirectURIs
+	client.TokenEndpointAuthMethod = authMethod
+	client.GrantTypes = grantTypes
+	client.ResponseTypes = responseTypes
+	client.ClientName, _ = regReq["client_name"].(string)
+	client.ClientURI, _ = regReq["client_uri"].(string)
+	client.LogoURI, _ = regReq["logo_uri"].(string)
+	client.UpstreamClientID = ""
+	if upstream != nil {
+		client.UpstreamClientID = upstream.ClientID
+	}
+
+	switch scope := regReq["scope"].(type) {
+	case string:
+		client.Scope = scope
+	case []interface{}:
+		client.Scope = strings.Join(stringList(scope), " ")
+	default:
+		client.Scope = ""
+	}
+	return "", nil
+}
+
+// selectUpstream returns the first upstream client that allows all of the
+// redirect URIs. Public clients are only mapped onto upstream clients without
+// a secret: codes and refresh tokens are not tied to the proxy client, so any
+// anonymous registrant could otherwise redeem them as the confidential client.
+func selectUpstream(upstream []config.UpstreamClient, redirectURIs []string, public bool) *config.UpstreamClient {
+	for i := range upstream {
+		uc := &upstream[i]
+		if public && uc.ClientSecret != "" {
+			continue
+		}
+		allowed := true
+		if len(uc.RedirectURIs) > 0 {
+			for _, uri := range redirectURIs {
+				if !containsString(uc.RedirectURIs, uri) {
+					allowed = false
+					break
+				}
+			}
+		}
+		if allowed {
+			return uc
+		}
+	}
+	return nil
+}
+
+func (c *ClientRegistry) upstreamClient(clientID string) *config.UpstreamClient {
+	for i := range c.upstream {
+		if c.upstream[i].ClientID == clientID {
+			return &c.upstream[i]
+		}
+	}
+	return nil
+}
+
+// authenticate checks the registration access token for RFC 7592 requests.
+// Unknown clients and invalid tokens are both answered with 401.
+func (c *ClientRegistry) authenticate(w http.ResponseWriter, r *http.Request, clientID string) (*RegisteredClient, bool) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	client, err := c.load(clientID)
+	if err != nil {
+		logger.Error("Failed to load client %s: %v", clientID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	if client == nil || token == "" ||
+		subtle.ConstantTimeCompare([]byte(hashSecret(token)), []byte(client.RegistrationTokenHash)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeOAuthError(w, http.StatusUnauthorized, "invalid_token", "")
+		return nil, false
+	}
+	return client, true
+}
+
+// clientResponse builds the client information response. The client secret and
+// registration access token are only known when the client is first registered.
+func (c *ClientRegistry) clientResponse(r *http.Request, client *RegisteredClient, secret, registrationToken string) map[string]interface{} {
+	resp := map[string]interface{}{
+		"client_id":                  client.ClientID,
+		"client_id_issued_at":        client.ClientIDIssuedAt,
+		"redirect_uris":              client.RedirectURIs,
+		"grant_types":                client.GrantTypes,
+		"response_types":             client.ResponseTypes,
+		"token_endpoint_auth_method": client.TokenEndpointAuthMethod,
+		"registration_client_uri":    c.cfg.PublicBaseURL() + "/register/" + client.ClientID,
+	}
+	for field, value := range map[string]string{
+		"client_name": client.ClientName,
+		"client_uri":  client.ClientURI,
+		"logo_uri":    client.LogoURI,
+		"scope":       client.Scope,
+	} {
+		if value != "" {
+			resp[field] = value
+		}
+	}
+	if secret != "" {
+		resp["client_secret"] = secret
+		resp["client_secret_expires_at"] = 0
+	}
+	if registrationToken != "" {
+		resp["registration_access_token"] = registrationToken
+	}
+	return resp
+}
+
+func (c *ClientRegistry) load(clientID string) (*RegisteredClient, error) {
+	var client RegisteredClient
+	found, err := c.store.Get(registeredClientPrefix+clientID, &client)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// save stores the client until it has gone unused for long enough
+func (c *ClientRegistry) save(client *RegisteredClient) error {
+	ttl := c.unusedTTL
+	if client.LastUsedAt != 0 {
+		// A zero ttl would keep the client for good
+		ttl = max(c.idleTTL-time.Since(time.Unix(client.LastUsedAt, 0)), time.Second)
+	}
+	return c.store.Put(registeredClientPrefix+client.ClientID, client, ttl)
+}
+
+// hashSecret hashes generated secrets for storage. They are random and long,
+// so a plain SHA-256 is sufficient.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// stringList reads a JSON array of strings
+func stringList(v interface{}) []string {
+	list, _ := v.([]interface{})
+	var out []string
+	for _, item := range list {
+		if s, ok := item.(string); ok && s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
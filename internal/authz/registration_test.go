@@ -0,0 +1,219 @@
+package authz
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func newTestRegistry(t *testing.T) *ClientRegistry {
+	t.Helper()
+	cfg := &config.Config{
+		ProxyBaseURL: "http://localhost:8080",
+		Default: config.DefaultConfig{
+			Registration: config.RegistrationConfig{
+				Enabled: true,
+				UpstreamClients: []config.UpstreamClient{
+					{ClientID: "web-client", RedirectURIs: []string{"https://app.example.com/cb"}},
+					{ClientID: "mcp-client", ClientSecret: "upstream-secret"},
+					{ClientID: "mcp-public"},
+				},
+			},
+		},
+	}
+	registry, err := NewClientRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewClientRegistry failed: %v", err)
+	}
+	return registry
+}
+
+func registryRequest(registry *ClientRegistry, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	registry.Handler()(w, req)
+	return w
+}
+
+func TestClientRegistryLifecycle(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	w := registryRequest(registry, "POST", "/register", "",
+		`{"client_name":"inspector","redirect_uris":["http://localhost:6274/callback"],"scope":["openid","mcp_init"]}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %v: %s", w.Code, w.Body.String())
+	}
+	var registered map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&registered)
+
+	clientID := registered["client_id"].(string)
+	token := registered["registration_access_token"].(string)
+	if registered["registration_client_uri"] != "http://localhost:8080/register/"+clientID {
+		t.Errorf("Unexpected registration_client_uri: %v", registered["registration_client_uri"])
+	}
+	if registered["scope"] != "openid mcp_init" {
+		t.Errorf("Expected space-separated scope, got %v", registered["scope"])
+	}
+	if _, ok := registered["client_secret"]; ok {
+		t.Errorf("Expected no client_secret for a public client")
+	}
+
+	// The redirect URI is not allowed for web-client, and public clients do
+	// not get the secret of mcp-client, so mcp-public is selected
+	resolved, err := registry.ResolveClient(clientID)
+	if err != nil || resolved == nil {
+		t.Fatalf("Expected client to resolve, got %v", err)
+	}
+	if resolved.UpstreamClientID != "mcp-public" || resolved.UpstreamClientSecret != "" {
+		t.Errorf("Expected mapping to mcp-public, got %+v", resolved)
+	}
+
+	if w := registryRequest(registry, "GET", "/register/"+clientID, "wrong-token", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 with a wrong registration token, got %v", w.Code)
+	}
+	if w := registryRequest(registry, "GET", "/register/"+clientID, token, ""); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 reading the client, got %v", w.Code)
+	}
+
+	w = registryRequest(registry, "PUT", "/register/"+clientID, token,
+		`{"client_id":"`+clientID+`","redirect_uris":["https://app.example.com/cb"]}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200 updating the client, got %v: %s", w.Code, w.Body.String())
+	}
+	if resolved, _ := registry.ResolveClient(clientID); resolved.UpstreamClientID != "web-client" {
+		t.Errorf("Expected update to remap to web-client, got %s", resolved.UpstreamClientID)
+	}
+
+	if w := registryRequest(registry, "DELETE", "/register/"+clientID, token, ""); w.Code != http.StatusNoContent {
+		t.Errorf("Expected 204 deleting the client, got %v", w.Code)
+	}
+	if resolved, _ := registry.ResolveClient(clientID); resolved != nil {
+		t.Errorf("Expected deleted client not to resolve")
+	}
+}
+
+func TestClientRegistryConfidentialClient(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	w := registryRequest(registry, "POST", "/register", "",
+		`{"redirect_uris":["http://localhost/cb"],"token_endpoint_auth_method":"client_secret_post"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Expected 201, got %v: %s", w.Code, w.Body.String())
+	}
+	var registered map[string]interface{}
+	json.NewDecoder(w.Body).Decode(&registered)
+
+	resolved, _ := registry.ResolveClient(registered["client_id"].(string))
+	if resolved.UpstreamClientID != "mcp-client" || resolved.UpstreamClientSecret != "upstream-secret" {
+		t.Errorf("Expected mapping to mcp-client, got %+v", resolved)
+	}
+	if !resolved.VerifySecret(registered["client_secret"].(string)) {
+		t.Errorf("Expected issued secret to verify")
+	}
+	if resolved.VerifySecret("guess") {
+		t.Errorf("Expected wrong secret to fail")
+	}
+}
+
+func TestClientRegistryRejectsInvalidMetadata(t *testing.T) {
+	registry := newTestRegistry(t)
+
+	tests := map[string]string{
+		"missing redirect_uris": `{"client_name":"x"}`,
+		"relative redirect_uri": `{"redirect_uris":["/callback"]}`,
+		"unsupported auth":      `{"redirect_uris":["http://localhost/cb"],"token_endpoint_auth_method":"private_key_jwt"}`,
+	}
+	for name, body := range tests {
+		if w := registryRequest(registry, "POST", "/register", "", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", name, w.Code)
+		}
+	}
+}
+
+func TestClientRegistryKeepsPublicClientsOffConfidentialUpstreams(t *testing.T) {
+	cfg := &config.Config{
+		ProxyBaseURL: "http://localhost:8080",
+		Default: config.DefaultConfig{
+			Registration: config.RegistrationConfig{
+				Enabled:         true,
+				UpstreamClients: []config.UpstreamClient{{ClientID: "mcp-client", ClientSecret: "upstream-secret"}},
+			},
+		},
+	}
+	registry, err := NewClientRegistry(cfg)
+	if err != nil {
+		t.Fatalf("NewClientRegistry failed: %v", err)
+	}
+
+	if w := registryRequest(registry, "POST", "/register", "", `{"redirect_uris":["http://localhost/cb"]}`); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected a public client to be refused, got %v: %s", w.Code, w.Body.String())
+	}
+
+	// Clients stored with such a mapping do not resolve
+	registry.save(&RegisteredClient{ClientID: "client-old", RedirectURIs: []string{"http://localhost/cb"}, UpstreamClientID: "mcp-client"})
+	if resolved, err := registry.ResolveClient("client-old"); err == nil || resolved != nil {
+		t.Errorf("Expected a stored public client not to get the upstream secret, got %+v", resolved)
+	}
+}
+
+func TestClientRegistryLimitsRegistrations(t *testing.T) {
+	registry := newTestRegistry(t)
+	register := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/register", strings.NewReader(`{"redirect_uris":["http://localhost/cb"]}`))
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		registry.Handler()(w, req)
+		return w
+	}
+
+	// Each address gets a burst of registrations
+	for i := 0; i < registrationBurst; i++ {
+		if w := register("198.51.100.1:1234"); w.Code != http.StatusCreated {
+			t.Fatalf("Expected registration %d to succeed, got %v: %s", i+1, w.Code, w.Body.String())
+		}
+	}
+	if w := register("198.51.100.1:4321"); w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected the address to be throttled, got %v", w.Code)
+	}
+	if w := register("198.51.100.2:1234"); w.Code != http.StatusCreated {
+		t.Errorf("Expected another address to register, got %v", w.Code)
+	}
+
+	// The number of clients is capped
+	registry.maxClients = registrationBurst + 1
+	if w := register("198.51.100.3:1234"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected registrations beyond the cap to be refused, got %v", w.Code)
+	}
+}
+
+func TestClientRegistryExpiresUnusedClients(t *testing.T) {
+	registry := newTestRegistry(t)
+	registry.unusedTTL = 50 * time.Millisecond
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		w := registryRequest(registry, "POST", "/register", "", `{"redirect_uris":["http://localhost/cb"]}`)
+		var registered map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&registered)
+		ids = append(ids, registered["client_id"].(string))
+	}
+	if resolved, _ := registry.ResolveClient(ids[0]); resolved == nil {
+		t.Fatal("Expected the client to resolve")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if resolved, _ := registry.ResolveClient(ids[0]); resolved == nil {
+		t.Error("Expected a used client to be kept")
+	}
+	if resolved, _ := registry.ResolveClient(ids[1]); resolved != nil {
+		t.Error("Expected a client that was never used to expire")
+	}
+}
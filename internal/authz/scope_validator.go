@@ -10,7 +10,10 @@ import (
 	"github.com/wso2/open-mcp-auth-proxy/internal/util"
 )
 
-type ScopeValidator struct{}
+type ScopeValidator struct {
+	// Mapper contributes scopes derived from provider-specific claims (optional)
+	Mapper ScopeMapper
+}
 
 // Evaluate and checks the token claims against one or more required scopes.
 func (d *ScopeValidator) ValidateAccess(
@@ -20,12 +23,20 @@ func (d *ScopeValidator) ValidateAccess(
 ) AccessControlResult {
 	env, err := util.ParseRPCRequest(r)
 	if err != nil {
-		return AccessControlResult{DecisionDeny, "bad JSON-RPC request"}
+		return AccessControlResult{Decision: DecisionDeny, Message: "bad JSON-RPC request"}
+	}
+	if env == nil {
+		if r.Method != http.MethodGet && r.Method != http.MethodDelete {
+			return AccessControlResult{Decision: DecisionDeny, Message: "empty JSON-RPC request"}
+		}
+		// Body-less stream (GET) and session end (DELETE) requests are only
+		// scoped when scopes_supported has a rule keyed on the HTTP method
+		env = &util.RPCEnvelope{Method: r.Method}
 	}
-	requiredScopes := util.GetRequiredScopes(config, env)
+	requiredScopes, rule := util.RequiredScopeRule(config, env)
 
 	if len(requiredScopes) == 0 {
-		return AccessControlResult{DecisionAllow, ""}
+		return allowed(config, env)
 	}
 
 	required := make(map[string]struct{}, len(requiredScopes))
@@ -50,6 +61,10 @@ func (d *ScopeValidator) ValidateAccess(
 		}
 	}
 
+	if d.Mapper != nil {
+		tokenScopes = append(tokenScopes, d.Mapper.MapScopes(*claims)...)
+	}
+
 	tokenScopeSet := make(map[string]struct{}, len(tokenScopes))
 	for _, s := range tokenScopes {
 		tokenScopeSet[s] = struct{}{}
@@ -63,10 +78,25 @@ func (d *ScopeValidator) ValidateAccess(
 	}
 
 	if len(missing) == 0 {
-		return AccessControlResult{DecisionAllow, ""}
+		return allowed(config, env)
 	}
 	return AccessControlResult{
-		DecisionDeny,
-		fmt.Sprintf("missing required scope(s): %s", strings.Join(missing, ", ")),
+		Decision:       DecisionDeny,
+		Message:        fmt.Sprintf("missing required scope(s): %s", strings.Join(missing, ", ")),
+		RequiredScopes: requiredScopes,
+		Rule:           rule,
+	}
+}
+
+// allowed is the result for a request that has the scopes it needs. Calls to
+// sensitive tools still wait for a person to approve them.
+func allowed(config *config.Config, env *util.RPCEnvelope) AccessControlResult {
+	if config.Approval.Requires(env.ToolName()) {
+		return AccessControlResult{
+			Decision: DecisionRequireApproval,
+			Message:  "calls to " + env.ToolName() + " need approval",
+			Rule:     env.Method + ":" + env.ToolName(),
+		}
 	}
+	return AccessControlResult{Decision: DecisionAllow}
 }
@@ -0,0 +1,135 @@
+package authz
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func TestScopeValidatorDenyDetails(t *testing.T) {
+	cfg := &config.Config{
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			ScopesSupported: []map[string]interface{}{
+				{"initialize": "mcp_init"},
+				{"DELETE": "mcp_session"},
+				{"tools/call": []interface{}{
+					map[interface{}]interface{}{"echo_tool": "mcp_echo_tool"},
+				}},
+				{"resources/read": "mcp_resources"},
+			},
+		},
+		Approval: config.ApprovalConfig{Enabled: true, Tools: []string{"echo_tool", "delete_repo"}},
+	}
+
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		scope        string
+		wantDecision Decision
+		wantRule     string
+	}{
+		{
+			name:         "Method-level scope present",
+			body:         `{"jsonrpc":"2.0","id":1,"method":"initialize"}`,
+			scope:        "mcp_init",
+			wantDecision: DecisionAllow,
+		},
+		{
+			name:         "Method-level scope missing",
+			body:         `{"jsonrpc":"2.0","id":1,"method":"initialize"}`,
+			scope:        "other",
+			wantDecision: DecisionDeny,
+			wantRule:     "initialize",
+		},
+		{
+			name:         "Tool-level scope missing",
+			body:         `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"echo_tool"}}`,
+			scope:        "mcp_init",
+			wantDecision: DecisionDeny,
+			wantRule:     "tools/call:echo_tool",
+		},
+		{
+			name:         "Method-level scope missing on a call with params",
+			body:         `{"jsonrpc":"2.0","id":5,"method":"resources/read","params":{"name":"notes","uri":"file:///notes"}}`,
+			scope:        "mcp_init",
+			wantDecision: DecisionDeny,
+			wantRule:     "resources/read",
+		},
+		{
+			name:         "Tool-level scope present on a tool that needs approval",
+			body:         `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"echo_tool"}}`,
+			scope:        "mcp_echo_tool",
+			wantDecision: DecisionRequireApproval,
+			wantRule:     "tools/call:echo_tool",
+		},
+		{
+			name:         "Tool without a scope that needs approval",
+			body:         `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"delete_repo"}}`,
+			wantDecision: DecisionRequireApproval,
+			wantRule:     "tools/call:delete_repo",
+		},
+		{
+			name:         "Body-less GET without a rule",
+			method:       "GET",
+			wantDecision: DecisionAllow,
+		},
+		{
+			name:         "Body-less DELETE with its scope",
+			method:       "DELETE",
+			scope:        "mcp_session",
+			wantDecision: DecisionAllow,
+		},
+		{
+			name:         "Body-less DELETE without its scope",
+			method:       "DELETE",
+			scope:        "mcp_init",
+			wantDecision: DecisionDeny,
+			wantRule:     "DELETE",
+		},
+	}
+
+	validator := &ScopeValidator{}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = "POST"
+			}
+			req := httptest.NewRequest(method, "/mcp", strings.NewReader(tc.body))
+			claims := jwt.MapClaims{"scope": tc.scope}
+
+			result := validator.ValidateAccess(req, &claims, cfg)
+			if result.Decision != tc.wantDecision {
+				t.Fatalf("Expected decision %v, got %v (%s)", tc.wantDecision, result.Decision, result.Message)
+			}
+			if result.Rule != tc.wantRule {
+				t.Errorf("Expected rule %q, got %q", tc.wantRule, result.Rule)
+			}
+			if tc.wantDecision == DecisionDeny && len(result.RequiredScopes) == 0 {
+				t.Errorf("Expected required scopes on denial")
+			}
+		})
+	}
+}
+
+func TestScopeValidatorBodyless(t *testing.T) {
+	validator := &ScopeValidator{}
+	cfg := &config.Config{}
+	claims := jwt.MapClaims{}
+
+	for _, method := range []string{"GET", "DELETE"} {
+		req := httptest.NewRequest(method, "/mcp", nil)
+		if result := validator.ValidateAccess(req, &claims, cfg); result.Decision != DecisionAllow {
+			t.Errorf("Expected body-less %s to be allowed without scopes, got %v (%s)", method, result.Decision, result.Message)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/mcp", nil)
+	if result := validator.ValidateAccess(req, &claims, cfg); result.Decision != DecisionDeny {
+		t.Errorf("Expected empty POST to be denied, got %v", result.Decision)
+	}
+}
@@ -0,0 +1,310 @@
+// Package balancer spreads requests across the replicas of an MCP server. It
+// keeps each session on the replica that created it, and takes replicas out
+// of rotation when they fail health checks or requests.
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// Load balancing strategies
+const (
+	RoundRobin       = "round_robin"
+	LeastConnections = "least_connections"
+)
+
+const (
+	defaultSessionTTL          = time.Hour
+	defaultHealthInterval      = 10 * time.Second
+	defaultHealthTimeout       = 2 * time.Second
+	defaultUnhealthyThreshold  = 2
+	defaultHealthyThreshold    = 1
+	defaultConsecutiveFailures = 3
+	defaultEjectionDuration    = 30 * time.Second
+)
+
+// ErrNoReplica is returned when every replica is unhealthy or ejected
+var ErrNoReplica = errors.New("no healthy MCP server replica")
+
+// Replica is one instance of the MCP server
+type Replica struct {
+	URL *url.URL
+
+	// Guarded by the pool's mutex
+	active       int
+	failures     int
+	ejectedUntil time.Time
+	unhealthy    bool
+	// Consecutive health check results in the current direction
+	probes int
+}
+
+type binding struct {
+	replica  *Replica
+	lastUsed time.Time
+}
+
+// Pool balances requests across replicas
+type Pool struct {
+	replicas    []*Replica
+	strategy    string
+	sessionTTL  time.Duration
+	maxFailures int
+	ejection    time.Duration
+	health      config.HealthCheckConfig
+	client      *http.Client
+	now         func() time.Time
+
+	mu       sync.Mutex
+	next     int
+	sessions map[string]*binding
+}
+
+// New creates a pool of the replica URLs and starts its health checks, which
+// stop when ctx is done
+func New(ctx context.Context, urls []string, cfg config.LoadBalancingConfig) (*Pool, error) {
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("load balancing requires at least one replica")
+	}
+
+	p := &Pool{
+		strategy:    cfg.Strategy,
+		sessionTTL:  seconds(cfg.SessionTTLSeconds, defaultSessionTTL),
+		maxFailures: cfg.Ejection.ConsecutiveFailures,
+		ejection:    seconds(cfg.Ejection.DurationSeconds, defaultEjectionDuration),
+		health:      cfg.HealthCheck,
+		client:      httpclient.Client(httpclient.DestinationUpstream),
+		now:         time.Now,
+		sessions:    make(map[string]*binding),
+	}
+	if p.strategy == "" {
+		p.strategy = RoundRobin
+	}
+	if p.strategy != RoundRobin && p.strategy != LeastConnections {
+		return nil, fmt.Errorf("unknown load balancing strategy %q", p.strategy)
+	}
+	if p.maxFailures == 0 {
+		p.maxFailures = defaultConsecutiveFailures
+	}
+	if p.health.UnhealthyThreshold == 0 {
+		p.health.UnhealthyThreshold = defaultUnhealthyThreshold
+	}
+	if p.health.HealthyThreshold == 0 {
+		p.health.HealthyThreshold = defaultHealthyThreshold
+	}
+
+	for _, raw := range urls {
+		u, err := url.Parse(raw)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid replica URL %q", raw)
+		}
+		p.replicas = append(p.replicas, &Replica{URL: u})
+	}
+
+	if p.health.Path != "" {
+		p.client = &http.Client{
+			Transport: httpclient.Transport(httpclient.DestinationUpstream),
+			Timeout:   seconds(p.health.TimeoutSeconds, defaultHealthTimeout),
+		}
+		go p.runHealthChecks(ctx, seconds(p.health.IntervalSeconds, defaultHealthInterval))
+	}
+	return p, nil
+}
+
+// Pick selects the replica for a request. Requests in a session go to the
+// replica bound to it while that replica is available. The caller must
+// Release the replica when the request is done.
+func (p *Pool) Pick(sessionID string) (*Replica, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+
+	if b, ok := p.sessions[sessionID]; ok && sessionID != "" {
+		if p.available(b.replica, now) {
+			b.lastUsed = now
+			b.replica.active++
+			return b.replica, nil
+		}
+		// The session cannot continue elsewhere; the new replica will reject it
+		// and the client starts a new session
+		logger.Warn("Replica %s of session is unavailable, failing over", b.replica.URL.Host)
+		delete(p.sessions, sessionID)
+	}
+
+	return p.choose(now, nil)
+}
+
+// PickOther selects a replica other than those already tried, for a request
+// that failed on them. The caller must Release the replica when the request is done.
+func (p *Pool) PickOther(tried []*Replica) (*Replica, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.choose(p.now(), tried)
+}
+
+// choose applies the strategy to the available replicas that are not
+// excluded; callers must hold the lock
+func (p *Pool) choose(now time.Time, exclude []*Replica) (*Replica, error) {
+	candidate := func(r *Replica) bool {
+		for _, e := range exclude {
+			if r == e {
+				return false
+			}
+		}
+		return p.available(r, now)
+	}
+
+	var picked *Replica
+	switch p.strategy {
+	case LeastConnections:
+		for _, r := range p.replicas {
+			if candidate(r) && (picked == nil || r.active < picked.active) {
+				picked = r
+			}
+		}
+	default:
+		for i := 0; i < len(p.replicas); i++ {
+			r := p.replicas[(p.next+i)%len(p.replicas)]
+			if candidate(r) {
+				picked = r
+				p.next = (p.next + i + 1) % len(p.replicas)
+				break
+			}
+		}
+	}
+	if picked == nil {
+		return nil, ErrNoReplica
+	}
+	picked.active++
+	return picked, nil
+}
+
+// Release marks a request to the replica as done
+func (p *Pool) Release(r *Replica) {
+	p.mu.Lock()
+	r.active--
+	p.mu.Unlock()
+}
+
+// Bind keeps the session on the replica
+func (p *Pool) Bind(sessionID string, r *Replica) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	for id, b := range p.sessions {
+		if now.Sub(b.lastUsed) > p.sessionTTL {
+			delete(p.sessions, id)
+		}
+	}
+	p.sessions[sessionID] = &binding{replica: r, lastUsed: now}
+}
+
+// Unbind forgets the replica of an ended session
+func (p *Pool) Unbind(sessionID string) {
+	p.mu.Lock()
+	delete(p.sessions, sessionID)
+	p.mu.Unlock()
+}
+
+// ReportSuccess resets the replica's failure count
+func (p *Pool) ReportSuccess(r *Replica) {
+	p.mu.Lock()
+	r.failures = 0
+	p.mu.Unlock()
+}
+
+// ReportFailure counts a 5xx response or connection error, ejecting the
+// replica after too many in a row
+func (p *Pool) ReportFailure(r *Replica) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r.failures++
+	if r.failures >= p.maxFailures {
+		r.failures = 0
+		r.ejectedUntil = p.now().Add(p.ejection)
+		logger.Warn("Ejected MCP server replica %s for %s after repeated failures", r.URL.Host, p.ejection)
+	}
+}
+
+func (p *Pool) available(r *Replica, now time.Time) bool {
+	return !r.unhealthy && !now.Before(r.ejectedUntil)
+}
+
+func (p *Pool) runHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Replicas start healthy and are first probed after one interval
+	for {
+		select {
+		case <-ticker.C:
+			p.checkHealth(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// checkHealth probes every replica once
+func (p *Pool) checkHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range p.replicas {
+		wg.Add(1)
+		go func(r *Replica) {
+			defer wg.Done()
+			p.recordProbe(r, p.probe(ctx, r))
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (p *Pool) probe(ctx context.Context, r *Replica) bool {
+	target := *r.URL
+	target.Path = strings.TrimRight(target.Path, "/") + p.health.Path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return false
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// recordProbe changes the replica's health after enough probes in a row disagree with it
+func (p *Pool) recordProbe(r *Replica, healthy bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if healthy != r.unhealthy {
+		// The probe agrees with the current state
+		r.probes = 0
+		return
+	}
+	r.probes++
+	if healthy && r.probes >= p.health.HealthyThreshold {
+		r.unhealthy, r.probes = false, 0
+		logger.Info("MCP server replica %s is healthy", r.URL.Host)
+	} else if !healthy && r.probes >= p.health.UnhealthyThreshold {
+		r.unhealthy, r.probes = true, 0
+		logger.Warn("MCP server replica %s failed health checks", r.URL.Host)
+	}
+}
+
+func seconds(n int, def time.Duration) time.Duration {
+	if n <= 0 {
+		return def
+	}
+	return time.Duration(n) * time.Second
+}
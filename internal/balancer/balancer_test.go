@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+var replicaURLs = []string{"http://replica-a:8000", "http://replica-b:8000", "http://replica-c:8000"}
+
+func pick(t *testing.T, p *Pool, sessionID string) string {
+	t.Helper()
+	r, err := p.Pick(sessionID)
+	if err != nil {
+		t.Fatalf("Pick failed: %v", err)
+	}
+	p.Release(r)
+	return r.URL.Host
+}
+
+func TestRoundRobinAndAffinity(t *testing.T) {
+	p, err := New(context.Background(), replicaURLs, config.LoadBalancingConfig{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	var hosts []string
+	for i := 0; i < 4; i++ {
+		hosts = append(hosts, pick(t, p, ""))
+	}
+	if hosts[0] != "replica-a:8000" || hosts[1] != "replica-b:8000" || hosts[2] != "replica-c:8000" || hosts[3] != "replica-a:8000" {
+		t.Errorf("Unexpected round robin order: %v", hosts)
+	}
+
+	// A bound session stays on its replica
+	r, _ := p.Pick("")
+	p.Bind("session-1", r)
+	p.Release(r)
+	for i := 0; i < 3; i++ {
+		if got := pick(t, p, "session-1"); got != r.URL.Host {
+			t.Errorf("Expected session to stay on %s, got %s", r.URL.Host, got)
+		}
+	}
+
+	// Sessions fail over when their replica is ejected
+	p.maxFailures = 1
+	p.ReportFailure(r)
+	if got := pick(t, p, "session-1"); got == r.URL.Host {
+		t.Errorf("Expected the session to move off the ejected replica")
+	}
+}
+
+func TestPickOther(t *testing.T) {
+	p, err := New(context.Background(), replicaURLs, config.LoadBalancingConfig{})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	first, _ := p.Pick("")
+	second, err := p.PickOther([]*Replica{first})
+	if err != nil || second == first {
+		t.Fatalf("Expected another replica, got %v (%v)", second, err)
+	}
+	third, err := p.PickOther([]*Replica{first, second})
+	if err != nil || third == first || third == second {
+		t.Fatalf("Expected the remaining replica, got %v (%v)", third, err)
+	}
+	if _, err := p.PickOther([]*Replica{first, second, third}); err != ErrNoReplica {
+		t.Errorf("Expected no replica once all were tried, got %v", err)
+	}
+}
+
+func TestLeastConnections(t *testing.T) {
+	p, err := New(context.Background(), replicaURLs[:2], config.LoadBalancingConfig{Strategy: LeastConnections})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	first, _ := p.Pick("")
+	second, _ := p.Pick("")
+	if first == second {
+		t.Fatalf("Expected the idle replica to be picked")
+	}
+	p.Release(first)
+	if r, _ := p.Pick(""); r != first {
+		t.Errorf("Expected the replica with fewer connections, got %s", r.URL.Host)
+	}
+}
+
+func TestEjectionExpires(t *testing.T) {
+	p, err := New(context.Background(), replicaURLs[:1], config.LoadBalancingConfig{Ejection: config.EjectionConfig{ConsecutiveFailures: 2, DurationSeconds: 30}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now()
+	p.now = func() time.Time { return now }
+	r := p.replicas[0]
+
+	p.ReportFailure(r)
+	p.ReportSuccess(r)
+	p.ReportFailure(r)
+	if _, err := p.Pick(""); err != nil {
+		t.Fatalf("Expected a success to reset the failure count")
+	}
+	p.Release(r)
+
+	p.ReportFailure(r)
+	if _, err := p.Pick(""); err != ErrNoReplica {
+		t.Fatalf("Expected the replica to be ejected, got %v", err)
+	}
+
+	now = now.Add(31 * time.Second)
+	if _, err := p.Pick(""); err != nil {
+		t.Errorf("Expected the replica to return after the ejection, got %v", err)
+	}
+}
+
+func TestHealthChecks(t *testing.T) {
+	var healthy atomic.Bool
+	healthy.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/base/healthz" || !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	// A long interval leaves the probes to the test
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := New(ctx, []string{server.URL + "/base"}, config.LoadBalancingConfig{HealthCheck: config.HealthCheckConfig{
+		Path:               "/healthz",
+		IntervalSeconds:    3600,
+		UnhealthyThreshold: 2,
+	}})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	healthy.Store(false)
+	p.checkHealth(ctx)
+	if _, err := p.Pick(""); err != nil {
+		t.Fatalf("Expected one failed probe to be tolerated, got %v", err)
+	}
+	p.Release(p.replicas[0])
+	p.checkHealth(ctx)
+	if _, err := p.Pick(""); err != ErrNoReplica {
+		t.Fatalf("Expected the replica to be unhealthy, got %v", err)
+	}
+
+	healthy.Store(true)
+	p.checkHealth(ctx)
+	if _, err := p.Pick(""); err != nil {
+		t.Errorf("Expected the replica to recover, got %v", err)
+	}
+}
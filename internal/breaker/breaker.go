@@ -0,0 +1,173 @@
+// Package breaker implements a circuit breaker that stops requests to an MCP
+// server after repeated failures and lets trial requests through once it may
+// have recovered.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// State is the state of a circuit
+type State int
+
+const (
+	// Closed lets all requests through
+	Closed State = iota
+	// Open rejects all requests
+	Open
+	// HalfOpen lets a limited number of trial requests through
+	HalfOpen
+)
+
+const (
+	defaultFailureThreshold = 5
+	defaultOpenDuration     = 30 * time.Second
+	defaultHalfOpenRequests = 1
+)
+
+// ErrOpen is returned while the circuit rejects requests
+var ErrOpen = errors.New("circuit breaker is open")
+
+func (s State) String() string {
+	switch s {
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// Breaker is a circuit breaker for one MCP server
+type Breaker struct {
+	name             string
+	failureThreshold int
+	openDuration     time.Duration
+	halfOpenRequests int
+	now              func() time.Time
+
+	mu        sync.Mutex
+	state     State
+	failures  int
+	openedAt  time.Time
+	trials    int // Trial requests admitted in the half-open state
+	successes int // Trial requests that succeeded
+}
+
+// New creates a closed circuit breaker for the named server
+func New(name string, cfg config.CircuitBreakerConfig) *Breaker {
+	b := &Breaker{
+		name:             name,
+		failureThreshold: cfg.FailureThreshold,
+		openDuration:     time.Duration(cfg.OpenSeconds) * time.Second,
+		halfOpenRequests: cfg.HalfOpenRequests,
+		now:              time.Now,
+	}
+	if b.failureThreshold <= 0 {
+		b.failureThreshold = defaultFailureThreshold
+	}
+	if b.openDuration <= 0 {
+		b.openDuration = defaultOpenDuration
+	}
+	if b.halfOpenRequests <= 0 {
+		b.halfOpenRequests = defaultHalfOpenRequests
+	}
+	return b
+}
+
+// Allow admits a request, returning ErrOpen when the circuit rejects it. The
+// returned function must be called once with the outcome of an admitted request.
+func (b *Breaker) Allow() (func(success bool), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open {
+		if b.now().Sub(b.openedAt) < b.openDuration {
+			return nil, ErrOpen
+		}
+		b.setState(HalfOpen)
+	}
+	if b.state == HalfOpen {
+		if b.trials >= b.halfOpenRequests {
+			return nil, ErrOpen
+		}
+		b.trials++
+	}
+
+	state := b.state
+	var once sync.Once
+	return func(success bool) {
+		once.Do(func() { b.record(state, success) })
+	}, nil
+}
+
+// RetryAfter returns how long the circuit stays open
+func (b *Breaker) RetryAfter() time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != Open {
+		return 0
+	}
+	if remaining := b.openDuration - b.now().Sub(b.openedAt); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// State returns the current state of the circuit
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// record applies the outcome of a request admitted in the given state
+func (b *Breaker) record(admitted State, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// Outcomes of requests admitted before the last state change are stale
+	if admitted != b.state {
+		return
+	}
+
+	switch b.state {
+	case Closed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.failureThreshold {
+			b.setState(Open)
+		}
+	case HalfOpen:
+		if !success {
+			b.setState(Open)
+			return
+		}
+		b.successes++
+		if b.successes >= b.halfOpenRequests {
+			b.setState(Closed)
+		}
+	}
+}
+
+func (b *Breaker) setState(state State) {
+	b.state = state
+	b.failures, b.trials, b.successes = 0, 0, 0
+	switch state {
+	case Open:
+		b.openedAt = b.now()
+		logger.Warn("Circuit breaker for %s opened; requests are rejected for %s", b.name, b.openDuration)
+	case HalfOpen:
+		logger.Info("Circuit breaker for %s is half-open; trying the MCP server again", b.name)
+	case Closed:
+		logger.Info("Circuit breaker for %s closed", b.name)
+	}
+}
@@ -0,0 +1,85 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b := New("test", config.CircuitBreakerConfig{FailureThreshold: 2, OpenSeconds: 10, HalfOpenRequests: 2})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	fail := func() {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatalf("Expected the request to be allowed, got %v", err)
+		}
+		done(false)
+	}
+
+	fail()
+	if b.State() != Closed {
+		t.Fatalf("Expected the circuit to stay closed below the threshold")
+	}
+	fail()
+	if b.State() != Open {
+		t.Fatalf("Expected the circuit to open, got %s", b.State())
+	}
+	if _, err := b.Allow(); err != ErrOpen {
+		t.Errorf("Expected requests to be rejected while open, got %v", err)
+	}
+	if got := b.RetryAfter(); got != 10*time.Second {
+		t.Errorf("Expected a 10s retry after, got %s", got)
+	}
+
+	// After the open period, a limited number of trial requests are let through
+	now = now.Add(11 * time.Second)
+	first, err := b.Allow()
+	if err != nil || b.State() != HalfOpen {
+		t.Fatalf("Expected a trial request, got %v in state %s", err, b.State())
+	}
+	second, _ := b.Allow()
+	if _, err := b.Allow(); err != ErrOpen {
+		t.Errorf("Expected requests beyond the trials to be rejected, got %v", err)
+	}
+	first(true)
+	first(false) // Outcomes are only recorded once
+	if b.State() != HalfOpen {
+		t.Errorf("Expected the circuit to wait for all trials, got %s", b.State())
+	}
+	second(true)
+	if b.State() != Closed {
+		t.Errorf("Expected the circuit to close, got %s", b.State())
+	}
+}
+
+func TestBreakerReopensOnFailedTrial(t *testing.T) {
+	b := New("test", config.CircuitBreakerConfig{FailureThreshold: 1, OpenSeconds: 10})
+	now := time.Now()
+	b.now = func() time.Time { return now }
+
+	done, _ := b.Allow()
+	done(false)
+	now = now.Add(11 * time.Second)
+	trial, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Expected a trial request, got %v", err)
+	}
+	trial(false)
+	if b.State() != Open {
+		t.Errorf("Expected a failed trial to reopen the circuit, got %s", b.State())
+	}
+
+	// A success while closed resets the failure count
+	b = New("test", config.CircuitBreakerConfig{FailureThreshold: 2})
+	for _, success := range []bool{false, true, false} {
+		done, _ := b.Allow()
+		done(success)
+	}
+	if b.State() != Closed {
+		t.Errorf("Expected failures separated by a success to keep the circuit closed")
+	}
+}
@@ -32,18 +32,76 @@ type StdioConfig struct {
 	WorkDir     string   `yaml:"work_dir"`       // Working directory (optional)
 	Args        []string `yaml:"args,omitempty"` // Additional arguments
 	Env         []string `yaml:"env,omitempty"`  // Environment variables
+
+	// Starts a subprocess for each user, with their credentials in its environment
+	PerUser            bool `yaml:"per_user,omitempty"`
+	IdleTimeoutSeconds int  `yaml:"idle_timeout_seconds,omitempty"` // Unused per-user subprocesses are stopped after this long
+	MaxProcesses       int  `yaml:"max_processes,omitempty"`        // Per-user subprocesses running at once
 }
 
 type DemoConfig struct {
-	ClientID     string `yaml:"client_id"`
-	ClientSecret string `yaml:"client_secret"`
-	OrgName      string `yaml:"org_name"`
+	ClientID     string             `yaml:"client_id"`
+	ClientSecret string             `yaml:"client_secret"`
+	OrgName      string             `yaml:"org_name"`
+	Apps         AsgardeoAppsConfig `yaml:"apps,omitempty"`
 }
 
 type AsgardeoConfig struct {
-	ClientID     string `yaml:"client_id"`
-	ClientSecret string `yaml:"client_secret"`
-	OrgName      string `yaml:"org_name"`
+	ClientID     string             `yaml:"client_id"`
+	ClientSecret string             `yaml:"client_secret"`
+	OrgName      string             `yaml:"org_name"`
+	Apps         AsgardeoAppsConfig `yaml:"apps,omitempty"`
+}
+
+// AsgardeoAppsConfig controls reuse and cleanup of the Asgardeo applications
+// created by /register
+type AsgardeoAppsConfig struct {
+	TTLHours               int         `yaml:"ttl_hours,omitempty"`                // Applications unused for this long are deleted; default 168
+	JanitorIntervalMinutes int         `yaml:"janitor_interval_minutes,omitempty"` // Default 60
+	Store                  StoreConfig `yaml:"store,omitempty"`
+}
+
+// OIDCConfig configures the discovery-based "oidc" provider
+type OIDCConfig struct {
+	Issuer                 string `yaml:"issuer"`
+	DiscoveryURL           string `yaml:"discovery_url,omitempty"`            // Overrides the well-known URLs derived from the issuer
+	RefreshIntervalSeconds int    `yaml:"refresh_interval_seconds,omitempty"` // How often metadata and keys are re-fetched
+}
+
+// KeycloakConfig configures the "keycloak" provider
+type KeycloakConfig struct {
+	BaseURL                string `yaml:"base_url"`                       // e.g. http://localhost:8080
+	Realm                  string `yaml:"realm"`                          // Realm that issues tokens for the MCP server
+	InitialAccessToken     string `yaml:"initial_access_token,omitempty"` // Token for the client registration service
+	RolesClientID          string `yaml:"roles_client_id,omitempty"`      // resource_access entry whose roles grant scopes
+	RefreshIntervalSeconds int    `yaml:"refresh_interval_seconds,omitempty"`
+}
+
+// Auth0Config configures the "auth0" provider
+type Auth0Config struct {
+	Domain                 string `yaml:"domain"`   // e.g. dev-123456.us.auth0.com
+	Audience               string `yaml:"audience"` // Identifier of the Auth0 API that represents the MCP server
+	RefreshIntervalSeconds int    `yaml:"refresh_interval_seconds,omitempty"`
+}
+
+// EmbeddedUser is a user account of the embedded authorization server
+type EmbeddedUser struct {
+	Username     string   `yaml:"username"`
+	Password     string   `yaml:"password,omitempty"`      // Plain text, for development only
+	PasswordHash string   `yaml:"password_hash,omitempty"` // bcrypt hash
+	Scopes       []string `yaml:"scopes,omitempty"`        // Scopes the user may be granted; defaults to default_scopes
+}
+
+// EmbeddedConfig configures the "embedded" provider, in which the proxy acts as
+// its own authorization server for offline and development use
+type EmbeddedConfig struct {
+	Issuer                 string         `yaml:"issuer,omitempty"` // Defaults to proxy_base_url
+	Users                  []EmbeddedUser `yaml:"users,omitempty"`
+	HtpasswdFile           string         `yaml:"htpasswd_file,omitempty"` // bcrypt or {SHA} entries
+	DefaultScopes          []string       `yaml:"default_scopes,omitempty"`
+	SigningKeyFile         string         `yaml:"signing_key_file,omitempty"` // RSA private key (PEM); generated if missing
+	AccessTokenTTLSeconds  int            `yaml:"access_token_ttl_seconds,omitempty"`
+	RefreshTokenTTLSeconds int            `yaml:"refresh_token_ttl_seconds,omitempty"`
 }
 
 type CORSConfig struct {
@@ -90,9 +148,343 @@ type PathConfig struct {
 }
 
 type DefaultConfig struct {
-	BaseURL string                `yaml:"base_url,omitempty"`
-	Path    map[string]PathConfig `yaml:"path,omitempty"`
-	JWKSURL string                `yaml:"jwks_url,omitempty"`
+	BaseURL      string                `yaml:"base_url,omitempty"`
+	Path         map[string]PathConfig `yaml:"path,omitempty"`
+	JWKSURL      string                `yaml:"jwks_url,omitempty"`
+	Registration RegistrationConfig    `yaml:"registration,omitempty"`
+}
+
+// UpstreamClient is a client pre-provisioned at the upstream IdP that
+// clients registered at the proxy are mapped onto
+type UpstreamClient struct {
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"client_secret,omitempty"`
+	AuthMethod   string   `yaml:"auth_method,omitempty"`   // "client_secret_post" (default) or "client_secret_basic"
+	RedirectURIs []string `yaml:"redirect_uris,omitempty"` // Redirect URIs allowed at the IdP; empty allows any
+}
+
+// RegistrationConfig enables dynamic client registration handled by the proxy
+// itself, for IdPs that do not support RFC 7591
+type RegistrationConfig struct {
+	Enabled         bool             `yaml:"enabled"`
+	UpstreamClients []UpstreamClient `yaml:"upstream_clients,omitempty"`
+	Store           StoreConfig      `yaml:"store,omitempty"` // Backend for registered clients
+}
+
+// ClientMetadataConfig enables client IDs that are HTTPS URLs of client
+// metadata documents, for clients that do not register dynamically
+type ClientMetadataConfig struct {
+	Enabled         bool             `yaml:"enabled"`
+	AllowedDomains  []string         `yaml:"allowed_domains,omitempty"` // Hosts or "*.example.com"; empty allows any
+	DeniedDomains   []string         `yaml:"denied_domains,omitempty"`
+	UpstreamClients []UpstreamClient `yaml:"upstream_clients,omitempty"` // Empty forwards the URL client ID unchanged
+	CacheTTLSeconds int              `yaml:"cache_ttl_seconds,omitempty"`
+}
+
+// ListenerTLSConfig serves the proxy over HTTPS
+type ListenerTLSConfig struct {
+	Enabled                bool   `yaml:"enabled"`
+	CertFile               string `yaml:"cert_file"`
+	KeyFile                string `yaml:"key_file"`
+	ReloadIntervalSeconds  int    `yaml:"reload_interval_seconds,omitempty"` // How often to check the files for changes; default 60
+	MinVersion             string `yaml:"min_version,omitempty"`             // "1.2" (default) or "1.3"
+	ClientCAFile           string `yaml:"client_ca_file,omitempty"`          // CA bundle for verifying client certificates
+	ClientAuth             string `yaml:"client_auth,omitempty"`             // "none" (default), "optional" or "require"
+	RedirectHTTPPort       int    `yaml:"redirect_http_port,omitempty"`      // Plain HTTP port that redirects to HTTPS
+	CertificateBoundTokens bool   `yaml:"certificate_bound_tokens"`          // Require tokens bound to the client certificate (RFC 8705)
+}
+
+// DPoPConfig enables DPoP sender-constrained access tokens (RFC 9449)
+type DPoPConfig struct {
+	Enabled       bool        `yaml:"enabled"`
+	Required      bool        `yaml:"required"`                  // Reject plain bearer tokens
+	SigningAlgs   []string    `yaml:"signing_algs,omitempty"`    // Accepted proof algorithms; default ES256, ES384, RS256, PS256
+	MaxAgeSeconds int         `yaml:"max_age_seconds,omitempty"` // Accepted clock difference for the proof iat; default 300
+	Store         StoreConfig `yaml:"store,omitempty"`           // Backend for the proof replay cache
+}
+
+// TokenExchangeConfig exchanges client tokens for downstream tokens sent to the
+// MCP server (RFC 8693)
+type TokenExchangeConfig struct {
+	Enabled            bool     `yaml:"enabled"`
+	TokenEndpoint      string   `yaml:"token_endpoint,omitempty"` // Defaults to the auth server's /token
+	ClientID           string   `yaml:"client_id"`
+	ClientSecret       string   `yaml:"client_secret,omitempty"`
+	AuthMethod         string   `yaml:"auth_method,omitempty"` // "client_secret_basic" (default) or "client_secret_post"
+	Audience           string   `yaml:"audience,omitempty"`
+	Resource           string   `yaml:"resource,omitempty"`
+	Scopes             []string `yaml:"scopes,omitempty"`
+	RequestedTokenType string   `yaml:"requested_token_type,omitempty"` // Defaults to an access token
+}
+
+// IdentityHeadersConfig passes the verified caller identity to the MCP server
+type IdentityHeadersConfig struct {
+	Enabled            bool                 `yaml:"enabled"`
+	Headers            map[string]string    `yaml:"headers,omitempty"` // Header name to claim; defaults to X-MCP-User, X-MCP-Email, X-MCP-Scopes and X-MCP-Client-Id
+	StripAuthorization bool                 `yaml:"strip_authorization"`
+	SignedToken        SignedIdentityConfig `yaml:"signed_token"`
+}
+
+// SignedIdentityConfig adds the identity as a short-lived JWT signed by the proxy
+type SignedIdentityConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	Header         string `yaml:"header,omitempty"`           // Defaults to X-MCP-Identity
+	Secret         string `yaml:"secret,omitempty"`           // Signs with HS256
+	PrivateKeyFile string `yaml:"private_key_file,omitempty"` // Signs with RS256
+	Issuer         string `yaml:"issuer,omitempty"`
+	Audience       string `yaml:"audience,omitempty"`
+	TTLSeconds     int    `yaml:"ttl_seconds,omitempty"` // Defaults to 60
+}
+
+// CredentialsConfig stores per-user credentials for third-party APIs and adds
+// them to upstream requests
+type CredentialsConfig struct {
+	Enabled           bool                       `yaml:"enabled"`
+	EncryptionKey     string                     `yaml:"encryption_key,omitempty"`      // Base64-encoded 32-byte key
+	EncryptionKeyFile string                     `yaml:"encryption_key_file,omitempty"` // Generated when missing
+	Store             StoreConfig                `yaml:"store,omitempty"`
+	Providers         []CredentialProviderConfig `yaml:"providers,omitempty"`
+}
+
+// CredentialProviderConfig describes a third-party API and how its credential is sent upstream
+type CredentialProviderConfig struct {
+	Name   string                 `yaml:"name"`
+	Header string                 `yaml:"header,omitempty"` // Upstream request header carrying the credential
+	Format string                 `yaml:"format,omitempty"` // Header value with {token} placeholder; defaults to "Bearer {token}"
+	Env    string                 `yaml:"env,omitempty"`    // Environment variable carrying the credential in per-user subprocesses
+	OAuth  *CredentialOAuthConfig `yaml:"oauth,omitempty"`  // Enables the connect flow
+}
+
+// CredentialOAuthConfig is the third party's OAuth client used by the connect flow
+type CredentialOAuthConfig struct {
+	AuthorizationURL string   `yaml:"authorization_url"`
+	TokenURL         string   `yaml:"token_url"`
+	ClientID         string   `yaml:"client_id"`
+	ClientSecret     string   `yaml:"client_secret,omitempty"`
+	Scopes           []string `yaml:"scopes,omitempty"`
+}
+
+// ServerConfig is an upstream MCP server mounted under its own path in gateway mode.
+// Protected resource metadata that is not set is inherited from the top level.
+type ServerConfig struct {
+	Name                      string                    `yaml:"name"`
+	MountPath                 string                    `yaml:"mount_path"` // Proxy path prefix, such as "/github"
+	BaseURL                   string                    `yaml:"base_url"`
+	BaseURLs                  []string                  `yaml:"base_urls,omitempty"` // Replicas of the server
+	LoadBalancing             LoadBalancingConfig       `yaml:"load_balancing"`
+	CircuitBreaker            CircuitBreakerConfig      `yaml:"circuit_breaker"` // Inherited from the top level when not enabled
+	Retry                     RetryConfig               `yaml:"retry"`           // Inherited from the top level when not enabled
+	Port                      int                       `yaml:"port"`
+	TransportMode             TransportMode             `yaml:"transport_mode"`
+	Paths                     PathsConfig               `yaml:"paths"`
+	Stdio                     StdioConfig               `yaml:"stdio"`
+	PathMapping               map[string]string         `yaml:"path_mapping,omitempty"`
+	ProtectedResourceMetadata ProtectedResourceMetadata `yaml:"protected_resource_metadata"`
+}
+
+// AggregateConfig presents several gateway servers as a single MCP server
+type AggregateConfig struct {
+	Enabled               bool                    `yaml:"enabled"`
+	Path                  string                  `yaml:"path"`                               // Aggregate MCP endpoint; defaults to /mcp
+	Separator             string                  `yaml:"separator"`                          // Between the prefix and the name; defaults to "_"
+	Servers               []AggregateServerConfig `yaml:"servers"`                            // Defaults to all streamable HTTP servers
+	MaxSessions           int                     `yaml:"max_sessions,omitempty"`             // Client sessions kept at once; defaults to 1000
+	MaxSessionsPerSubject int                     `yaml:"max_sessions_per_subject,omitempty"` // A subject's oldest session ends beyond this; defaults to 10
+}
+
+// AggregateServerConfig selects a gateway server to include in the aggregate
+type AggregateServerConfig struct {
+	Name   string `yaml:"name"`   // Name of an entry in servers
+	Prefix string `yaml:"prefix"` // Prefix for its tool, resource and prompt names; defaults to the name
+}
+
+// LoadBalancingConfig spreads MCP traffic across the replicas in base_urls
+type LoadBalancingConfig struct {
+	Strategy          string            `yaml:"strategy"`            // "round_robin" (default) or "least_connections"
+	SessionTTLSeconds int               `yaml:"session_ttl_seconds"` // Idle time after which a session may move to another replica; default 3600
+	HealthCheck       HealthCheckConfig `yaml:"health_check"`
+	Ejection          EjectionConfig    `yaml:"ejection"`
+}
+
+// HealthCheckConfig actively probes replicas; disabled unless a path is set
+type HealthCheckConfig struct {
+	Path               string `yaml:"path"`                // Probed with GET; 2xx is healthy
+	IntervalSeconds    int    `yaml:"interval_seconds"`    // Default 10
+	TimeoutSeconds     int    `yaml:"timeout_seconds"`     // Default 2
+	UnhealthyThreshold int    `yaml:"unhealthy_threshold"` // Failed probes before a replica is removed; default 2
+	HealthyThreshold   int    `yaml:"healthy_threshold"`   // Passed probes before it is restored; default 1
+}
+
+// EjectionConfig takes replicas that fail requests out of rotation for a while
+type EjectionConfig struct {
+	ConsecutiveFailures int `yaml:"consecutive_failures"` // 5xx responses or connection errors in a row; default 3
+	DurationSeconds     int `yaml:"duration_seconds"`     // Default 30
+}
+
+// CircuitBreakerConfig stops forwarding to an MCP server that keeps failing
+type CircuitBreakerConfig struct {
+	Enabled          bool `yaml:"enabled"`
+	FailureThreshold int  `yaml:"failure_threshold"`  // Failures in a row that open the circuit; default 5
+	OpenSeconds      int  `yaml:"open_seconds"`       // Time before trial requests are let through; default 30
+	HalfOpenRequests int  `yaml:"half_open_requests"` // Trial requests that must succeed to close the circuit; default 1
+}
+
+// RetryConfig retries MCP requests that are safe to repeat
+type RetryConfig struct {
+	Enabled       bool     `yaml:"enabled"`
+	MaxAttempts   int      `yaml:"max_attempts"`   // Including the first attempt; default 3
+	BackoffMillis int      `yaml:"backoff_millis"` // Doubled after each attempt; default 100
+	Methods       []string `yaml:"methods"`        // Idempotent JSON-RPC methods; defaults to initialize, ping and the list methods
+}
+
+// LimitsConfig bounds and validates requests before they are authorized
+type LimitsConfig struct {
+	MaxBodyBytes    int64 `yaml:"max_body_bytes"`   // Request bodies of MCP and proxy endpoints; default 4 MiB
+	MaxHeaderBytes  int   `yaml:"max_header_bytes"` // Request headers; default 1 MiB
+	ValidateJSONRPC bool  `yaml:"validate_jsonrpc"` // Require JSON content and well-formed JSON-RPC 2.0 messages
+	ValidateParams  bool  `yaml:"validate_params"`  // Check params of known MCP methods against the MCP schema
+	// Check tools/call arguments against the inputSchema the server listed for the tool
+	ValidateToolArguments bool `yaml:"validate_tool_arguments"`
+}
+
+// Actions taken when a tool definition does not match its approved fingerprint
+const (
+	ToolPinBlock = "block" // Keep listing the approved definition and reject calls
+	ToolPinStrip = "strip" // Remove the tool from listings and reject calls
+	ToolPinAlert = "alert" // Log and count the change, but pass the tool on
+)
+
+// ToolPinningConfig detects changes to tool definitions after they were approved
+type ToolPinningConfig struct {
+	Enabled         bool        `yaml:"enabled"`
+	Action          string      `yaml:"action"`           // "block" (default), "strip" or "alert"
+	RequireApproval bool        `yaml:"require_approval"` // Treat tools seen for the first time as unapproved instead of trusting them
+	Store           StoreConfig `yaml:"store,omitempty"`  // Approved fingerprints; defaults to the file tool_pins.json
+}
+
+// Actions taken when a tool result contains sensitive content
+const (
+	InspectionRedact = "redact" // Replace each match with a placeholder
+	InspectionBlock  = "block"  // Replace the result with a JSON-RPC error
+	InspectionFlag   = "flag"   // Log and count the matches, but pass the result on
+)
+
+// InspectionConfig scans tool results for secrets and personal data before they reach the client
+type InspectionConfig struct {
+	Enabled   bool                `yaml:"enabled"`
+	Action    string              `yaml:"action"`              // "redact" (default), "block" or "flag"
+	Detectors []string            `yaml:"detectors,omitempty"` // Built-in detectors to apply; defaults to all of them
+	Patterns  []InspectionPattern `yaml:"patterns,omitempty"`  // Additional detectors
+}
+
+// InspectionPattern is a detector defined by a regular expression
+type InspectionPattern struct {
+	Name  string `yaml:"name"`
+	Regex string `yaml:"regex"`
+}
+
+// Actions taken when tool descriptions or results look like prompt injection
+const (
+	InjectionWarn  = "warn"  // Log and count the match, but pass the text on
+	InjectionStrip = "strip" // Remove the matched text
+	InjectionBlock = "block" // Remove the tool from listings, or replace the result with a JSON-RPC error
+	InjectionOff   = "off"   // Disable the rule set
+)
+
+// InjectionConfig flags prompt injection in tool descriptions and tool results
+type InjectionConfig struct {
+	Enabled bool              `yaml:"enabled"`
+	Action  string            `yaml:"action"`          // Action of rule sets not listed in rules: "warn" (default), "strip" or "block"
+	Rules   map[string]string `yaml:"rules,omitempty"` // Action by rule set
+	// Hosts, and their subdomains, that markdown links and images may point to
+	AllowedLinkHosts []string `yaml:"allowed_link_hosts,omitempty"`
+}
+
+// ApprovalConfig holds calls to sensitive tools until a person approves them
+type ApprovalConfig struct {
+	Enabled           bool     `yaml:"enabled"`
+	Tools             []string `yaml:"tools"`                    // Tools whose calls need approval; "*" for all tools
+	TimeoutSeconds    int      `yaml:"timeout_seconds"`          // Calls not decided in time are rejected; default 300
+	ProgressSeconds   int      `yaml:"progress_seconds"`         // Interval of progress notifications while a call waits; default 10
+	Path              string   `yaml:"path"`                     // Approval API; default /approvals
+	ApproverScope     string   `yaml:"approver_scope"`           // Scope an approver's access token needs; default mcp:approve
+	AllowSelfApproval bool     `yaml:"allow_self_approval"`      // Let callers approve their own calls
+	WebhookURL        string   `yaml:"webhook_url,omitempty"`    // Notified of new and decided approvals
+	WebhookSecret     string   `yaml:"webhook_secret,omitempty"` // Signs webhook bodies with HMAC-SHA256
+}
+
+// Requires reports whether calls to a tool need approval
+func (a *ApprovalConfig) Requires(tool string) bool {
+	if !a.Enabled || tool == "" {
+		return false
+	}
+	for _, t := range a.Tools {
+		if t == tool || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// MetricsConfig exposes proxy counters for Prometheus
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Path    string `yaml:"path"` // Default /metrics
+}
+
+// OutboundTLSConfig configures TLS for calls the proxy makes to other services
+type OutboundTLSConfig struct {
+	CAFile             string `yaml:"ca_file,omitempty"`   // PEM bundle trusted in addition to the system roots
+	CertFile           string `yaml:"cert_file,omitempty"` // Client certificate for mutual TLS
+	KeyFile            string `yaml:"key_file,omitempty"`
+	MinVersion         string `yaml:"min_version,omitempty"`          // "1.2" (default) or "1.3"
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify,omitempty"` // Never use in production
+}
+
+// OutboundDestinationConfig overrides the outbound settings for one destination
+type OutboundDestinationConfig struct {
+	TimeoutSeconds int                `yaml:"timeout_seconds,omitempty"`
+	TLS            *OutboundTLSConfig `yaml:"tls,omitempty"` // Replaces the shared TLS settings
+}
+
+// OutboundConfig configures the HTTP clients used for JWKS, IdP and MCP server calls
+type OutboundConfig struct {
+	TLS          OutboundTLSConfig                    `yaml:"tls,omitempty"`
+	Proxy        string                               `yaml:"proxy,omitempty"`        // HTTP proxy URL; defaults to HTTP_PROXY/HTTPS_PROXY
+	Destinations map[string]OutboundDestinationConfig `yaml:"destinations,omitempty"` // jwks, idp, upstream, client_metadata
+}
+
+// StoreConfig selects where the proxy keeps state that should survive restarts
+type StoreConfig struct {
+	Type string `yaml:"type"` // "memory" (default) or "file"
+	Path string `yaml:"path,omitempty"`
+}
+
+// RateLimitRule is a token bucket applied per distinct combination of key values
+type RateLimitRule struct {
+	Name              string   `yaml:"name"`
+	Keys              []string `yaml:"keys"`             // Any of: subject, client_id, ip, method, tool
+	Method            string   `yaml:"method,omitempty"` // Only count requests for this JSON-RPC method
+	Tool              string   `yaml:"tool,omitempty"`   // Only count tools/call requests for this tool
+	RequestsPerMinute float64  `yaml:"requests_per_minute"`
+	Burst             int      `yaml:"burst,omitempty"`
+}
+
+// QuotaRule caps the number of calls per key within a calendar period
+type QuotaRule struct {
+	Name   string   `yaml:"name"`
+	Keys   []string `yaml:"keys"`
+	Method string   `yaml:"method,omitempty"`
+	Tool   string   `yaml:"tool,omitempty"`
+	Period string   `yaml:"period"` // "daily" or "monthly"
+	Limit  int64    `yaml:"limit"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool            `yaml:"enabled"`
+	Rules   []RateLimitRule `yaml:"rules,omitempty"`
+	Quotas  []QuotaRule     `yaml:"quotas,omitempty"`
+	Store   StoreConfig     `yaml:"store,omitempty"` // Backend for quota counters
 }
 
 type Config struct {
@@ -110,11 +502,82 @@ type Config struct {
 	Paths             PathsConfig       `yaml:"paths"`
 	Stdio             StdioConfig       `yaml:"stdio"`
 
+	// Replicas of the MCP server; replaces base_url when set
+	BaseURLs      []string            `yaml:"base_urls,omitempty"`
+	LoadBalancing LoadBalancingConfig `yaml:"load_balancing"`
+
+	// Failure handling for requests to the MCP server
+	CircuitBreaker CircuitBreakerConfig `yaml:"circuit_breaker"`
+	Retry          RetryConfig          `yaml:"retry"`
+
+	// Upstream MCP servers mounted under their own paths; replaces the single
+	// server above when set
+	Servers []ServerConfig `yaml:"servers,omitempty"`
+
+	// Path prefix of a server mounted in gateway mode; set on the configs
+	// returned by UpstreamConfigs
+	MountPath  string `yaml:"-"`
+	ServerName string `yaml:"-"`
+
+	// One MCP endpoint that merges the servers above
+	Aggregate AggregateConfig `yaml:"aggregate"`
+
+	// Request size limits and validation
+	Limits LimitsConfig `yaml:"limits"`
+
+	// Fingerprints of approved tool definitions
+	ToolPinning ToolPinningConfig `yaml:"tool_pinning"`
+
+	// Detection of secrets and personal data in tool results
+	Inspection InspectionConfig `yaml:"inspection"`
+
+	// Prompt injection heuristics for tool descriptions and tool results
+	Injection InjectionConfig `yaml:"injection"`
+
+	// Human approval of calls to sensitive tools
+	Approval ApprovalConfig `yaml:"approval"`
+
+	// Prometheus metrics endpoint
+	Metrics MetricsConfig `yaml:"metrics"`
+
+	// Respond to denied JSON-RPC calls with JSON-RPC error objects instead of plain-text HTTP errors
+	JSONRPCErrors bool `yaml:"jsonrpc_errors"`
+
+	// HTTPS listener
+	TLS ListenerTLSConfig `yaml:"tls"`
+
+	// DPoP proof-of-possession for access tokens
+	DPoP DPoPConfig `yaml:"dpop"`
+
+	// Downstream credentials for the MCP server
+	TokenExchange TokenExchangeConfig `yaml:"token_exchange"`
+
+	// Caller identity headers added to upstream requests
+	IdentityHeaders IdentityHeadersConfig `yaml:"identity_headers"`
+
+	// Per-user third-party credentials
+	Credentials CredentialsConfig `yaml:"credentials"`
+
+	// HTTP clients for outbound calls
+	Outbound OutboundConfig `yaml:"outbound"`
+
+	// URL-based client IDs backed by client metadata documents
+	ClientMetadata ClientMetadataConfig `yaml:"client_metadata"`
+
+	// Rate limits and quotas for MCP requests
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+
 	// Nested config for Asgardeo
 	Demo     DemoConfig     `yaml:"demo"`
 	Asgardeo AsgardeoConfig `yaml:"asgardeo"`
 	Default  DefaultConfig  `yaml:"default"`
 
+	// Discovery-based OIDC provider
+	OIDC     OIDCConfig     `yaml:"oidc"`
+	Keycloak KeycloakConfig `yaml:"keycloak"`
+	Auth0    Auth0Config    `yaml:"auth0"`
+	Embedded EmbeddedConfig `yaml:"embedded"`
+
 	// Protected resource metadata
 	ProtectedResourceMetadata ProtectedResourceMetadata `yaml:"protected_resource_metadata"`
 }
@@ -130,6 +593,9 @@ func (c *Config) Validate() error {
 			return fmt.Errorf("stdio.user_command is required in stdio transport mode")
 		}
 	}
+	if err := c.validatePerUser(c.Stdio, "stdio"); err != nil {
+		return err
+	}
 
 	// Validate paths
 	if c.Paths.SSE == "" {
@@ -139,6 +605,38 @@ func (c *Config) Validate() error {
 		c.Paths.Messages = "/messages" // Default value
 	}
 
+	if c.Metrics.Enabled && c.Metrics.Path == "" {
+		c.Metrics.Path = "/metrics" // Default value
+	}
+
+	if err := c.TLS.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.ToolPinning.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Inspection.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Injection.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.Approval.Validate(); err != nil {
+		return err
+	}
+
+	if c.Limits.MaxBodyBytes < 0 || c.Limits.MaxHeaderBytes < 0 {
+		return fmt.Errorf("limits.max_body_bytes and limits.max_header_bytes cannot be negative")
+	}
+
+	if err := validateReplicas(c.TransportMode, &c.BaseURL, c.BaseURLs, c.LoadBalancing); err != nil {
+		return err
+	}
+
 	// Validate base URL
 	if c.BaseURL == "" {
 		if c.Port > 0 {
@@ -148,12 +646,395 @@ func (c *Config) Validate() error {
 		}
 	}
 
+	return c.validateServers()
+}
+
+// validatePerUser checks that per-user subprocesses have credentials to pass
+// and no replicas to balance across
+func (c *Config) validatePerUser(stdio StdioConfig, section string) error {
+	if !stdio.PerUser {
+		return nil
+	}
+	if !c.Credentials.Enabled {
+		return fmt.Errorf("%s.per_user requires credentials to be enabled", section)
+	}
+	if stdio.IdleTimeoutSeconds < 0 || stdio.MaxProcesses < 0 {
+		return fmt.Errorf("%s.idle_timeout_seconds and max_processes cannot be negative", section)
+	}
+	return nil
+}
+
+// PublicBaseURL returns the externally visible base URL of the proxy from the
+// configured proxy_base_url. The Host and X-Forwarded-Proto headers are set by
+// clients and are not trusted, so without it the local listener is assumed.
+func (c *Config) PublicBaseURL() string {
+	if c.ProxyBaseURL != "" {
+		return strings.TrimSuffix(c.ProxyBaseURL, "/")
+	}
+
+	scheme := "http"
+	if c.TLS.Enabled {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d", scheme, c.ListenPort)
+}
+
+// Validate checks that client certificates are verified when tokens must be bound to them
+func (t *ListenerTLSConfig) Validate() error {
+	if !t.CertificateBoundTokens {
+		return nil
+	}
+	if !t.Enabled {
+		return fmt.Errorf("tls.certificate_bound_tokens requires tls.enabled")
+	}
+	if t.ClientAuth == "" || t.ClientAuth == "none" {
+		return fmt.Errorf("tls.certificate_bound_tokens requires tls.client_auth to be optional or require")
+	}
+	return nil
+}
+
+// Validate checks the tool pinning settings and fills in defaults
+func (p *ToolPinningConfig) Validate() error {
+	if !p.Enabled {
+		return nil
+	}
+	switch p.Action {
+	case "":
+		p.Action = ToolPinBlock // Default value
+	case ToolPinBlock, ToolPinStrip, ToolPinAlert:
+	default:
+		return fmt.Errorf("unknown tool_pinning.action %q", p.Action)
+	}
+	if p.Store.Type == "" {
+		// Approvals are made with the pins command, so they must outlive the proxy
+		p.Store = StoreConfig{Type: "file", Path: "tool_pins.json"}
+	}
+	return nil
+}
+
+// Validate checks the inspection settings and fills in defaults
+func (i *InspectionConfig) Validate() error {
+	if !i.Enabled {
+		return nil
+	}
+	switch i.Action {
+	case "":
+		i.Action = InspectionRedact // Default value
+	case InspectionRedact, InspectionBlock, InspectionFlag:
+	default:
+		return fmt.Errorf("unknown inspection.action %q", i.Action)
+	}
+	for _, p := range i.Patterns {
+		if p.Name == "" || p.Regex == "" {
+			return fmt.Errorf("inspection.patterns need a name and a regex")
+		}
+	}
+	return nil
+}
+
+// Blocks reports whether any rule set blocks what it matches
+func (i *InjectionConfig) Blocks() bool {
+	if i.Action == InjectionBlock {
+		return true
+	}
+	for _, action := range i.Rules {
+		if action == InjectionBlock {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the prompt injection settings and fills in defaults
+func (i *InjectionConfig) Validate() error {
+	if !i.Enabled {
+		return nil
+	}
+	switch i.Action {
+	case "":
+		i.Action = InjectionWarn // Default value
+	case InjectionWarn, InjectionStrip, InjectionBlock, InjectionOff:
+	default:
+		return fmt.Errorf("unknown injection.action %q", i.Action)
+	}
+	for rule, action := range i.Rules {
+		switch action {
+		case InjectionWarn, InjectionStrip, InjectionBlock, InjectionOff:
+		default:
+			return fmt.Errorf("unknown action %q of injection rule set %s", action, rule)
+		}
+	}
+	return nil
+}
+
+// Validate checks the approval settings and fills in defaults
+func (a *ApprovalConfig) Validate() error {
+	if !a.Enabled {
+		return nil
+	}
+	if a.TimeoutSeconds < 0 || a.ProgressSeconds < 0 {
+		return fmt.Errorf("approval.timeout_seconds and approval.progress_seconds cannot be negative")
+	}
+	if a.TimeoutSeconds == 0 {
+		a.TimeoutSeconds = 300 // Default value
+	}
+	if a.ProgressSeconds == 0 {
+		a.ProgressSeconds = 10 // Default value
+	}
+	if a.Path == "" {
+		a.Path = "/approvals" // Default value
+	}
+	if a.ApproverScope == "" {
+		a.ApproverScope = "mcp:approve" // Default value
+	}
+	return nil
+}
+
+// validateReplicas checks the replica list of an MCP server. The first
+// replica becomes the base URL, which is used where only one URL applies.
+func validateReplicas(mode TransportMode, baseURL *string, replicas []string, lb LoadBalancingConfig) error {
+	if len(replicas) == 0 {
+		return nil
+	}
+	if mode == StdioTransport {
+		return fmt.Errorf("base_urls is not supported in stdio transport mode")
+	}
+	switch lb.Strategy {
+	case "", "round_robin", "least_connections":
+	default:
+		return fmt.Errorf("unknown load_balancing.strategy %q", lb.Strategy)
+	}
+	if *baseURL != "" && *baseURL != replicas[0] {
+		return fmt.Errorf("base_url and base_urls cannot both be set")
+	}
+	*baseURL = replicas[0]
+	return nil
+}
+
+// validateServers checks the gateway mode servers and fills in their defaults
+func (c *Config) validateServers() error {
+	mounts := make(map[string]string)
+	for i := range c.Servers {
+		s := &c.Servers[i]
+		if s.Name == "" {
+			return fmt.Errorf("servers[%d].name is required", i)
+		}
+
+		s.MountPath = "/" + strings.Trim(s.MountPath, "/")
+		if s.MountPath == "/" {
+			return fmt.Errorf("server %s requires a mount_path other than /", s.Name)
+		}
+		for mount, other := range mounts {
+			if strings.HasPrefix(s.MountPath+"/", mount+"/") || strings.HasPrefix(mount+"/", s.MountPath+"/") {
+				return fmt.Errorf("server %s mount_path %s overlaps with server %s", s.Name, s.MountPath, other)
+			}
+		}
+		mounts[s.MountPath] = s.Name
+
+		if s.TransportMode == "" {
+			s.TransportMode = SSETransport
+		}
+		if s.Paths.SSE == "" {
+			s.Paths.SSE = "/sse"
+		}
+		if s.Paths.Messages == "" {
+			s.Paths.Messages = "/messages"
+		}
+		if s.TransportMode == StdioTransport {
+			if s.Stdio.UserCommand == "" {
+				return fmt.Errorf("server %s requires stdio.user_command in stdio transport mode", s.Name)
+			}
+			if s.Port == 0 {
+				return fmt.Errorf("server %s requires a port for its stdio subprocess", s.Name)
+			}
+			s.Stdio.Enabled = true
+		}
+		if err := c.validatePerUser(s.Stdio, "server "+s.Name+" stdio"); err != nil {
+			return err
+		}
+		if err := validateReplicas(s.TransportMode, &s.BaseURL, s.BaseURLs, s.LoadBalancing); err != nil {
+			return fmt.Errorf("server %s: %w", s.Name, err)
+		}
+		if s.BaseURL == "" {
+			if s.Port == 0 {
+				return fmt.Errorf("server %s requires a base_url or port", s.Name)
+			}
+			s.BaseURL = fmt.Sprintf("http://localhost:%d", s.Port)
+		}
+	}
+	return c.validateAggregate(mounts)
+}
+
+// validateAggregate checks the aggregate endpoint and fills in its defaults
+func (c *Config) validateAggregate(mounts map[string]string) error {
+	a := &c.Aggregate
+	if !a.Enabled {
+		return nil
+	}
+	if len(c.Servers) == 0 {
+		return fmt.Errorf("aggregate requires servers")
+	}
+	if a.Path == "" {
+		a.Path = "/mcp"
+	}
+	a.Path = "/" + strings.Trim(a.Path, "/")
+	for mount, name := range mounts {
+		if strings.HasPrefix(a.Path+"/", mount+"/") || strings.HasPrefix(mount+"/", a.Path+"/") {
+			return fmt.Errorf("aggregate path %s overlaps with server %s", a.Path, name)
+		}
+	}
+	if a.Separator == "" {
+		a.Separator = "_"
+	}
+	if a.MaxSessions < 0 || a.MaxSessionsPerSubject < 0 {
+		return fmt.Errorf("aggregate max_sessions and max_sessions_per_subject must not be negative")
+	}
+	if a.MaxSessions == 0 {
+		a.MaxSessions = 1000 // Default value
+	}
+	if a.MaxSessionsPerSubject == 0 {
+		a.MaxSessionsPerSubject = 10 // Default value
+	}
+
+	if len(a.Servers) == 0 {
+		for _, s := range c.Servers {
+			if s.TransportMode == StreamableHTTPTransport {
+				a.Servers = append(a.Servers, AggregateServerConfig{Name: s.Name})
+			}
+		}
+		if len(a.Servers) == 0 {
+			return fmt.Errorf("aggregate requires at least one streamable HTTP server")
+		}
+	}
+
+	prefixes := make(map[string]bool)
+	for i := range a.Servers {
+		as := &a.Servers[i]
+		server := c.server(as.Name)
+		if server == nil {
+			return fmt.Errorf("aggregate server %q is not in servers", as.Name)
+		}
+		// Only streamable HTTP servers can be called request by request
+		if server.TransportMode != StreamableHTTPTransport {
+			return fmt.Errorf("aggregate server %s must use the streamable_http transport", as.Name)
+		}
+		if as.Prefix == "" {
+			as.Prefix = as.Name
+		}
+		if prefixes[as.Prefix] {
+			return fmt.Errorf("duplicate aggregate prefix %q", as.Prefix)
+		}
+		prefixes[as.Prefix] = true
+	}
+	return nil
+}
+
+// server returns the gateway server with the given name
+func (c *Config) server(name string) *ServerConfig {
+	for i := range c.Servers {
+		if c.Servers[i].Name == name {
+			return &c.Servers[i]
+		}
+	}
 	return nil
 }
 
+// UpstreamConfigs returns one config per upstream MCP server. In gateway mode
+// each server gets a copy of the top-level config with its own upstream,
+// paths and protected resource metadata; otherwise the config itself is returned.
+func (c *Config) UpstreamConfigs() []*Config {
+	if len(c.Servers) == 0 {
+		return []*Config{c}
+	}
+
+	configs := make([]*Config, 0, len(c.Servers))
+	for _, s := range c.Servers {
+		sc := *c
+		sc.Servers = nil
+		sc.ServerName = s.Name
+		sc.MountPath = s.MountPath
+		sc.BaseURL = s.BaseURL
+		sc.BaseURLs = s.BaseURLs
+		sc.LoadBalancing = s.LoadBalancing
+		if s.CircuitBreaker.Enabled {
+			sc.CircuitBreaker = s.CircuitBreaker
+		}
+		if s.Retry.Enabled {
+			sc.Retry = s.Retry
+		}
+		sc.Port = s.Port
+		sc.TransportMode = s.TransportMode
+		sc.Paths = s.Paths
+		sc.Stdio = s.Stdio
+		sc.PathMapping = s.PathMapping
+
+		prm := s.ProtectedResourceMetadata
+		parent := c.ProtectedResourceMetadata
+		if prm.Audience == "" {
+			prm.Audience = parent.Audience
+		}
+		if prm.ScopesSupported == nil {
+			prm.ScopesSupported = parent.ScopesSupported
+		}
+		if len(prm.AuthorizationServers) == 0 {
+			prm.AuthorizationServers = parent.AuthorizationServers
+		}
+		if prm.JwksURI == "" {
+			prm.JwksURI = parent.JwksURI
+		}
+		if len(prm.BearerMethodsSupported) == 0 {
+			prm.BearerMethodsSupported = parent.BearerMethodsSupported
+		}
+		if prm.ResourceIdentifier == "" {
+			prm.ResourceIdentifier = strings.TrimSuffix(c.ProxyBaseURL, "/") + sc.MountPath + sc.resourcePath()
+		}
+		sc.ProtectedResourceMetadata = prm
+
+		configs = append(configs, &sc)
+	}
+	return configs
+}
+
+// AggregateResourceConfig returns the config of the aggregate endpoint as a
+// protected resource. It uses the top-level protected resource metadata.
+func (c *Config) AggregateResourceConfig() *Config {
+	ac := *c
+	ac.Servers = nil
+	ac.BaseURL = ""
+	ac.TransportMode = StreamableHTTPTransport
+	ac.Paths = PathsConfig{StreamableHTTP: c.Aggregate.Path}
+	ac.PathMapping = nil
+	if ac.ProtectedResourceMetadata.ResourceIdentifier == "" {
+		ac.ProtectedResourceMetadata.ResourceIdentifier = strings.TrimSuffix(c.ProxyBaseURL, "/") + c.Aggregate.Path
+	}
+	return &ac
+}
+
+// resourcePath is the upstream path that identifies the MCP endpoint for the transport
+func (c *Config) resourcePath() string {
+	switch c.TransportMode {
+	case SSETransport:
+		return c.Paths.SSE
+	case StreamableHTTPTransport:
+		return c.Paths.StreamableHTTP
+	}
+	return ""
+}
+
 // GetMCPPaths returns the list of paths that should be proxied to the MCP server
 func (c *Config) GetMCPPaths() []string {
-	return []string{c.Paths.SSE, c.Paths.Messages, c.Paths.StreamableHTTP}
+	if c.MountPath == "" {
+		return []string{c.Paths.SSE, c.Paths.Messages, c.Paths.StreamableHTTP}
+	}
+
+	// Mounted servers only serve the paths they have, under their mount path
+	var paths []string
+	for _, p := range []string{c.Paths.SSE, c.Paths.Messages, c.Paths.StreamableHTTP} {
+		if p != "" {
+			paths = append(paths, c.MountPath+p)
+		}
+	}
+	return paths
 }
 
 // BuildExecCommand constructs the full command string for execution in stdio mode
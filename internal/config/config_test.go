@@ -118,6 +118,37 @@ func TestValidate(t *testing.T) {
 			},
 			expectError: true,
 		},
+		{
+			name: "Per-user stdio without credentials",
+			config: Config{
+				TransportMode: StdioTransport,
+				Stdio:         StdioConfig{Enabled: true, UserCommand: "some-command", PerUser: true},
+			},
+			expectError: true,
+		},
+		{
+			name: "Per-user stdio with credentials",
+			config: Config{
+				TransportMode: StdioTransport,
+				Stdio:         StdioConfig{Enabled: true, UserCommand: "some-command", PerUser: true},
+				Credentials:   CredentialsConfig{Enabled: true},
+			},
+			expectError: false,
+		},
+		{
+			name: "Certificate-bound tokens without client authentication",
+			config: Config{
+				TLS: ListenerTLSConfig{Enabled: true, CertificateBoundTokens: true},
+			},
+			expectError: true,
+		},
+		{
+			name: "Certificate-bound tokens with client authentication",
+			config: Config{
+				TLS: ListenerTLSConfig{Enabled: true, ClientAuth: "optional", CertificateBoundTokens: true},
+			},
+			expectError: false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -189,3 +220,124 @@ func TestBuildExecCommand(t *testing.T) {
 		})
 	}
 }
+
+func TestUpstreamConfigs(t *testing.T) {
+	cfg := Config{
+		ProxyBaseURL: "https://proxy.example.com",
+		ProtectedResourceMetadata: ProtectedResourceMetadata{
+			Audience:             "shared",
+			AuthorizationServers: []string{"https://idp.example.com"},
+		},
+		Servers: []ServerConfig{
+			{Name: "github", MountPath: "github/", Port: 9001},
+			{Name: "jira", MountPath: "/jira", BaseURL: "http://jira:8080", TransportMode: StreamableHTTPTransport,
+				Paths:                     PathsConfig{StreamableHTTP: "/mcp"},
+				ProtectedResourceMetadata: ProtectedResourceMetadata{Audience: "jira"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+
+	upstreams := cfg.UpstreamConfigs()
+	if len(upstreams) != 2 {
+		t.Fatalf("Expected 2 upstreams, got %d", len(upstreams))
+	}
+	github, jira := upstreams[0], upstreams[1]
+	if github.MountPath != "/github" || github.BaseURL != "http://localhost:9001" || github.TransportMode != SSETransport {
+		t.Errorf("Unexpected github defaults: %s %s %s", github.MountPath, github.BaseURL, github.TransportMode)
+	}
+	if github.ProtectedResourceMetadata.Audience != "shared" || github.ProtectedResourceMetadata.ResourceIdentifier != "https://proxy.example.com/github/sse" {
+		t.Errorf("Unexpected github metadata: %+v", github.ProtectedResourceMetadata)
+	}
+	if jira.ProtectedResourceMetadata.Audience != "jira" || len(jira.ProtectedResourceMetadata.AuthorizationServers) != 1 {
+		t.Errorf("Unexpected jira metadata: %+v", jira.ProtectedResourceMetadata)
+	}
+
+	paths := jira.GetMCPPaths()
+	expected := []string{"/jira/sse", "/jira/messages", "/jira/mcp"}
+	if len(paths) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, paths)
+	}
+	for i := range expected {
+		if paths[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, paths)
+		}
+	}
+
+	// Without servers the config itself is the only upstream
+	single := Config{}
+	if upstreams := single.UpstreamConfigs(); len(upstreams) != 1 || upstreams[0] != &single {
+		t.Errorf("Expected the config itself without servers")
+	}
+}
+
+func TestValidateServers(t *testing.T) {
+	invalid := [][]ServerConfig{
+		{{MountPath: "/a", Port: 9001}},
+		{{Name: "root", MountPath: "/", Port: 9001}},
+		{{Name: "a", MountPath: "/tools", Port: 9001}, {Name: "b", MountPath: "/tools/b", Port: 9002}},
+		{{Name: "a", MountPath: "/a"}},
+		{{Name: "a", MountPath: "/a", TransportMode: StdioTransport, Port: 9001}},
+	}
+	for _, servers := range invalid {
+		cfg := Config{Servers: servers}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", servers)
+		}
+	}
+}
+
+func TestValidateAggregate(t *testing.T) {
+	servers := []ServerConfig{
+		{Name: "github", MountPath: "/github", Port: 9001, TransportMode: StreamableHTTPTransport, Paths: PathsConfig{StreamableHTTP: "/mcp"}},
+		{Name: "legacy", MountPath: "/legacy", Port: 9002},
+	}
+
+	cfg := Config{Servers: servers, Aggregate: AggregateConfig{Enabled: true}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if cfg.Aggregate.Path != "/mcp" || cfg.Aggregate.Separator != "_" {
+		t.Errorf("Unexpected aggregate defaults: %+v", cfg.Aggregate)
+	}
+	if len(cfg.Aggregate.Servers) != 1 || cfg.Aggregate.Servers[0].Prefix != "github" {
+		t.Errorf("Expected only the streamable HTTP server by default, got %+v", cfg.Aggregate.Servers)
+	}
+
+	invalid := []AggregateConfig{
+		{Enabled: true, Servers: []AggregateServerConfig{{Name: "unknown"}}},
+		{Enabled: true, Servers: []AggregateServerConfig{{Name: "legacy"}}},
+		{Enabled: true, Path: "/github"},
+	}
+	for _, aggregate := range invalid {
+		cfg := Config{Servers: append([]ServerConfig(nil), servers...), Aggregate: aggregate}
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", aggregate)
+		}
+	}
+}
+
+func TestValidateReplicas(t *testing.T) {
+	cfg := Config{BaseURLs: []string{"http://replica-a:8000", "http://replica-b:8000"}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	if cfg.BaseURL != "http://replica-a:8000" {
+		t.Errorf("Expected the first replica as base URL, got %s", cfg.BaseURL)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected validation to be repeatable, got %v", err)
+	}
+
+	invalid := []Config{
+		{BaseURL: "http://other:8000", BaseURLs: []string{"http://replica-a:8000"}},
+		{BaseURLs: []string{"http://replica-a:8000"}, LoadBalancing: LoadBalancingConfig{Strategy: "random"}},
+		{TransportMode: StdioTransport, Stdio: StdioConfig{Enabled: true, UserCommand: "server"}, BaseURLs: []string{"http://replica-a:8000"}},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Expected %+v to be rejected", c)
+		}
+	}
+}
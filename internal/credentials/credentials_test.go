@@ -0,0 +1,268 @@
+package credentials
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+var testKey = base64.StdEncoding.EncodeToString([]byte("0123456789abcdef0123456789abcdef"))
+
+func TestVaultEncryptsAndBindsEntries(t *testing.T) {
+	vault, err := NewVault(config.CredentialsConfig{EncryptionKey: testKey})
+	if err != nil {
+		t.Fatalf("NewVault failed: %v", err)
+	}
+	backing := store.NewMemoryStore()
+	vault.store = backing
+
+	if err := vault.Put("alice", "github", &Credential{AccessToken: "ghp_secret"}); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	cred, err := vault.Get("alice", "github")
+	if err != nil || cred == nil || cred.AccessToken != "ghp_secret" {
+		t.Fatalf("Expected the stored credential, got %+v (%v)", cred, err)
+	}
+
+	// Nothing readable is stored, and entries cannot be moved to another user
+	var sealed string
+	aliceKey := subjectPrefix("alice") + "github"
+	backing.Get(aliceKey, &sealed)
+	if strings.Contains(sealed, "ghp_secret") {
+		t.Errorf("Credential is stored in plain text")
+	}
+	backing.Put(subjectPrefix("bob")+"github", sealed, 0)
+	if _, err := vault.Get("bob", "github"); err == nil {
+		t.Errorf("Expected a credential copied to another subject to fail decryption")
+	}
+}
+
+func TestVaultGeneratesKeyFile(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "credentials.key")
+	cfg := config.CredentialsConfig{EncryptionKeyFile: keyFile}
+	if _, err := NewVault(cfg); err != nil {
+		t.Fatalf("NewVault failed: %v", err)
+	}
+	first, err := os.ReadFile(keyFile)
+	if err != nil {
+		t.Fatalf("Expected the key file to be written: %v", err)
+	}
+	if _, err := NewVault(cfg); err != nil {
+		t.Fatalf("NewVault failed: %v", err)
+	}
+	second, _ := os.ReadFile(keyFile)
+	if string(first) != string(second) {
+		t.Errorf("Expected the existing key to be reused")
+	}
+
+	if _, err := NewVault(config.CredentialsConfig{EncryptionKey: "c2hvcnQ="}); err == nil {
+		t.Errorf("Expected a short key to be rejected")
+	}
+}
+
+func newTestManager(t *testing.T, tokenURL string) *Manager {
+	t.Helper()
+	m, err := NewManager(config.CredentialsConfig{
+		EncryptionKey: testKey,
+		Providers: []config.CredentialProviderConfig{
+			{Name: "jira", Header: "X-Jira-Token", Format: "token {token}", Env: "JIRA_TOKEN"},
+			{Name: "github", Header: "X-GitHub-Token", OAuth: &config.CredentialOAuthConfig{
+				AuthorizationURL: "https://github.example.com/login/oauth/authorize",
+				TokenURL:         tokenURL,
+				ClientID:         "proxy-app",
+				ClientSecret:     "app-secret",
+				Scopes:           []string{"repo"},
+			}},
+		},
+	}, "https://proxy.example.com")
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+	return m
+}
+
+func authenticateAs(subject string) Authenticator {
+	return func(r *http.Request) (string, error) {
+		if r.Header.Get("Authorization") != "Bearer "+subject {
+			return "", errors.New("invalid token")
+		}
+		return subject, nil
+	}
+}
+
+func TestHandlerStoresAndAppliesCredentials(t *testing.T) {
+	m := newTestManager(t, "https://github.example.com/token")
+	handler := m.Handler(authenticateAs("alice"))
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/credentials/jira", `{"access_token":"jira-1"}`, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/credentials/unknown", `{"access_token":"x"}`, "alice"); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown provider, got %d", rec.Code)
+	}
+	if rec := do(http.MethodPut, "/credentials/jira", `{"access_token":"jira-1"}`, "alice"); rec.Code != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := do(http.MethodGet, "/credentials", "", "alice")
+	var statuses []credentialStatus
+	json.NewDecoder(rec.Body).Decode(&statuses)
+	if len(statuses) != 2 || !statuses[0].Connected || statuses[1].Connected || !statuses[1].Connectable {
+		t.Errorf("Unexpected credential listing: %+v", statuses)
+	}
+
+	h := http.Header{}
+	m.Apply(h, "alice")
+	if got := h.Get("X-Jira-Token"); got != "token jira-1" {
+		t.Errorf("Expected the Jira credential header, got %q", got)
+	}
+	other := http.Header{}
+	m.Apply(other, "bob")
+	if len(other) != 0 {
+		t.Errorf("Expected no credentials for another user, got %v", other)
+	}
+	if env := m.Env("alice"); len(env) != 1 || env[0] != "JIRA_TOKEN=jira-1" {
+		t.Errorf("Expected the Jira credential in the environment, got %v", env)
+	}
+	if env := m.Env("bob"); len(env) != 0 {
+		t.Errorf("Expected no environment for another user, got %v", env)
+	}
+
+	if rec := do(http.MethodDelete, "/credentials/jira", "", "alice"); rec.Code != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d", rec.Code)
+	}
+	if cred, _ := m.vault.Get("alice", "jira"); cred != nil {
+		t.Errorf("Expected the credential to be deleted")
+	}
+}
+
+func TestConnectFlowAndRefresh(t *testing.T) {
+	var refreshed bool
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.PostForm.Get("client_id") != "proxy-app" || r.PostForm.Get("client_secret") != "app-secret" {
+			t.Errorf("Expected the app's client credentials")
+		}
+		switch r.PostForm.Get("grant_type") {
+		case "authorization_code":
+			if r.PostForm.Get("code") != "auth-code" || r.PostForm.Get("code_verifier") == "" {
+				t.Errorf("Unexpected code exchange: %v", r.PostForm)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "gh-1", "refresh_token": "gh-refresh", "expires_in": 60})
+		case "refresh_token":
+			refreshed = r.PostForm.Get("refresh_token") == "gh-refresh"
+			json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "gh-2", "expires_in": 3600})
+		}
+	}))
+	defer thirdParty.Close()
+
+	m := newTestManager(t, thirdParty.URL)
+	handler := m.Handler(authenticateAs("alice"))
+
+	connect := func() (url.Values, *http.Cookie) {
+		req := httptest.NewRequest(http.MethodPost, "/credentials/github/connect", nil)
+		req.Header.Set("Authorization", "Bearer alice")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		var body map[string]string
+		json.NewDecoder(rec.Body).Decode(&body)
+		authURL, err := url.Parse(body["authorization_url"])
+		if err != nil || authURL.Host != "github.example.com" {
+			t.Fatalf("Unexpected authorization URL %q", body["authorization_url"])
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != "/credentials/github/callback" {
+			t.Fatalf("Expected an HttpOnly connect cookie for the callback, got %+v", cookies)
+		}
+		return authURL.Query(), cookies[0]
+	}
+	callback := func(q url.Values, cookie *http.Cookie) int {
+		req := httptest.NewRequest(http.MethodGet, "/credentials/github/callback?code=auth-code&state="+url.QueryEscape(q.Get("state")), nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	// A victim's browser completing someone else's flow has no connect cookie
+	q, _ := connect()
+	if code := callback(q, nil); code != http.StatusBadRequest {
+		t.Errorf("Expected a callback without the connect cookie to be rejected, got %d", code)
+	}
+	if cred, _ := m.vault.Get("alice", "github"); cred != nil {
+		t.Fatalf("Expected no credential to be stored")
+	}
+
+	q, cookie := connect()
+	if q.Get("redirect_uri") != "https://proxy.example.com/credentials/github/callback" || q.Get("code_challenge") == "" || q.Get("scope") != "repo" {
+		t.Errorf("Unexpected authorization request: %v", q)
+	}
+	if code := callback(q, cookie); code != http.StatusOK {
+		t.Fatalf("Expected the callback to succeed, got %d", code)
+	}
+	if code := callback(q, cookie); code != http.StatusBadRequest {
+		t.Errorf("Expected a reused state to be rejected, got %d", code)
+	}
+
+	// The credential expires within the refresh margin and is refreshed on use
+	m.now = func() time.Time { return time.Now().Add(45 * time.Second) }
+	h := http.Header{}
+	m.Apply(h, "alice")
+	if got := h.Get("X-GitHub-Token"); got != "Bearer gh-2" || !refreshed {
+		t.Errorf("Expected the refreshed credential, got %q (refreshed=%v)", got, refreshed)
+	}
+	if cred, _ := m.vault.Get("alice", "github"); cred == nil || cred.RefreshToken != "gh-refresh" {
+		t.Errorf("Expected the refresh token to be kept, got %+v", cred)
+	}
+	if len(m.refreshing) != 0 {
+		t.Errorf("Expected no refresh locks to be left behind, got %d", len(m.refreshing))
+	}
+}
+
+func TestNewManagerValidatesProviders(t *testing.T) {
+	invalid := [][]config.CredentialProviderConfig{
+		nil,
+		{{Name: "Bad Name", Header: "X-Token"}},
+		{{Name: "jira"}},
+		{{Name: "jira", Header: "X-Token", Format: "static"}},
+		{{Name: "jira", Header: "X-Token"}, {Name: "jira", Header: "X-Other"}},
+		{{Name: "github", Header: "X-Token", OAuth: &config.CredentialOAuthConfig{ClientID: "app"}}},
+		{{Name: "jira", Env: "JIRA-TOKEN"}},
+	}
+	for _, providers := range invalid {
+		if _, err := NewManager(config.CredentialsConfig{EncryptionKey: testKey, Providers: providers}, "https://proxy.example.com"); err == nil {
+			t.Errorf("Expected %+v to be rejected", providers)
+		}
+	}
+
+	valid := []config.CredentialProviderConfig{{Name: "jira", Env: "JIRA_TOKEN"}}
+	if _, err := NewManager(config.CredentialsConfig{EncryptionKey: testKey, Providers: valid}, "https://proxy.example.com"); err != nil {
+		t.Errorf("Expected a provider with only env to be accepted, got %v", err)
+	}
+	if _, err := NewManager(config.CredentialsConfig{EncryptionKey: testKey, Providers: valid}, ""); err == nil {
+		t.Errorf("Expected a missing base URL to be rejected")
+	}
+}
@@ -0,0 +1,192 @@
+package credentials
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// Authenticator returns the subject of the access token on a request
+type Authenticator func(r *http.Request) (string, error)
+
+// credentialStatus describes one provider in the credential listing
+type credentialStatus struct {
+	Provider    string     `json:"provider"`
+	Connected   bool       `json:"connected"`
+	Connectable bool       `json:"connectable"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// storeRequest is the body of PUT /credentials/{provider}
+type storeRequest struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+}
+
+// Handler serves the credential API under /credentials:
+//
+//	GET    /credentials                     lists providers and the caller's credentials
+//	PUT    /credentials/{provider}          stores the caller's token
+//	DELETE /credentials/{provider}          removes it
+//	POST   /credentials/{provider}/connect  starts the OAuth connect flow
+//	GET    /credentials/{provider}/callback completes it
+//
+// All but the callback require the caller's access token. The callback must
+// be reached by the browser that made the connect request.
+func (m *Manager) Handler(authenticate Authenticator) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/credentials"), "/")
+		parts := strings.Split(rest, "/")
+		if rest == "" {
+			parts = nil
+		}
+
+		// The callback is reached by the user's browser, authenticated by its state
+		if len(parts) == 2 && parts[1] == "callback" {
+			m.handleCallback(w, r, parts[0])
+			return
+		}
+
+		subject, err := authenticate(r)
+		if err != nil || subject == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case len(parts) == 0 && r.Method == http.MethodGet:
+			m.handleList(w, subject)
+		case len(parts) == 1:
+			p, ok := m.providers[parts[0]]
+			if !ok {
+				http.Error(w, "Unknown credential provider", http.StatusNotFound)
+				return
+			}
+			switch r.Method {
+			case http.MethodPut:
+				m.handleStore(w, r, subject, p.Name)
+			case http.MethodDelete:
+				if err := m.vault.Delete(subject, p.Name); err != nil {
+					logger.Error("Failed to delete %s credential: %v", p.Name, err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				w.WriteHeader(http.StatusNoContent)
+			default:
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			}
+		case len(parts) == 2 && parts[1] == "connect":
+			p, ok := m.providers[parts[0]]
+			if !ok || p.OAuth == nil {
+				http.Error(w, "Credential provider does not support connect", http.StatusNotFound)
+				return
+			}
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]string{"authorization_url": m.startConnect(w, subject, p)})
+		default:
+			http.NotFound(w, r)
+		}
+	}
+}
+
+func (m *Manager) handleList(w http.ResponseWriter, subject string) {
+	statuses := make([]credentialStatus, 0, len(m.order))
+	for _, name := range m.order {
+		status := credentialStatus{Provider: name, Connectable: m.providers[name].OAuth != nil}
+		cred, err := m.vault.Get(subject, name)
+		if err != nil {
+			logger.Warn("Failed to load %s credential: %v", name, err)
+		}
+		if cred != nil {
+			status.Connected = true
+			status.UpdatedAt = &cred.UpdatedAt
+			if !cred.ExpiresAt.IsZero() {
+				status.ExpiresAt = &cred.ExpiresAt
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (m *Manager) handleStore(w http.ResponseWriter, r *http.Request, subject, provider string) {
+	var req storeRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&req); err != nil || req.AccessToken == "" {
+		http.Error(w, "Bad request: access_token is required", http.StatusBadRequest)
+		return
+	}
+
+	now := m.now()
+	cred := &Credential{AccessToken: req.AccessToken, RefreshToken: req.RefreshToken, UpdatedAt: now}
+	if req.ExpiresIn > 0 {
+		cred.ExpiresAt = now.Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+	if err := m.vault.Put(subject, provider, cred); err != nil {
+		logger.Error("Failed to store %s credential: %v", provider, err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (m *Manager) handleCallback(w http.ResponseWriter, r *http.Request, name string) {
+	p, ok := m.providers[name]
+	if !ok || p.OAuth == nil {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		http.Error(w, fmt.Sprintf("Authorization failed: %s", e), http.StatusBadRequest)
+		return
+	}
+	var binding string
+	if cookie, err := r.Cookie(connectCookie); err == nil {
+		binding = cookie.Value
+	}
+	// The cookie is only needed once
+	http.SetCookie(w, &http.Cookie{Name: connectCookie, Path: r.URL.Path, MaxAge: -1, HttpOnly: true})
+	if err := m.finishConnect(p, q.Get("state"), q.Get("code"), binding); err != nil {
+		logger.Warn("Failed to connect %s credential: %v", name, err)
+		http.Error(w, "Failed to connect: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html><html><body><p>Connected %s. You can close this window.</p></body></html>", html.EscapeString(name))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("Failed to encode response: %v", err)
+	}
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err) // crypto/rand does not fail on supported platforms
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,369 @@
+package credentials
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const (
+	defaultFormat    = "Bearer {token}"
+	tokenPlaceholder = "{token}"
+	connectStateTTL  = 10 * time.Minute
+	// Credentials are refreshed this long before they expire
+	refreshMargin = 30 * time.Second
+)
+
+// connectCookie binds a connect flow to the browser that started it
+const connectCookie = "mcp_credentials_connect"
+
+var (
+	providerNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	envNamePattern      = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+type connectState struct {
+	subject      string
+	provider     string
+	codeVerifier string
+	redirectURI  string
+	// Hash of the connect cookie set on the browser that started the flow
+	binding   [sha256.Size]byte
+	expiresAt time.Time
+}
+
+// refreshLock serializes the refreshes of one credential
+type refreshLock struct {
+	sync.Mutex
+	// Requests holding or waiting for the lock; guarded by Manager.mu
+	refs int
+}
+
+// Manager serves the credential API and the OAuth connect flow, and adds
+// stored credentials to upstream requests
+type Manager struct {
+	vault     *Vault
+	providers map[string]config.CredentialProviderConfig
+	order     []string
+	baseURL   string
+	client    *http.Client
+	now       func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*connectState
+	// Per-credential locks so that a refresh token is only redeemed once
+	refreshing map[string]*refreshLock
+}
+
+// NewManager validates the provider configuration and opens the vault.
+// baseURL is the proxy's public URL used in OAuth callback URLs.
+func NewManager(cfg config.CredentialsConfig, baseURL string) (*Manager, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("credentials requires the proxy base URL")
+	}
+	m := &Manager{
+		providers:  make(map[string]config.CredentialProviderConfig),
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		client:     httpclient.Client(httpclient.DestinationIdP),
+		now:        time.Now,
+		states:     make(map[string]*connectState),
+		refreshing: make(map[string]*refreshLock),
+	}
+	for _, p := range cfg.Providers {
+		if !providerNamePattern.MatchString(p.Name) {
+			return nil, fmt.Errorf("invalid credential provider name %q", p.Name)
+		}
+		if _, dup := m.providers[p.Name]; dup {
+			return nil, fmt.Errorf("duplicate credential provider %q", p.Name)
+		}
+		if p.Header == "" && p.Env == "" {
+			return nil, fmt.Errorf("credential provider %s requires a header or env", p.Name)
+		}
+		if p.Env != "" && !envNamePattern.MatchString(p.Env) {
+			return nil, fmt.Errorf("credential provider %s has an invalid env name %q", p.Name, p.Env)
+		}
+		if p.Format != "" && !strings.Contains(p.Format, tokenPlaceholder) {
+			return nil, fmt.Errorf("credential provider %s format must contain %s", p.Name, tokenPlaceholder)
+		}
+		if p.OAuth != nil && (p.OAuth.AuthorizationURL == "" || p.OAuth.TokenURL == "" || p.OAuth.ClientID == "") {
+			return nil, fmt.Errorf("credential provider %s oauth requires authorization_url, token_url and client_id", p.Name)
+		}
+		m.providers[p.Name] = p
+		m.order = append(m.order, p.Name)
+	}
+	if len(m.providers) == 0 {
+		return nil, fmt.Errorf("credentials requires at least one provider")
+	}
+
+	vault, err := NewVault(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.vault = vault
+	return m, nil
+}
+
+// Apply sets the subject's stored credentials on upstream request headers,
+// refreshing expired OAuth credentials first
+func (m *Manager) Apply(h http.Header, subject string) {
+	for _, name := range m.order {
+		p := m.providers[name]
+		if p.Header == "" {
+			continue
+		}
+		cred, err := m.credential(subject, p)
+		if err != nil {
+			logger.Warn("Failed to load %s credential for %s: %v", name, subject, err)
+			continue
+		}
+		if cred == nil {
+			continue
+		}
+		format := p.Format
+		if format == "" {
+			format = defaultFormat
+		}
+		h.Set(p.Header, strings.ReplaceAll(format, tokenPlaceholder, cred.AccessToken))
+	}
+}
+
+// Env returns the subject's stored credentials as NAME=value environment
+// variables for their own MCP server subprocess, refreshing them first
+func (m *Manager) Env(subject string) []string {
+	var env []string
+	for _, name := range m.order {
+		p := m.providers[name]
+		if p.Env == "" {
+			continue
+		}
+		cred, err := m.credential(subject, p)
+		if err != nil {
+			logger.Warn("Failed to load %s credential for %s: %v", name, subject, err)
+			continue
+		}
+		if cred != nil {
+			env = append(env, p.Env+"="+cred.AccessToken)
+		}
+	}
+	return env
+}
+
+// credential returns a usable credential, refreshing it if needed. Expired
+// credentials that cannot be refreshed are not returned.
+func (m *Manager) credential(subject string, p config.CredentialProviderConfig) (*Credential, error) {
+	cred, err := m.vault.Get(subject, p.Name)
+	if err != nil || cred == nil {
+		return nil, err
+	}
+	if !cred.Expired(m.now().Add(refreshMargin)) {
+		return cred, nil
+	}
+	if p.OAuth == nil || cred.RefreshToken == "" {
+		if cred.Expired(m.now()) {
+			return nil, nil
+		}
+		return cred, nil
+	}
+
+	key := subject + "\x00" + p.Name
+	lock := m.lockRefresh(key)
+	defer m.unlockRefresh(key, lock)
+
+	// Another request may have refreshed it meanwhile
+	if cred, err = m.vault.Get(subject, p.Name); err != nil || cred == nil {
+		return nil, err
+	}
+	if !cred.Expired(m.now().Add(refreshMargin)) {
+		return cred, nil
+	}
+
+	refreshed, err := m.requestToken(p.OAuth, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {cred.RefreshToken},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("refresh failed: %w", err)
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = cred.RefreshToken
+	}
+	if err := m.vault.Put(subject, p.Name, refreshed); err != nil {
+		return nil, err
+	}
+	return refreshed, nil
+}
+
+// lockRefresh locks the refresh of one credential
+func (m *Manager) lockRefresh(key string) *refreshLock {
+	m.mu.Lock()
+	lock, ok := m.refreshing[key]
+	if !ok {
+		lock = &refreshLock{}
+		m.refreshing[key] = lock
+	}
+	lock.refs++
+	m.mu.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+// unlockRefresh unlocks the refresh and forgets the lock once nobody holds or waits for it
+func (m *Manager) unlockRefresh(key string, lock *refreshLock) {
+	lock.Unlock()
+
+	m.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(m.refreshing, key)
+	}
+	m.mu.Unlock()
+}
+
+// requestToken calls the third party's token endpoint
+func (m *Manager) requestToken(oauth *config.CredentialOAuthConfig, form url.Values) (*Credential, error) {
+	form.Set("client_id", oauth.ClientID)
+	if oauth.ClientSecret != "" {
+		form.Set("client_secret", oauth.ClientSecret)
+	}
+	req, err := http.NewRequest(http.MethodPost, oauth.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// Some providers, such as GitHub, answer form-encoded unless JSON is requested
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Error        string `json:"error"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("unexpected token response (%d)", resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK || result.Error != "" || result.AccessToken == "" {
+		return nil, fmt.Errorf("token endpoint error (%d): %s", resp.StatusCode, result.Error)
+	}
+
+	now := m.now()
+	cred := &Credential{AccessToken: result.AccessToken, RefreshToken: result.RefreshToken, UpdatedAt: now}
+	if result.ExpiresIn > 0 {
+		cred.ExpiresAt = now.Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return cred, nil
+}
+
+// startConnect records the connect state and returns the third party's
+// authorization URL. The state is bound to a cookie on the browser that
+// starts the flow, so that nobody else can complete it with their own
+// third-party account.
+func (m *Manager) startConnect(w http.ResponseWriter, subject string, p config.CredentialProviderConfig) string {
+	state := randomString(24)
+	verifier := randomString(32)
+	binding := randomString(24)
+	callbackPath := "/credentials/" + p.Name + "/callback"
+	redirectURI := m.baseURL + callbackPath
+
+	secure := strings.HasPrefix(m.baseURL, "https://")
+	cookie := &http.Cookie{
+		Name:     connectCookie,
+		Value:    binding,
+		Path:     callbackPath,
+		MaxAge:   int(connectStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   secure,
+		SameSite: http.SameSiteLaxMode,
+	}
+	if secure {
+		// Browser apps on another origin start the flow with a credentialed request
+		cookie.SameSite = http.SameSiteNoneMode
+	}
+	http.SetCookie(w, cookie)
+
+	m.mu.Lock()
+	for k, s := range m.states {
+		if m.now().After(s.expiresAt) {
+			delete(m.states, k)
+		}
+	}
+	m.states[state] = &connectState{
+		subject:      subject,
+		provider:     p.Name,
+		codeVerifier: verifier,
+		redirectURI:  redirectURI,
+		binding:      sha256.Sum256([]byte(binding)),
+		expiresAt:    m.now().Add(connectStateTTL),
+	}
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(verifier))
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.OAuth.ClientID},
+		"redirect_uri":          {redirectURI},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	if len(p.OAuth.Scopes) > 0 {
+		query.Set("scope", strings.Join(p.OAuth.Scopes, " "))
+	}
+	sep := "?"
+	if strings.Contains(p.OAuth.AuthorizationURL, "?") {
+		sep = "&"
+	}
+	return p.OAuth.AuthorizationURL + sep + query.Encode()
+}
+
+// finishConnect redeems the authorization code of a connect flow and stores
+// the credential. binding is the connect cookie of the browser completing it.
+func (m *Manager) finishConnect(p config.CredentialProviderConfig, state, code, binding string) error {
+	m.mu.Lock()
+	s := m.states[state]
+	delete(m.states, state) // States are single use
+	m.mu.Unlock()
+
+	if s == nil || m.now().After(s.expiresAt) || s.provider != p.Name {
+		return fmt.Errorf("unknown or expired connect state")
+	}
+	if sum := sha256.Sum256([]byte(binding)); subtle.ConstantTimeCompare(sum[:], s.binding[:]) != 1 {
+		return fmt.Errorf("connect flow was started by another browser")
+	}
+
+	cred, err := m.requestToken(p.OAuth, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {s.redirectURI},
+		"code_verifier": {s.codeVerifier},
+	})
+	if err != nil {
+		return err
+	}
+	if err := m.vault.Put(s.subject, p.Name, cred); err != nil {
+		return err
+	}
+	logger.Info("Connected %s credential for %s", p.Name, s.subject)
+	return nil
+}
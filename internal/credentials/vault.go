@@ -0,0 +1,162 @@
+// Package credentials keeps each user's credentials for third-party APIs,
+// encrypted at rest, and adds them to requests forwarded to the MCP server.
+package credentials
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+const credentialPrefix = "credential:"
+
+// Credential is a user's token for one third-party API
+type Credential struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token,omitempty"`
+	ExpiresAt    time.Time `json:"expires_at,omitempty"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// Expired reports whether the credential has passed its expiry time
+func (c *Credential) Expired(now time.Time) bool {
+	return !c.ExpiresAt.IsZero() && !now.Before(c.ExpiresAt)
+}
+
+// Vault stores credentials encrypted with AES-GCM. Each entry is bound to its
+// subject and provider, so ciphertexts cannot be moved between users.
+type Vault struct {
+	store store.Store
+	aead  cipher.AEAD
+}
+
+// NewVault opens the credential store with the configured encryption key
+func NewVault(cfg config.CredentialsConfig) (*Vault, error) {
+	key, err := loadOrGenerateKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := store.New(cfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credential store: %w", err)
+	}
+	return &Vault{store: s, aead: aead}, nil
+}
+
+// loadOrGenerateKey reads the 32-byte encryption key, generating and saving
+// one when the configured key file does not exist yet
+func loadOrGenerateKey(cfg config.CredentialsConfig) ([]byte, error) {
+	if cfg.EncryptionKey != "" {
+		return decodeKey(cfg.EncryptionKey)
+	}
+
+	if cfg.EncryptionKeyFile != "" {
+		data, err := os.ReadFile(cfg.EncryptionKeyFile)
+		if err == nil {
+			return decodeKey(strings.TrimSpace(string(data)))
+		}
+		if !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read credential encryption key: %w", err)
+		}
+	}
+
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return nil, fmt.Errorf("failed to generate credential encryption key: %w", err)
+	}
+	if cfg.EncryptionKeyFile != "" {
+		if err := os.WriteFile(cfg.EncryptionKeyFile, []byte(base64.StdEncoding.EncodeToString(key)), 0o600); err != nil {
+			return nil, fmt.Errorf("failed to write credential encryption key: %w", err)
+		}
+		logger.Info("Generated credential encryption key at %s", cfg.EncryptionKeyFile)
+	} else {
+		logger.Warn("Using an ephemeral credential encryption key; stored credentials will not survive a restart")
+	}
+	return key, nil
+}
+
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("credential encryption key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("credential encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// subjectPrefix is the store prefix of a subject's credentials. Subjects are
+// hashed so that the store does not reveal who has stored credentials.
+func subjectPrefix(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return credentialPrefix + hex.EncodeToString(sum[:]) + ":"
+}
+
+// Get returns the subject's credential for the provider, if any
+func (v *Vault) Get(subject, provider string) (*Credential, error) {
+	var sealed string
+	key := subjectPrefix(subject) + provider
+	found, err := v.store.Get(key, &sealed)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < v.aead.NonceSize() {
+		return nil, fmt.Errorf("corrupt credential entry")
+	}
+	nonce, ciphertext := data[:v.aead.NonceSize()], data[v.aead.NonceSize():]
+	plaintext, err := v.aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credential: %w", err)
+	}
+
+	var cred Credential
+	if err := json.Unmarshal(plaintext, &cred); err != nil {
+		return nil, fmt.Errorf("failed to decode credential: %w", err)
+	}
+	return &cred, nil
+}
+
+// Put encrypts and stores the subject's credential for the provider
+func (v *Vault) Put(subject, provider string, cred *Credential) error {
+	plaintext, err := json.Marshal(cred)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, v.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	key := subjectPrefix(subject) + provider
+	sealed := v.aead.Seal(nonce, nonce, plaintext, []byte(key))
+	return v.store.Put(key, base64.StdEncoding.EncodeToString(sealed), 0)
+}
+
+// Delete removes the subject's credential for the provider
+func (v *Vault) Delete(subject, provider string) error {
+	return v.store.Delete(subjectPrefix(subject) + provider)
+}
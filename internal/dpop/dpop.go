@@ -0,0 +1,353 @@
+// Package dpop validates DPoP proofs (RFC 9449) that bind access tokens to a
+// key held by the client.
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+// HeaderName is the request header carrying the proof
+const HeaderName = "DPoP"
+
+// Error codes returned in WWW-Authenticate challenges and token endpoint errors
+const (
+	ErrorInvalidProof = "invalid_dpop_proof"
+	ErrorInvalidToken = "invalid_token"
+)
+
+const (
+	proofType     = "dpop+jwt"
+	defaultMaxAge = 5 * time.Minute
+	jtiPrefix     = "dpop-jti:"
+)
+
+// DefaultSigningAlgs are the proof algorithms accepted when none are configured
+var DefaultSigningAlgs = []string{"ES256", "ES384", "RS256", "PS256"}
+
+var supportedAlgs = map[string]bool{
+	"ES256": true, "ES384": true, "ES512": true,
+	"RS256": true, "RS384": true, "RS512": true,
+	"PS256": true, "PS384": true, "PS512": true,
+}
+
+// Error is a rejected proof or token. Code is the OAuth error code to report.
+type Error struct {
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	return e.Description
+}
+
+func invalidProof(format string, args ...interface{}) error {
+	return &Error{Code: ErrorInvalidProof, Description: fmt.Sprintf(format, args...)}
+}
+
+// Algorithms returns the proof algorithms accepted under the configuration
+func Algorithms(cfg config.DPoPConfig) []string {
+	if len(cfg.SigningAlgs) == 0 {
+		return DefaultSigningAlgs
+	}
+	return cfg.SigningAlgs
+}
+
+// Verifier checks DPoP proofs and remembers their jti values to reject replays
+type Verifier struct {
+	algs    []string
+	maxAge  time.Duration
+	baseURL string
+	store   store.Store
+	now     func() time.Time
+
+	// Serializes the replay check and the jti write
+	mu sync.Mutex
+}
+
+// New creates a Verifier. baseURL is the externally visible URL of the
+// server the proofs are addressed to; when empty it is derived from each request.
+func New(cfg config.DPoPConfig, baseURL string) (*Verifier, error) {
+	algs := Algorithms(cfg)
+	for _, alg := range algs {
+		if !supportedAlgs[alg] {
+			return nil, fmt.Errorf("unsupported DPoP signing algorithm %q", alg)
+		}
+	}
+
+	s, err := store.New(cfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DPoP replay store: %w", err)
+	}
+
+	maxAge := defaultMaxAge
+	if cfg.MaxAgeSeconds > 0 {
+		maxAge = time.Duration(cfg.MaxAgeSeconds) * time.Second
+	}
+	return &Verifier{
+		algs:    algs,
+		maxAge:  maxAge,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		store:   s,
+		now:     time.Now,
+	}, nil
+}
+
+// Algorithms returns the accepted proof algorithms
+func (v *Verifier) Algorithms() []string {
+	return v.algs
+}
+
+// Verify checks the request's proof for an access token and that the token is
+// bound to the proof key through its cnf.jkt claim
+func (v *Verifier) Verify(r *http.Request, accessToken string, claims jwt.MapClaims) error {
+	jkt, err := v.VerifyProof(r, accessToken)
+	if err != nil {
+		return err
+	}
+
+	bound := BoundThumbprint(claims)
+	if bound == "" {
+		return &Error{Code: ErrorInvalidToken, Description: "access token is not bound to a DPoP key"}
+	}
+	if subtle.ConstantTimeCompare([]byte(bound), []byte(jkt)) != 1 {
+		return &Error{Code: ErrorInvalidToken, Description: "access token is bound to a different DPoP key"}
+	}
+	return nil
+}
+
+// VerifyProof validates the request's DPoP proof and returns the JWK thumbprint
+// of its key. The ath claim is checked when accessToken is not empty.
+func (v *Verifier) VerifyProof(r *http.Request, accessToken string) (string, error) {
+	proofs := r.Header.Values(HeaderName)
+	if len(proofs) != 1 {
+		return "", invalidProof("exactly one DPoP proof is required")
+	}
+
+	var jwk map[string]interface{}
+	parser := &jwt.Parser{ValidMethods: v.algs, SkipClaimsValidation: true}
+	token, err := parser.Parse(proofs[0], func(t *jwt.Token) (interface{}, error) {
+		if typ, _ := t.Header["typ"].(string); typ != proofType {
+			return nil, fmt.Errorf("typ must be %s", proofType)
+		}
+		jwk, _ = t.Header["jwk"].(map[string]interface{})
+		if jwk == nil {
+			return nil, fmt.Errorf("missing jwk header")
+		}
+		return publicKey(jwk)
+	})
+	if err != nil || !token.Valid {
+		return "", invalidProof("invalid DPoP proof: %v", err)
+	}
+	claims := token.Claims.(jwt.MapClaims)
+
+	if htm, _ := claims["htm"].(string); htm != r.Method {
+		return "", invalidProof("DPoP proof htm does not match the request method")
+	}
+	htu, _ := claims["htu"].(string)
+	if !sameURL(htu, v.requestURL(r)) {
+		return "", invalidProof("DPoP proof htu does not match the request URL")
+	}
+
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return "", invalidProof("DPoP proof is missing iat")
+	}
+	now := v.now()
+	if math.Abs(now.Sub(time.Unix(int64(iat), 0)).Seconds()) > v.maxAge.Seconds() {
+		return "", invalidProof("DPoP proof iat is outside the accepted window")
+	}
+
+	if accessToken != "" {
+		sum := sha256.Sum256([]byte(accessToken))
+		ath, _ := claims["ath"].(string)
+		if subtle.ConstantTimeCompare([]byte(ath), []byte(base64.RawURLEncoding.EncodeToString(sum[:]))) != 1 {
+			return "", invalidProof("DPoP proof ath does not match the access token")
+		}
+	}
+
+	jkt, err := Thumbprint(jwk)
+	if err != nil {
+		return "", invalidProof("invalid DPoP proof key: %v", err)
+	}
+
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return "", invalidProof("DPoP proof is missing jti")
+	}
+	if err := v.markUsed(jkt, jti); err != nil {
+		return "", err
+	}
+	return jkt, nil
+}
+
+// markUsed records the jti until any proof carrying it would be too old to accept
+func (v *Verifier) markUsed(jkt, jti string) error {
+	sum := sha256.Sum256([]byte(jkt + ":" + jti))
+	key := jtiPrefix + base64.RawURLEncoding.EncodeToString(sum[:])
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var seen bool
+	found, err := v.store.Get(key, &seen)
+	if err != nil {
+		return fmt.Errorf("DPoP replay check failed: %w", err)
+	}
+	if found {
+		return invalidProof("DPoP proof has already been used")
+	}
+	if err := v.store.Put(key, true, 2*v.maxAge); err != nil {
+		return fmt.Errorf("DPoP replay check failed: %w", err)
+	}
+	return nil
+}
+
+// requestURL is the URL the client addressed, without query or fragment
+func (v *Verifier) requestURL(r *http.Request) string {
+	if v.baseURL != "" {
+		return v.baseURL + r.URL.Path
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+	return scheme + "://" + r.Host + r.URL.Path
+}
+
+// sameURL compares htu with the request URL, ignoring query, fragment and the
+// case of the scheme and host
+func sameURL(htu, expected string) bool {
+	a, err := url.Parse(htu)
+	if err != nil {
+		return false
+	}
+	b, err := url.Parse(expected)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(a.Scheme, b.Scheme) && strings.EqualFold(a.Host, b.Host) && a.Path == b.Path
+}
+
+// BoundThumbprint returns the cnf.jkt claim of an access token, if any
+func BoundThumbprint(claims jwt.MapClaims) string {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	jkt, _ := cnf["jkt"].(string)
+	return jkt
+}
+
+// Thumbprint computes the RFC 7638 SHA-256 thumbprint of a public JWK
+func Thumbprint(jwk map[string]interface{}) (string, error) {
+	str := func(name string) (string, error) {
+		v, _ := jwk[name].(string)
+		if v == "" {
+			return "", fmt.Errorf("missing %s", name)
+		}
+		return v, nil
+	}
+
+	// Only the required members, in lexicographic order
+	var members []string
+	switch kty, _ := jwk["kty"].(string); kty {
+	case "EC":
+		members = []string{"crv", "kty", "x", "y"}
+	case "RSA":
+		members = []string{"e", "kty", "n"}
+	default:
+		return "", fmt.Errorf("unsupported key type %q", kty)
+	}
+
+	canonical := make(map[string]string, len(members))
+	for _, m := range members {
+		v, err := str(m)
+		if err != nil {
+			return "", err
+		}
+		canonical[m] = v
+	}
+	// encoding/json writes map keys in sorted order without whitespace
+	data, err := json.Marshal(canonical)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// publicKey converts a public JWK into a key usable for signature verification
+func publicKey(jwk map[string]interface{}) (interface{}, error) {
+	if _, ok := jwk["d"]; ok {
+		return nil, fmt.Errorf("jwk must not contain a private key")
+	}
+
+	decode := func(name string) (*big.Int, error) {
+		s, _ := jwk[name].(string)
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		if err != nil || len(b) == 0 {
+			return nil, fmt.Errorf("invalid jwk member %s", name)
+		}
+		return new(big.Int).SetBytes(b), nil
+	}
+
+	switch kty, _ := jwk["kty"].(string); kty {
+	case "EC":
+		var curve elliptic.Curve
+		switch crv, _ := jwk["crv"].(string); crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", crv)
+		}
+		x, err := decode("x")
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode("y")
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("jwk point is not on the curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "RSA":
+		n, err := decode("n")
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode("e")
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > math.MaxInt32 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", kty)
+	}
+}
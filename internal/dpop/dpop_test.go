@@ -0,0 +1,182 @@
+package dpop
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+const testURL = "https://proxy.example.com/mcp"
+
+func newKey(t *testing.T) (*ecdsa.PrivateKey, map[string]interface{}) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	jwk := map[string]interface{}{
+		"kty": "EC",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}
+	return key, jwk
+}
+
+func newProof(t *testing.T, key *ecdsa.PrivateKey, jwk map[string]interface{}, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["typ"] = "dpop+jwt"
+	token.Header["jwk"] = jwk
+	proof, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign proof: %v", err)
+	}
+	return proof
+}
+
+func ath(accessToken string) string {
+	sum := sha256.Sum256([]byte(accessToken))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestThumbprintMatchesRFC7638Example(t *testing.T) {
+	jwk := map[string]interface{}{
+		"kty": "RSA",
+		"n":   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		"e":   "AQAB",
+		"alg": "RS256",
+		"kid": "2011-04-29",
+	}
+	got, err := Thumbprint(jwk)
+	if err != nil {
+		t.Fatalf("Thumbprint failed: %v", err)
+	}
+	if want := "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"; got != want {
+		t.Errorf("Expected thumbprint %s, got %s", want, got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	key, jwk := newKey(t)
+	jkt, _ := Thumbprint(jwk)
+	otherKey, otherJWK := newKey(t)
+	accessToken := "access-token"
+	boundClaims := jwt.MapClaims{"cnf": map[string]interface{}{"jkt": jkt}}
+
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"htm": http.MethodPost,
+			"htu": testURL,
+			"iat": time.Now().Unix(),
+			"jti": base64.RawURLEncoding.EncodeToString([]byte(time.Now().String())),
+			"ath": ath(accessToken),
+		}
+	}
+
+	tests := []struct {
+		name     string
+		proof    func() string
+		claims   jwt.MapClaims
+		wantCode string
+	}{
+		{"valid proof", func() string { return newProof(t, key, jwk, validClaims()) }, boundClaims, ""},
+		{"wrong method", func() string {
+			c := validClaims()
+			c["htm"] = http.MethodGet
+			return newProof(t, key, jwk, c)
+		}, boundClaims, ErrorInvalidProof},
+		{"wrong URL", func() string {
+			c := validClaims()
+			c["htu"] = "https://proxy.example.com/other"
+			return newProof(t, key, jwk, c)
+		}, boundClaims, ErrorInvalidProof},
+		{"query ignored", func() string {
+			c := validClaims()
+			c["htu"] = "HTTPS://Proxy.Example.com/mcp?session=1"
+			return newProof(t, key, jwk, c)
+		}, boundClaims, ""},
+		{"stale iat", func() string {
+			c := validClaims()
+			c["iat"] = time.Now().Add(-10 * time.Minute).Unix()
+			return newProof(t, key, jwk, c)
+		}, boundClaims, ErrorInvalidProof},
+		{"wrong access token hash", func() string {
+			c := validClaims()
+			c["ath"] = ath("another-token")
+			return newProof(t, key, jwk, c)
+		}, boundClaims, ErrorInvalidProof},
+		{"signed with another key", func() string { return newProof(t, otherKey, jwk, validClaims()) }, boundClaims, ErrorInvalidProof},
+		{"token bound to another key", func() string { return newProof(t, otherKey, otherJWK, validClaims()) }, boundClaims, ErrorInvalidToken},
+		{"unbound token", func() string { return newProof(t, key, jwk, validClaims()) }, jwt.MapClaims{}, ErrorInvalidToken},
+		{"missing proof", func() string { return "" }, boundClaims, ErrorInvalidProof},
+	}
+
+	verifier, err := New(config.DPoPConfig{}, "https://proxy.example.com")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/mcp?session=1", nil)
+			if proof := tc.proof(); proof != "" {
+				req.Header.Set(HeaderName, proof)
+			}
+			err := verifier.Verify(req, accessToken, tc.claims)
+			if tc.wantCode == "" {
+				if err != nil {
+					t.Errorf("Expected the proof to be accepted: %v", err)
+				}
+				return
+			}
+			dpopErr, ok := err.(*Error)
+			if !ok || dpopErr.Code != tc.wantCode {
+				t.Errorf("Expected %s error, got %v", tc.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestVerifyProofRejectsReplay(t *testing.T) {
+	key, jwk := newKey(t)
+	verifier, err := New(config.DPoPConfig{}, "")
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	proof := newProof(t, key, jwk, jwt.MapClaims{
+		"htm": http.MethodPost,
+		"htu": "http://localhost:8080/token",
+		"iat": time.Now().Unix(),
+		"jti": "one-time",
+	})
+	newRequest := func() *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "http://localhost:8080/token", nil)
+		req.Header.Set(HeaderName, proof)
+		return req
+	}
+
+	if _, err := verifier.VerifyProof(newRequest(), ""); err != nil {
+		t.Fatalf("Expected the first use to be accepted: %v", err)
+	}
+	if _, err := verifier.VerifyProof(newRequest(), ""); err == nil {
+		t.Errorf("Expected the replayed proof to be rejected")
+	}
+}
+
+func TestNewRejectsUnsupportedAlgorithms(t *testing.T) {
+	for _, alg := range []string{"none", "HS256"} {
+		if _, err := New(config.DPoPConfig{SigningAlgs: []string{alg}}, ""); err == nil {
+			t.Errorf("Expected %s to be rejected", alg)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+// Package httpclient builds the HTTP clients the proxy uses for outbound calls,
+// so that trust, client certificates, proxies and timeouts are configured once.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// Destinations of outbound calls
+const (
+	DestinationJWKS           = "jwks"            // Signing key downloads
+	DestinationIdP            = "idp"             // Discovery, registration and admin APIs, proxied OAuth endpoints
+	DestinationUpstream       = "upstream"        // The MCP server
+	DestinationClientMetadata = "client_metadata" // Client metadata documents
+	DestinationWebhook        = "webhook"         // Approval notifications
+)
+
+// Default timeouts; the upstream has none because SSE streams are long-lived
+// and requests are bounded by timeout_seconds instead
+var defaultTimeouts = map[string]time.Duration{
+	DestinationJWKS:           10 * time.Second,
+	DestinationIdP:            15 * time.Second,
+	DestinationClientMetadata: 10 * time.Second,
+	DestinationWebhook:        10 * time.Second,
+}
+
+type destination struct {
+	transport *http.Transport
+	tlsConfig *tls.Config
+	timeout   time.Duration
+}
+
+var (
+	mu           sync.RWMutex
+	outbound     config.OutboundConfig
+	destinations = make(map[string]*destination)
+)
+
+// Configure validates the outbound configuration and replaces the clients
+// for all destinations
+func Configure(cfg config.OutboundConfig) error {
+	for name := range cfg.Destinations {
+		if _, ok := defaultTimeouts[name]; !ok && name != DestinationUpstream {
+			return fmt.Errorf("unknown outbound destination %q", name)
+		}
+	}
+
+	built := make(map[string]*destination)
+	for _, name := range []string{DestinationJWKS, DestinationIdP, DestinationUpstream, DestinationClientMetadata, DestinationWebhook} {
+		d, err := build(cfg, name)
+		if err != nil {
+			return fmt.Errorf("outbound %s: %w", name, err)
+		}
+		built[name] = d
+	}
+
+	mu.Lock()
+	outbound = cfg
+	destinations = built
+	mu.Unlock()
+	return nil
+}
+
+// Client returns an HTTP client for the destination
+func Client(dest string) *http.Client {
+	d := get(dest)
+	return &http.Client{Transport: d.transport, Timeout: d.timeout}
+}
+
+// Transport returns the shared transport for the destination
+func Transport(dest string) *http.Transport {
+	return get(dest).transport
+}
+
+// TLSConfig returns a copy of the TLS configuration for the destination, for
+// callers that need their own transport
+func TLSConfig(dest string) *tls.Config {
+	return get(dest).tlsConfig.Clone()
+}
+
+// Timeout returns the configured timeout for the destination
+func Timeout(dest string) time.Duration {
+	return get(dest).timeout
+}
+
+func get(dest string) *destination {
+	mu.RLock()
+	d, ok := destinations[dest]
+	cfg := outbound
+	mu.RUnlock()
+	if ok {
+		return d
+	}
+
+	// Not configured yet, e.g. in tests: build from the current settings
+	d, err := build(cfg, dest)
+	if err != nil {
+		logger.Warn("Invalid outbound configuration for %s, using defaults: %v", dest, err)
+		d, _ = build(config.OutboundConfig{}, dest)
+	}
+
+	mu.Lock()
+	if existing, ok := destinations[dest]; ok {
+		d = existing
+	} else {
+		destinations[dest] = d
+	}
+	mu.Unlock()
+	return d
+}
+
+func build(cfg config.OutboundConfig, name string) (*destination, error) {
+	tlsCfg := cfg.TLS
+	timeout := defaultTimeouts[name]
+	if override, ok := cfg.Destinations[name]; ok {
+		if override.TLS != nil {
+			tlsCfg = *override.TLS
+		}
+		if override.TimeoutSeconds > 0 {
+			timeout = time.Duration(override.TimeoutSeconds) * time.Second
+		}
+	}
+
+	tlsConfig, err := buildTLSConfig(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	if tlsCfg.InsecureSkipVerify {
+		logger.Warn("TLS certificate verification is disabled for outbound %s calls", name)
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid proxy URL %q", cfg.Proxy)
+		}
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	transport := &http.Transport{
+		Proxy: proxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSClientConfig:       tlsConfig,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	return &destination{transport: transport, tlsConfig: tlsConfig, timeout: timeout}, nil
+}
+
+func buildTLSConfig(cfg config.OutboundTLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+
+	switch cfg.MinVersion {
+	case "", "1.2":
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("unsupported min_version %q", cfg.MinVersion)
+	}
+
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
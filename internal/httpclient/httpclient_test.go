@@ -0,0 +1,157 @@
+package httpclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+// newClientCertificate creates a self-signed client certificate and returns its files
+func newClientCertificate(t *testing.T) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "proxy"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+	cert, _ = x509.ParseCertificate(der)
+	return writePEM(t, "client.pem", "CERTIFICATE", der), writePEM(t, "client-key.pem", "EC PRIVATE KEY", keyDER), cert
+}
+
+func TestConfigureTrustsCustomCA(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	t.Cleanup(func() { Configure(config.OutboundConfig{}) })
+
+	// Certificate verification is never skipped by default
+	if err := Configure(config.OutboundConfig{}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	if _, err := Client(DestinationJWKS).Get(server.URL); err == nil {
+		t.Errorf("Expected an untrusted certificate to be rejected")
+	}
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	if err := Configure(config.OutboundConfig{TLS: config.OutboundTLSConfig{CAFile: caFile}}); err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+	resp, err := Client(DestinationJWKS).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the custom CA to be trusted: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestConfigureClientCertificate(t *testing.T) {
+	certFile, keyFile, cert := newClientCertificate(t)
+
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(cert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+	t.Cleanup(func() { Configure(config.OutboundConfig{}) })
+
+	caFile := writePEM(t, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	err := Configure(config.OutboundConfig{
+		TLS: config.OutboundTLSConfig{CAFile: caFile},
+		Destinations: map[string]config.OutboundDestinationConfig{
+			DestinationUpstream: {TLS: &config.OutboundTLSConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	if resp, err := Client(DestinationUpstream).Get(server.URL); err != nil {
+		t.Errorf("Expected mutual TLS to succeed: %v", err)
+	} else {
+		resp.Body.Close()
+	}
+	if _, err := Client(DestinationIdP).Get(server.URL); err == nil {
+		t.Errorf("Expected a destination without a client certificate to be rejected")
+	}
+}
+
+func TestConfigureSettings(t *testing.T) {
+	t.Cleanup(func() { Configure(config.OutboundConfig{}) })
+
+	err := Configure(config.OutboundConfig{
+		TLS:   config.OutboundTLSConfig{MinVersion: "1.3"},
+		Proxy: "http://proxy.internal:3128",
+		Destinations: map[string]config.OutboundDestinationConfig{
+			DestinationJWKS: {TimeoutSeconds: 3},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Configure failed: %v", err)
+	}
+
+	if got := Transport(DestinationIdP).TLSClientConfig.MinVersion; got != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3 minimum, got %x", got)
+	}
+	if Transport(DestinationIdP).TLSClientConfig.InsecureSkipVerify {
+		t.Errorf("Expected certificate verification to stay enabled")
+	}
+	if got := Timeout(DestinationJWKS); got != 3*time.Second {
+		t.Errorf("Expected 3s JWKS timeout, got %v", got)
+	}
+	if got := Timeout(DestinationIdP); got != defaultTimeouts[DestinationIdP] {
+		t.Errorf("Expected default IdP timeout, got %v", got)
+	}
+
+	req := &http.Request{URL: &url.URL{Scheme: "https", Host: "idp.example.com"}}
+	if proxyURL, _ := Transport(DestinationIdP).Proxy(req); proxyURL == nil || proxyURL.Host != "proxy.internal:3128" {
+		t.Errorf("Expected the configured proxy, got %v", proxyURL)
+	}
+}
+
+func TestConfigureRejectsInvalidSettings(t *testing.T) {
+	tests := map[string]config.OutboundConfig{
+		"min version":    {TLS: config.OutboundTLSConfig{MinVersion: "1.0"}},
+		"missing CA":     {TLS: config.OutboundTLSConfig{CAFile: "/nonexistent/ca.pem"}},
+		"proxy URL":      {Proxy: "::not a url"},
+		"destination":    {Destinations: map[string]config.OutboundDestinationConfig{"jwk": {}}},
+		"client keypair": {TLS: config.OutboundTLSConfig{CertFile: "/nonexistent/cert.pem"}},
+	}
+	for name, cfg := range tests {
+		if err := Configure(cfg); err == nil {
+			t.Errorf("%s: expected configuration to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+// Package injection flags tool descriptions and tool results that look like
+// prompt injection: text hidden from the user, instructions aimed at the
+// model, and markdown that makes the client fetch external URLs.
+package injection
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/inspect"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// Rule sets
+const (
+	HiddenUnicode = "hidden_unicode" // Unicode tag characters, which render as nothing but spell out text
+	ZeroWidth     = "zero_width"     // Zero-width spaces and bidirectional control characters
+	Instructions  = "instructions"   // Phrases that address the model, such as "ignore previous instructions"
+	ExternalLinks = "external_links" // Markdown links and images pointing to hosts that are not allowed
+)
+
+// Where a finding was made
+const (
+	TargetToolDescription = "tool_description"
+	TargetToolResult      = "tool_result"
+)
+
+// RuleSets returns the names of all rule sets
+func RuleSets() []string {
+	return []string{HiddenUnicode, ZeroWidth, Instructions, ExternalLinks}
+}
+
+var (
+	tagCharacters = regexp.MustCompile(`[\x{E0000}-\x{E007F}]+`)
+	// Zero-width joiners are left out: emoji and several scripts need them
+	zeroWidth    = regexp.MustCompile(`[\x{180E}\x{200B}\x{200E}\x{200F}\x{202A}-\x{202E}\x{2060}-\x{2064}\x{2066}-\x{2069}\x{FEFF}]+`)
+	instructions = regexp.MustCompile(`(?i)\b(?:` +
+		`(?:ignore|disregard|forget|override)\s+(?:all\s+|any\s+)?(?:of\s+)?(?:the\s+|your\s+)?(?:previous|prior|above|earlier|preceding|system)\s+(?:instructions|prompts?|messages|rules|directions)` +
+		`|(?:new|updated)\s+system\s+prompt` +
+		`|(?:do\s+not|don'?t)\s+(?:tell|inform|mention\s+(?:this\s+)?to|reveal\s+(?:this\s+)?to|show\s+(?:this\s+)?to)\s+the\s+user` +
+		`|you\s+are\s+now\s+in\s+(?:developer|god|jailbreak)\s+mode` +
+		`)\b|</?\s*(?:important|system|instructions?)\s*>`)
+	// Images with external sources are fetched as soon as they are rendered,
+	// so data placed in their URL leaves without a click
+	markdownLink = regexp.MustCompile(`(!?)\[([^\]]*)\]\(\s*<?(https?://[^)\s>]+)>?(?:\s+"[^"]*")?\s*\)`)
+	htmlImage    = regexp.MustCompile(`(?i)<img\b[^>]*\bsrc\s*=\s*["']?(https?://[^"'\s>]+)[^>]*>`)
+)
+
+// Finding is what the rule sets found in one tool description or tool result
+type Finding struct {
+	Target   string           // TargetToolDescription or TargetToolResult
+	Tool     string           // The tool whose description matched
+	Findings inspect.Findings // Matches by rule set
+	Action   string           // The strongest action of the matched rule sets
+}
+
+// blockedData is the structured data member of the error that replaces a blocked result
+type blockedData struct {
+	Reason string   `json:"reason"`
+	Rules  []string `json:"rules"`
+}
+
+// Scanner applies the enabled rule sets
+type Scanner struct {
+	actions      map[string]string
+	allowedHosts []string
+}
+
+// New creates a scanner. Rule sets take the configured action, or the default one.
+func New(cfg config.InjectionConfig) (*Scanner, error) {
+	s := &Scanner{actions: make(map[string]string), allowedHosts: cfg.AllowedLinkHosts}
+	for _, rule := range RuleSets() {
+		s.actions[rule] = cfg.Action
+	}
+	for rule, action := range cfg.Rules {
+		if _, ok := s.actions[rule]; !ok {
+			return nil, fmt.Errorf("unknown injection rule set %q; known rule sets are %s", rule, strings.Join(RuleSets(), ", "))
+		}
+		s.actions[rule] = action
+	}
+	for rule, action := range s.actions {
+		if action == config.InjectionOff || action == "" {
+			delete(s.actions, rule)
+		}
+	}
+	return s, nil
+}
+
+// Scan checks text against the enabled rule sets. It returns the text with
+// the matches of rule sets that strip removed.
+func (s *Scanner) Scan(text string) (string, inspect.Findings) {
+	findings := inspect.Findings{}
+	for _, rule := range RuleSets() {
+		action, ok := s.actions[rule]
+		if !ok {
+			continue
+		}
+		var n int
+		var stripped string
+		switch rule {
+		case HiddenUnicode:
+			stripped, n = replace(tagCharacters, text, func([]string) string { return "" })
+		case ZeroWidth:
+			stripped, n = replace(zeroWidth, text, func([]string) string { return "" })
+		case Instructions:
+			stripped, n = replace(instructions, text, func([]string) string { return "" })
+		case ExternalLinks:
+			stripped, n = s.stripLinks(text)
+		}
+		if n == 0 {
+			continue
+		}
+		findings[rule] = n
+		if action == config.InjectionStrip {
+			text = stripped
+		}
+	}
+	return text, findings
+}
+
+// stripLinks replaces external links with their text and removes external images
+func (s *Scanner) stripLinks(text string) (string, int) {
+	total := 0
+	text, n := replace(markdownLink, text, func(m []string) string {
+		if s.allowed(m[3]) {
+			return m[0]
+		}
+		if m[1] == "!" {
+			return ""
+		}
+		return m[2]
+	})
+	total += n
+	text, n = replace(htmlImage, text, func(m []string) string {
+		if s.allowed(m[1]) {
+			return m[0]
+		}
+		return ""
+	})
+	return text, total + n
+}
+
+func (s *Scanner) allowed(link string) bool {
+	u, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range s.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// replace replaces the matches of re, counting those whose replacement differs
+func replace(re *regexp.Regexp, text string, fn func(match []string) string) (string, int) {
+	n := 0
+	text = re.ReplaceAllStringFunc(text, func(match string) string {
+		replacement := fn(re.FindStringSubmatch(match))
+		if replacement != match {
+			n++
+		}
+		return replacement
+	})
+	return text, n
+}
+
+// action returns the strongest action of the matched rule sets
+func (s *Scanner) action(findings inspect.Findings) string {
+	strongest := config.InjectionWarn
+	for rule := range findings {
+		switch s.actions[rule] {
+		case config.InjectionBlock:
+			return config.InjectionBlock
+		case config.InjectionStrip:
+			strongest = config.InjectionStrip
+		}
+	}
+	return strongest
+}
+
+// Message checks the tool descriptions of a tools/list result or the text of
+// a tool result in a JSON-RPC message, and applies the actions in place.
+// Tools whose description is blocked are removed from the listing; a blocked
+// tool result is replaced by a JSON-RPC error. It reports whether the message
+// changed.
+func (s *Scanner) Message(msg map[string]json.RawMessage) ([]Finding, bool, error) {
+	raw := msg["result"]
+	if len(raw) == 0 {
+		return nil, false, nil
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, false, err
+	}
+	if tools, ok := fields["tools"]; ok {
+		return s.toolList(msg, fields, tools)
+	}
+	if _, ok := fields["content"]; !ok {
+		if _, ok := fields["structuredContent"]; !ok {
+			return nil, false, nil
+		}
+	}
+
+	findings := inspect.Findings{}
+	stripped, err := inspect.RewriteResult(raw, func(text string) string {
+		stripped, found := s.Scan(text)
+		for rule, n := range found {
+			findings[rule] += n
+		}
+		return stripped
+	})
+	if err != nil || len(findings) == 0 {
+		return nil, false, err
+	}
+
+	finding := Finding{Target: TargetToolResult, Findings: findings, Action: s.action(findings)}
+	switch finding.Action {
+	case config.InjectionBlock:
+		rpcErr, err := json.Marshal(util.RPCError{
+			Code:    util.RPCErrorContentBlocked,
+			Message: "The result was withheld because it looks like prompt injection",
+			Data:    blockedData{Reason: "prompt_injection", Rules: findings.Names()},
+		})
+		if err != nil {
+			return nil, false, err
+		}
+		delete(msg, "result")
+		msg["error"] = rpcErr
+		return []Finding{finding}, true, nil
+	case config.InjectionStrip:
+		if stripped != nil {
+			msg["result"] = stripped
+			return []Finding{finding}, true, nil
+		}
+	}
+	return []Finding{finding}, false, nil
+}
+
+// toolList checks the definitions in a tools/list result. Every string of a
+// definition reaches the model, so all of them are checked except the name,
+// which clients need unchanged to call the tool.
+func (s *Scanner) toolList(msg, fields map[string]json.RawMessage, raw json.RawMessage) ([]Finding, bool, error) {
+	var tools []map[string]any
+	if err := json.Unmarshal(raw, &tools); err != nil {
+		return nil, false, fmt.Errorf("invalid tools: %w", err)
+	}
+
+	var result []Finding
+	modified := false
+	kept := make([]map[string]any, 0, len(tools))
+	for _, tool := range tools {
+		name, _ := tool["name"].(string)
+		findings := inspect.Findings{}
+		changed := false
+		for key, value := range tool {
+			if key == "name" || key == "_meta" {
+				continue
+			}
+			var c bool
+			if tool[key], c = inspect.RewriteStrings(value, func(text string) string {
+				stripped, found := s.Scan(text)
+				for rule, n := range found {
+					findings[rule] += n
+				}
+				return stripped
+			}); c {
+				changed = true
+			}
+		}
+		if len(findings) == 0 {
+			kept = append(kept, tool)
+			continue
+		}
+
+		finding := Finding{Target: TargetToolDescription, Tool: name, Findings: findings, Action: s.action(findings)}
+		result = append(result, finding)
+		if finding.Action == config.InjectionBlock {
+			modified = true
+			continue
+		}
+		kept = append(kept, tool)
+		if changed {
+			modified = true
+		}
+	}
+	if !modified {
+		return result, false, nil
+	}
+
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return nil, false, err
+	}
+	fields["tools"] = data
+	if msg["result"], err = json.Marshal(fields); err != nil {
+		return nil, false, err
+	}
+	return result, true, nil
+}
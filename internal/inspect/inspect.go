@@ -0,0 +1,258 @@
+// Package inspect finds secrets and personal data in the text of MCP tool
+// results, so that they can be redacted before the result reaches the client
+// and the language model behind it.
+package inspect
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// detector finds one kind of sensitive content. When the expression has a
+// capture group, only the first group is sensitive; the rest of the match is
+// context, such as the name of a key.
+type detector struct {
+	name  string
+	re    *regexp.Regexp
+	check func(match string) bool // Optional test that rules out false positives
+}
+
+var builtins = []detector{
+	{name: "aws_access_key", re: regexp.MustCompile(`\b(?:AKIA|ASIA|ABIA|ACCA)[0-9A-Z]{16}\b`)},
+	{name: "aws_secret_key", re: regexp.MustCompile(`(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?([A-Za-z0-9/+]{40})\b`)},
+	{name: "gcp_api_key", re: regexp.MustCompile(`\bAIza[0-9A-Za-z_\-]{35}`)},
+	// PEM private keys, including the private_key of GCP service account files
+	{name: "private_key", re: regexp.MustCompile(`-----BEGIN (?:[A-Z]+ )?PRIVATE KEY-----[\s\S]*?-----END (?:[A-Z]+ )?PRIVATE KEY-----`)},
+	{name: "credit_card", re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), check: luhn},
+	{name: "email", re: regexp.MustCompile(`\b[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}\b`)},
+}
+
+// Detectors returns the names of the built-in detectors
+func Detectors() []string {
+	names := make([]string, len(builtins))
+	for i, d := range builtins {
+		names[i] = d.name
+	}
+	return names
+}
+
+// Findings counts matches by detector
+type Findings map[string]int
+
+// Names returns the detectors that matched, sorted
+func (f Findings) Names() []string {
+	names := make([]string, 0, len(f))
+	for name := range f {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f Findings) add(other Findings) {
+	for name, n := range other {
+		f[name] += n
+	}
+}
+
+// Inspector applies the configured detectors
+type Inspector struct {
+	detectors []detector
+}
+
+// New creates an inspector with the configured built-in detectors, or all of
+// them when none are listed, followed by the configured patterns
+func New(cfg config.InspectionConfig) (*Inspector, error) {
+	i := &Inspector{}
+	if len(cfg.Detectors) == 0 {
+		i.detectors = append(i.detectors, builtins...)
+	}
+	for _, name := range cfg.Detectors {
+		found := false
+		for _, d := range builtins {
+			if d.name == name {
+				i.detectors = append(i.detectors, d)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown inspection detector %q; known detectors are %s",
+				name, strings.Join(Detectors(), ", "))
+		}
+	}
+	for _, p := range cfg.Patterns {
+		re, err := regexp.Compile(p.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex of inspection pattern %s: %w", p.Name, err)
+		}
+		i.detectors = append(i.detectors, detector{name: p.Name, re: re})
+	}
+	return i, nil
+}
+
+// Scan finds sensitive content in text and returns the text with each match
+// replaced by [REDACTED:<detector>]
+func (i *Inspector) Scan(text string) (string, Findings) {
+	findings := Findings{}
+	for _, d := range i.detectors {
+		text = d.redact(text, findings)
+	}
+	return text, findings
+}
+
+func (d detector) redact(text string, findings Findings) string {
+	matches := d.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		if start == end || (d.check != nil && !d.check(text[start:end])) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString("[REDACTED:" + d.name + "]")
+		last = end
+		findings[d.name]++
+	}
+	if last == 0 {
+		return text
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+// Result inspects the text a tool result carries. It returns the redacted
+// result, or nil when nothing was found.
+func (i *Inspector) Result(result json.RawMessage) (json.RawMessage, Findings, error) {
+	findings := Findings{}
+	redacted, err := RewriteResult(result, func(text string) string {
+		redacted, found := i.Scan(text)
+		findings.add(found)
+		return redacted
+	})
+	return redacted, findings, err
+}
+
+// RewriteResult calls fn with each text a tools/call result carries: text
+// content, embedded text resources and the strings of structured content. It
+// returns the result with the texts fn returned, or nil when none changed.
+func RewriteResult(result json.RawMessage, fn func(text string) string) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return nil, err
+	}
+	modified := false
+
+	if raw, ok := fields["content"]; ok {
+		var content []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &content); err != nil {
+			return nil, fmt.Errorf("invalid content: %w", err)
+		}
+		changed := false
+		for _, item := range content {
+			if rewriteField(item, "text", fn) {
+				changed = true
+			}
+			if resource, ok := item["resource"]; ok {
+				var fields map[string]json.RawMessage
+				if json.Unmarshal(resource, &fields) == nil && rewriteField(fields, "text", fn) {
+					item["resource"], _ = json.Marshal(fields)
+					changed = true
+				}
+			}
+		}
+		if changed {
+			fields["content"], _ = json.Marshal(content)
+			modified = true
+		}
+	}
+
+	if raw, ok := fields["structuredContent"]; ok {
+		var structured any
+		if err := json.Unmarshal(raw, &structured); err != nil {
+			return nil, fmt.Errorf("invalid structuredContent: %w", err)
+		}
+		if structured, changed := RewriteStrings(structured, fn); changed {
+			fields["structuredContent"], _ = json.Marshal(structured)
+			modified = true
+		}
+	}
+
+	if !modified {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+// rewriteField applies fn to a string field of a JSON object in place
+func rewriteField(fields map[string]json.RawMessage, name string, fn func(string) string) bool {
+	var text string
+	if json.Unmarshal(fields[name], &text) != nil {
+		return false
+	}
+	rewritten := fn(text)
+	if rewritten == text {
+		return false
+	}
+	fields[name], _ = json.Marshal(rewritten)
+	return true
+}
+
+// RewriteStrings applies fn to every string in a decoded JSON value, in
+// place where it can, and reports whether any changed
+func RewriteStrings(v any, fn func(string) string) (any, bool) {
+	changed := false
+	switch v := v.(type) {
+	case string:
+		rewritten := fn(v)
+		return rewritten, rewritten != v
+	case map[string]any:
+		for key, value := range v {
+			var c bool
+			if v[key], c = RewriteStrings(value, fn); c {
+				changed = true
+			}
+		}
+	case []any:
+		for n, value := range v {
+			var c bool
+			if v[n], c = RewriteStrings(value, fn); c {
+				changed = true
+			}
+		}
+	}
+	return v, changed
+}
+
+// luhn reports whether a card number, possibly with spaces or dashes, has a valid check digit
+func luhn(number string) bool {
+	sum, digits := 0, 0
+	for n := len(number) - 1; n >= 0; n-- {
+		c := number[n]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+	return digits >= 13 && digits <= 19 && sum%10 == 0
+}
@@ -0,0 +1,437 @@
+// Package jsonschema validates JSON values against the subset of JSON Schema
+// used by the MCP specification and typical tool input schemas: types,
+// properties, required, items, enum, const, anyOf, oneOf, allOf, numeric and
+// length bounds, patterns and local $ref definitions. Other keywords are
+// ignored, so a schema is never stricter than it is meant to be.
+package jsonschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a compiled JSON schema
+type Schema struct {
+	Type                 []string
+	Properties           map[string]*Schema
+	Required             []string
+	AdditionalProperties *Schema // Nil allows any additional property
+	NoAdditional         bool    // additionalProperties: false
+	Items                *Schema
+	Enum                 []interface{}
+	Const                interface{}
+	HasConst             bool
+	AnyOf                []*Schema
+	OneOf                []*Schema
+	AllOf                []*Schema
+	Minimum              *float64
+	Maximum              *float64
+	MinLength            *int
+	MaxLength            *int
+	MinItems             *int
+	MaxItems             *int
+	Pattern              *regexp.Regexp
+	Ref                  string
+	Definitions          map[string]*Schema
+	// Keywords of the whole schema that cannot be checked, such as patterns
+	// Go cannot compile; they are ignored and the rest is still checked
+	Ignored []string
+
+	root *Schema
+}
+
+// ValidationError describes where a value does not match its schema
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+// rawSchema is the JSON form of a schema
+type rawSchema struct {
+	Type                 json.RawMessage            `json:"type"`
+	Properties           map[string]json.RawMessage `json:"properties"`
+	Required             []string                   `json:"required"`
+	AdditionalProperties json.RawMessage            `json:"additionalProperties"`
+	Items                json.RawMessage            `json:"items"`
+	Enum                 []interface{}              `json:"enum"`
+	Const                json.RawMessage            `json:"const"`
+	AnyOf                []json.RawMessage          `json:"anyOf"`
+	OneOf                []json.RawMessage          `json:"oneOf"`
+	AllOf                []json.RawMessage          `json:"allOf"`
+	Minimum              *float64                   `json:"minimum"`
+	Maximum              *float64                   `json:"maximum"`
+	MinLength            *int                       `json:"minLength"`
+	MaxLength            *int                       `json:"maxLength"`
+	MinItems             *int                       `json:"minItems"`
+	MaxItems             *int                       `json:"maxItems"`
+	Pattern              string                     `json:"pattern"`
+	Ref                  string                     `json:"$ref"`
+	Definitions          map[string]json.RawMessage `json:"definitions"`
+	Defs                 map[string]json.RawMessage `json:"$defs"`
+}
+
+// Compile parses a schema document. References are resolved against its definitions.
+func Compile(data []byte) (*Schema, error) {
+	root, err := parse(data, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := root.checkRefs(root, make(map[*Schema]bool)); err != nil {
+		return nil, err
+	}
+	return root, nil
+}
+
+func parse(data []byte, root *Schema) (*Schema, error) {
+	// Boolean schemas: true accepts everything, false nothing
+	switch strings.TrimSpace(string(data)) {
+	case "true":
+		return &Schema{root: root}, nil
+	case "false":
+		return &Schema{root: root, Type: []string{"never"}}, nil
+	}
+
+	var raw rawSchema
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	s := &Schema{
+		Required:  raw.Required,
+		Enum:      raw.Enum,
+		Minimum:   raw.Minimum,
+		Maximum:   raw.Maximum,
+		MinLength: raw.MinLength,
+		MaxLength: raw.MaxLength,
+		MinItems:  raw.MinItems,
+		MaxItems:  raw.MaxItems,
+		Ref:       raw.Ref,
+		root:      root,
+	}
+	if root == nil {
+		s.root = s
+	}
+
+	if len(raw.Type) > 0 {
+		var single string
+		if json.Unmarshal(raw.Type, &single) == nil {
+			s.Type = []string{single}
+		} else if err := json.Unmarshal(raw.Type, &s.Type); err != nil {
+			return nil, fmt.Errorf("invalid schema type: %s", raw.Type)
+		}
+	}
+	if raw.Pattern != "" {
+		// ECMA-262 patterns may use lookarounds and backreferences, which
+		// RE2 does not support
+		if pattern, err := regexp.Compile(raw.Pattern); err == nil {
+			s.Pattern = pattern
+		} else {
+			s.root.Ignored = append(s.root.Ignored, fmt.Sprintf("pattern %q (%v)", raw.Pattern, err))
+		}
+	}
+	if len(raw.Const) > 0 {
+		s.HasConst = true
+		json.Unmarshal(raw.Const, &s.Const)
+	}
+
+	var err error
+	sub := func(data json.RawMessage) *Schema {
+		if err != nil || len(data) == 0 {
+			return nil
+		}
+		var child *Schema
+		child, err = parse(data, s.root)
+		return child
+	}
+
+	if len(raw.Properties) > 0 {
+		s.Properties = make(map[string]*Schema, len(raw.Properties))
+		for name, data := range raw.Properties {
+			s.Properties[name] = sub(data)
+		}
+	}
+	if strings.TrimSpace(string(raw.AdditionalProperties)) == "false" {
+		s.NoAdditional = true
+	} else {
+		s.AdditionalProperties = sub(raw.AdditionalProperties)
+	}
+	s.Items = sub(raw.Items)
+	for _, data := range raw.AnyOf {
+		s.AnyOf = append(s.AnyOf, sub(data))
+	}
+	for _, data := range raw.OneOf {
+		s.OneOf = append(s.OneOf, sub(data))
+	}
+	for _, data := range raw.AllOf {
+		s.AllOf = append(s.AllOf, sub(data))
+	}
+	// Draft 2019-09 renamed definitions to $defs; both are resolved the same way
+	if len(raw.Definitions)+len(raw.Defs) > 0 {
+		s.Definitions = make(map[string]*Schema, len(raw.Definitions)+len(raw.Defs))
+		for name, data := range raw.Definitions {
+			s.Definitions[name] = sub(data)
+		}
+		for name, data := range raw.Defs {
+			s.Definitions[name] = sub(data)
+		}
+	}
+	return s, err
+}
+
+// checkRefs makes sure every reference in the schema resolves
+func (s *Schema) checkRefs(root *Schema, seen map[*Schema]bool) error {
+	if s == nil || seen[s] {
+		return nil
+	}
+	seen[s] = true
+	if s.Ref != "" && s.resolve() == nil {
+		return fmt.Errorf("unresolved schema reference %q", s.Ref)
+	}
+	children := []*Schema{s.AdditionalProperties, s.Items}
+	children = append(children, s.AnyOf...)
+	children = append(children, s.OneOf...)
+	children = append(children, s.AllOf...)
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if err := child.checkRefs(root, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) resolve() *Schema {
+	if s.Ref == "#" {
+		return s.root
+	}
+	for _, prefix := range []string{"#/definitions/", "#/$defs/"} {
+		if strings.HasPrefix(s.Ref, prefix) {
+			return s.root.Definitions[strings.TrimPrefix(s.Ref, prefix)]
+		}
+	}
+	return nil
+}
+
+// Validate checks a value decoded by encoding/json against the schema
+func (s *Schema) Validate(v interface{}) error {
+	return s.validate(v, "")
+}
+
+func (s *Schema) validate(v interface{}, path string) error {
+	if s.Ref != "" {
+		return s.resolve().validate(v, path)
+	}
+
+	if len(s.Type) > 0 && !s.matchesType(v) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("expected %s, got %s", strings.Join(s.Type, " or "), typeOf(v))}
+	}
+	if s.HasConst && !reflect.DeepEqual(v, s.Const) {
+		return &ValidationError{Path: path, Message: fmt.Sprintf("must be %v", s.Const)}
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if reflect.DeepEqual(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be one of %v", s.Enum)}
+		}
+	}
+	if err := s.validateBounds(v, path); err != nil {
+		return err
+	}
+
+	if len(s.AnyOf) > 0 {
+		var first error
+		matched := false
+		for _, alt := range s.AnyOf {
+			err := alt.validate(v, path)
+			if err == nil {
+				matched = true
+				break
+			}
+			if first == nil {
+				first = err
+			}
+		}
+		if !matched {
+			return &ValidationError{Path: path, Message: "does not match any allowed schema (" + first.Error() + ")"}
+		}
+	}
+
+	if len(s.OneOf) > 0 {
+		matches := 0
+		for _, alt := range s.OneOf {
+			if alt.validate(v, path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must match exactly one allowed schema, matches %d", matches)}
+		}
+	}
+	for _, part := range s.AllOf {
+		if err := part.validate(v, path); err != nil {
+			return err
+		}
+	}
+
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return s.validateObject(value, path)
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range value {
+				if err := s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateBounds checks the numeric, length and pattern constraints that apply to the value's type
+func (s *Schema) validateBounds(v interface{}, path string) error {
+	switch value := v.(type) {
+	case float64:
+		if s.Minimum != nil && value < *s.Minimum {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at least %v", *s.Minimum)}
+		}
+		if s.Maximum != nil && value > *s.Maximum {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at most %v", *s.Maximum)}
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.MinLength != nil && length < *s.MinLength {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at least %d characters", *s.MinLength)}
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must be at most %d characters", *s.MaxLength)}
+		}
+		if s.Pattern != nil && !s.Pattern.MatchString(value) {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must match %q", s.Pattern.String())}
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must have at least %d items", *s.MinItems)}
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("must have at most %d items", *s.MaxItems)}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) validateObject(obj map[string]interface{}, path string) error {
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			return &ValidationError{Path: path, Message: fmt.Sprintf("missing required property %q", name)}
+		}
+	}
+
+	// Sorted for deterministic error messages
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		childPath := name
+		if path != "" {
+			childPath = path + "." + name
+		}
+		if prop, ok := s.Properties[name]; ok {
+			if err := prop.validate(obj[name], childPath); err != nil {
+				return err
+			}
+			continue
+		}
+		if s.NoAdditional {
+			return &ValidationError{Path: childPath, Message: "unexpected property"}
+		}
+		if s.AdditionalProperties != nil {
+			if err := s.AdditionalProperties.validate(obj[name], childPath); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(v interface{}) bool {
+	for _, t := range s.Type {
+		switch t {
+		case "object":
+			if _, ok := v.(map[string]interface{}); ok {
+				return true
+			}
+		case "array":
+			if _, ok := v.([]interface{}); ok {
+				return true
+			}
+		case "string":
+			if _, ok := v.(string); ok {
+				return true
+			}
+		case "boolean":
+			if _, ok := v.(bool); ok {
+				return true
+			}
+		case "number":
+			if _, ok := v.(float64); ok {
+				return true
+			}
+		case "integer":
+			if n, ok := v.(float64); ok && n == math.Trunc(n) {
+				return true
+			}
+		case "null":
+			if v == nil {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func typeOf(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
@@ -0,0 +1,177 @@
+package jsonschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Invalid test JSON %s: %v", s, err)
+	}
+	return v
+}
+
+func TestValidate(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"definitions": {
+			"Id": {"type": ["string", "integer"]}
+		},
+		"type": "object",
+		"properties": {
+			"id": {"$ref": "#/definitions/Id"},
+			"level": {"enum": ["info", "error"]},
+			"kind": {"const": "ref/prompt"},
+			"count": {"type": "integer", "minimum": 1},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"labels": {"type": "object", "additionalProperties": {"type": "string"}},
+			"strict": {"type": "object", "additionalProperties": false, "properties": {"a": true}},
+			"either": {"anyOf": [{"type": "string"}, {"type": "object", "required": ["x"]}]}
+		},
+		"required": ["id"]
+	}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{`{"id": "a", "level": "info", "kind": "ref/prompt", "count": 2, "tags": ["x"], "labels": {"k": "v"}, "strict": {"a": 1}, "either": {"x": 1}, "extra": true}`, ""},
+		{`{"id": 1.5}`, "id: expected string or integer, got number"},
+		{`{}`, `missing required property "id"`},
+		{`[]`, "expected object, got array"},
+		{`{"id": 1, "level": "trace"}`, "level: must be one of"},
+		{`{"id": 1, "kind": "ref/resource"}`, "kind: must be ref/prompt"},
+		{`{"id": 1, "count": 0}`, "count: must be at least 1"},
+		{`{"id": 1, "tags": ["x", 2]}`, "tags[1]: expected string"},
+		{`{"id": 1, "labels": {"k": 1}}`, "labels.k: expected string"},
+		{`{"id": 1, "strict": {"b": 1}}`, "strict.b: unexpected property"},
+		{`{"id": 1, "either": {"y": 1}}`, "either: does not match any allowed schema"},
+	}
+	for _, tt := range tests {
+		err := schema.Validate(decode(t, tt.value))
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("Expected %s to be valid, got %v", tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected %s to fail with %q, got %v", tt.value, tt.err, err)
+		}
+	}
+}
+
+func TestValidateToolSchemaKeywords(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"$schema": "https://json-schema.org/draft/2020-12/schema",
+		"$defs": {
+			"Path": {"type": "string", "pattern": "^/[a-z/]*$", "maxLength": 16}
+		},
+		"type": "object",
+		"properties": {
+			"path": {"$ref": "#/$defs/Path"},
+			"name": {"type": "string", "minLength": 1, "format": "hostname"},
+			"limit": {"type": "integer", "maximum": 100},
+			"ids": {"type": "array", "minItems": 1, "maxItems": 2},
+			"mode": {"oneOf": [{"const": "fast"}, {"type": "string", "pattern": "^s"}]},
+			"window": {"allOf": [{"type": "number"}, {"minimum": 0}]}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("Compile failed: %v", err)
+	}
+
+	tests := []struct {
+		value string
+		err   string
+	}{
+		{`{"path": "/tmp", "name": "x", "limit": 100, "ids": [1], "mode": "slow", "window": 0.5}`, ""},
+		{`{"path": "/etc/../passwd"}`, "path: must match"},
+		{`{"path": "/aaaaaaaaaaaaaaaaaaaa"}`, "path: must be at most 16 characters"},
+		{`{"name": ""}`, "name: must be at least 1 characters"},
+		{`{"limit": 101}`, "limit: must be at most 100"},
+		{`{"ids": []}`, "ids: must have at least 1 items"},
+		{`{"ids": [1, 2, 3]}`, "ids: must have at most 2 items"},
+		{`{"mode": "turbo"}`, "mode: must match exactly one allowed schema, matches 0"},
+		{`{"window": -1}`, "window: must be at least 0"},
+	}
+	for _, tt := range tests {
+		err := schema.Validate(decode(t, tt.value))
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("Expected %s to be valid, got %v", tt.value, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Expected %s to fail with %q, got %v", tt.value, tt.err, err)
+		}
+	}
+}
+
+func TestCompileRejectsUnresolvedRefs(t *testing.T) {
+	if _, err := Compile([]byte(`{"properties": {"a": {"$ref": "#/definitions/Missing"}}}`)); err == nil {
+		t.Error("Expected an unresolved reference to be rejected")
+	}
+}
+
+func TestUnsupportedPatternIsIgnored(t *testing.T) {
+	schema, err := Compile([]byte(`{
+		"type": "object",
+		"properties": {
+			"password": {"type": "string", "pattern": "^(?=.*[0-9]).{8,}$"},
+			"user": {"type": "string", "pattern": "^[a-z]+$"}
+		},
+		"required": ["user"]
+	}`))
+	if err != nil {
+		t.Fatalf("Expected a schema with an unsupported pattern to compile, got %v", err)
+	}
+	if len(schema.Ignored) != 1 || !strings.Contains(schema.Ignored[0], "(?=") {
+		t.Errorf("Expected the unsupported pattern to be reported, got %v", schema.Ignored)
+	}
+	if err := schema.Validate(map[string]interface{}{"user": "alice", "password": "x"}); err != nil {
+		t.Errorf("Expected the unsupported pattern to be skipped, got %v", err)
+	}
+	if err := schema.Validate(map[string]interface{}{"user": "Alice1"}); err == nil {
+		t.Error("Expected the other keywords to still be checked")
+	}
+	if err := schema.Validate(map[string]interface{}{"password": "secret123"}); err == nil {
+		t.Error("Expected required properties to still be checked")
+	}
+}
+
+func TestMCPMethodSchema(t *testing.T) {
+	for _, version := range []string{"2024-11-05", "2025-03-26", "2025-06-18"} {
+		schema, err := MCPMethodSchema(version, "tools/call")
+		if err != nil || schema == nil {
+			t.Fatalf("Expected a tools/call schema for %s, got %v", version, err)
+		}
+		if err := schema.Validate(decode(t, `{"name": "search", "arguments": {"q": "x"}}`)); err != nil {
+			t.Errorf("Expected valid tools/call params for %s, got %v", version, err)
+		}
+		if err := schema.Validate(decode(t, `{"arguments": {}}`)); err == nil {
+			t.Errorf("Expected tools/call without a name to be rejected for %s", version)
+		}
+	}
+
+	// Titles were introduced in 2025-06-18 and must be strings
+	schema, _ := MCPMethodSchema("2025-06-18", "initialize")
+	params := decode(t, `{"protocolVersion": "2025-06-18", "capabilities": {}, "clientInfo": {"name": "c", "title": 1, "version": "1"}}`)
+	if err := schema.Validate(params); err == nil {
+		t.Error("Expected a non-string client title to be rejected")
+	}
+
+	if schema, _ := MCPMethodSchema("2099-01-01", "tools/call"); schema != nil {
+		t.Error("Expected no schema for an unknown protocol version")
+	}
+	if schema, _ := MCPMethodSchema("2025-06-18", "custom/method"); schema != nil {
+		t.Error("Expected no schema for an unknown method")
+	}
+}
@@ -0,0 +1,57 @@
+package jsonschema
+
+import (
+	"embed"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The params of MCP requests and notifications, one document per protocol
+// version. Each method is a definition named after it.
+//
+//go:embed mcp/*.json
+var mcpSchemas embed.FS
+
+var (
+	mcpOnce     sync.Once
+	mcpVersions map[string]*Schema
+	mcpErr      error
+)
+
+func loadMCPSchemas() {
+	mcpVersions = make(map[string]*Schema)
+	entries, err := mcpSchemas.ReadDir("mcp")
+	if err != nil {
+		mcpErr = err
+		return
+	}
+	for _, entry := range entries {
+		data, err := mcpSchemas.ReadFile(path.Join("mcp", entry.Name()))
+		if err != nil {
+			mcpErr = err
+			return
+		}
+		schema, err := Compile(data)
+		if err != nil {
+			mcpErr = fmt.Errorf("MCP schema %s: %w", entry.Name(), err)
+			return
+		}
+		mcpVersions[strings.TrimSuffix(entry.Name(), ".json")] = schema
+	}
+}
+
+// MCPMethodSchema returns the schema for the params of an MCP method in the
+// given protocol version, or nil when the version or method is not known
+func MCPMethodSchema(version, method string) (*Schema, error) {
+	mcpOnce.Do(loadMCPSchemas)
+	if mcpErr != nil {
+		return nil, mcpErr
+	}
+	doc := mcpVersions[version]
+	if doc == nil {
+		return nil, nil
+	}
+	return doc.Definitions[method], nil
+}
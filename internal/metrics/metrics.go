@@ -0,0 +1,123 @@
+// Package metrics keeps counters of proxy events and serves them in the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*Counter)
+)
+
+// Counter is a monotonically increasing count, partitioned by label values
+type Counter struct {
+	name   string
+	help   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]float64 // Keyed by the label values joined with a zero byte
+}
+
+// NewCounter registers a counter. Registering a name twice returns the first counter.
+func NewCounter(name, help string, labels ...string) *Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if c, ok := registry[name]; ok {
+		return c
+	}
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[string]float64)}
+	registry[name] = c
+	return c
+}
+
+// Inc adds one to the count for the label values, given in the order of the counter's labels
+func (c *Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add adds delta to the count for the label values
+func (c *Counter) Add(delta float64, values ...string) {
+	if len(values) != len(c.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", c.name, len(c.labels), len(values)))
+	}
+	key := strings.Join(values, "\x00")
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+// Value returns the count for the label values
+func (c *Counter) Value(values ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.values[strings.Join(values, "\x00")]
+}
+
+func (c *Counter) write(sb *strings.Builder) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s counter\n", c.name, escapeHelp(c.help), c.name)
+	keys := make([]string, 0, len(c.values))
+	for key := range c.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sb.WriteString(c.name)
+		if len(c.labels) > 0 {
+			values := strings.Split(key, "\x00")
+			pairs := make([]string, len(c.labels))
+			for i, label := range c.labels {
+				pairs[i] = fmt.Sprintf(`%s="%s"`, label, escapeLabel(values[i]))
+			}
+			sb.WriteString("{" + strings.Join(pairs, ",") + "}")
+		}
+		fmt.Fprintf(sb, " %v\n", c.values[key])
+	}
+}
+
+// Handler serves all registered metrics
+func Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		registryMu.Lock()
+		names := make([]string, 0, len(registry))
+		for name := range registry {
+			names = append(names, name)
+		}
+		counters := make([]*Counter, 0, len(names))
+		sort.Strings(names)
+		for _, name := range names {
+			counters = append(counters, registry[name])
+		}
+		registryMu.Unlock()
+
+		var sb strings.Builder
+		for _, c := range counters {
+			c.write(&sb)
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.Write([]byte(sb.String()))
+	}
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
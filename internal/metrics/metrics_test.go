@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerWritesCounters(t *testing.T) {
+	c := NewCounter("test_requests_total", "Requests by \"result\".", "tool", "result")
+	c.Inc("search", "invalid")
+	c.Inc("search", "invalid")
+	c.Inc(`say "hi"`, "valid")
+	if NewCounter("test_requests_total", "ignored") != c {
+		t.Fatal("Expected registering a name twice to return the same counter")
+	}
+	if got := c.Value("search", "invalid"); got != 2 {
+		t.Errorf("Expected a count of 2, got %v", got)
+	}
+
+	rec := httptest.NewRecorder()
+	Handler()(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	want := `# HELP test_requests_total Requests by "result".
+# TYPE test_requests_total counter
+test_requests_total{tool="say \"hi\"",result="valid"} 1
+test_requests_total{tool="search",result="invalid"} 2
+`
+	if !strings.Contains(string(body), want) {
+		t.Errorf("Unexpected metrics output:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	Handler()(rec, httptest.NewRequest(http.MethodPost, "/metrics", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", rec.Code)
+	}
+}
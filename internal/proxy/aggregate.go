@@ -0,0 +1,310 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/aggregate"
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// aggregateCallerKey is the context key of the aggregateCaller of a request
+type aggregateCallerKey struct{}
+
+// aggregateCaller is the client an aggregate request to a server is made for
+type aggregateCaller struct {
+	accessToken  string
+	isLatestSpec bool
+}
+
+// newAggregateServer creates the aggregate of the configured gateway servers.
+// Requests to each server share the routing of its own path.
+func newAggregateServer(cfg *config.Config, accessController authz.AccessControl, routings map[string]*upstreamRouting) (*aggregate.Server, error) {
+	upstreams := make([]aggregate.Upstream, 0, len(cfg.Aggregate.Servers))
+	for _, as := range cfg.Aggregate.Servers {
+		for _, upstream := range cfg.UpstreamConfigs() {
+			if upstream.ServerName == as.Name {
+				upstreams = append(upstreams, aggregate.Upstream{
+					Name:      as.Name,
+					Prefix:    as.Prefix,
+					URL:       strings.TrimRight(upstream.BaseURL, "/") + upstream.Paths.StreamableHTTP,
+					Transport: newAggregateTransport(upstream, accessController, routings[as.Name]),
+				})
+			}
+		}
+	}
+	return aggregate.New(upstreams, cfg.Aggregate)
+}
+
+// aggregateTransport sends the aggregate's requests to one gateway server.
+// They carry the names that server knows, so they are checked here against
+// its own audience, scopes, tool pins and tool schemas, and go through its
+// circuit breaker, replicas and retries like requests to its own path.
+type aggregateTransport struct {
+	cfg              *config.Config
+	accessController authz.AccessControl
+	routing          *upstreamRouting
+	base             http.RoundTripper
+}
+
+func newAggregateTransport(cfg *config.Config, accessController authz.AccessControl, routing *upstreamRouting) *aggregateTransport {
+	// Rejections are JSON-RPC errors, which the aggregate passes on to the client
+	checked := *cfg
+	checked.JSONRPCErrors = true
+	if routing == nil {
+		routing = &upstreamRouting{}
+	}
+	return &aggregateTransport{
+		cfg:              &checked,
+		accessController: accessController,
+		routing:          routing,
+		base:             httpclient.Transport(httpclient.DestinationUpstream),
+	}
+}
+
+func (t *aggregateTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	env, body := readRPCRequest(req)
+	if resp := respondIfRejected(req, func(w http.ResponseWriter) bool { return t.check(w, req, env) }); resp != nil {
+		return resp, nil
+	}
+
+	reportOutcome := func(success bool) {}
+	if t.routing.breaker != nil {
+		done, err := t.routing.breaker.Allow()
+		if err != nil {
+			logger.Warn("Rejected aggregate request to %s: %v", t.cfg.ServerName, err)
+			return respondIfRejected(req, func(w http.ResponseWriter) bool {
+				writeUpstreamUnavailable(w, t.cfg, env, http.StatusServiceUnavailable, "circuit_open", "too many recent failures", t.routing.breaker.RetryAfter())
+				return false
+			}), nil
+		}
+		reportOutcome = done
+	}
+
+	var failover *replicaFailover
+	if t.routing.pool != nil {
+		replica, err := t.routing.pool.Pick(affinityKey(req))
+		if err != nil {
+			reportOutcome(true)
+			logger.Error("Cannot route aggregate request to %s: %v", t.cfg.ServerName, err)
+			return respondIfRejected(req, func(w http.ResponseWriter) bool {
+				writeUpstreamUnavailable(w, t.cfg, env, http.StatusServiceUnavailable, "no_replica", "no healthy replica", 0)
+				return false
+			}), nil
+		}
+		failover = newReplicaFailover(t.routing.pool, replica, req)
+		req.URL.Scheme = replica.URL.Scheme
+		req.URL.Host = replica.URL.Host
+		req.URL.Path = strings.TrimRight(replica.URL.Path, "/") + t.cfg.Paths.StreamableHTTP
+		req.Host = replica.URL.Host
+	}
+
+	transport := t.base
+	if t.routing.retry != nil {
+		transport = &retryTransport{
+			base:       transport,
+			policy:     t.routing.retry,
+			body:       body,
+			idempotent: env != nil && t.routing.retry.methods[env.Method],
+			failover:   failover,
+		}
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		// A client that went away is not a failure of the server
+		canceled := errors.Is(err, context.Canceled)
+		reportOutcome(canceled)
+		if failover != nil {
+			if !canceled {
+				t.routing.pool.ReportFailure(failover.replica)
+			}
+			failover.release()
+		}
+		return nil, err
+	}
+
+	reportOutcome(resp.StatusCode < http.StatusInternalServerError)
+	if failover != nil {
+		trackReplica(t.routing.pool, failover.replica, req, resp)
+		resp.Body = &releasingBody{ReadCloser: resp.Body, release: failover.release}
+	}
+	// Pins apply first, so that only approved tools are remembered
+	if t.routing.pins != nil && env != nil && env.Method == "tools/list" {
+		onToolList(resp, env, filterToolList(t.routing.pins))
+	}
+	if t.routing.tools != nil {
+		trackToolList(t.routing.tools, req, env, resp)
+	}
+	return resp, nil
+}
+
+// check applies the server's policy, tool pins and tool schemas to a request.
+// It returns false after writing the rejection.
+func (t *aggregateTransport) check(w http.ResponseWriter, req *http.Request, env *util.RPCEnvelope) bool {
+	caller, _ := req.Context().Value(aggregateCallerKey{}).(*aggregateCaller)
+	if caller == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	if err := util.ValidateJWT(caller.isLatestSpec, caller.accessToken, t.cfg.ProtectedResourceMetadata.Audience); err != nil {
+		logger.Warn("Denied aggregate request to %s: %v", t.cfg.ServerName, err)
+		denyAggregate(w, env, authz.AccessControlResult{Message: "the token is not valid for server " + t.cfg.ServerName})
+		return false
+	}
+	// Scopes are not checked for older clients, as on the server's own path
+	if caller.isLatestSpec {
+		claims, err := util.ParseJWT(caller.accessToken)
+		if err != nil {
+			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+			return false
+		}
+		// Approval was decided for the call before it reached the aggregate
+		if pr := t.accessController.ValidateAccess(req, &claims, t.cfg); pr.Decision == authz.DecisionDeny {
+			logger.Warn("Denied aggregate request to %s: %s", t.cfg.ServerName, pr.Message)
+			denyAggregate(w, env, pr)
+			return false
+		}
+	}
+
+	if env == nil {
+		return true
+	}
+	if t.routing.pins != nil && !checkToolPin(w, t.cfg, t.routing.pins, env) {
+		return false
+	}
+	return t.routing.tools == nil || checkToolArguments(w, req, t.cfg, t.routing.tools, env)
+}
+
+// denyAggregate writes an access denial for a request of the aggregate
+func denyAggregate(w http.ResponseWriter, env *util.RPCEnvelope, pr authz.AccessControlResult) {
+	if env != nil && env.ID != nil {
+		writeAccessDenied(w, env, pr)
+		return
+	}
+	http.Error(w, "Forbidden: "+pr.Message, http.StatusForbidden)
+}
+
+// respondIfRejected runs a check that writes its rejection, and returns the
+// rejection as the response to req, or nil when the check passed
+func respondIfRejected(req *http.Request, check func(w http.ResponseWriter) bool) *http.Response {
+	buf := &responseBuffer{header: http.Header{}}
+	if check(buf) {
+		return nil
+	}
+	if buf.status == 0 {
+		buf.status = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: buf.status,
+		Header:     buf.header,
+		Body:       io.NopCloser(&buf.body),
+		Request:    req,
+	}
+}
+
+// releasingBody releases the replica that served a response once its body is closed
+type releasingBody struct {
+	io.ReadCloser
+	once    sync.Once
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// buildAggregateHandler authorizes requests to the aggregate endpoint like
+// any MCP request and serves them from the aggregate server
+func buildAggregateHandler(cfg *config.Config, server *aggregate.Server, accessController authz.AccessControl, stages *upstreamStages) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !handleCORS(w, r, cfg) {
+			return
+		}
+
+		specVersion := util.GetVersionWithDefault(r.Header.Get("MCP-Protocol-Version"))
+		ver, err := util.ParseVersionDate(specVersion)
+		isLatestSpec := util.IsLatestSpec(ver, err)
+
+		if !validateMCPRequest(w, r, cfg) {
+			return
+		}
+		decision, err := authorizeMCP(w, r, isLatestSpec, cfg, accessController, stages.dpop)
+		if err != nil {
+			// authorizeMCP has already written the error response
+			logger.Warn("Denied %s request: %v", r.URL.Path, err)
+			return
+		}
+		if stages.limiter != nil && !enforceRateLimit(w, r, cfg, stages.limiter) {
+			return
+		}
+
+		accessToken, _ := util.ExtractAccessToken(r.Header.Get("Authorization"))
+		claims, _ := util.ParseJWT(accessToken)
+		upstream, ok := prepareUpstream(w, r, cfg.ProtectedResourceMetadata.Audience, stages, claims)
+		if !ok {
+			return
+		}
+
+		env, _ := util.ParseRPCRequest(r)
+		if stages.blocked != nil && env != nil && !checkBlockedTool(w, cfg, stages.blocked, env) {
+			return
+		}
+		if decision == authz.DecisionAllow && env != nil && cfg.Approval.Enabled {
+			// Approval rules may name the tool as its server knows it
+			if _, original := server.Route(env.ToolName()); cfg.Approval.Requires(original) {
+				decision = authz.DecisionRequireApproval
+			}
+		}
+		if decision == authz.DecisionRequireApproval {
+			stream, ok := awaitApproval(w, r, cfg, stages.approvals, env)
+			if !ok {
+				return
+			}
+			if stream != nil {
+				defer stream.finish()
+				w = stream
+			}
+		}
+
+		prepare := func(h http.Header) {
+			// The client's token is passed on unless token exchange replaces it
+			h.Set("Authorization", r.Header.Get("Authorization"))
+			upstream.apply(h, stages.identity)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), time.Duration(cfg.TimeoutSeconds)*time.Second)
+		defer cancel()
+		// Requests to each server are authorized against its own policy
+		ctx = context.WithValue(ctx, aggregateCallerKey{}, &aggregateCaller{accessToken: accessToken, isLatestSpec: isLatestSpec})
+		handle := func(w http.ResponseWriter, r *http.Request) {
+			server.Handle(w, r, subjectOf(claims, accessToken), prepare)
+		}
+		if stages.inspector != nil || stages.injection != nil {
+			serveInspected(w, r.WithContext(ctx), stages, cfg, handle)
+			return
+		}
+		handle(w, r.WithContext(ctx))
+	}
+}
+
+// subjectOf identifies the caller for session binding, falling back to the
+// token itself when it has no subject
+func subjectOf(claims jwt.MapClaims, accessToken string) string {
+	if sub, _ := claims["sub"].(string); sub != "" {
+		return sub
+	}
+	return accessToken
+}
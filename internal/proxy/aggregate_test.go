@@ -0,0 +1,144 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// aggregateUpstream is a streamable HTTP MCP server with a search and a delete tool
+type aggregateUpstream struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (u *aggregateUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var env util.RPCEnvelope
+	json.NewDecoder(r.Body).Decode(&env)
+	if env.ID == nil {
+		w.WriteHeader(http.StatusAccepted)
+		return
+	}
+	id, _ := json.Marshal(env.ID)
+
+	result := `{}`
+	switch env.Method {
+	case "initialize":
+		w.Header().Set("Mcp-Session-Id", "upstream-session")
+		result = `{"protocolVersion":"2025-06-18","capabilities":{"tools":{}}}`
+	case "tools/list":
+		result = `{"tools":[` +
+			`{"name":"search","inputSchema":{"type":"object","properties":{"q":{"type":"string"}},"required":["q"]}},` +
+			`{"name":"delete","inputSchema":{"type":"object"}}]}`
+	case "tools/call":
+		u.mu.Lock()
+		u.calls = append(u.calls, env.ToolName())
+		u.mu.Unlock()
+		result = `{"content":[{"type":"text","text":"done"}]}`
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, `{"jsonrpc":"2.0","id":%s,"result":%s}`, id, result)
+}
+
+func TestAggregateAppliesServerPolicy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("aggregate-test", &key.PublicKey)
+
+	github := &aggregateUpstream{}
+	jira := &aggregateUpstream{}
+	githubServer := httptest.NewServer(github)
+	jiraServer := httptest.NewServer(jira)
+	t.Cleanup(githubServer.Close)
+	t.Cleanup(jiraServer.Close)
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		TimeoutSeconds:    5,
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		Limits:            config.LimitsConfig{ValidateToolArguments: true},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "shared-audience",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+		Servers: []config.ServerConfig{
+			{Name: "github", MountPath: "/github", BaseURL: githubServer.URL, TransportMode: config.StreamableHTTPTransport, Paths: config.PathsConfig{StreamableHTTP: "/mcp"},
+				ProtectedResourceMetadata: config.ProtectedResourceMetadata{ScopesSupported: []map[string]interface{}{
+					{"tools/call": []interface{}{map[interface{}]interface{}{"delete": "github_admin"}}},
+				}}},
+			{Name: "jira", MountPath: "/jira", BaseURL: jiraServer.URL, TransportMode: config.StreamableHTTPTransport, Paths: config.PathsConfig{StreamableHTTP: "/mcp"},
+				ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "jira-audience"}},
+		},
+		Aggregate: config.AggregateConfig{Enabled: true, Path: "/all", Servers: []config.AggregateServerConfig{
+			{Name: "github", Prefix: "gh"},
+			{Name: "jira"},
+		}},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+	token := signTestToken(t, key, "aggregate-test", "shared-audience")
+
+	sessionID := ""
+	call := func(method, params string) map[string]json.RawMessage {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/all", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"`+method+`","params":`+params+`}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if sessionID != "" {
+			req.Header.Set("Mcp-Session-Id", sessionID)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected 200 for %s, got %d: %s", method, rec.Code, rec.Body.String())
+		}
+		if id := rec.Header().Get("Mcp-Session-Id"); id != "" {
+			sessionID = id
+		}
+		var reply map[string]json.RawMessage
+		json.NewDecoder(rec.Body).Decode(&reply)
+		return reply
+	}
+
+	// The token is not valid for the jira server, which is left out
+	call("initialize", `{"protocolVersion":"2025-06-18"}`)
+	if reply := call("tools/list", `{}`); !strings.Contains(string(reply["result"]), "gh_search") || strings.Contains(string(reply["result"]), "jira_") {
+		t.Errorf("Expected only the github tools, got %s", reply["result"])
+	}
+
+	// Tool scopes of the server apply to its prefixed tools
+	if reply := call("tools/call", `{"name":"gh_delete","arguments":{}}`); !strings.Contains(string(reply["error"]), "github_admin") {
+		t.Errorf("Expected the call to need the server's tool scope, got %s", reply["error"])
+	}
+
+	// Arguments are checked against the schema the server listed
+	if reply := call("tools/call", `{"name":"gh_search","arguments":{"q":1}}`); !strings.Contains(string(reply["error"]), "Invalid arguments") {
+		t.Errorf("Expected invalid arguments to be rejected, got %s", reply["error"])
+	}
+	if reply := call("tools/call", `{"name":"gh_search","arguments":{"q":"bug"}}`); reply["error"] != nil {
+		t.Errorf("Expected a valid call to succeed, got %s", reply["error"])
+	}
+
+	github.mu.Lock()
+	defer github.mu.Unlock()
+	if len(github.calls) != 1 || github.calls[0] != "search" || len(jira.calls) != 0 {
+		t.Errorf("Expected only the valid call to reach github, got github=%v jira=%v", github.calls, jira.calls)
+	}
+}
@@ -0,0 +1,328 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/approval"
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolpin"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// approvalData is the structured data member of the error for a call that was not approved
+type approvalData struct {
+	Reason     string `json:"reason"`
+	ApprovalID string `json:"approval_id,omitempty"`
+	Detail     string `json:"detail,omitempty"` // The approver's reason
+}
+
+// approverAuthenticator authenticates approval API calls with access tokens
+// that carry the approver scope
+func approverAuthenticator(cfg *config.Config, dpopVerifier *dpop.Verifier) approval.Authenticator {
+	subject := credentialAuthenticator(cfg, dpopVerifier)
+	return func(r *http.Request) (string, error) {
+		sub, err := subject(r)
+		if err != nil {
+			return "", err
+		}
+		accessToken, _ := util.ExtractAccessToken(r.Header.Get("Authorization"))
+		claims, _ := util.ParseJWT(accessToken)
+		if !hasScope(claims, cfg.Approval.ApproverScope) {
+			return "", fmt.Errorf("access token lacks the %s scope", cfg.Approval.ApproverScope)
+		}
+		return sub, nil
+	}
+}
+
+// hasScope reports whether the scope claim, a string or a list, holds scope
+func hasScope(claims jwt.MapClaims, scope string) bool {
+	switch v := claims["scope"].(type) {
+	case string:
+		for _, s := range strings.Fields(v) {
+			if s == scope {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			if s == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// approvalDecision applies approval to clients of protocol versions that are
+// not checked against scopes. Calls to tools that need approval cannot be
+// hidden in a batch, because a batch cannot be held for one of its calls.
+func approvalDecision(w http.ResponseWriter, r *http.Request, cfg *config.Config) (authz.Decision, error) {
+	if !cfg.Approval.Enabled {
+		return authz.DecisionAllow, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return authz.DecisionDeny, err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	var batch []util.RPCEnvelope
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' && json.Unmarshal(trimmed, &batch) == nil {
+		for _, env := range batch {
+			if cfg.Approval.Requires(env.ToolName()) {
+				http.Error(w, "Forbidden: calls to "+env.ToolName()+" need approval and cannot be batched", http.StatusForbidden)
+				return authz.DecisionDeny, fmt.Errorf("batched call to %s, which needs approval", env.ToolName())
+			}
+		}
+		return authz.DecisionAllow, nil
+	}
+
+	var env util.RPCEnvelope
+	if json.Unmarshal(body, &env) == nil && cfg.Approval.Requires(env.ToolName()) {
+		return authz.DecisionRequireApproval, nil
+	}
+	return authz.DecisionAllow, nil
+}
+
+// awaitApproval holds a request until an approver decides on it. It returns
+// false after writing the response when the call may not proceed. Clients
+// that accept an event stream are answered with one right away, which carries
+// progress notifications while the call waits and then the MCP server's
+// response; the stream is returned to write that response to.
+func awaitApproval(w http.ResponseWriter, r *http.Request, cfg *config.Config, queue *approval.Queue, env *util.RPCEnvelope) (*eventStream, bool) {
+	if env == nil {
+		env = &util.RPCEnvelope{}
+	}
+	if queue == nil {
+		logger.Warn("Denied %s: it needs approval, but approval is not enabled", env.Method)
+		writeNotApproved(w, cfg, env, approval.Request{Tool: env.ToolName()})
+		return nil, false
+	}
+
+	accessToken, _ := util.ExtractAccessToken(r.Header.Get("Authorization"))
+	claims, _ := util.ParseJWT(accessToken)
+	req := approval.Request{
+		Server:  cfg.ServerName,
+		Method:  env.Method,
+		Tool:    env.ToolName(),
+		Subject: subjectOf(claims, ""),
+	}
+	if req.Server == "" {
+		req.Server = toolpin.DefaultServer
+	}
+	req.ClientID, _ = claims["client_id"].(string)
+	if req.ClientID == "" {
+		req.ClientID, _ = claims["azp"].(string)
+	}
+	params, _ := env.Params.(map[string]any)
+	if req.Tool != "" {
+		req.Arguments = params["arguments"]
+	} else {
+		req.Arguments = env.Params
+	}
+	ticket := queue.Submit(req)
+
+	var stream *eventStream
+	if acceptsEventStream(r) && r.URL.Path != cfg.MountPath+cfg.Paths.Messages {
+		stream = startEventStream(w, env.ID)
+	}
+	var progressToken any
+	if meta, ok := params["_meta"].(map[string]any); ok {
+		progressToken = meta["progressToken"]
+	}
+	progress := 0
+	report := func() {
+		if stream == nil {
+			return
+		}
+		if progressToken == nil {
+			// Keeps intermediaries from closing an idle stream
+			stream.comment("awaiting approval " + ticket.ID)
+			return
+		}
+		stream.send(map[string]any{
+			"jsonrpc": "2.0",
+			"method":  "notifications/progress",
+			"params": map[string]any{
+				"progressToken": progressToken,
+				"progress":      progress,
+				"message":       fmt.Sprintf("Waiting for approval of %s (request %s)", req.Tool, ticket.ID),
+			},
+		})
+		progress++
+	}
+	report()
+
+	ticker := time.NewTicker(time.Duration(cfg.Approval.ProgressSeconds) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticket.Done:
+			decided := ticket.Request()
+			if decided.Status == approval.Approved {
+				return stream, true
+			}
+			if stream != nil {
+				writeNotApproved(stream, cfg, env, decided)
+				stream.finish()
+			} else {
+				writeNotApproved(w, cfg, env, decided)
+			}
+			return nil, false
+		case <-ticker.C:
+			report()
+		case <-r.Context().Done():
+			ticket.Cancel()
+			return nil, false
+		}
+	}
+}
+
+// writeNotApproved reports a call that was rejected, not decided in time, or
+// could not be submitted for approval
+func writeNotApproved(w http.ResponseWriter, cfg *config.Config, env *util.RPCEnvelope, req approval.Request) {
+	reason := "approval_" + string(req.Status)
+	message := "Forbidden: the call to " + req.Tool + " was rejected"
+	switch req.Status {
+	case approval.Expired:
+		message = "Forbidden: the call to " + req.Tool + " was not approved in time"
+	case "":
+		reason = "approval_unavailable"
+		message = "Forbidden: the call to " + req.Tool + " needs approval, which is not enabled"
+	}
+	_, streaming := w.(*eventStream)
+	if (streaming || cfg.JSONRPCErrors) && env.ID != nil {
+		util.WriteRPCError(w, http.StatusOK, env.ID, util.RPCErrorAccessDenied, message, approvalData{
+			Reason:     reason,
+			ApprovalID: req.ID,
+			Detail:     req.Reason,
+		})
+		return
+	}
+	http.Error(w, message, http.StatusForbidden)
+}
+
+func acceptsEventStream(r *http.Request) bool {
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(accept)); mediaType == "text/event-stream" {
+			return true
+		}
+	}
+	return false
+}
+
+// eventStream is a response that was started as an event stream before the
+// response to the request was known. What is written to it afterwards is
+// sent as events: event streams are passed through, and other bodies become
+// one event holding the JSON-RPC response.
+type eventStream struct {
+	w           http.ResponseWriter
+	id          any
+	header      http.Header
+	status      int
+	passthrough bool
+	body        bytes.Buffer
+}
+
+func startEventStream(w http.ResponseWriter, id any) *eventStream {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	s := &eventStream{w: w, id: id, header: http.Header{}}
+	s.flush()
+	return s
+}
+
+func (s *eventStream) Header() http.Header { return s.header }
+
+func (s *eventStream) WriteHeader(status int) {
+	if s.status != 0 {
+		return
+	}
+	s.status = status
+	mediaType, _, _ := mime.ParseMediaType(s.header.Get("Content-Type"))
+	s.passthrough = status == http.StatusOK && mediaType == "text/event-stream"
+}
+
+func (s *eventStream) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.WriteHeader(http.StatusOK)
+	}
+	if s.passthrough {
+		return s.w.Write(p)
+	}
+	return s.body.Write(p)
+}
+
+// Flush passes streamed events on as they arrive
+func (s *eventStream) Flush() {
+	if s.passthrough {
+		s.flush()
+	}
+}
+
+func (s *eventStream) flush() {
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// send writes a JSON-RPC message as an event
+func (s *eventStream) send(msg any) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Failed to encode JSON-RPC message: %v", err)
+		return
+	}
+	s.event(data)
+}
+
+func (s *eventStream) event(data []byte) {
+	fmt.Fprintf(s.w, "data: %s\n\n", data)
+	s.flush()
+}
+
+func (s *eventStream) comment(text string) {
+	fmt.Fprintf(s.w, ": %s\n\n", text)
+	s.flush()
+}
+
+// finish sends a response body that was not an event stream as an event
+func (s *eventStream) finish() {
+	if s.passthrough || s.status == 0 {
+		return
+	}
+	var compact bytes.Buffer
+	if data := bytes.TrimSpace(s.body.Bytes()); len(data) > 0 && json.Compact(&compact, data) == nil {
+		s.event(compact.Bytes())
+		return
+	}
+
+	// A plain-text error from the proxy or the server
+	code := util.RPCErrorInvalidRequest
+	if s.status >= http.StatusInternalServerError {
+		code = util.RPCErrorUpstreamUnavailable
+	}
+	message := strings.TrimSpace(s.body.String())
+	if message == "" {
+		message = http.StatusText(s.status)
+	}
+	s.send(util.RPCErrorResponse{
+		JSONRPC: "2.0",
+		ID:      s.id,
+		Error:   &util.RPCError{Code: code, Message: message, Data: map[string]int{"status": s.status}},
+	})
+}
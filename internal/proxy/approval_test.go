@@ -0,0 +1,334 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/approval"
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func TestApprovalHoldsSensitiveToolCalls(t *testing.T) {
+	var calls int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"content":[{"type":"text","text":"deleted"}]}}`))
+	}))
+	defer upstream.Close()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("approval-test", &key.PublicKey)
+	sign := func(sub, scope string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"sub":   sub,
+			"aud":   "mcp",
+			"scope": scope,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		token.Header["kid"] = "approval-test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	caller := sign("alice", "mcp:approve")
+	approver := sign("bob", "mcp:approve")
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           upstream.URL,
+		TimeoutSeconds:    5,
+		TransportMode:     config.StreamableHTTPTransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		JSONRPCErrors:     true,
+		Approval:          config.ApprovalConfig{Enabled: true, Tools: []string{"delete_repo"}, ProgressSeconds: 1},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	proxy := httptest.NewServer(NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{}))
+	defer proxy.Close()
+
+	call := func(accept, body string) (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", accept)
+		req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+		req.Header.Set("Authorization", "Bearer "+caller)
+		return http.DefaultClient.Do(req)
+	}
+	api := func(method, path, token string) *http.Response {
+		req, _ := http.NewRequest(method, proxy.URL+"/approvals"+path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Approval API call failed: %v", err)
+		}
+		return resp
+	}
+	pending := func() approval.Request {
+		t.Helper()
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			var requests []approval.Request
+			resp := api(http.MethodGet, "", approver)
+			json.NewDecoder(resp.Body).Decode(&requests)
+			resp.Body.Close()
+			if len(requests) > 0 {
+				return requests[0]
+			}
+		}
+		t.Fatal("No call awaits approval")
+		return approval.Request{}
+	}
+
+	// Clients that accept an event stream see progress while the call waits
+	resp, err := call("application/json, text/event-stream",
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_repo","arguments":{"repo":"web"},"_meta":{"progressToken":"p1"}}}`)
+	if err != nil {
+		t.Fatalf("Call failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %s", ct)
+	}
+	events := bufio.NewReader(resp.Body)
+	if line, _ := events.ReadString('\n'); !strings.Contains(line, `"notifications/progress"`) || !strings.Contains(line, `"p1"`) {
+		t.Errorf("Expected a progress notification first, got %s", line)
+	}
+
+	req := pending()
+	if req.Tool != "delete_repo" || req.Subject != "alice" || atomic.LoadInt32(&calls) != 0 {
+		t.Fatalf("Unexpected pending request %+v (%d calls made)", req, calls)
+	}
+	if resp := api(http.MethodPost, "/"+req.ID+"/approve", caller); resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Expected callers not to approve their own calls, got %d", resp.StatusCode)
+	}
+	if resp := api(http.MethodGet, "", sign("carol", "")); resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Expected tokens without the approver scope to be refused, got %d", resp.StatusCode)
+	}
+	if resp := api(http.MethodPost, "/"+req.ID+"/approve", approver); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Approve failed with %d", resp.StatusCode)
+	}
+
+	var result string
+	for {
+		line, err := events.ReadString('\n')
+		if strings.Contains(line, `"result"`) {
+			result = line
+			break
+		}
+		if err != nil {
+			break
+		}
+	}
+	if !strings.Contains(result, "deleted") || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected the approved call to reach the server, got %q", result)
+	}
+
+	// A rejected call never reaches the server
+	done := make(chan *http.Response)
+	go func() {
+		resp, err := call("application/json", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"delete_repo"}}`)
+		if err != nil {
+			t.Errorf("Call failed: %v", err)
+		}
+		done <- resp
+	}()
+	req = pending()
+	if resp := api(http.MethodPost, "/"+req.ID+"/reject", approver); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Reject failed with %d", resp.StatusCode)
+	}
+	rejected := <-done
+	defer rejected.Body.Close()
+	var rpcResp util.RPCErrorResponse
+	json.NewDecoder(rejected.Body).Decode(&rpcResp)
+	if rpcResp.Error == nil || rpcResp.Error.Code != util.RPCErrorAccessDenied {
+		t.Errorf("Expected an access denied error, got %+v", rpcResp)
+	}
+	if atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected the rejected call not to reach the server")
+	}
+	if resp := api(http.MethodPost, "/"+req.ID+"/approve", approver); resp.StatusCode != http.StatusConflict {
+		t.Errorf("Expected a decided request to stay decided, got %d", resp.StatusCode)
+	}
+}
+
+// allowAll is an access controller that leaves approval to the proxy
+type allowAll struct{}
+
+func (allowAll) ValidateAccess(*http.Request, *jwt.MapClaims, *config.Config) authz.AccessControlResult {
+	return authz.AccessControlResult{Decision: authz.DecisionAllow}
+}
+
+func TestApprovalOnSSEMessages(t *testing.T) {
+	sse, upstream := newSSEUpstream(t, func(env util.RPCEnvelope) string {
+		return `{"content":[{"type":"text","text":"deleted"}]}`
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("sse-approval-test", &key.PublicKey)
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           upstream.URL,
+		TimeoutSeconds:    5,
+		TransportMode:     config.SSETransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		Approval:          config.ApprovalConfig{Enabled: true, Tools: []string{"delete_repo"}},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	proxy := httptest.NewServer(NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), allowAll{}))
+	t.Cleanup(proxy.Close)
+	c := openSSE(t, proxy.URL, signTestToken(t, key, "sse-approval-test", "mcp"))
+
+	approver := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":   "bob",
+		"aud":   "mcp",
+		"scope": "mcp:approve",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	})
+	approver.Header["kid"] = "sse-approval-test"
+	approverToken, err := approver.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	reject := func() {
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			req, _ := http.NewRequest(http.MethodGet, proxy.URL+"/approvals", nil)
+			req.Header.Set("Authorization", "Bearer "+approverToken)
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("Approval API call failed: %v", err)
+				return
+			}
+			var requests []approval.Request
+			json.NewDecoder(resp.Body).Decode(&requests)
+			resp.Body.Close()
+			if len(requests) > 0 {
+				req, _ := http.NewRequest(http.MethodPost, proxy.URL+"/approvals/"+requests[0].ID+"/reject", nil)
+				req.Header.Set("Authorization", "Bearer "+approverToken)
+				if resp, err := http.DefaultClient.Do(req); err == nil {
+					resp.Body.Close()
+				}
+				return
+			}
+		}
+		t.Error("No call awaits approval")
+	}
+
+	// Calls of clients before 2025-06-18, and of newer ones whose access
+	// controller does not ask for approval, are held all the same
+	for _, version := range []string{"", "2025-06-18"} {
+		go reject()
+		req, _ := http.NewRequest(http.MethodPost, proxy.URL+c.endpoint, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"delete_repo"}}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		if version != "" {
+			req.Header.Set("MCP-Protocol-Version", version)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("Call failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("version=%q: expected the rejected call to be refused, got %d", version, resp.StatusCode)
+		}
+	}
+	if got := atomic.LoadInt32(&sse.calls); got != 0 {
+		t.Errorf("Expected no calls to reach the server, got %d", got)
+	}
+}
+
+func TestApproverNeedsProofOfBoundToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("approver-binding-test", &key.PublicKey)
+	sign := func(cnf map[string]interface{}) string {
+		claims := jwt.MapClaims{"sub": "bob", "aud": "mcp", "scope": "mcp:approve", "exp": time.Now().Add(time.Hour).Unix()}
+		if cnf != nil {
+			claims["cnf"] = cnf
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "approver-binding-test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+
+	cfg := &config.Config{
+		DPoP:                      config.DPoPConfig{Enabled: true},
+		Approval:                  config.ApprovalConfig{Enabled: true, ApproverScope: "mcp:approve"},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp"},
+	}
+	verifier, err := dpop.New(cfg.DPoP, "http://proxy.test")
+	if err != nil {
+		t.Fatalf("dpop.New failed: %v", err)
+	}
+	handler := approval.New(cfg.Approval).Handler("/approvals", approverAuthenticator(cfg, verifier), false)
+	list := func(header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/approvals", nil)
+		req.Header.Set("Authorization", header)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	if code := list("Bearer " + sign(nil)); code != http.StatusOK {
+		t.Errorf("Expected an approver's bearer token to be accepted, got %d", code)
+	}
+
+	// A replayed DPoP-bound token cannot decide held calls
+	bound := sign(map[string]interface{}{"jkt": "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"})
+	for _, header := range []string{"Bearer " + bound, "DPoP " + bound} {
+		if code := list(header); code != http.StatusUnauthorized {
+			t.Errorf("Expected %.10s... without a proof to be rejected, got %d", header, code)
+		}
+	}
+
+	// Neither can a certificate-bound token without its client certificate
+	cfg.DPoP = config.DPoPConfig{}
+	cfg.TLS.CertificateBoundTokens = true
+	handler = approval.New(cfg.Approval).Handler("/approvals", approverAuthenticator(cfg, nil), false)
+	if code := list("Bearer " + sign(map[string]interface{}{"x5t#S256": "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"})); code != http.StatusUnauthorized {
+		t.Errorf("Expected a certificate-bound token without a client certificate to be rejected, got %d", code)
+	}
+}
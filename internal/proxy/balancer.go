@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/balancer"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// sessionHeader carries the session ID of the streamable HTTP transport
+const sessionHeader = "Mcp-Session-Id"
+
+// affinityKey returns the session a request belongs to: the streamable HTTP
+// session header, or the session query parameter of SSE message posts
+func affinityKey(r *http.Request) string {
+	if id := r.Header.Get(sessionHeader); id != "" {
+		return id
+	}
+	return querySession(r.URL.Query())
+}
+
+// endpointSession returns the session ID in an SSE endpoint event
+func endpointSession(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return querySession(u.Query())
+}
+
+func querySession(q url.Values) string {
+	if id := q.Get("session_id"); id != "" {
+		return id
+	}
+	return q.Get("sessionId")
+}
+
+// trackReplica records the outcome of a response from a replica: 5xx responses
+// count towards ejection, new sessions are bound and ended sessions forgotten
+func trackReplica(pool *balancer.Pool, replica *balancer.Replica, r *http.Request, resp *http.Response) {
+	if resp.StatusCode >= http.StatusInternalServerError {
+		pool.ReportFailure(replica)
+		return
+	}
+	pool.ReportSuccess(replica)
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		return
+	}
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		pool.Bind(id, replica)
+	}
+	if r.Method == http.MethodDelete {
+		if id := r.Header.Get(sessionHeader); id != "" {
+			pool.Unbind(id)
+		}
+	}
+}
+
+// replicaFailover tracks the replica serving a request, which can change when
+// the request is repeated after a failure
+type replicaFailover struct {
+	pool    *balancer.Pool
+	replica *balancer.Replica
+	tried   []*balancer.Replica
+	// A session is only known to its replica, so its requests cannot move
+	pinned bool
+}
+
+func newReplicaFailover(pool *balancer.Pool, replica *balancer.Replica, r *http.Request) *replicaFailover {
+	return &replicaFailover{
+		pool:    pool,
+		replica: replica,
+		tried:   []*balancer.Replica{replica},
+		pinned:  affinityKey(r) != "",
+	}
+}
+
+// next counts the failure of the current replica and moves req to a replica
+// that has not been tried, keeping the current one when there is none
+func (f *replicaFailover) next(req *http.Request) {
+	f.pool.ReportFailure(f.replica)
+	if f.pinned {
+		return
+	}
+	replica, err := f.pool.PickOther(f.tried)
+	if err != nil {
+		return
+	}
+	logger.Warn("Moving %s from replica %s to %s", req.URL.Path, f.replica.URL.Host, replica.URL.Host)
+	f.pool.Release(f.replica)
+	path := strings.TrimPrefix(req.URL.Path, strings.TrimRight(f.replica.URL.Path, "/"))
+	req.URL.Scheme = replica.URL.Scheme
+	req.URL.Host = replica.URL.Host
+	req.URL.Path = strings.TrimRight(replica.URL.Path, "/") + path
+	req.Host = replica.URL.Host
+	f.replica = replica
+	f.tried = append(f.tried, replica)
+}
+
+// release marks the request to its current replica as done
+func (f *replicaFailover) release() {
+	f.pool.Release(f.replica)
+}
@@ -0,0 +1,183 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func TestLoadBalancingKeepsSessionsOnReplica(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("balancer-test", &key.PublicKey)
+	token := signTestToken(t, key, "balancer-test", "mcp")
+
+	newReplica := func(name string, status int) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			session := r.Header.Get(sessionHeader)
+			if session == "" {
+				w.Header().Set(sessionHeader, name+"-session")
+			} else if session != name+"-session" {
+				http.Error(w, "Session not found", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("X-Replica", name)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	a := newReplica("a", http.StatusOK)
+	b := newReplica("b", http.StatusOK)
+	broken := newReplica("broken", http.StatusBadGateway)
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		TimeoutSeconds:    5,
+		TransportMode:     config.StreamableHTTPTransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		BaseURLs:          []string{a.URL, b.URL, broken.URL},
+		LoadBalancing:     config.LoadBalancingConfig{Ejection: config.EjectionConfig{ConsecutiveFailures: 1}},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+
+	call := func(session string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+		req.Header.Set("Authorization", "Bearer "+token)
+		if session != "" {
+			req.Header.Set(sessionHeader, session)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// New sessions are spread across the replicas
+	first, second := call(""), call("")
+	if first.Header().Get("X-Replica") != "a" || second.Header().Get("X-Replica") != "b" {
+		t.Fatalf("Expected round robin across a and b, got %q and %q", first.Header().Get("X-Replica"), second.Header().Get("X-Replica"))
+	}
+
+	// The broken replica is ejected after its failure
+	if rec := call(""); rec.Code != http.StatusBadGateway {
+		t.Errorf("Expected the broken replica's response, got %d", rec.Code)
+	}
+
+	// Requests in a session stay on the replica that created it
+	session := second.Header().Get(sessionHeader)
+	for i := 0; i < 4; i++ {
+		rec := call(session)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Replica") != "b" {
+			t.Fatalf("Expected the session to stay on b, got %d from %q", rec.Code, rec.Header().Get("X-Replica"))
+		}
+	}
+	for i := 0; i < 4; i++ {
+		if rec := call(""); rec.Code != http.StatusOK {
+			t.Errorf("Expected the ejected replica to be skipped, got %d", rec.Code)
+		}
+	}
+}
+
+func TestFailedRequestsMoveToAnotherReplica(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("failover-test", &key.PublicKey)
+	token := signTestToken(t, key, "failover-test", "mcp")
+
+	newReplica := func(name string, status int) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if status != http.StatusOK {
+				w.WriteHeader(status)
+				return
+			}
+			w.Header().Set("X-Replica", name)
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	// A replica that cannot be reached
+	down := newReplica("down", http.StatusOK)
+	down.Close()
+	overloaded := newReplica("overloaded", http.StatusServiceUnavailable)
+	up := newReplica("up", http.StatusOK)
+
+	newRouter := func(retry config.RetryConfig, urls ...string) http.Handler {
+		cfg := &config.Config{
+			ProxyBaseURL:      "http://proxy.test",
+			AuthServerBaseURL: "http://idp.test",
+			TimeoutSeconds:    5,
+			TransportMode:     config.StreamableHTTPTransport,
+			Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+			CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+			BaseURLs:          urls,
+			Retry:             retry,
+			ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+				Audience:             "mcp",
+				AuthorizationServers: []string{"http://idp.test"},
+			},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate failed: %v", err)
+		}
+		return NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+	}
+
+	// Requests that could not reach a replica move on without retry configured
+	router := newRouter(config.RetryConfig{}, down.URL, up.URL)
+	for i := 0; i < 4; i++ {
+		rec := postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"echo"}}`)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Replica") != "up" {
+			t.Fatalf("Expected the request to reach the healthy replica, got %d from %q", rec.Code, rec.Header().Get("X-Replica"))
+		}
+	}
+
+	// Retried requests go to another replica rather than the one that failed
+	router = newRouter(config.RetryConfig{Enabled: true, MaxAttempts: 2, BackoffMillis: 1}, overloaded.URL, up.URL)
+	for i := 0; i < 4; i++ {
+		rec := postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		if rec.Code != http.StatusOK || rec.Header().Get("X-Replica") != "up" {
+			t.Fatalf("Expected the retry to reach the healthy replica, got %d from %q", rec.Code, rec.Header().Get("X-Replica"))
+		}
+	}
+}
+
+func TestEndpointSession(t *testing.T) {
+	tests := map[string]string{
+		"/messages/?session_id=abc":                  "abc",
+		"http://proxy.test/messages?sessionId=def":   "def",
+		"http://proxy.test/messages?other=parameter": "",
+	}
+	for endpoint, expected := range tests {
+		if got := endpointSession(endpoint); got != expected {
+			t.Errorf("endpointSession(%q) = %q, want %q", endpoint, got, expected)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// verifyTokenBinding enforces RFC 8705 certificate-bound access tokens: the
+// token's cnf.x5t#S256 must match the client certificate of the connection
+func verifyTokenBinding(w http.ResponseWriter, r *http.Request, accessToken string) error {
+	claims, err := util.ParseJWT(accessToken)
+	if err == nil {
+		err = util.VerifyCertificateBinding(r, claims)
+	}
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="invalid_token", error_description=%q`, err.Error()))
+		w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return err
+	}
+	return nil
+}
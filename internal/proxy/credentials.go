@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/credentials"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// credentialAuthenticator authenticates credential API calls with the same
+// access tokens that are accepted for MCP requests. Sender-constrained tokens
+// need the same DPoP proof or client certificate as on MCP requests.
+func credentialAuthenticator(cfg *config.Config, dpopVerifier *dpop.Verifier) credentials.Authenticator {
+	return func(r *http.Request) (string, error) {
+		authzHeader := r.Header.Get("Authorization")
+		isDPoP := dpopVerifier != nil && strings.HasPrefix(authzHeader, "DPoP ")
+		if !strings.HasPrefix(authzHeader, "Bearer ") && !isDPoP {
+			return "", fmt.Errorf("missing or invalid Authorization header")
+		}
+		accessToken, err := util.ExtractAccessToken(authzHeader)
+		if err != nil {
+			return "", err
+		}
+		audience := cfg.ProtectedResourceMetadata.Audience
+		if err := util.ValidateJWT(audience != "", accessToken, audience); err != nil {
+			return "", err
+		}
+		if dpopVerifier != nil {
+			if err := checkDPoP(r, isDPoP, accessToken, cfg, dpopVerifier); err != nil {
+				return "", err
+			}
+		}
+		claims, err := util.ParseJWT(accessToken)
+		if err != nil {
+			return "", err
+		}
+		if cfg.TLS.CertificateBoundTokens {
+			if err := util.VerifyCertificateBinding(r, claims); err != nil {
+				return "", err
+			}
+		}
+		sub, _ := claims["sub"].(string)
+		if sub == "" {
+			return "", fmt.Errorf("access token has no subject")
+		}
+		return sub, nil
+	}
+}
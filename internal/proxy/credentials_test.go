@@ -0,0 +1,148 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func TestCredentialsAPI(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("credentials-test", &key.PublicKey)
+
+	cfg := &config.Config{
+		ListenPort:        8080,
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           "http://mcp.test",
+		TransportMode:     config.StreamableHTTPTransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig: config.CORSConfig{
+			AllowedOrigins: []string{"http://localhost:6274"},
+			AllowedMethods: []string{"GET", "PUT", "DELETE", "POST"},
+		},
+		Credentials: config.CredentialsConfig{
+			Enabled:       true,
+			EncryptionKey: base64.StdEncoding.EncodeToString(make([]byte, 32)),
+			Providers: []config.CredentialProviderConfig{{Name: "github", Header: "X-GitHub-Token", OAuth: &config.CredentialOAuthConfig{
+				AuthorizationURL: "https://github.example.com/authorize",
+				TokenURL:         "https://github.example.com/token",
+				ClientID:         "app",
+			}}},
+		},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+
+	// Browser apps on allowed origins can call the API
+	preflight := httptest.NewRequest(http.MethodOptions, "/credentials/github", nil)
+	preflight.Header.Set("Origin", "http://localhost:6274")
+	preflight.Header.Set("Access-Control-Request-Method", "PUT")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, preflight)
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "http://localhost:6274" {
+		t.Errorf("Expected the preflight to be answered, got %d %v", rec.Code, rec.Header())
+	}
+	preflight.Header.Set("Origin", "http://evil.example.com")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, preflight)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a disallowed origin to be rejected, got %d", rec.Code)
+	}
+
+	// The callback URL does not follow the Host header of the request
+	req := httptest.NewRequest(http.MethodPost, "/credentials/github/connect", nil)
+	req.Host = "evil.example.com"
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, key, "credentials-test", "mcp"))
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	var body map[string]string
+	json.NewDecoder(rec.Body).Decode(&body)
+	authURL, err := url.Parse(body["authorization_url"])
+	if err != nil {
+		t.Fatalf("Unexpected connect response %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := authURL.Query().Get("redirect_uri"); got != "http://localhost:8080/credentials/github/callback" {
+		t.Errorf("Expected the callback on the proxy's own URL, got %q", got)
+	}
+}
+
+func TestCredentialAuthenticatorChecksSenderConstraints(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("credentials-binding-test", &key.PublicKey)
+	sign := func(cnf map[string]interface{}) string {
+		claims := jwt.MapClaims{"sub": "alice", "aud": "mcp", "exp": time.Now().Add(time.Hour).Unix()}
+		if cnf != nil {
+			claims["cnf"] = cnf
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "credentials-binding-test"
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+		return signed
+	}
+	authenticate := func(cfg *config.Config, header string) error {
+		var verifier *dpop.Verifier
+		if cfg.DPoP.Enabled {
+			if verifier, err = dpop.New(cfg.DPoP, "http://proxy.test"); err != nil {
+				t.Fatalf("dpop.New failed: %v", err)
+			}
+		}
+		req := httptest.NewRequest(http.MethodPut, "/credentials/github", nil)
+		req.Header.Set("Authorization", header)
+		_, err := credentialAuthenticator(cfg, verifier)(req)
+		return err
+	}
+
+	dpopCfg := &config.Config{
+		DPoP:                      config.DPoPConfig{Enabled: true},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp"},
+	}
+	if err := authenticate(dpopCfg, "Bearer "+sign(nil)); err != nil {
+		t.Errorf("Expected a bearer token to be accepted, got %v", err)
+	}
+
+	// A stolen DPoP-bound token is useless without a proof of its key
+	bound := sign(map[string]interface{}{"jkt": "0ZcOCORZNYy-DWpqq30jZyJGHTN0d2HglBV3uiguA4I"})
+	for _, header := range []string{"Bearer " + bound, "DPoP " + bound} {
+		if err := authenticate(dpopCfg, header); err == nil {
+			t.Errorf("Expected %.10s... without a proof to be rejected", header)
+		}
+	}
+	dpopCfg.DPoP.Required = true
+	if err := authenticate(dpopCfg, "Bearer "+sign(nil)); err == nil {
+		t.Error("Expected a bearer token to be rejected when DPoP is required")
+	}
+
+	// A certificate-bound token needs the client certificate it is bound to
+	tlsCfg := &config.Config{
+		TLS:                       config.ListenerTLSConfig{CertificateBoundTokens: true},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "mcp"},
+	}
+	if err := authenticate(tlsCfg, "Bearer "+sign(map[string]interface{}{"x5t#S256": "bwcK0esc3ACC3DB2Y5_lESsXE8o9ltc05O89jdN-dg2"})); err == nil {
+		t.Error("Expected a certificate-bound token without a client certificate to be rejected")
+	}
+}
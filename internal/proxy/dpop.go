@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// verifyDPoP enforces DPoP sender-constrained tokens (RFC 9449). Tokens sent
+// with the DPoP scheme need a valid proof for their cnf.jkt key; bound tokens
+// cannot be downgraded to the Bearer scheme, and plain bearer tokens are
+// rejected when DPoP is required.
+func verifyDPoP(w http.ResponseWriter, r *http.Request, isDPoP bool, accessToken string, cfg *config.Config, verifier *dpop.Verifier) error {
+	err := checkDPoP(r, isDPoP, accessToken, cfg, verifier)
+	if err == nil {
+		return nil
+	}
+
+	dpopErr, ok := err.(*dpop.Error)
+	if !ok {
+		logger.Error("DPoP verification failed: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return err
+	}
+	setDPoPChallenge(w, verifier, dpopErr)
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
+	return err
+}
+
+// checkDPoP applies the rules of verifyDPoP without writing a response
+func checkDPoP(r *http.Request, isDPoP bool, accessToken string, cfg *config.Config, verifier *dpop.Verifier) error {
+	claims, err := util.ParseJWT(accessToken)
+	switch {
+	case err != nil:
+		return &dpop.Error{Code: dpop.ErrorInvalidToken, Description: "invalid token claims"}
+	case isDPoP:
+		return verifier.Verify(r, accessToken, claims)
+	case dpop.BoundThumbprint(claims) != "":
+		return &dpop.Error{Code: dpop.ErrorInvalidToken, Description: "DPoP-bound access token must be sent with the DPoP scheme"}
+	case cfg.DPoP.Required:
+		return &dpop.Error{Code: "invalid_request", Description: "a DPoP-bound access token is required"}
+	}
+	return nil
+}
+
+// setDPoPChallenge adds a DPoP WWW-Authenticate challenge listing the accepted
+// proof algorithms, with the error when there is one
+func setDPoPChallenge(w http.ResponseWriter, verifier *dpop.Verifier, dpopErr *dpop.Error) {
+	challenge := fmt.Sprintf(`DPoP algs=%q`, strings.Join(verifier.Algorithms(), " "))
+	if dpopErr != nil {
+		challenge += fmt.Sprintf(`, error=%q, error_description=%q`, dpopErr.Code, dpopErr.Description)
+	}
+	w.Header().Add("WWW-Authenticate", challenge)
+	w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
+}
@@ -0,0 +1,38 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+)
+
+func TestAuthorizeSSERequiresDPoPProof(t *testing.T) {
+	cfg := &config.Config{DPoP: config.DPoPConfig{Enabled: true}}
+	verifier, err := dpop.New(cfg.DPoP, "")
+	if err != nil {
+		t.Fatalf("dpop.New failed: %v", err)
+	}
+
+	for name, v := range map[string]*dpop.Verifier{"DPoP enabled": verifier, "DPoP disabled": nil} {
+		t.Run(name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/sse", nil)
+			req.Header.Set("Authorization", "DPoP not-a-verified-token")
+			w := httptest.NewRecorder()
+			if err := authorizeSSE(w, req, false, cfg, v); err == nil {
+				t.Fatal("Expected the DPoP scheme without a valid token and proof to be rejected")
+			}
+			if w.Code != http.StatusUnauthorized {
+				t.Errorf("Expected 401, got %d", w.Code)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/sse", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	if err := authorizeSSE(httptest.NewRecorder(), req, false, cfg, verifier); err != nil {
+		t.Errorf("Expected the bearer scheme to be accepted on the handshake, got %v", err)
+	}
+}
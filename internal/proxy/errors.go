@@ -0,0 +1,24 @@
+package proxy
+
+import (
+	"net/http"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// accessDeniedData is the structured data member of an access denied JSON-RPC error
+type accessDeniedData struct {
+	RequiredScopes []string `json:"required_scopes,omitempty"`
+	Rule           string   `json:"rule,omitempty"`
+}
+
+// writeAccessDenied reports a policy denial as a JSON-RPC error so that MCP clients
+// surface it as a tool error rather than a transport failure. The HTTP status is 200
+// because the request itself was delivered and answered.
+func writeAccessDenied(w http.ResponseWriter, env *util.RPCEnvelope, pr authz.AccessControlResult) {
+	util.WriteRPCError(w, http.StatusOK, env.ID, util.RPCErrorAccessDenied, "Forbidden: "+pr.Message, accessDeniedData{
+		RequiredScopes: pr.RequiredScopes,
+		Rule:           pr.Rule,
+	})
+}
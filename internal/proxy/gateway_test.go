@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid, audience string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "alice",
+		"aud": audience,
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestGatewayModeMountsServers(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("gateway-test", &key.PublicKey)
+
+	received := make(chan string, 1)
+	newUpstream := func(name string) *httptest.Server {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received <- name + " " + r.URL.Path
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	github := newUpstream("github")
+	jira := newUpstream("jira")
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		TimeoutSeconds:    5,
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "shared-audience",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+		Servers: []config.ServerConfig{
+			{Name: "github", MountPath: "github/", BaseURL: github.URL, TransportMode: config.StreamableHTTPTransport, Paths: config.PathsConfig{StreamableHTTP: "/mcp"}},
+			{Name: "jira", MountPath: "/jira", BaseURL: jira.URL, TransportMode: config.StreamableHTTPTransport, Paths: config.PathsConfig{StreamableHTTP: "/mcp"},
+				ProtectedResourceMetadata: config.ProtectedResourceMetadata{Audience: "jira-audience"}},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+
+	call := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// Requests reach the mounted server without the mount path
+	if rec := call("/github/mcp", signTestToken(t, key, "gateway-test", "shared-audience")); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from the github server, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := <-received; got != "github /mcp" {
+		t.Errorf("Expected the github server to receive /mcp, got %q", got)
+	}
+
+	// Each server checks its own audience
+	if rec := call("/jira/mcp", signTestToken(t, key, "gateway-test", "shared-audience")); rec.Code == http.StatusOK {
+		t.Errorf("Expected a token for another audience to be rejected by the jira server")
+	}
+	if rec := call("/jira/mcp", signTestToken(t, key, "gateway-test", "jira-audience")); rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from the jira server, got %d: %s", rec.Code, rec.Body.String())
+	}
+	<-received
+
+	// Each server has its own protected resource metadata
+	rec := call("/jira/mcp", "")
+	challenge := rec.Header().Get("WWW-Authenticate")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(challenge, "http://proxy.test/.well-known/oauth-protected-resource/jira/mcp") {
+		t.Errorf("Expected a challenge for the jira metadata, got %d %q", rec.Code, challenge)
+	}
+
+	metaRec := httptest.NewRecorder()
+	router.ServeHTTP(metaRec, httptest.NewRequest(http.MethodGet, "/.well-known/oauth-protected-resource/jira/mcp", nil))
+	var meta map[string]interface{}
+	if err := json.NewDecoder(metaRec.Body).Decode(&meta); err != nil {
+		t.Fatalf("Failed to decode metadata: %v", err)
+	}
+	if meta["resource"] != "http://proxy.test/jira/mcp" {
+		t.Errorf("Expected the jira resource, got %v", meta["resource"])
+	}
+}
+
+func TestMountEndpoint(t *testing.T) {
+	tests := map[string]string{
+		"/messages/?session_id=1":                       "/jira/messages/?session_id=1",
+		"http://proxy.test/messages/?session_id=1":      "http://proxy.test/jira/messages/?session_id=1",
+		"http://proxy.test:8080/messages?sessionId=abc": "http://proxy.test:8080/jira/messages?sessionId=abc",
+	}
+	for endpoint, expected := range tests {
+		if got := mountEndpoint(endpoint, "/jira"); got != expected {
+			t.Errorf("mountEndpoint(%q) = %q, want %q", endpoint, got, expected)
+		}
+	}
+	if got := mountEndpoint("/messages", ""); got != "/messages" {
+		t.Errorf("Expected endpoints to be unchanged without a mount path, got %q", got)
+	}
+}
@@ -0,0 +1,233 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+const (
+	defaultIdentityTokenHeader = "X-MCP-Identity"
+	defaultIdentityTokenTTL    = time.Minute
+	defaultIdentityIssuer      = "open-mcp-auth-proxy"
+)
+
+// defaultIdentityHeaders maps the identity headers added when none are configured to their claims
+var defaultIdentityHeaders = map[string]string{
+	"X-MCP-User":      "sub",
+	"X-MCP-Email":     "email",
+	"X-MCP-Scopes":    "scope",
+	"X-MCP-Client-Id": "client_id",
+}
+
+// identityInjector adds the verified caller identity to upstream requests and
+// removes any identity headers supplied by the client
+type identityInjector struct {
+	headers            map[string]string
+	stripAuthorization bool
+
+	tokenHeader string
+	tokenTTL    time.Duration
+	issuer      string
+	audience    string
+	method      jwt.SigningMethod
+	key         interface{}
+	kid         string
+}
+
+func newIdentityInjector(cfg config.IdentityHeadersConfig) (*identityInjector, error) {
+	headers := cfg.Headers
+	if len(headers) == 0 {
+		headers = defaultIdentityHeaders
+	}
+	inj := &identityInjector{
+		headers:            make(map[string]string, len(headers)),
+		stripAuthorization: cfg.StripAuthorization,
+	}
+	for header, claim := range headers {
+		name := http.CanonicalHeaderKey(header)
+		if name == "Authorization" || name == "Host" {
+			return nil, fmt.Errorf("identity header %q is not allowed", header)
+		}
+		inj.headers[name] = claim
+	}
+
+	st := cfg.SignedToken
+	if !st.Enabled {
+		return inj, nil
+	}
+	inj.tokenHeader = http.CanonicalHeaderKey(st.Header)
+	if inj.tokenHeader == "" {
+		inj.tokenHeader = defaultIdentityTokenHeader
+	}
+	inj.tokenTTL = defaultIdentityTokenTTL
+	if st.TTLSeconds > 0 {
+		inj.tokenTTL = time.Duration(st.TTLSeconds) * time.Second
+	}
+	inj.issuer = st.Issuer
+	if inj.issuer == "" {
+		inj.issuer = defaultIdentityIssuer
+	}
+	inj.audience = st.Audience
+
+	switch {
+	case st.Secret != "" && st.PrivateKeyFile != "":
+		return nil, fmt.Errorf("identity_headers.signed_token takes either a secret or a private_key_file, not both")
+	case st.Secret != "":
+		inj.method = jwt.SigningMethodHS256
+		inj.key = []byte(st.Secret)
+	case st.PrivateKeyFile != "":
+		data, err := os.ReadFile(st.PrivateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read identity signing key: %w", err)
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity signing key: %w", err)
+		}
+		inj.method = jwt.SigningMethodRS256
+		inj.key = key
+		sum := sha256.Sum256(key.PublicKey.N.Bytes())
+		inj.kid = base64.RawURLEncoding.EncodeToString(sum[:12])
+	default:
+		return nil, fmt.Errorf("identity_headers.signed_token requires a secret or a private_key_file")
+	}
+	return inj, nil
+}
+
+// apply removes client-supplied identity headers and, when claims are known,
+// sets the identity headers and signed identity token from them
+func (inj *identityInjector) apply(h http.Header, claims jwt.MapClaims) error {
+	for name := range inj.headers {
+		h.Del(name)
+	}
+	if inj.tokenHeader != "" {
+		h.Del(inj.tokenHeader)
+	}
+	if inj.stripAuthorization {
+		h.Del("Authorization")
+	}
+	if claims == nil {
+		return nil
+	}
+
+	for name, claim := range inj.headers {
+		if v := identityClaim(claims, claim); v != "" {
+			h.Set(name, v)
+		}
+	}
+
+	if inj.tokenHeader != "" {
+		token, err := inj.sign(claims)
+		if err != nil {
+			return err
+		}
+		h.Set(inj.tokenHeader, token)
+	}
+	return nil
+}
+
+// sign issues the internal identity token carrying the mapped claims
+func (inj *identityInjector) sign(claims jwt.MapClaims) (string, error) {
+	now := time.Now()
+	identity := jwt.MapClaims{
+		"iss": inj.issuer,
+		"iat": now.Unix(),
+		"exp": now.Add(inj.tokenTTL).Unix(),
+	}
+	if inj.audience != "" {
+		identity["aud"] = inj.audience
+	}
+	for _, claim := range inj.headers {
+		if v, ok := claims[claim]; ok {
+			identity[claim] = v
+		}
+	}
+	if sub, ok := claims["sub"]; ok {
+		identity["sub"] = sub
+	}
+	if clientID := clientIDFromClaims(claims); clientID != "" {
+		identity["client_id"] = clientID
+	}
+
+	token := jwt.NewWithClaims(inj.method, identity)
+	if inj.kid != "" {
+		token.Header["kid"] = inj.kid
+	}
+	signed, err := token.SignedString(inj.key)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign identity token: %w", err)
+	}
+	return signed, nil
+}
+
+// identityClaim renders a claim as a header value. Scopes and client IDs fall
+// back to the other claim names IdPs use for them.
+func identityClaim(claims jwt.MapClaims, claim string) string {
+	v, ok := claims[claim]
+	if !ok {
+		switch claim {
+		case "client_id":
+			return clientIDFromClaims(claims)
+		case "scope":
+			v, ok = claims["scp"]
+		}
+		if !ok {
+			return ""
+		}
+	}
+
+	var s string
+	switch val := v.(type) {
+	case string:
+		s = val
+	case []interface{}:
+		parts := make([]string, 0, len(val))
+		for _, item := range val {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		s = strings.Join(parts, " ")
+	case float64:
+		s = strconv.FormatFloat(val, 'f', -1, 64)
+	case map[string]interface{}:
+		data, _ := json.Marshal(val)
+		s = string(data)
+	default:
+		s = fmt.Sprint(val)
+	}
+	return sanitizeHeaderValue(s)
+}
+
+// sanitizeHeaderValue drops control characters so that claim values cannot
+// inject additional headers
+func sanitizeHeaderValue(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// identityHeaderNames lists the headers managed by the injector, for logging
+func (inj *identityInjector) identityHeaderNames() []string {
+	names := make([]string, 0, len(inj.headers)+1)
+	for name := range inj.headers {
+		names = append(names, name)
+	}
+	if inj.tokenHeader != "" {
+		names = append(names, inj.tokenHeader)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func TestIdentityInjectorSetsHeadersAndStripsSpoofs(t *testing.T) {
+	inj, err := newIdentityInjector(config.IdentityHeadersConfig{
+		StripAuthorization: true,
+		SignedToken:        config.SignedIdentityConfig{Enabled: true, Secret: "internal-secret", Audience: "mcp-server"},
+	})
+	if err != nil {
+		t.Fatalf("newIdentityInjector failed: %v", err)
+	}
+
+	h := http.Header{}
+	h.Set("Authorization", "Bearer client-token")
+	h.Set("X-MCP-User", "mallory")
+	h.Set("X-MCP-Identity", "forged")
+	claims := jwt.MapClaims{
+		"sub":   "alice",
+		"email": "alice@example.com\r\nX-Injected: 1",
+		"scp":   []interface{}{"mcp_init", "mcp_echo_tool"},
+		"azp":   "client-1",
+	}
+	if err := inj.apply(h, claims); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+
+	expected := map[string]string{
+		"Authorization":   "",
+		"X-Mcp-User":      "alice",
+		"X-Mcp-Email":     "alice@example.comX-Injected: 1",
+		"X-Mcp-Scopes":    "mcp_init mcp_echo_tool",
+		"X-Mcp-Client-Id": "client-1",
+	}
+	for name, want := range expected {
+		if got := h.Get(name); got != want {
+			t.Errorf("Expected %s=%q, got %q", name, want, got)
+		}
+	}
+
+	var identity jwt.MapClaims
+	_, err = jwt.ParseWithClaims(h.Get("X-MCP-Identity"), &identity, func(*jwt.Token) (interface{}, error) {
+		return []byte("internal-secret"), nil
+	})
+	if err != nil {
+		t.Fatalf("Identity token did not verify: %v", err)
+	}
+	if identity["sub"] != "alice" || identity["aud"] != "mcp-server" || identity["client_id"] != "client-1" {
+		t.Errorf("Unexpected identity token claims: %v", identity)
+	}
+}
+
+func TestIdentityInjectorWithoutClaimsOnlyStrips(t *testing.T) {
+	inj, err := newIdentityInjector(config.IdentityHeadersConfig{
+		Headers: map[string]string{"x-tenant": "tenant_id"},
+	})
+	if err != nil {
+		t.Fatalf("newIdentityInjector failed: %v", err)
+	}
+
+	h := http.Header{}
+	h.Set("X-Tenant", "other-tenant")
+	h.Set("Authorization", "Bearer client-token")
+	if err := inj.apply(h, nil); err != nil {
+		t.Fatalf("apply failed: %v", err)
+	}
+	if h.Get("X-Tenant") != "" {
+		t.Errorf("Expected the client-supplied header to be removed")
+	}
+	if h.Get("Authorization") == "" {
+		t.Errorf("Expected Authorization to be kept")
+	}
+}
+
+func TestNewIdentityInjectorValidatesConfig(t *testing.T) {
+	invalid := []config.IdentityHeadersConfig{
+		{Headers: map[string]string{"authorization": "sub"}},
+		{SignedToken: config.SignedIdentityConfig{Enabled: true}},
+		{SignedToken: config.SignedIdentityConfig{Enabled: true, Secret: "s", PrivateKeyFile: "key.pem"}},
+	}
+	for _, cfg := range invalid {
+		if _, err := newIdentityInjector(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
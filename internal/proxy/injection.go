@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/injection"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+var injectionFindings = metrics.NewCounter(
+	"mcp_proxy_prompt_injection_findings_total",
+	"Tool descriptions and tool results matching prompt injection rules, by rule set and the action taken.",
+	"server", "target", "rule", "action",
+)
+
+// blockedTools remembers the tools that prompt injection rules removed from
+// the listings of each MCP server, so that calls to them are rejected too
+type blockedTools struct {
+	mu    sync.Mutex
+	tools map[*config.Config]map[string]bool
+}
+
+func newBlockedTools() *blockedTools {
+	return &blockedTools{tools: make(map[*config.Config]map[string]bool)}
+}
+
+// update records which of the tools in a listing of the server were blocked
+func (b *blockedTools) update(cfg *config.Config, listed []string, findings []injection.Finding) {
+	blocked := make(map[string]bool)
+	for _, f := range findings {
+		if f.Target == injection.TargetToolDescription && f.Action == config.InjectionBlock {
+			blocked[f.Tool] = true
+		}
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	tools := b.tools[cfg]
+	if tools == nil {
+		tools = make(map[string]bool)
+		b.tools[cfg] = tools
+	}
+	// A tool listed with a clean description again is no longer blocked
+	for _, name := range listed {
+		if blocked[name] {
+			tools[name] = true
+		} else {
+			delete(tools, name)
+		}
+	}
+}
+
+func (b *blockedTools) blocked(cfg *config.Config, tool string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tools[cfg][tool]
+}
+
+// listedTools returns the names of the tools in a tools/list result, or nil
+// for other messages
+func listedTools(msg map[string]json.RawMessage) []string {
+	if len(msg["result"]) == 0 {
+		return nil
+	}
+	var list struct {
+		Tools *[]struct {
+			Name string `json:"name"`
+		} `json:"tools"`
+	}
+	if json.Unmarshal(msg["result"], &list) != nil || list.Tools == nil {
+		return nil
+	}
+	names := make([]string, 0, len(*list.Tools))
+	for _, tool := range *list.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+// checkInjection applies the prompt injection rules to a tools/list result or
+// tool result, and reports whether it changed the message
+func checkInjection(stages *upstreamStages, cfg *config.Config, msg map[string]json.RawMessage) bool {
+	listed := listedTools(msg)
+	findings, changed, err := stages.injection.Message(msg)
+	if err != nil {
+		logger.Warn("Failed to check a response from %s for prompt injection: %v", cfg.ServerName, err)
+		return false
+	}
+	if listed != nil {
+		stages.blocked.update(cfg, listed, findings)
+	}
+	for _, f := range findings {
+		rules := f.Findings.Names()
+		for _, rule := range rules {
+			injectionFindings.Add(float64(f.Findings[rule]), cfg.ServerName, f.Target, rule, f.Action)
+		}
+		if f.Target == injection.TargetToolDescription {
+			logger.Warn("Tool %s looks like prompt injection (%s); action: %s", f.Tool, strings.Join(rules, ", "), f.Action)
+		} else {
+			logger.Warn("Result %s looks like prompt injection (%s); action: %s", msg["id"], strings.Join(rules, ", "), f.Action)
+		}
+	}
+	return changed
+}
+
+// checkBlockedTool rejects calls to tools that prompt injection rules removed
+// from the listing. It returns false after writing the rejection.
+func checkBlockedTool(w http.ResponseWriter, cfg *config.Config, blocked *blockedTools, env *util.RPCEnvelope) bool {
+	name := env.ToolName()
+	if name == "" || !blocked.blocked(cfg, name) {
+		return true
+	}
+
+	logger.Warn("Blocked call to tool %s: its description looks like prompt injection", name)
+	message := "Forbidden: the description of tool " + name + " looks like prompt injection"
+	if cfg.JSONRPCErrors && env.ID != nil {
+		util.WriteRPCError(w, http.StatusOK, env.ID, util.RPCErrorAccessDenied, message, toolBlockedData{
+			Reason: "prompt_injection",
+			Tool:   name,
+		})
+	} else {
+		http.Error(w, message, http.StatusForbidden)
+	}
+	return false
+}
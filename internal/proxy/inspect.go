@@ -0,0 +1,146 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/inspect"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+var inspectionFindings = metrics.NewCounter(
+	"mcp_proxy_content_inspection_findings_total",
+	"Sensitive content found in tool results, by detector and the action taken.",
+	"server", "detector", "action",
+)
+
+// contentBlockedData is the structured data member of the error that replaces a blocked result
+type contentBlockedData struct {
+	Reason    string   `json:"reason"`
+	Detectors []string `json:"detectors,omitempty"`
+}
+
+// contentInspector applies the inspection action to the tool results of one MCP server
+type contentInspector struct {
+	inspector *inspect.Inspector
+	action    string
+}
+
+func newContentInspector(cfg config.InspectionConfig) (*contentInspector, error) {
+	inspector, err := inspect.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &contentInspector{inspector: inspector, action: cfg.Action}, nil
+}
+
+// inspectResponse checks the tool descriptions and tool results in a response
+// from the MCP server, including those sent on event streams
+func inspectResponse(stages *upstreamStages, cfg *config.Config, resp *http.Response) {
+	rewriteMessages(resp, func(msg map[string]json.RawMessage) (bool, bool) {
+		changed := false
+		// Prompt injection rules apply first, so that blocked results are not inspected
+		if stages.injection != nil && checkInjection(stages, cfg, msg) {
+			changed = true
+		}
+		if stages.inspector != nil && stages.inspector.inspectMessage(cfg, msg) {
+			changed = true
+		}
+		return changed, false
+	}, blocksUnreadable(stages, cfg))
+}
+
+// blocksUnreadable reports whether responses that cannot be inspected are
+// withheld, because the inspection or a prompt injection rule set blocks
+func blocksUnreadable(stages *upstreamStages, cfg *config.Config) bool {
+	if stages.inspector != nil && stages.inspector.action == config.InspectionBlock {
+		return true
+	}
+	return stages.injection != nil && cfg.Injection.Blocks()
+}
+
+// inspectMessage applies the action to a response that carries a tool result,
+// and reports whether it changed the message. Results of other methods have
+// neither content nor structuredContent, so no request is needed to tell them apart.
+func (ci *contentInspector) inspectMessage(cfg *config.Config, msg map[string]json.RawMessage) bool {
+	raw := msg["result"]
+	if len(raw) == 0 || !(bytes.Contains(raw, []byte(`"content"`)) || bytes.Contains(raw, []byte(`"structuredContent"`))) {
+		return false
+	}
+	redacted, findings, err := ci.inspector.Result(raw)
+	if err != nil {
+		logger.Warn("Failed to inspect a result from %s: %v", cfg.ServerName, err)
+		return false
+	}
+	if len(findings) == 0 {
+		return false
+	}
+
+	// Only detector names and counts are logged, never what they matched
+	found := findings.Names()
+	for _, name := range found {
+		inspectionFindings.Add(float64(findings[name]), cfg.ServerName, name, ci.action)
+	}
+	logger.Warn("Sensitive content in result %s (%s); action: %s", msg["id"], strings.Join(found, ", "), ci.action)
+
+	switch ci.action {
+	case config.InspectionRedact:
+		msg["result"] = redacted
+		return true
+	case config.InspectionBlock:
+		rpcErr, err := json.Marshal(util.RPCError{
+			Code:    util.RPCErrorContentBlocked,
+			Message: "The result was withheld because it contains sensitive content",
+			Data:    contentBlockedData{Reason: "sensitive_content", Detectors: found},
+		})
+		if err != nil {
+			logger.Error("Failed to encode JSON-RPC error: %v", err)
+			return false
+		}
+		delete(msg, "result")
+		msg["error"] = rpcErr
+		return true
+	}
+	return false
+}
+
+// responseBuffer holds a response written by a handler so that it can be
+// inspected before it is sent
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *responseBuffer) Header() http.Header         { return b.header }
+func (b *responseBuffer) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+// serveInspected calls handler and inspects the response it writes before sending it to w
+func serveInspected(w http.ResponseWriter, r *http.Request, stages *upstreamStages, cfg *config.Config, handler http.HandlerFunc) {
+	buf := &responseBuffer{header: http.Header{}}
+	handler(buf, r)
+	if buf.status == 0 {
+		buf.status = http.StatusOK
+	}
+
+	resp := &http.Response{StatusCode: buf.status, Header: buf.header, Body: io.NopCloser(&buf.body), Request: r}
+	inspectResponse(stages, cfg, resp)
+	for k, v := range resp.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(resp.StatusCode)
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		logger.Debug("Failed to write response: %v", err)
+	}
+}
@@ -6,8 +6,10 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
 	"github.com/wso2/open-mcp-auth-proxy/internal/logging"
 )
@@ -20,11 +22,14 @@ type RequestModifier interface {
 // AuthorizationModifier adds parameters to authorization requests
 type AuthorizationModifier struct {
 	Config *config.Config
+	// Clients translates client IDs issued by the proxy; nil when the proxy issues none
+	Clients authz.ClientResolver
 }
 
 // TokenModifier adds parameters to token requests
 type TokenModifier struct {
-	Config *config.Config
+	Config  *config.Config
+	Clients authz.ClientResolver
 }
 
 type RegisterModifier struct {
@@ -33,6 +38,12 @@ type RegisterModifier struct {
 
 // ModifyRequest adds configured parameters to authorization requests
 func (m *AuthorizationModifier) ModifyRequest(req *http.Request) (*http.Request, error) {
+	if m.Clients != nil {
+		if err := m.translateClient(req); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if we have parameters to add
 	if m.Config.Default.Path == nil {
 		return req, nil
@@ -63,6 +74,12 @@ func (m *TokenModifier) ModifyRequest(req *http.Request) (*http.Request, error)
 		return req, nil
 	}
 
+	if m.Clients != nil && strings.Contains(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		if err := m.translateClient(req); err != nil {
+			return nil, err
+		}
+	}
+
 	// Check if we have parameters to add
 	if m.Config.Default.Path == nil {
 		return req, nil
@@ -128,6 +145,76 @@ func (m *TokenModifier) ModifyRequest(req *http.Request) (*http.Request, error)
 	return req, nil
 }
 
+// translateClient checks the redirect URI of a proxy-issued client and swaps
+// in the upstream client ID
+func (m *AuthorizationModifier) translateClient(req *http.Request) error {
+	query := req.URL.Query()
+	client, err := m.Clients.ResolveClient(query.Get("client_id"))
+	if err != nil || client == nil {
+		return err
+	}
+
+	redirectURI := query.Get("redirect_uri")
+	if redirectURI == "" && len(client.RedirectURIs) == 1 {
+		redirectURI = client.RedirectURIs[0]
+		query.Set("redirect_uri", redirectURI)
+	}
+	if !client.AllowsRedirect(redirectURI) {
+		return fmt.Errorf("redirect_uri %q is not registered for client %s", redirectURI, client.ClientID)
+	}
+
+	if client.UpstreamClientID != "" {
+		query.Set("client_id", client.UpstreamClientID)
+	}
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// translateClient authenticates a proxy-issued client and replaces its
+// credentials with those of the upstream client
+func (m *TokenModifier) translateClient(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+	form := req.PostForm
+
+	clientID, secret, basic := req.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = form.Get("client_id")
+		secret = form.Get("client_secret")
+	}
+
+	client, err := m.Clients.ResolveClient(clientID)
+	if err != nil || client == nil {
+		return err
+	}
+	if !client.VerifySecret(secret) {
+		return fmt.Errorf("client authentication failed for %s", client.ClientID)
+	}
+
+	if client.UpstreamClientID != "" {
+		req.Header.Del("Authorization")
+		form.Del("client_secret")
+		form.Set("client_id", client.UpstreamClientID)
+		if client.UpstreamClientSecret != "" {
+			if client.UpstreamAuthMethod == "client_secret_basic" {
+				req.SetBasicAuth(url.QueryEscape(client.UpstreamClientID), url.QueryEscape(client.UpstreamClientSecret))
+			} else {
+				form.Set("client_secret", client.UpstreamClientSecret)
+			}
+		}
+	}
+
+	formEncoded := form.Encode()
+	req.Body = io.NopCloser(strings.NewReader(formEncoded))
+	req.ContentLength = int64(len(formEncoded))
+	req.Header.Set("Content-Length", fmt.Sprintf("%d", len(formEncoded)))
+	return nil
+}
+
 func (m *RegisterModifier) ModifyRequest(req *http.Request) (*http.Request, error) {
 	// Only modify POST requests
 	if req.Method != http.MethodPost {
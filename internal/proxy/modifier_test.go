@@ -1,11 +1,13 @@
 package proxy
 
 import (
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
 	"testing"
 
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
 )
 
@@ -145,3 +147,72 @@ func TestRegisterModifier(t *testing.T) {
 		t.Errorf("Expected body to contain redirect_uris, got %s", bodyStr)
 	}
 }
+
+// stubClients resolves a single proxy-issued client
+type stubClients struct {
+	client *authz.ResolvedClient
+}
+
+func (s *stubClients) ResolveClient(clientID string) (*authz.ResolvedClient, error) {
+	if s.client != nil && clientID == s.client.ClientID {
+		return s.client, nil
+	}
+	return nil, nil
+}
+
+func TestAuthorizationModifierTranslatesClient(t *testing.T) {
+	clients := &stubClients{client: &authz.ResolvedClient{
+		ClientID:         "client-abc",
+		RedirectURIs:     []string{"http://localhost/cb"},
+		UpstreamClientID: "upstream-id",
+	}}
+	modifier := &AuthorizationModifier{Config: &config.Config{}, Clients: clients}
+
+	req, _ := http.NewRequest("GET", "/authorize?client_id=client-abc&redirect_uri=http://localhost/cb", nil)
+	modifiedReq, err := modifier.ModifyRequest(req)
+	if err != nil {
+		t.Fatalf("ModifyRequest failed: %v", err)
+	}
+	if got := modifiedReq.URL.Query().Get("client_id"); got != "upstream-id" {
+		t.Errorf("Expected client_id=upstream-id, got %s", got)
+	}
+
+	req, _ = http.NewRequest("GET", "/authorize?client_id=client-abc&redirect_uri=http://evil.example.com/cb", nil)
+	if _, err := modifier.ModifyRequest(req); err == nil {
+		t.Errorf("Expected unregistered redirect_uri to be rejected")
+	}
+
+	// Client IDs not issued by the proxy pass through unchanged
+	req, _ = http.NewRequest("GET", "/authorize?client_id=other", nil)
+	modifiedReq, _ = modifier.ModifyRequest(req)
+	if got := modifiedReq.URL.Query().Get("client_id"); got != "other" {
+		t.Errorf("Expected client_id=other, got %s", got)
+	}
+}
+
+func TestTokenModifierTranslatesClient(t *testing.T) {
+	clients := &stubClients{client: &authz.ResolvedClient{
+		ClientID:             "client-abc",
+		UpstreamClientID:     "upstream-id",
+		UpstreamClientSecret: "upstream-secret",
+		UpstreamAuthMethod:   "client_secret_basic",
+	}}
+	modifier := &TokenModifier{Config: &config.Config{}, Clients: clients}
+
+	form := url.Values{"grant_type": {"authorization_code"}, "code": {"c"}, "client_id": {"client-abc"}}
+	req, _ := http.NewRequest("POST", "/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	modifiedReq, err := modifier.ModifyRequest(req)
+	if err != nil {
+		t.Fatalf("ModifyRequest failed: %v", err)
+	}
+	body, _ := io.ReadAll(modifiedReq.Body)
+	sent, _ := url.ParseQuery(string(body))
+	if sent.Get("client_id") != "upstream-id" || sent.Get("code") != "c" {
+		t.Errorf("Expected upstream client_id and original code, got %s", body)
+	}
+	if user, pass, ok := modifiedReq.BasicAuth(); !ok || user != "upstream-id" || pass != "upstream-secret" {
+		t.Errorf("Expected upstream credentials in basic auth, got %s:%s", user, pass)
+	}
+}
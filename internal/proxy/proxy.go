@@ -2,48 +2,223 @@ package proxy
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/approval"
 	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/credentials"
+	"github.com/wso2/open-mcp-auth-proxy/internal/dpop"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	"github.com/wso2/open-mcp-auth-proxy/internal/injection"
 	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+	"github.com/wso2/open-mcp-auth-proxy/internal/ratelimit"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+	"github.com/wso2/open-mcp-auth-proxy/internal/tokenexchange"
 	"github.com/wso2/open-mcp-auth-proxy/internal/util"
 )
 
+// Router routes requests to the auth server and the MCP servers
+type Router struct {
+	*http.ServeMux
+	// Stop what the router started that must not outlive the proxy
+	closers []func()
+}
+
+// Close stops the subprocesses the router started for MCP servers and
+// writes the changes its stores have not saved yet
+func (rt *Router) Close() {
+	for _, closer := range rt.closers {
+		closer()
+	}
+}
+
 // NewRouter builds an http.ServeMux that routes
 // * /authorize, /token, /register, /.well-known to the provider or proxy
 // * MCP paths to the MCP server, etc.
-func NewRouter(cfg *config.Config, provider authz.Provider, accessController authz.AccessControl) http.Handler {
-	mux := http.NewServeMux()
+// Background work of the router stops when ctx is done.
+func NewRouter(ctx context.Context, cfg *config.Config, provider authz.Provider, accessController authz.AccessControl) *Router {
+	router := &Router{ServeMux: http.NewServeMux()}
+	mux := router.ServeMux
 
-	modifiers := map[string]RequestModifier{
-		"/authorize": &AuthorizationModifier{Config: cfg},
-		"/token":     &TokenModifier{Config: cfg},
-		"/register":  &RegisterModifier{Config: cfg},
+	var limiter *ratelimit.Limiter
+	if cfg.RateLimit.Enabled {
+		var err error
+		limiter, err = ratelimit.New(cfg.RateLimit)
+		if err != nil {
+			logger.Error("Invalid rate limit configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+		router.closers = append(router.closers, func() {
+			if err := limiter.Close(); err != nil {
+				logger.Error("Failed to save quota counters: %v", err)
+			}
+		})
+	}
+
+	var dpopVerifier *dpop.Verifier
+	if cfg.DPoP.Enabled {
+		var err error
+		dpopVerifier, err = dpop.New(cfg.DPoP, cfg.ProxyBaseURL)
+		if err != nil {
+			logger.Error("Invalid DPoP configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+	}
+
+	var exchanger *tokenexchange.Exchanger
+	if cfg.TokenExchange.Enabled {
+		var err error
+		exchanger, err = tokenexchange.New(cfg.TokenExchange, defaultTokenEndpoint(cfg, provider))
+		if err != nil {
+			logger.Error("Invalid token exchange configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+	}
+
+	var identity *identityInjector
+	if cfg.IdentityHeaders.Enabled {
+		var err error
+		identity, err = newIdentityInjector(cfg.IdentityHeaders)
+		if err != nil {
+			logger.Error("Invalid identity header configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+		logger.Info("Adding identity headers to upstream requests: %s", strings.Join(identity.identityHeaderNames(), ", "))
+	}
+
+	var creds *credentials.Manager
+	if cfg.Credentials.Enabled {
+		var err error
+		creds, err = credentials.NewManager(cfg.Credentials, cfg.PublicBaseURL())
+		if err != nil {
+			logger.Error("Invalid credentials configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+	}
+
+	var inspector *contentInspector
+	if cfg.Inspection.Enabled {
+		var err error
+		inspector, err = newContentInspector(cfg.Inspection)
+		if err != nil {
+			logger.Error("Invalid inspection configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+	}
+
+	var approvals *approval.Queue
+	if cfg.Approval.Enabled {
+		approvals = approval.New(cfg.Approval)
+		logger.Info("Calls to %s need approval at %s", strings.Join(cfg.Approval.Tools, ", "), cfg.Approval.Path)
+	}
+
+	var scanner *injection.Scanner
+	if cfg.Injection.Enabled {
+		var err error
+		scanner, err = injection.New(cfg.Injection)
+		if err != nil {
+			logger.Error("Invalid injection configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+	}
+
+	stages := &upstreamStages{
+		limiter:     limiter,
+		dpop:        dpopVerifier,
+		exchanger:   exchanger,
+		identity:    identity,
+		credentials: creds,
+		inspector:   inspector,
+		injection:   scanner,
+		approvals:   approvals,
+	}
+	if scanner != nil {
+		stages.blocked = newBlockedTools()
+	}
+	if mapper, ok := provider.(authz.PathMapper); ok {
+		stages.paths = mapper
 	}
 
 	registeredPaths := make(map[string]bool)
 
 	var defaultPaths []string
 
+	// Resolves client IDs issued by the proxy to upstream clients
+	var clients authz.ClientResolver
+
 	// Handle based on mode configuration
-	if cfg.Mode == "demo" || cfg.Mode == "asgardeo" {
+	switch cfg.Mode {
+	case "demo", "asgardeo":
 		// Demo/Asgardeo mode: Custom handlers for well-known and register
 		mux.HandleFunc("/.well-known/oauth-authorization-server", provider.WellKnownHandler())
 		registeredPaths["/.well-known/oauth-authorization-server"] = true
 
-		mux.HandleFunc("/register", provider.RegisterHandler())
+		mux.HandleFunc("/register", withBodyLimit(cfg, provider.RegisterHandler()))
 		registeredPaths["/register"] = true
 
+		// Clients issued by /register are tracked to clean up unused applications
+		if resolver, ok := provider.(authz.ClientResolver); ok {
+			clients = resolver
+		}
+
 		// Authorize and token will be proxied with parameter modification
 		defaultPaths = []string{"/authorize", "/token"}
-	} else {
+	case "oidc", "keycloak", "auth0":
+		// Discovery-based mode: the provider republishes the upstream metadata
+		// under both well-known names, and the endpoints are proxied
+		mux.HandleFunc("/.well-known/oauth-authorization-server", provider.WellKnownHandler())
+		registeredPaths["/.well-known/oauth-authorization-server"] = true
+		mux.HandleFunc("/.well-known/openid-configuration", provider.WellKnownHandler())
+		registeredPaths["/.well-known/openid-configuration"] = true
+
+		// Providers that handle registration themselves serve /register directly
+		if registerHandler := provider.RegisterHandler(); registerHandler != nil {
+			mux.HandleFunc("/register", withBodyLimit(cfg, registerHandler))
+			registeredPaths["/register"] = true
+		}
+
+		defaultPaths = []string{"/authorize", "/token", "/register"}
+	case "embedded":
+		// Embedded mode: the proxy is the authorization server, nothing is proxied
+		mux.HandleFunc("/.well-known/oauth-authorization-server", provider.WellKnownHandler())
+		registeredPaths["/.well-known/oauth-authorization-server"] = true
+
+		mux.HandleFunc("/register", withBodyLimit(cfg, provider.RegisterHandler()))
+		registeredPaths["/register"] = true
+
+		if endpointProvider, ok := provider.(authz.EndpointProvider); ok {
+			for path, handler := range endpointProvider.Endpoints() {
+				mux.HandleFunc(path, withBodyLimit(cfg, handler))
+				registeredPaths[path] = true
+			}
+		}
+	default:
 		// Default provider mode
+		if cfg.Default.Registration.Enabled {
+			// The proxy handles registration itself for IdPs without RFC 7591 support
+			registry, err := authz.NewClientRegistry(cfg)
+			if err != nil {
+				logger.Error("Failed to initialize client registration: %v", err)
+				panic(err) // Fatal error that prevents startup
+			}
+			mux.HandleFunc("/register", withBodyLimit(cfg, registry.Handler()))
+			mux.HandleFunc("/register/", withBodyLimit(cfg, registry.Handler()))
+			registeredPaths["/register"] = true
+			registeredPaths["/register/"] = true
+			clients = registry
+		}
+
 		if cfg.Default.Path != nil {
 			// Check if we have custom response for well-known
 			wellKnownConfig, exists := cfg.Default.Path["/.well-known/oauth-authorization-server"]
@@ -64,19 +239,52 @@ func NewRouter(cfg *config.Config, provider authz.Provider, accessController aut
 		}
 	}
 
-	mux.HandleFunc(getProtectedResourceMetadataEndpointPath(cfg), func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		allowed := getAllowedOrigin(origin, cfg)
-		if r.Method == http.MethodOptions {
-			addCORSHeaders(w, cfg, allowed, r.Header.Get("Access-Control-Request-Headers"))
-			w.WriteHeader(http.StatusNoContent)
-			return
+	if cfg.ClientMetadata.Enabled {
+		if cfg.Mode == "embedded" {
+			logger.Warn("client_metadata is not supported in embedded mode and is ignored")
+		} else {
+			// URL client IDs are checked before clients registered at the proxy
+			resolvers := authz.ClientResolvers{authz.NewClientMetadataResolver(cfg.ClientMetadata)}
+			if clients != nil {
+				resolvers = append(resolvers, clients)
+			}
+			clients = resolvers
 		}
+	}
 
-		addCORSHeaders(w, cfg, allowed, "")
-		provider.ProtectedResourceMetadataHandler()(w, r)
-	})
-	registeredPaths[getProtectedResourceMetadataEndpointPath(cfg)] = true
+	if creds != nil {
+		credentialsHandler := withCORS(cfg, withBodyLimit(cfg, creds.Handler(credentialAuthenticator(cfg, dpopVerifier))))
+		mux.HandleFunc("/credentials", credentialsHandler)
+		mux.HandleFunc("/credentials/", credentialsHandler)
+		registeredPaths["/credentials"] = true
+		registeredPaths["/credentials/"] = true
+	}
+
+	if approvals != nil {
+		approvalHandler := withBodyLimit(cfg, approvals.Handler(cfg.Approval.Path, approverAuthenticator(cfg, dpopVerifier), cfg.Approval.AllowSelfApproval))
+		mux.HandleFunc(cfg.Approval.Path, approvalHandler)
+		mux.HandleFunc(cfg.Approval.Path+"/", approvalHandler)
+		registeredPaths[cfg.Approval.Path] = true
+		registeredPaths[cfg.Approval.Path+"/"] = true
+	}
+
+	modifiers := map[string]RequestModifier{
+		"/authorize": &AuthorizationModifier{Config: cfg, Clients: clients},
+		"/token":     &TokenModifier{Config: cfg, Clients: clients},
+		"/register":  &RegisterModifier{Config: cfg},
+	}
+
+	// In gateway mode every mounted server is its own protected resource
+	upstreams := cfg.UpstreamConfigs()
+	for _, upstream := range upstreams {
+		metadataHandler := provider.ProtectedResourceMetadataHandler()
+		if upstream.MountPath != "" {
+			metadataHandler = authz.ProtectedResourceMetadataHandler(upstream)
+		}
+		path := getProtectedResourceMetadataEndpointPath(upstream)
+		mux.HandleFunc(path, protectedResourceMetadataHandler(cfg, metadataHandler))
+		registeredPaths[path] = true
+	}
 
 	// Remove duplicates from defaultPaths
 	uniquePaths := make(map[string]bool)
@@ -91,30 +299,120 @@ func NewRouter(cfg *config.Config, provider authz.Provider, accessController aut
 
 	for _, path := range defaultPaths {
 		if !registeredPaths[path] {
-			mux.HandleFunc(path, buildProxyHandler(cfg, modifiers, accessController))
+			mux.HandleFunc(path, buildProxyHandler(cfg, modifiers, accessController, stages, nil))
 			registeredPaths[path] = true
 		}
 	}
 
+	// Approved tool definitions, shared by all servers
+	var pinStore store.Store
+	if cfg.ToolPinning.Enabled {
+		var err error
+		pinStore, err = store.New(cfg.ToolPinning.Store)
+		if err != nil {
+			logger.Error("Invalid tool pinning configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+		router.closers = append(router.closers, func() {
+			if err := store.Close(pinStore); err != nil {
+				logger.Error("Failed to save tool pins: %v", err)
+			}
+		})
+	}
+
 	// MCP paths
-	mcpPaths := cfg.GetMCPPaths()
-	for _, path := range mcpPaths {
-		mux.HandleFunc(path, buildProxyHandler(cfg, modifiers, accessController))
-		registeredPaths[path] = true
+	routings := make(map[string]*upstreamRouting)
+	for _, upstream := range upstreams {
+		if upstream.MountPath != "" {
+			logger.Info("Mounting MCP server %s at %s -> %s", upstream.ServerName, upstream.MountPath, upstream.BaseURL)
+		}
+		// All paths of a server share its replicas, sessions and circuit breaker
+		routing, err := newUpstreamRouting(ctx, upstream, pinStore)
+		if err != nil {
+			logger.Error("Invalid load balancing configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+		routings[upstream.ServerName] = routing
+		if routing.users != nil {
+			logger.Info("Starting a subprocess for each user of %s", upstream.Stdio.UserCommand)
+			routing.users.StartJanitor(ctx)
+			router.closers = append(router.closers, routing.users.Shutdown)
+		}
+		if routing.pool != nil {
+			logger.Info("Balancing MCP traffic across %d replicas: %s", len(upstream.BaseURLs), strings.Join(upstream.BaseURLs, ", "))
+		}
+		for _, path := range upstream.GetMCPPaths() {
+			mux.HandleFunc(path, buildProxyHandler(upstream, modifiers, accessController, stages, routing))
+			registeredPaths[path] = true
+		}
+	}
+
+	// One endpoint that merges the gateway servers
+	if cfg.Aggregate.Enabled {
+		server, err := newAggregateServer(cfg, accessController, routings)
+		if err != nil {
+			logger.Error("Invalid aggregate configuration: %v", err)
+			panic(err) // Fatal error that prevents startup
+		}
+		aggregateCfg := cfg.AggregateResourceConfig()
+		metadataPath := getProtectedResourceMetadataEndpointPath(aggregateCfg)
+		mux.HandleFunc(metadataPath, protectedResourceMetadataHandler(cfg, authz.ProtectedResourceMetadataHandler(aggregateCfg)))
+		mux.HandleFunc(cfg.Aggregate.Path, buildAggregateHandler(aggregateCfg, server, accessController, stages))
+		registeredPaths[metadataPath] = true
+		registeredPaths[cfg.Aggregate.Path] = true
+		logger.Info("Serving the aggregate of %d MCP servers at %s", len(cfg.Aggregate.Servers), cfg.Aggregate.Path)
+	}
+
+	if cfg.Metrics.Enabled {
+		mux.HandleFunc(cfg.Metrics.Path, metrics.Handler())
+		registeredPaths[cfg.Metrics.Path] = true
 	}
 
 	// Register paths from PathMapping that haven't been registered yet
 	for path := range cfg.PathMapping {
 		if !registeredPaths[path] {
-			mux.HandleFunc(path, buildProxyHandler(cfg, modifiers, accessController))
+			mux.HandleFunc(path, buildProxyHandler(cfg, modifiers, accessController, stages, nil))
 			registeredPaths[path] = true
 		}
 	}
 
-	return mux
+	return router
+}
+
+// upstreamStages holds the optional stages that authorize MCP requests,
+// prepare them for the MCP server and inspect what it returns. Nil stages
+// are disabled.
+type upstreamStages struct {
+	limiter     *ratelimit.Limiter
+	dpop        *dpop.Verifier
+	exchanger   *tokenexchange.Exchanger
+	identity    *identityInjector
+	credentials *credentials.Manager
+	inspector   *contentInspector
+	injection   *injection.Scanner
+	approvals   *approval.Queue
+	// Tools the injection rules removed from listings
+	blocked *blockedTools
+
+	// Maps auth server paths that can change at runtime (optional)
+	paths authz.PathMapper
+}
+
+// mapPath returns the upstream path for a proxy path, preferring the
+// provider's current endpoints over the startup path mappings
+func mapPath(cfg *config.Config, paths authz.PathMapper, path string) (string, bool) {
+	if paths != nil {
+		if rewrite, ok := paths.MapPath(path); ok {
+			return rewrite, true
+		}
+	}
+	rewrite, ok := cfg.PathMapping[path]
+	return rewrite, ok
 }
 
-func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier, accessController authz.AccessControl) http.HandlerFunc {
+// buildProxyHandler proxies requests to the auth server or the MCP server.
+// MCP paths are given the routing of their MCP server; other paths have none.
+func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier, accessController authz.AccessControl, stages *upstreamStages, routing *upstreamRouting) http.HandlerFunc {
 	// Parse the base URLs up front
 	authBase, err := url.Parse(cfg.AuthServerBaseURL)
 	if err != nil {
@@ -128,34 +426,19 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 		panic(err) // Fatal error that prevents startup
 	}
 
+	if routing == nil {
+		routing = &upstreamRouting{}
+	}
+
 	// Detect SSE paths from config
 	ssePaths := make(map[string]bool)
 	ssePaths[cfg.Paths.SSE] = true
 
 	return func(w http.ResponseWriter, r *http.Request) {
-		origin := r.Header.Get("Origin")
-		allowedOrigin := getAllowedOrigin(origin, cfg)
-		// Handle OPTIONS
-		if r.Method == http.MethodOptions {
-			if allowedOrigin == "" {
-				logger.Warn("Preflight request from disallowed origin: %s", origin)
-				http.Error(w, "CORS origin not allowed", http.StatusForbidden)
-				return
-			}
-			addCORSHeaders(w, cfg, allowedOrigin, r.Header.Get("Access-Control-Request-Headers"))
-			w.WriteHeader(http.StatusNoContent)
+		if !handleCORS(w, r, cfg) {
 			return
 		}
 
-		if allowedOrigin == "" {
-			logger.Warn("Request from disallowed origin: %s for %s", origin, r.URL.Path)
-			http.Error(w, "CORS origin not allowed", http.StatusForbidden)
-			return
-		}
-
-		// Add CORS headers to all responses
-		addCORSHeaders(w, cfg, allowedOrigin, "")
-
 		// Check if the request is for the latest spec
 		specVersion := util.GetVersionWithDefault(r.Header.Get("MCP-Protocol-Version"))
 		ver, err := util.ParseVersionDate(specVersion)
@@ -164,32 +447,156 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 		// Decide whether the request should go to the auth server or MCP
 		var targetURL *url.URL
 		isSSE := false
+		isMCP := false
+		// The replica serving the request when the MCP server is balanced
+		var failover *replicaFailover
+		// The JSON-RPC request and body of MCP requests, for error responses and retries
+		var env *util.RPCEnvelope
+		var body []byte
+		// Reports the outcome to the circuit breaker
+		reportOutcome := func(success bool) {}
+		// Whether the policy holds the call until it is approved
+		decision := authz.DecisionAllow
+		// Verified claims of the caller, for identity headers and credentials
+		var callerClaims jwt.MapClaims
+		// What the request carries to the MCP server on behalf of the caller
+		upstream := &upstreamAuth{}
+		destination := httpclient.DestinationUpstream
 
 		if isAuthPath(r.URL.Path, cfg) {
+			if _, ok := limitRequestBody(w, r, cfg); !ok {
+				return
+			}
 			targetURL = authBase
+			destination = httpclient.DestinationIdP
 		} else if isMCPPath(r.URL.Path, cfg) {
+			if !validateMCPRequest(w, r, cfg) {
+				return
+			}
 			if ssePaths[r.URL.Path] {
-				if err := authorizeSSE(w, r, isLatestSpec, cfg); err != nil {
-					http.Error(w, err.Error(), http.StatusUnauthorized)
+				if err := authorizeSSE(w, r, isLatestSpec, cfg, stages.dpop); err != nil {
+					// authorizeSSE has already written the error response
+					logger.Warn("Denied %s request: %v", r.URL.Path, err)
 					return
 				}
+				if stages.identity != nil || stages.credentials != nil {
+					// The SSE handshake is not authorized by token, so only a verified signature yields an identity
+					if accessToken, err := util.ExtractAccessToken(r.Header.Get("Authorization")); err == nil && util.ValidateJWT(false, accessToken, "") == nil {
+						callerClaims, _ = util.ParseJWT(accessToken)
+					}
+				}
 				isSSE = true
 			} else {
-				if err := authorizeMCP(w, r, isLatestSpec, cfg, accessController); err != nil {
-					http.Error(w, err.Error(), http.StatusForbidden)
+				var err error
+				if decision, err = authorizeMCP(w, r, isLatestSpec, cfg, accessController, stages.dpop); err != nil {
+					// authorizeMCP has already written the error response
+					logger.Warn("Denied %s request: %v", r.URL.Path, err)
+					return
+				}
+				if stages.limiter != nil && !enforceRateLimit(w, r, cfg, stages.limiter) {
 					return
 				}
+				if stages.identity != nil || stages.credentials != nil {
+					accessToken, _ := util.ExtractAccessToken(r.Header.Get("Authorization"))
+					callerClaims, _ = util.ParseJWT(accessToken)
+				}
+			}
+
+			var ok bool
+			if upstream, ok = prepareUpstream(w, r, cfg.ProtectedResourceMetadata.Audience, stages, callerClaims); !ok {
+				return
 			}
 
 			targetURL = mcpBase
+			isMCP = true
 			if ssePaths[r.URL.Path] {
 				isSSE = true
 			}
+
+			env, body = readRPCRequest(r)
+
+			if routing.pins != nil && env != nil && !checkToolPin(w, cfg, routing.pins, env) {
+				return
+			}
+			if stages.blocked != nil && env != nil && !checkBlockedTool(w, cfg, stages.blocked, env) {
+				return
+			}
+			if routing.tools != nil && env != nil && !checkToolArguments(w, r, cfg, routing.tools, env) {
+				return
+			}
+			// Calls are held only once they are known to be valid, and before
+			// they take up a replica or a trial of the circuit breaker
+			if decision == authz.DecisionRequireApproval {
+				stream, ok := awaitApproval(w, r, cfg, stages.approvals, env)
+				if !ok {
+					return
+				}
+				if stream != nil {
+					defer stream.finish()
+					w = stream
+				}
+			}
+
+			if routing.breaker != nil {
+				done, err := routing.breaker.Allow()
+				if err != nil {
+					logger.Warn("Rejected %s: %v", r.URL.Path, err)
+					writeUpstreamUnavailable(w, cfg, env, http.StatusServiceUnavailable, "circuit_open", "too many recent failures", routing.breaker.RetryAfter())
+					return
+				}
+				reportOutcome = done
+				// Requests that end without a response from the server are not its failure
+				defer done(true)
+			}
+
+			if routing.pool != nil {
+				var err error
+				picked, err := routing.pool.Pick(affinityKey(r))
+				if err != nil {
+					logger.Error("Cannot route %s: %v", r.URL.Path, err)
+					writeUpstreamUnavailable(w, cfg, env, http.StatusServiceUnavailable, "no_replica", "no healthy replica", 0)
+					return
+				}
+				failover = newReplicaFailover(routing.pool, picked, r)
+				defer failover.release()
+				targetURL = picked.URL
+			}
+
+			if routing.users != nil {
+				// Each user has their own subprocess, started with their credentials
+				sub, _ := callerClaims["sub"].(string)
+				if sub == "" {
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				var userEnv []string
+				if stages.credentials != nil {
+					userEnv = stages.credentials.Env(sub)
+				}
+				userURL, release, err := routing.users.Acquire(sub, userEnv)
+				if err != nil {
+					logger.Error("Cannot start the subprocess of %s: %v", sub, err)
+					writeUpstreamUnavailable(w, cfg, env, http.StatusServiceUnavailable, "no_subprocess", "no subprocess available", 0)
+					return
+				}
+				defer release()
+				targetURL = userURL
+			}
+
+			// Responses to messages of SSE sessions arrive on the session's event stream
+			if routing.lists != nil && env != nil && env.Method == "tools/list" {
+				if sessionID := querySession(r.URL.Query()); sessionID != "" {
+					routing.lists.expect(sessionID, env)
+				}
+			}
 		} else {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
 
+		// The session of an SSE event stream, from its endpoint event
+		var streamSession atomic.Value
+
 		// Apply request modifiers to add parameters
 		if modifier, exists := modifiers[r.URL.Path]; exists {
 			var err error
@@ -204,9 +611,9 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 		// Build the reverse proxy
 		rp := &httputil.ReverseProxy{
 			Director: func(req *http.Request) {
-				// Path rewriting if needed
-				mapped := r.URL.Path
-				if rewrite, ok := cfg.PathMapping[r.URL.Path]; ok {
+				// Path rewriting if needed; mounted servers see paths without their mount path
+				mapped := strings.TrimPrefix(r.URL.Path, cfg.MountPath)
+				if rewrite, ok := mapPath(cfg, stages.paths, mapped); ok {
 					mapped = rewrite
 				}
 				basePath := strings.TrimRight(targetURL.Path, "/")
@@ -234,12 +641,49 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 					cleanHeaders.Set(k, v[0])
 				}
 
+				if isMCP {
+					upstream.apply(cleanHeaders, stages.identity)
+					// The transport asks for gzip itself and decodes the response, so that its messages can be read
+					cleanHeaders.Del("Accept-Encoding")
+				}
+
 				req.Header = cleanHeaders
 
 				logger.Debug("%s -> %s%s", r.URL.Path, req.URL.Host, req.URL.Path)
 			},
 			ModifyResponse: func(resp *http.Response) error {
 				logger.Debug("Response from %s%s: %d", resp.Request.URL.Host, resp.Request.URL.Path, resp.StatusCode)
+				if isMCP {
+					reportOutcome(resp.StatusCode < http.StatusInternalServerError)
+				}
+				if failover != nil {
+					trackReplica(routing.pool, failover.replica, r, resp)
+				}
+				// Pins apply first, so that only approved tools are remembered
+				if routing.pins != nil {
+					filter := filterToolList(routing.pins)
+					if isSSE {
+						routing.lists.onToolList(resp, &streamSession, func(_ string, result json.RawMessage, _ bool) json.RawMessage {
+							return filter(result)
+						})
+					} else if env != nil && env.Method == "tools/list" {
+						onToolList(resp, env, filter)
+					}
+				}
+				// Tools removed by the injection rules are not remembered either
+				if isMCP && (stages.inspector != nil || stages.injection != nil) {
+					inspectResponse(stages, cfg, resp)
+				}
+				if routing.tools != nil {
+					if isSSE {
+						routing.lists.onToolList(resp, &streamSession, storeToolList(routing.tools))
+					} else {
+						trackToolList(routing.tools, r, env, resp)
+					}
+				}
+				if isSSE && routing.lists != nil {
+					routing.lists.settle(resp, &streamSession)
+				}
 				if resp.StatusCode == http.StatusUnauthorized {
 					resp.Header.Set(
 						"WWW-Authenticate",
@@ -255,17 +699,37 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 			},
 			ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
 				logger.Error("Error proxying: %v", err)
-				http.Error(rw, "Bad Gateway", http.StatusBadGateway)
+				if !isMCP {
+					http.Error(rw, "Bad Gateway", http.StatusBadGateway)
+					return
+				}
+				// A client that went away is not a failure of the server
+				canceled := errors.Is(err, context.Canceled)
+				reportOutcome(canceled)
+				if failover != nil && !canceled {
+					routing.pool.ReportFailure(failover.replica)
+				}
+				writeProxyError(rw, cfg, env, err)
 			},
 			FlushInterval: -1, // immediate flush for SSE
+			Transport:     httpclient.Transport(destination),
 		}
 
 		if isSSE {
 			// Add special response handling for SSE connections to rewrite endpoint URLs
 			rp.Transport = &sseTransport{
-				Transport:  http.DefaultTransport,
+				Transport:  rp.Transport,
 				proxyHost:  r.Host,
 				targetHost: targetURL.Host,
+				mountPath:  cfg.MountPath,
+			}
+			rp.Transport.(*sseTransport).onEndpoint = func(endpoint string) {
+				sessionID := endpointSession(endpoint)
+				streamSession.Store(sessionID)
+				// Messages of the SSE session must reach the same replica
+				if failover != nil && sessionID != "" {
+					routing.pool.Bind(sessionID, failover.replica)
+				}
 			}
 
 			// Set SSE-specific headers
@@ -276,6 +740,16 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 			// Keep SSE connections open
 			HandleSSE(w, r, rp)
 		} else {
+			if isMCP && routing.retry != nil {
+				rp.Transport = &retryTransport{
+					base:       rp.Transport,
+					policy:     routing.retry,
+					body:       body,
+					idempotent: env != nil && routing.retry.methods[env.Method],
+					failover:   failover,
+				}
+			}
+
 			// Standard requests: enforce a timeout
 			ctx, cancel := context.WithTimeout(r.Context(), time.Duration(cfg.TimeoutSeconds)*time.Second)
 			defer cancel()
@@ -284,26 +758,128 @@ func buildProxyHandler(cfg *config.Config, modifiers map[string]RequestModifier,
 	}
 }
 
-// Check if the request is for SSE handshake and authorize it
-func authorizeSSE(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg *config.Config) error {
+// upstreamAuth is what an authorized MCP request carries to the MCP server
+type upstreamAuth struct {
+	// Verified claims of the caller, for identity headers
+	claims jwt.MapClaims
+	// Replaces the client's token when token exchange is enabled
+	downstreamToken string
+	// The caller's third-party credentials
+	credentialHeaders http.Header
+}
+
+// prepareUpstream runs the token exchange and credential stages for an
+// authorized MCP request. It writes the error response when it fails.
+func prepareUpstream(w http.ResponseWriter, r *http.Request, audience string, stages *upstreamStages, callerClaims jwt.MapClaims) (*upstreamAuth, bool) {
+	upstream := &upstreamAuth{claims: callerClaims, credentialHeaders: http.Header{}}
+	if stages.exchanger != nil {
+		var ok bool
+		if upstream.downstreamToken, ok = exchangeToken(w, r, audience, stages.exchanger); !ok {
+			return nil, false
+		}
+	}
+	if stages.credentials != nil {
+		if sub, _ := callerClaims["sub"].(string); sub != "" {
+			stages.credentials.Apply(upstream.credentialHeaders, sub)
+		}
+	}
+	return upstream, true
+}
+
+// apply sets the identity headers, downstream token and credentials on the
+// headers of a request to the MCP server
+func (u *upstreamAuth) apply(h http.Header, identity *identityInjector) {
+	if identity != nil {
+		if err := identity.apply(h, u.claims); err != nil {
+			logger.Error("Failed to add identity headers: %v", err)
+		}
+	}
+
+	if u.downstreamToken != "" {
+		h.Set("Authorization", "Bearer "+u.downstreamToken)
+		// A DPoP proof only applies to the client's own token
+		h.Del(dpop.HeaderName)
+	}
+
+	for k, v := range u.credentialHeaders {
+		h.Set(k, v[0])
+	}
+}
+
+// withCORS answers preflight requests and adds CORS headers before handing
+// the request to an API handler
+func withCORS(cfg *config.Config, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !handleCORS(w, r, cfg) {
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// handleCORS answers preflight requests and adds CORS headers. It returns
+// false when the request has been answered.
+func handleCORS(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	origin := r.Header.Get("Origin")
+	allowedOrigin := getAllowedOrigin(origin, cfg)
+	// Handle OPTIONS
+	if r.Method == http.MethodOptions {
+		if allowedOrigin == "" {
+			logger.Warn("Preflight request from disallowed origin: %s", origin)
+			http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+			return false
+		}
+		addCORSHeaders(w, cfg, allowedOrigin, r.Header.Get("Access-Control-Request-Headers"))
+		w.WriteHeader(http.StatusNoContent)
+		return false
+	}
+
+	if allowedOrigin == "" {
+		logger.Warn("Request from disallowed origin: %s for %s", origin, r.URL.Path)
+		http.Error(w, "CORS origin not allowed", http.StatusForbidden)
+		return false
+	}
+
+	// Add CORS headers to all responses
+	addCORSHeaders(w, cfg, allowedOrigin, "")
+	return true
+}
+
+// Check if the request is for SSE handshake and authorize it. The DPoP scheme
+// is only accepted with a valid token and proof, as there is nothing else to bind.
+func authorizeSSE(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg *config.Config, dpopVerifier *dpop.Verifier) error {
 	authHeader := r.Header.Get("Authorization")
-	if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+	isDPoP := dpopVerifier != nil && strings.HasPrefix(authHeader, "DPoP ")
+	if !strings.HasPrefix(authHeader, "Bearer ") && !isDPoP {
 		if isLatestSpec {
 			realm := cfg.BaseURL + getProtectedResourceMetadataEndpointPath(cfg)
 			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer resource_metadata="%s"`, realm))
 			w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
 		}
-		return fmt.Errorf("missing or invalid Authorization header")
+		err := fmt.Errorf("missing or invalid Authorization header")
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return err
 	}
 
+	if isDPoP {
+		accessToken, _ := util.ExtractAccessToken(authHeader)
+		if err := util.ValidateJWT(isLatestSpec, accessToken, cfg.ProtectedResourceMetadata.Audience); err != nil {
+			setDPoPChallenge(w, dpopVerifier, &dpop.Error{Code: dpop.ErrorInvalidToken, Description: "invalid access token"})
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return err
+		}
+		return verifyDPoP(w, r, true, accessToken, cfg, dpopVerifier)
+	}
 	return nil
 }
 
-// Handles both v1 (just signature) and v2 (aud + scope) flows
-func authorizeMCP(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg *config.Config, accessController authz.AccessControl) error {
+// Handles both v1 (just signature) and v2 (aud + scope) flows. The decision
+// tells whether an authorized request must wait for approval.
+func authorizeMCP(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg *config.Config, accessController authz.AccessControl, dpopVerifier *dpop.Verifier) (authz.Decision, error) {
 	authzHeader := r.Header.Get("Authorization")
 	accessToken, _ := util.ExtractAccessToken(authzHeader)
-	if !strings.HasPrefix(authzHeader, "Bearer ") {
+	isDPoP := dpopVerifier != nil && strings.HasPrefix(authzHeader, "DPoP ")
+	if !strings.HasPrefix(authzHeader, "Bearer ") && !isDPoP {
 		if isLatestSpec {
 			realm := cfg.ProxyBaseURL + getProtectedResourceMetadataEndpointPath(cfg)
 			w.Header().Set("WWW-Authenticate", fmt.Sprintf(
@@ -311,8 +887,11 @@ func authorizeMCP(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg
 			))
 			w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate")
 		}
+		if dpopVerifier != nil {
+			setDPoPChallenge(w, dpopVerifier, nil)
+		}
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return fmt.Errorf("missing or invalid Authorization header")
+		return authz.DecisionDeny, fmt.Errorf("missing or invalid Authorization header")
 	}
 
 	err := util.ValidateJWT(isLatestSpec, accessToken, cfg.ProtectedResourceMetadata.Audience)
@@ -328,30 +907,53 @@ func authorizeMCP(w http.ResponseWriter, r *http.Request, isLatestSpec bool, cfg
 		} else {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		}
-		return err
+		return authz.DecisionDeny, err
 	}
 
-	if isLatestSpec {
-		_, err := util.ParseRPCRequest(r)
-		if err != nil {
-			http.Error(w, "Bad request", http.StatusBadRequest)
-			return err
+	if dpopVerifier != nil {
+		if err := verifyDPoP(w, r, isDPoP, accessToken, cfg, dpopVerifier); err != nil {
+			return authz.DecisionDeny, err
 		}
+	}
 
-		claimsMap, err := util.ParseJWT(accessToken)
-		if err != nil {
-			http.Error(w, "Invalid token claims", http.StatusUnauthorized)
-			return fmt.Errorf("invalid token claims")
+	if cfg.TLS.CertificateBoundTokens {
+		if err := verifyTokenBinding(w, r, accessToken); err != nil {
+			return authz.DecisionDeny, err
 		}
+	}
+
+	if !isLatestSpec {
+		// Scopes are not checked for older clients, but approval still applies
+		return approvalDecision(w, r, cfg)
+	}
+
+	env, err := util.ParseRPCRequest(r)
+	if err != nil {
+		http.Error(w, "Bad request", http.StatusBadRequest)
+		return authz.DecisionDeny, err
+	}
 
-		pr := accessController.ValidateAccess(r, &claimsMap, cfg)
-		if pr.Decision == authz.DecisionDeny {
+	claimsMap, err := util.ParseJWT(accessToken)
+	if err != nil {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return authz.DecisionDeny, fmt.Errorf("invalid token claims")
+	}
+
+	pr := accessController.ValidateAccess(r, &claimsMap, cfg)
+	if pr.Decision == authz.DecisionDeny {
+		if cfg.JSONRPCErrors && env != nil && env.ID != nil {
+			writeAccessDenied(w, env, pr)
+		} else {
 			http.Error(w, "Forbidden: "+pr.Message, http.StatusForbidden)
-			return fmt.Errorf("forbidden — %s", pr.Message)
 		}
+		return authz.DecisionDeny, fmt.Errorf("forbidden — %s", pr.Message)
+	}
+	if pr.Decision == authz.DecisionAllow {
+		// Approval applies whatever the access controller decides
+		return approvalDecision(w, r, cfg)
 	}
 
-	return nil
+	return pr.Decision, nil
 }
 
 func getAllowedOrigin(origin string, cfg *config.Config) string {
@@ -371,7 +973,7 @@ func getAllowedOrigin(origin string, cfg *config.Config) string {
 func addCORSHeaders(w http.ResponseWriter, cfg *config.Config, allowedOrigin, requestHeaders string) {
 	w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 	w.Header().Set("Access-Control-Allow-Methods", strings.Join(cfg.CORSConfig.AllowedMethods, ", "))
-	w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate, MCP-Protocol-Version")
+	w.Header().Set("Access-Control-Expose-Headers", "WWW-Authenticate, MCP-Protocol-Version, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-Quota-Limit, X-Quota-Remaining, X-Quota-Reset")
 	if requestHeaders != "" {
 		w.Header().Set("Access-Control-Allow-Headers", requestHeaders)
 	} else {
@@ -410,6 +1012,22 @@ func isMCPPath(path string, cfg *config.Config) bool {
 	return false
 }
 
+// protectedResourceMetadataHandler adds CORS handling to a protected resource metadata handler
+func protectedResourceMetadataHandler(cfg *config.Config, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		allowed := getAllowedOrigin(origin, cfg)
+		if r.Method == http.MethodOptions {
+			addCORSHeaders(w, cfg, allowed, r.Header.Get("Access-Control-Request-Headers"))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		addCORSHeaders(w, cfg, allowed, "")
+		handler(w, r)
+	}
+}
+
 func skipHeader(h string) bool {
 	switch strings.ToLower(h) {
 	case "connection", "keep-alive", "transfer-encoding", "upgrade", "proxy-authorization", "proxy-connection", "te", "trailer":
@@ -420,7 +1038,7 @@ func skipHeader(h string) bool {
 
 func getProtectedResourceMetadataEndpointPath(cfg *config.Config) string {
 
-	protectedResourceMetadataPath := "/.well-known/oauth-protected-resource"
+	protectedResourceMetadataPath := "/.well-known/oauth-protected-resource" + cfg.MountPath
 
 	switch cfg.TransportMode {
 	case config.SSETransport:
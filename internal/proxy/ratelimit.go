@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/ratelimit"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// rateLimitedData is the structured data member of a rate limit JSON-RPC error
+type rateLimitedData struct {
+	Rule              string `json:"rule,omitempty"`
+	RetryAfterSeconds int    `json:"retry_after_seconds"`
+}
+
+// enforceRateLimit applies the configured rate limits and quotas to an authorized MCP request.
+// It returns false, after writing the rejection, when the request must not be forwarded.
+func enforceRateLimit(w http.ResponseWriter, r *http.Request, cfg *config.Config, limiter *ratelimit.Limiter) bool {
+	env, _ := util.ParseRPCRequest(r)
+
+	req := ratelimit.Request{IP: ratelimit.ClientIP(r)}
+	if env != nil {
+		req.Method = env.Method
+		req.Tool = env.ToolName()
+	}
+	if accessToken, err := util.ExtractAccessToken(r.Header.Get("Authorization")); err == nil {
+		if claims, err := util.ParseJWT(accessToken); err == nil {
+			req.Subject, _ = claims["sub"].(string)
+			req.ClientID = clientIDFromClaims(claims)
+		}
+	}
+
+	res := limiter.Allow(req)
+	setBudgetHeaders(w, res)
+	if res.Allowed {
+		return true
+	}
+
+	retryAfter := int(math.Ceil(res.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	logger.Warn("Rate limited %s (subject=%s, client=%s, ip=%s): %s", req.Method, req.Subject, req.ClientID, req.IP, res.Message)
+
+	if cfg.JSONRPCErrors && env != nil && env.ID != nil {
+		util.WriteRPCError(w, http.StatusOK, env.ID, util.RPCErrorRateLimited, "Too many requests: "+res.Message, rateLimitedData{
+			Rule:              res.Rule,
+			RetryAfterSeconds: retryAfter,
+		})
+		return false
+	}
+	http.Error(w, "Too Many Requests: "+res.Message, http.StatusTooManyRequests)
+	return false
+}
+
+// setBudgetHeaders exposes the tightest remaining rate limit and quota budgets
+func setBudgetHeaders(w http.ResponseWriter, res ratelimit.Result) {
+	if b := res.RateLimit; b != nil {
+		w.Header().Set("X-RateLimit-Limit", strconv.FormatInt(b.Limit, 10))
+		w.Header().Set("X-RateLimit-Remaining", strconv.FormatInt(max(b.Remaining, 0), 10))
+	}
+	if b := res.Quota; b != nil {
+		w.Header().Set("X-Quota-Limit", strconv.FormatInt(b.Limit, 10))
+		w.Header().Set("X-Quota-Remaining", strconv.FormatInt(max(b.Remaining, 0), 10))
+		w.Header().Set("X-Quota-Reset", strconv.FormatInt(b.Reset.Unix(), 10))
+	}
+}
+
+// clientIDFromClaims reads the OAuth client id, which IdPs publish under different claims
+func clientIDFromClaims(claims jwt.MapClaims) string {
+	for _, name := range []string{"client_id", "azp", "cid"} {
+		if v, ok := claims[name].(string); ok && v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/balancer"
+	"github.com/wso2/open-mcp-auth-proxy/internal/breaker"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+	"github.com/wso2/open-mcp-auth-proxy/internal/subprocess"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolpin"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolschema"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 100 * time.Millisecond
+)
+
+// defaultRetryMethods are JSON-RPC methods that can be repeated without side effects
+var defaultRetryMethods = []string{"initialize", "ping", "tools/list", "resources/list", "resources/templates/list", "prompts/list"}
+
+// upstreamRouting holds what is shared by all paths of one MCP server: its
+// replicas, circuit breaker, retry policy, the tools listed in its sessions
+// and their pins. Nil members are disabled.
+type upstreamRouting struct {
+	pool    *balancer.Pool
+	breaker *breaker.Breaker
+	retry   *retryPolicy
+	tools   *toolschema.Cache
+	pins    *toolpin.Manager
+	// tools/list requests of SSE sessions, whose responses arrive on the event stream
+	lists *sseToolLists
+	// Per-user subprocesses that replace the shared one
+	users *subprocess.UserProcesses
+}
+
+// newUpstreamRouting sets up the load balancing, failure handling and tool
+// checks of an MCP server. Tool pins of all servers are kept in pinStore, and
+// health checks of its replicas run until ctx is done.
+func newUpstreamRouting(ctx context.Context, cfg *config.Config, pinStore store.Store) (*upstreamRouting, error) {
+	routing := &upstreamRouting{}
+	if len(cfg.BaseURLs) > 0 {
+		pool, err := balancer.New(ctx, cfg.BaseURLs, cfg.LoadBalancing)
+		if err != nil {
+			return nil, err
+		}
+		routing.pool = pool
+	}
+	if cfg.CircuitBreaker.Enabled {
+		name := cfg.ServerName
+		if name == "" {
+			name = cfg.BaseURL
+		}
+		routing.breaker = breaker.New(name, cfg.CircuitBreaker)
+	}
+	if cfg.Retry.Enabled {
+		routing.retry = newRetryPolicy(cfg.Retry)
+	} else if routing.pool != nil {
+		// Requests that could not reach a replica move to another one, since
+		// nothing was sent; other failures are repeated only with retry
+		routing.retry = &retryPolicy{attempts: len(cfg.BaseURLs), methods: map[string]bool{}}
+	}
+	if cfg.Limits.ValidateToolArguments {
+		routing.tools = toolschema.New(0)
+	}
+	if pinStore != nil {
+		routing.pins = toolpin.New(cfg.ServerName, cfg.ToolPinning, pinStore)
+	}
+	if routing.tools != nil || routing.pins != nil {
+		routing.lists = newSSEToolLists()
+	}
+	if cfg.TransportMode == config.StdioTransport && cfg.Stdio.PerUser {
+		routing.users = subprocess.NewUserProcesses(cfg)
+	}
+	return routing, nil
+}
+
+// retryPolicy decides which failed MCP requests are repeated
+type retryPolicy struct {
+	attempts int
+	backoff  time.Duration
+	methods  map[string]bool
+}
+
+func newRetryPolicy(cfg config.RetryConfig) *retryPolicy {
+	p := &retryPolicy{
+		attempts: cfg.MaxAttempts,
+		backoff:  time.Duration(cfg.BackoffMillis) * time.Millisecond,
+		methods:  make(map[string]bool),
+	}
+	if p.attempts <= 0 {
+		p.attempts = defaultRetryAttempts
+	}
+	if p.backoff <= 0 {
+		p.backoff = defaultRetryBackoff
+	}
+	methods := cfg.Methods
+	if len(methods) == 0 {
+		methods = defaultRetryMethods
+	}
+	for _, m := range methods {
+		p.methods[m] = true
+	}
+	return p
+}
+
+// retryTransport repeats a request when that is safe: idempotent methods are
+// retried after connection errors and 502, 503 and 504 responses, other
+// requests only when the connection to the server could not be made. With
+// failover, each attempt goes to another replica when the request can move.
+type retryTransport struct {
+	base       http.RoundTripper
+	policy     *retryPolicy
+	body       []byte
+	idempotent bool
+	failover   *replicaFailover
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.policy.backoff
+	for attempt := 1; ; attempt++ {
+		resp, err := t.base.RoundTrip(req)
+		if attempt >= t.policy.attempts || !t.retryable(resp, err) || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+			logger.Warn("Retrying %s after status %d (attempt %d of %d)", req.URL.Path, resp.StatusCode, attempt+1, t.policy.attempts)
+		} else {
+			logger.Warn("Retrying %s after error: %v (attempt %d of %d)", req.URL.Path, err, attempt+1, t.policy.attempts)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+		backoff *= 2
+
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(t.body))
+		if t.failover != nil {
+			t.failover.next(req)
+		}
+	}
+}
+
+func (t *retryTransport) retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return t.idempotent || isConnectError(err)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return t.idempotent
+	}
+	return false
+}
+
+// isConnectError reports whether a request failed before anything was sent to the server
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// readRPCRequest buffers the request body so it can be sent again, and parses
+// its JSON-RPC envelope when it has one
+func readRPCRequest(r *http.Request) (*util.RPCEnvelope, []byte) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	body, err := io.ReadAll(r.Body)
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil || len(body) == 0 {
+		return nil, body
+	}
+	var env util.RPCEnvelope
+	if json.Unmarshal(body, &env) != nil {
+		return nil, body
+	}
+	return &env, body
+}
+
+// upstreamUnavailableData is the structured data member of an upstream unavailable JSON-RPC error
+type upstreamUnavailableData struct {
+	Reason            string `json:"reason"`
+	RetryAfterSeconds int    `json:"retry_after_seconds,omitempty"`
+}
+
+// writeUpstreamUnavailable explains that the MCP server could not serve the
+// request. JSON-RPC requests get a JSON-RPC error so that clients can show
+// the reason; with jsonrpc_errors its HTTP status is 200 like other errors.
+func writeUpstreamUnavailable(w http.ResponseWriter, cfg *config.Config, env *util.RPCEnvelope, status int, reason, message string, retryAfter time.Duration) {
+	retryAfterSeconds := int(math.Ceil(retryAfter.Seconds()))
+	if retryAfterSeconds > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+	}
+	if env == nil || env.ID == nil {
+		http.Error(w, http.StatusText(status)+": "+message, status)
+		return
+	}
+	if cfg.JSONRPCErrors {
+		status = http.StatusOK
+	}
+	util.WriteRPCError(w, status, env.ID, util.RPCErrorUpstreamUnavailable, "MCP server unavailable: "+message, upstreamUnavailableData{
+		Reason:            reason,
+		RetryAfterSeconds: retryAfterSeconds,
+	})
+}
+
+// writeProxyError reports an error forwarding the request to the MCP server
+func writeProxyError(w http.ResponseWriter, cfg *config.Config, env *util.RPCEnvelope, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeUpstreamUnavailable(w, cfg, env, http.StatusGatewayTimeout, "timeout", "the request timed out", 0)
+		return
+	}
+	writeUpstreamUnavailable(w, cfg, env, http.StatusBadGateway, "unreachable", "the server could not be reached", 0)
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// newResilienceRouter proxies /mcp to the upstream with retries and a circuit breaker
+func newResilienceRouter(t *testing.T, upstreamURL string) (http.Handler, string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("resilience-test", &key.PublicKey)
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           upstreamURL,
+		TimeoutSeconds:    5,
+		TransportMode:     config.StreamableHTTPTransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		CircuitBreaker:    config.CircuitBreakerConfig{Enabled: true, FailureThreshold: 2, OpenSeconds: 60},
+		Retry:             config.RetryConfig{Enabled: true, MaxAttempts: 3, BackoffMillis: 1},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	return NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{}), signTestToken(t, key, "resilience-test", "mcp")
+}
+
+func postRPC(router http.Handler, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("MCP-Protocol-Version", "2025-06-18")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRetriesIdempotentRequests(t *testing.T) {
+	var attempts int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var env util.RPCEnvelope
+		json.NewDecoder(r.Body).Decode(&env)
+		// Every other attempt fails
+		if atomic.AddInt32(&attempts, 1)%2 == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{"method":"` + env.Method + `"}}`))
+	}))
+	defer upstream.Close()
+	router, token := newResilienceRouter(t, upstream.URL)
+
+	rec := postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "tools/list") {
+		t.Errorf("Expected tools/list to succeed on retry, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if got := atomic.LoadInt32(&attempts); got != 2 {
+		t.Errorf("Expected 2 attempts with the full body, got %d", got)
+	}
+
+	// Tool calls may have side effects, so a failed response is not repeated
+	rec = postRPC(router, token, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"deploy"}}`)
+	if rec.Code != http.StatusServiceUnavailable || atomic.LoadInt32(&attempts) != 3 {
+		t.Errorf("Expected tools/call not to be retried, got %d after %d attempts", rec.Code, atomic.LoadInt32(&attempts))
+	}
+}
+
+func TestCircuitBreakerRejectsWithJSONRPCError(t *testing.T) {
+	var requests int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer upstream.Close()
+	router, token := newResilienceRouter(t, upstream.URL)
+
+	call := `{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"deploy"}}`
+	postRPC(router, token, call)
+	postRPC(router, token, call)
+
+	rec := postRPC(router, token, call)
+	if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") == "" {
+		t.Fatalf("Expected 503 with Retry-After while open, got %d", rec.Code)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Expected the open circuit not to reach the server, got %d requests", got)
+	}
+
+	var resp util.RPCErrorResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("Expected a JSON-RPC error body: %v", err)
+	}
+	data, _ := resp.Error.Data.(map[string]interface{})
+	if resp.ID != float64(7) || resp.Error.Code != util.RPCErrorUpstreamUnavailable || data["reason"] != "circuit_open" {
+		t.Errorf("Unexpected error response: %+v", resp)
+	}
+}
+
+func TestUnreachableUpstreamReturnsJSONRPCError(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstreamURL := upstream.URL
+	upstream.Close()
+	router, token := newResilienceRouter(t, upstreamURL)
+
+	rec := postRPC(router, token, `{"jsonrpc":"2.0","id":"a","method":"tools/call","params":{"name":"deploy"}}`)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("Expected 502, got %d", rec.Code)
+	}
+	var resp util.RPCErrorResponse
+	json.NewDecoder(rec.Body).Decode(&resp)
+	if resp.ID != "a" || resp.Error == nil || resp.Error.Code != util.RPCErrorUpstreamUnavailable {
+		t.Errorf("Unexpected error response: %+v", resp)
+	}
+}
@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// maxMessageBytes bounds how much of a response is buffered to read its JSON-RPC messages
+const maxMessageBytes = 8 << 20
+
+// messageFunc is called with a JSON-RPC message of a response. It may change
+// the message, and reports whether it did and whether it needs to see more
+// messages of the response.
+type messageFunc func(msg map[string]json.RawMessage) (changed, done bool)
+
+// rewriteMessages calls fn with the JSON-RPC messages of a successful
+// response: a JSON body, or the events of a stream as the client reads them.
+// Gzip-encoded responses are decoded. Content that cannot be read, because it
+// is too large or in another encoding, is passed on as it is, or with block
+// replaced by a JSON-RPC error.
+func rewriteMessages(resp *http.Response, fn messageFunc, block bool) {
+	if resp.StatusCode != http.StatusOK {
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "application/json" && mediaType != "text/event-stream" {
+		return
+	}
+	switch encoding := resp.Header.Get("Content-Encoding"); encoding {
+	case "", "identity":
+	case "gzip":
+		body, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			logger.Warn("Not reading the messages of a response from %s: %v", resp.Request.URL.Path, err)
+			withholdResponse(resp, mediaType, block)
+			return
+		}
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{body, resp.Body}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	default:
+		logger.Warn("Not reading the messages of a response from %s: unsupported encoding %q", resp.Request.URL.Path, encoding)
+		withholdResponse(resp, mediaType, block)
+		return
+	}
+
+	switch mediaType {
+	case "application/json":
+		data, err := io.ReadAll(io.LimitReader(resp.Body, maxMessageBytes+1))
+		if err != nil || len(data) > maxMessageBytes {
+			logger.Warn("Not reading the messages of a response from %s: it is too large", resp.Request.URL.Path)
+			if block {
+				withholdResponse(resp, mediaType, block)
+				return
+			}
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), resp.Body), resp.Body}
+			return
+		}
+		resp.Body.Close()
+		if rewritten, changed := rewriteJSONMessages(data, fn); changed {
+			data = rewritten
+		}
+		setBody(resp, data)
+	case "text/event-stream":
+		resp.Body = &eventRewriter{src: bufio.NewReader(resp.Body), closer: resp.Body, fn: fn, block: block}
+	}
+}
+
+// withholdResponse passes on a response whose messages cannot be read, or
+// with block replaces it with a JSON-RPC error
+func withholdResponse(resp *http.Response, mediaType string, block bool) {
+	if !block {
+		return
+	}
+	resp.Body.Close()
+	resp.Header.Del("Content-Encoding")
+	data := unreadableError()
+	if mediaType == "text/event-stream" {
+		data = []byte("data: " + string(data) + "\n\n")
+	}
+	setBody(resp, data)
+}
+
+func setBody(resp *http.Response, data []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	resp.ContentLength = int64(len(data))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(data)))
+}
+
+// unreadableError replaces content that cannot be inspected. The request it
+// answers is not known, so the error has no ID.
+func unreadableError() []byte {
+	data, err := json.Marshal(util.RPCErrorResponse{
+		JSONRPC: "2.0",
+		Error: &util.RPCError{
+			Code:    util.RPCErrorContentBlocked,
+			Message: "The response was withheld because it cannot be inspected",
+			Data:    contentBlockedData{Reason: "uninspectable_content"},
+		},
+	})
+	if err != nil {
+		logger.Error("Failed to encode JSON-RPC error: %v", err)
+	}
+	return data
+}
+
+// rewriteJSONMessages applies fn to a JSON-RPC message or batch
+func rewriteJSONMessages(data []byte, fn messageFunc) ([]byte, bool) {
+	if batch := bytes.TrimSpace(data); len(batch) > 0 && batch[0] == '[' {
+		var msgs []json.RawMessage
+		if json.Unmarshal(batch, &msgs) != nil {
+			return data, false
+		}
+		changed := false
+		for i, msg := range msgs {
+			if rewritten, ok := rewriteMessage(msg, fn); ok {
+				msgs[i] = rewritten
+				changed = true
+			}
+		}
+		if !changed {
+			return data, false
+		}
+		rewritten, err := json.Marshal(msgs)
+		if err != nil {
+			logger.Error("Failed to encode a JSON-RPC batch: %v", err)
+			return data, false
+		}
+		return rewritten, true
+	}
+	return rewriteMessage(data, fn)
+}
+
+func rewriteMessage(data []byte, fn messageFunc) ([]byte, bool) {
+	rewritten, changed, _ := applyMessageFunc(data, fn)
+	if !changed {
+		return data, false
+	}
+	return rewritten, true
+}
+
+// applyMessageFunc decodes a message for fn and encodes it again when fn changed it
+func applyMessageFunc(data []byte, fn messageFunc) (rewritten []byte, changed, done bool) {
+	var msg map[string]json.RawMessage
+	if json.Unmarshal(data, &msg) != nil {
+		return nil, false, false
+	}
+	changed, done = fn(msg)
+	if !changed {
+		return nil, false, done
+	}
+	rewritten, err := json.Marshal(msg)
+	if err != nil {
+		logger.Error("Failed to encode a JSON-RPC message: %v", err)
+		return nil, false, done
+	}
+	return rewritten, true, done
+}
+
+// onToolList calls fn with the result of the response to a tools/list
+// request. A non-nil return value replaces the result.
+func onToolList(resp *http.Response, env *util.RPCEnvelope, fn func(result json.RawMessage) json.RawMessage) {
+	rewriteMessages(resp, func(msg map[string]json.RawMessage) (bool, bool) {
+		if len(msg["result"]) == 0 {
+			return false, false
+		}
+		var id any
+		if json.Unmarshal(msg["id"], &id) != nil || !reflect.DeepEqual(id, env.ID) {
+			return false, false
+		}
+		result := fn(msg["result"])
+		if result == nil {
+			return false, true
+		}
+		msg["result"] = result
+		return true, true
+	}, false)
+}
+
+// eventRewriter passes an event stream through one event at a time, letting
+// fn change the message in each event until it has seen what it needs
+type eventRewriter struct {
+	src    *bufio.Reader
+	closer io.Closer
+	fn     messageFunc
+	block  bool // Replace events too large to read with a JSON-RPC error
+
+	out     bytes.Buffer // Output not yet read by the client
+	event   bytes.Buffer // Raw lines of the current event
+	other   bytes.Buffer // Lines of the current event other than data
+	line    []byte       // The current line while it is read in parts
+	data    []byte
+	partial bool // The last part read did not end a line
+	skip    bool // The current event is too large and is not read
+	done    bool
+	err     error
+}
+
+func (e *eventRewriter) Read(p []byte) (int, error) {
+	for e.out.Len() == 0 {
+		if e.done {
+			return e.src.Read(p)
+		}
+		if e.err != nil {
+			return 0, e.err
+		}
+		e.readLine()
+	}
+	return e.out.Read(p)
+}
+
+func (e *eventRewriter) Close() error {
+	return e.closer.Close()
+}
+
+// readLine reads the next line, or part of a long line, of the stream,
+// emitting the current event when it ends
+func (e *eventRewriter) readLine() {
+	chunk, err := e.src.ReadSlice('\n')
+	startsLine := !e.partial
+	e.partial = err == bufio.ErrBufferFull
+	if e.skip {
+		e.skipLine(chunk, startsLine, err)
+		return
+	}
+	e.event.Write(chunk)
+	if err == bufio.ErrBufferFull {
+		e.line = append(e.line, chunk...)
+		if e.event.Len() > maxMessageBytes {
+			e.tooLarge()
+		}
+		return
+	}
+	if err != nil {
+		// Whatever is left of an unfinished event is passed on as it was
+		e.out.Write(e.event.Bytes())
+		e.err = err
+		return
+	}
+	line := append(e.line, chunk...)
+	e.line = e.line[:0]
+
+	trimmed := bytes.TrimRight(line, "\r\n")
+	if len(trimmed) > 0 {
+		if value, ok := bytes.CutPrefix(trimmed, []byte("data:")); ok {
+			if len(e.data) > 0 {
+				e.data = append(e.data, '\n')
+			}
+			e.data = append(e.data, bytes.TrimPrefix(value, []byte(" "))...)
+		} else {
+			e.other.Write(line)
+		}
+		if e.event.Len() > maxMessageBytes {
+			e.tooLarge()
+		}
+		return
+	}
+
+	// A blank line ends the event
+	var rewritten []byte
+	if len(e.data) > 0 {
+		rewritten, _, e.done = applyMessageFunc(e.data, e.fn)
+	}
+	if rewritten != nil {
+		e.out.Write(e.other.Bytes())
+		e.out.WriteString("data: ")
+		e.out.Write(rewritten)
+		e.out.WriteString("\n\n")
+	} else {
+		e.out.Write(e.event.Bytes())
+	}
+	e.reset()
+}
+
+// tooLarge stops reading the current event, which is passed on as it is or,
+// with block, dropped. Later events are read again.
+func (e *eventRewriter) tooLarge() {
+	logger.Warn("Not reading an event of a stream: it is too large")
+	if !e.block {
+		e.out.Write(e.event.Bytes())
+	}
+	e.reset()
+	e.skip = true
+}
+
+// skipLine handles a line, or part of a line, of an event that is not read
+func (e *eventRewriter) skipLine(chunk []byte, startsLine bool, err error) {
+	if !e.block {
+		e.out.Write(chunk)
+	}
+	if err != nil && err != bufio.ErrBufferFull {
+		e.err = err
+		return
+	}
+	if err == nil && startsLine && len(bytes.TrimRight(chunk, "\r\n")) == 0 {
+		// A blank line ends the event
+		e.skip = false
+		if e.block {
+			e.out.WriteString("data: ")
+			e.out.Write(unreadableError())
+			e.out.WriteString("\n\n")
+		}
+	}
+}
+
+func (e *eventRewriter) reset() {
+	e.event.Reset()
+	e.other.Reset()
+	e.line = e.line[:0]
+	e.data = e.data[:0]
+}
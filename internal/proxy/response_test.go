@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testResponse(contentType, body string) *http.Response {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {contentType}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    httptest.NewRequest(http.MethodPost, "/mcp", nil),
+	}
+}
+
+// markResults adds a field to each result, to show which messages were read
+func markResults(msg map[string]json.RawMessage) (bool, bool) {
+	if msg["result"] == nil {
+		return false, false
+	}
+	msg["result"] = json.RawMessage(`{"read":true}`)
+	return true, false
+}
+
+func TestOversizedEventsAreSkipped(t *testing.T) {
+	large := `data: {"jsonrpc":"2.0","id":1,"result":{"text":"` + strings.Repeat("x", maxMessageBytes) + `"}}` + "\n\n"
+	small := `data: {"jsonrpc":"2.0","id":2,"result":{}}` + "\n\n"
+
+	for _, block := range []bool{false, true} {
+		resp := testResponse("text/event-stream", small+large+small)
+		rewriteMessages(resp, markResults, block)
+		out, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("Read failed: %v", err)
+		}
+		events := strings.Split(strings.TrimSuffix(string(out), "\n\n"), "\n\n")
+		if len(events) != 3 {
+			t.Fatalf("block=%v: expected 3 events, got %d", block, len(events))
+		}
+		// Events after the oversized one are still read
+		if !strings.Contains(events[0], `"read":true`) || !strings.Contains(events[2], `"read":true`) {
+			t.Errorf("block=%v: expected the small events to be read, got %.100s and %.100s", block, events[0], events[2])
+		}
+		if block && (len(events[1]) > 1000 || !strings.Contains(events[1], "uninspectable_content")) {
+			t.Errorf("Expected the oversized event to be replaced by an error, got %.100s", events[1])
+		}
+		if !block && events[1]+"\n\n" != large {
+			t.Errorf("Expected the oversized event to pass unchanged, got %.100s", events[1])
+		}
+	}
+}
+
+func TestOversizedJSONIsBlocked(t *testing.T) {
+	large := `{"jsonrpc":"2.0","id":1,"result":{"text":"` + strings.Repeat("x", maxMessageBytes) + `"}}`
+
+	resp := testResponse("application/json", large)
+	rewriteMessages(resp, markResults, false)
+	if out, _ := io.ReadAll(resp.Body); string(out) != large {
+		t.Errorf("Expected the response to pass unchanged, got %.100s", out)
+	}
+
+	resp = testResponse("application/json", large)
+	rewriteMessages(resp, markResults, true)
+	if out, _ := io.ReadAll(resp.Body); !strings.Contains(string(out), "uninspectable_content") {
+		t.Errorf("Expected the response to be replaced by an error, got %.100s", out)
+	}
+}
+
+func TestUnknownEncodingIsBlocked(t *testing.T) {
+	resp := testResponse("application/json", "compressed")
+	resp.Header.Set("Content-Encoding", "br")
+	rewriteMessages(resp, markResults, true)
+	out, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(out), "uninspectable_content") || resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Expected the response to be replaced by an error, got %s", out)
+	}
+}
@@ -7,9 +7,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"strings"
 	"time"
-	
+
 	"github.com/wso2/open-mcp-auth-proxy/internal/logging"
 )
 
@@ -43,6 +44,8 @@ type sseTransport struct {
 	Transport  http.RoundTripper
 	proxyHost  string
 	targetHost string
+	mountPath  string                // Prefix for endpoints of servers mounted in gateway mode
+	onEndpoint func(endpoint string) // Called with each endpoint the MCP server announces
 }
 
 func (t *sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
@@ -51,27 +54,27 @@ func (t *sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	if err != nil {
 		return nil, err
 	}
-	
+
 	// Check if this is an SSE response
 	contentType := resp.Header.Get("Content-Type")
 	if !strings.Contains(contentType, "text/event-stream") {
 		return resp, nil
 	}
-	
+
 	logger.Info("Intercepting SSE response to modify endpoint events")
-	
+
 	// Create a response wrapper that modifies the response body
 	originalBody := resp.Body
 	pr, pw := io.Pipe()
-	
+
 	go func() {
 		defer originalBody.Close()
 		defer pw.Close()
-		
+
 		scanner := bufio.NewScanner(originalBody)
 		for scanner.Scan() {
 			line := scanner.Text()
-			
+
 			// Check if this line contains an endpoint event
 			if strings.HasPrefix(line, "event: endpoint") {
 				// Read the data line
@@ -80,12 +83,16 @@ func (t *sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 					if strings.HasPrefix(dataLine, "data: ") {
 						// Extract the endpoint URL
 						endpoint := strings.TrimPrefix(dataLine, "data: ")
-						
+						if t.onEndpoint != nil {
+							t.onEndpoint(endpoint)
+						}
+
 						// Replace the host in the endpoint
 						logger.Debug("Original endpoint: %s", endpoint)
 						endpoint = strings.Replace(endpoint, t.targetHost, t.proxyHost, 1)
+						endpoint = mountEndpoint(endpoint, t.mountPath)
 						logger.Debug("Modified endpoint: %s", endpoint)
-						
+
 						// Write the modified event lines
 						fmt.Fprintln(pw, line)
 						fmt.Fprintln(pw, "data: "+endpoint)
@@ -93,17 +100,33 @@ func (t *sseTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 					}
 				}
 			}
-			
+
 			// Write the original line for non-endpoint events
 			fmt.Fprintln(pw, line)
 		}
-		
+
 		if err := scanner.Err(); err != nil {
 			logger.Error("Error reading SSE stream: %v", err)
 		}
 	}()
-	
+
 	// Replace the response body with our modified pipe
 	resp.Body = pr
 	return resp, nil
 }
+
+// mountEndpoint prefixes the path of an endpoint URL with the mount path of its server
+func mountEndpoint(endpoint, mountPath string) string {
+	if mountPath == "" {
+		return endpoint
+	}
+	if strings.HasPrefix(endpoint, "/") {
+		return mountPath + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return endpoint
+	}
+	u.Path = mountPath + u.Path
+	return u.String()
+}
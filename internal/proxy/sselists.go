@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// sseListTTL bounds how long a tools/list request posted to an SSE session
+// waits for its response on the event stream
+const sseListTTL = 10 * time.Minute
+
+// maxPendingLists bounds the tools/list requests waiting for a response
+const maxPendingLists = 10000
+
+// sseToolLists remembers the tools/list requests posted to sessions of the
+// SSE transport. Their responses do not come back in the reply to the POST
+// but on the session's event stream, where they are matched by ID.
+type sseToolLists struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	pending map[string]pendingList
+}
+
+type pendingList struct {
+	firstPage bool
+	expires   time.Time
+}
+
+func newSSEToolLists() *sseToolLists {
+	return &sseToolLists{now: time.Now, pending: make(map[string]pendingList)}
+}
+
+// pendingListKey identifies a request of a session by its ID, which is
+// encoded so that the number 1 and the string "1" stay apart
+func pendingListKey(session string, id any) string {
+	encoded, _ := json.Marshal(id)
+	return session + "\x00" + string(encoded)
+}
+
+// expect records a tools/list request posted to the session
+func (l *sseToolLists) expect(session string, env *util.RPCEnvelope) {
+	params, _ := env.Params.(map[string]any)
+	_, hasCursor := params["cursor"]
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.pending) >= maxPendingLists {
+		for key, p := range l.pending {
+			if !now.Before(p.expires) {
+				delete(l.pending, key)
+			}
+		}
+		if len(l.pending) >= maxPendingLists {
+			return
+		}
+	}
+	l.pending[pendingListKey(session, env.ID)] = pendingList{firstPage: !hasCursor, expires: now.Add(sseListTTL)}
+}
+
+// lookup returns the expected request that a message of the session answers
+func (l *sseToolLists) lookup(session string, msg map[string]json.RawMessage) (pendingList, string, bool) {
+	if session == "" || msg["id"] == nil {
+		return pendingList{}, "", false
+	}
+	var id any
+	if json.Unmarshal(msg["id"], &id) != nil {
+		return pendingList{}, "", false
+	}
+	key := pendingListKey(session, id)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	p, ok := l.pending[key]
+	if ok && !l.now().Before(p.expires) {
+		delete(l.pending, key)
+		return pendingList{}, "", false
+	}
+	return p, key, ok
+}
+
+// onToolList calls fn with the session and the results on its event stream
+// that answer its tools/list requests. A non-nil return value replaces the
+// result. The session is known once the stream announced its endpoint.
+func (l *sseToolLists) onToolList(resp *http.Response, session *atomic.Value, fn func(session string, result json.RawMessage, firstPage bool) json.RawMessage) {
+	rewriteMessages(resp, func(msg map[string]json.RawMessage) (bool, bool) {
+		if len(msg["result"]) == 0 {
+			return false, false
+		}
+		id, _ := session.Load().(string)
+		p, _, ok := l.lookup(id, msg)
+		if !ok {
+			return false, false
+		}
+		if result := fn(id, msg["result"], p.firstPage); result != nil {
+			msg["result"] = result
+			return true, false
+		}
+		return false, false
+	}, false)
+}
+
+// settle forgets the tools/list requests once their responses have been
+// seen on the event stream. It must wrap the stream after every onToolList.
+func (l *sseToolLists) settle(resp *http.Response, session *atomic.Value) {
+	rewriteMessages(resp, func(msg map[string]json.RawMessage) (bool, bool) {
+		id, _ := session.Load().(string)
+		if _, key, ok := l.lookup(id, msg); ok {
+			l.mu.Lock()
+			delete(l.pending, key)
+			l.mu.Unlock()
+		}
+		return false, false
+	}, false)
+}
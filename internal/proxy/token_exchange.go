@@ -0,0 +1,61 @@
+package proxy
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/tokenexchange"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// defaultTokenEndpoint returns the token endpoint of the authorization server,
+// as discovered by the provider when it supports discovery
+func defaultTokenEndpoint(cfg *config.Config, provider authz.Provider) string {
+	if p, ok := provider.(authz.TokenEndpointer); ok {
+		if endpoint := p.TokenEndpoint(); endpoint != "" {
+			return endpoint
+		}
+	}
+	return strings.TrimSuffix(cfg.AuthServerBaseURL, "/") + "/token"
+}
+
+// exchangeToken returns the downstream token to send to the MCP server in place
+// of the client's token. It returns false, after writing the error response,
+// when the exchange fails. Only tokens whose signature and audience verify are
+// exchanged, as the SSE handshake is not otherwise authorized by token.
+func exchangeToken(w http.ResponseWriter, r *http.Request, audience string, exchanger *tokenexchange.Exchanger) (string, bool) {
+	accessToken, err := util.ExtractAccessToken(r.Header.Get("Authorization"))
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	if err := util.ValidateJWT(true, accessToken, audience); err != nil {
+		logger.Warn("Refusing to exchange token: %v", err)
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return "", false
+	}
+	claims, err := util.ParseJWT(accessToken)
+	if err != nil {
+		http.Error(w, "Invalid token claims", http.StatusUnauthorized)
+		return "", false
+	}
+
+	token, err := exchanger.Token(accessToken, claims)
+	if err != nil {
+		logger.Error("Token exchange failed: %v", err)
+		// The IdP refusing the exchange is a policy decision, anything else a gateway failure
+		var exchangeErr *tokenexchange.Error
+		if errors.As(err, &exchangeErr) && exchangeErr.Status < http.StatusInternalServerError {
+			http.Error(w, "Forbidden: token exchange was denied", http.StatusForbidden)
+		} else {
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		}
+		return "", false
+	}
+	return token, true
+}
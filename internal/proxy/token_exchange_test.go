@@ -0,0 +1,73 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/tokenexchange"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func TestExchangeTokenRequiresVerifiedToken(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("exchange-test", &key.PublicKey)
+	forger, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	var calls int32
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "downstream", "token_type": "Bearer", "expires_in": 300})
+	}))
+	defer idp.Close()
+	exchanger, err := tokenexchange.New(config.TokenExchangeConfig{Enabled: true, ClientID: "proxy"}, idp.URL)
+	if err != nil {
+		t.Fatalf("tokenexchange.New failed: %v", err)
+	}
+
+	for name, token := range map[string]string{
+		"forged signature": signTestToken(t, forger, "exchange-test", "mcp"),
+		"other audience":   signTestToken(t, key, "exchange-test", "other"),
+		"unsigned":         jwtWithoutSignature(t),
+	} {
+		req := httptest.NewRequest("GET", "/sse", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		if _, ok := exchangeToken(w, req, "mcp", exchanger); ok || w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401 without an exchange, got %d", name, w.Code)
+		}
+	}
+	if atomic.LoadInt32(&calls) != 0 {
+		t.Fatalf("Expected unverified tokens not to be exchanged, got %d calls", atomic.LoadInt32(&calls))
+	}
+
+	req := httptest.NewRequest("GET", "/sse", nil)
+	req.Header.Set("Authorization", "Bearer "+signTestToken(t, key, "exchange-test", "mcp"))
+	if token, ok := exchangeToken(httptest.NewRecorder(), req, "mcp", exchanger); !ok || token != "downstream" {
+		t.Errorf("Expected the verified token to be exchanged, got %q", token)
+	}
+}
+
+// jwtWithoutSignature builds a token with the alg "none"
+func jwtWithoutSignature(t *testing.T) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodNone, jwt.MapClaims{"sub": "alice", "aud": "mcp"})
+	token.Header["kid"] = "exchange-test"
+	signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+	if err != nil {
+		t.Fatalf("Failed to build token: %v", err)
+	}
+	return signed
+}
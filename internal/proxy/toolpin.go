@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolpin"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+// toolBlockedData is the structured data member of the error for a blocked tool
+type toolBlockedData struct {
+	Reason string `json:"reason"`
+	Tool   string `json:"tool"`
+}
+
+// checkToolPin rejects calls to tools whose current definition has not been
+// approved. It returns false after writing the rejection.
+func checkToolPin(w http.ResponseWriter, cfg *config.Config, pins *toolpin.Manager, env *util.RPCEnvelope) bool {
+	name := env.ToolName()
+	if name == "" || !pins.Blocked(name) {
+		return true
+	}
+
+	logger.Warn("Blocked call to tool %s: its definition has not been approved", name)
+	message := "Forbidden: the definition of tool " + name + " has not been approved"
+	if cfg.JSONRPCErrors && env.ID != nil {
+		util.WriteRPCError(w, http.StatusOK, env.ID, util.RPCErrorAccessDenied, message, toolBlockedData{
+			Reason: "unapproved_tool_definition",
+			Tool:   name,
+		})
+	} else {
+		http.Error(w, message, http.StatusForbidden)
+	}
+	return false
+}
+
+// filterToolList applies the pinning action to a tools/list result
+func filterToolList(pins *toolpin.Manager) func(result json.RawMessage) json.RawMessage {
+	return func(result json.RawMessage) json.RawMessage {
+		filtered, err := pins.FilterList(result)
+		if err != nil {
+			logger.Warn("Failed to check the tools/list response against tool pins: %v", err)
+			return nil
+		}
+		return filtered
+	}
+}
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+	"github.com/wso2/open-mcp-auth-proxy/internal/toolschema"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+var toolArgumentValidations = metrics.NewCounter(
+	"mcp_proxy_tool_argument_validations_total",
+	"Tool calls checked against the input schema of the tool, by result.",
+	"server", "tool", "result",
+)
+
+// toolSessionKey identifies whose tool list a request uses: the MCP session,
+// or the caller's subject for servers without sessions
+func toolSessionKey(r *http.Request) string {
+	if id := affinityKey(r); id != "" {
+		return id
+	}
+	accessToken, err := util.ExtractAccessToken(r.Header.Get("Authorization"))
+	if err != nil {
+		return ""
+	}
+	claims, err := util.ParseJWT(accessToken)
+	if err != nil {
+		return ""
+	}
+	if sub, _ := claims["sub"].(string); sub != "" {
+		return "sub:" + sub
+	}
+	return ""
+}
+
+// checkToolArguments validates the arguments of a tools/call request against
+// the input schema the server listed for the tool. It returns false, after
+// writing a JSON-RPC error, when the arguments do not match or the tool is
+// missing from the listed tools. Calls are passed on unchecked until the
+// server's tools have been listed.
+func checkToolArguments(w http.ResponseWriter, r *http.Request, cfg *config.Config, tools *toolschema.Cache, env *util.RPCEnvelope) bool {
+	name := env.ToolName()
+	if name == "" {
+		return true
+	}
+	var arguments any
+	if params, ok := env.Params.(map[string]any); ok {
+		arguments = params["arguments"]
+	}
+
+	key := toolSessionKey(r)
+	res, err := tools.Validate(key, name, arguments)
+	if res == toolschema.Unknown {
+		return true
+	}
+	// Names of unlisted tools come from the client and would add a series each
+	label := name
+	if res == toolschema.Unlisted {
+		label = "unlisted"
+	}
+	toolArgumentValidations.Inc(cfg.ServerName, label, res.String())
+	if res == toolschema.Valid {
+		return true
+	}
+
+	message := "Unknown tool: " + name
+	if res == toolschema.Invalid {
+		message = "Invalid arguments for tool " + name + ": " + err.Error()
+	}
+	logger.Warn("Rejected call to tool %s (session=%s): %s", name, key, message)
+	status := http.StatusBadRequest
+	if cfg.JSONRPCErrors {
+		status = http.StatusOK
+	}
+	util.WriteRPCError(w, status, env.ID, util.RPCErrorInvalidParams, message, nil)
+	return false
+}
+
+// trackToolList keeps the tool list of a session up to date: tools/list
+// responses are read, and the tools of ended sessions forgotten
+func trackToolList(tools *toolschema.Cache, r *http.Request, env *util.RPCEnvelope, resp *http.Response) {
+	if r.Method == http.MethodDelete && resp.StatusCode < http.StatusMultipleChoices {
+		if id := r.Header.Get(sessionHeader); id != "" {
+			tools.Forget(id)
+		}
+		return
+	}
+	if env != nil && env.Method == "tools/list" {
+		captureToolList(tools, toolSessionKey(r), env, resp)
+	}
+}
+
+// storeToolList records the tools of a tools/list result for the session
+func storeToolList(tools *toolschema.Cache) func(key string, result json.RawMessage, firstPage bool) json.RawMessage {
+	return func(key string, result json.RawMessage, firstPage bool) json.RawMessage {
+		if err := tools.Store(key, result, firstPage); err != nil {
+			logger.Warn("Failed to read the tools/list response: %v", err)
+		}
+		return nil
+	}
+}
+
+// captureToolList reads the tools from the response to a tools/list request
+func captureToolList(tools *toolschema.Cache, key string, env *util.RPCEnvelope, resp *http.Response) {
+	if key == "" {
+		return
+	}
+	params, _ := env.Params.(map[string]any)
+	_, hasCursor := params["cursor"]
+
+	store := storeToolList(tools)
+	onToolList(resp, env, func(result json.RawMessage) json.RawMessage {
+		return store(key, result, !hasCursor)
+	})
+}
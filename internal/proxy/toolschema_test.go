@@ -0,0 +1,300 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+const deployTools = `{"tools":[{"name":"deploy","inputSchema":{"type":"object","properties":{"env":{"enum":["staging","prod"]}},"required":["env"],"additionalProperties":false}}]}`
+
+func TestToolArgumentValidation(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		var calls int32
+		upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var env util.RPCEnvelope
+			json.NewDecoder(r.Body).Decode(&env)
+			id, _ := json.Marshal(env.ID)
+			result := `{}`
+			switch env.Method {
+			case "tools/list":
+				result = deployTools
+			case "tools/call":
+				atomic.AddInt32(&calls, 1)
+			}
+			msg := `{"jsonrpc":"2.0","id":` + string(id) + `,"result":` + result + `}`
+			if stream {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Write([]byte("event: message\r\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/message\"}\r\n\r\ndata: " + msg + "\n\n"))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(msg))
+		}))
+		defer upstream.Close()
+
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		util.AddPublicKey("tools-test", &key.PublicKey)
+		cfg := &config.Config{
+			ProxyBaseURL:      "http://proxy.test",
+			AuthServerBaseURL: "http://idp.test",
+			BaseURL:           upstream.URL,
+			TimeoutSeconds:    5,
+			TransportMode:     config.StreamableHTTPTransport,
+			Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+			CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+			Limits:            config.LimitsConfig{ValidateToolArguments: true},
+			Metrics:           config.MetricsConfig{Enabled: true},
+			ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+				Audience:             "mcp",
+				AuthorizationServers: []string{"http://idp.test"},
+			},
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatalf("Validate failed: %v", err)
+		}
+		router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+		token := signTestToken(t, key, "tools-test", "mcp")
+
+		// Calls are passed on unchecked until the tools have been listed, as
+		// after a restart of the proxy
+		invalid := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"prod; rm -rf /"}}}`
+		if rec := postRPC(router, token, invalid); rec.Code != http.StatusOK {
+			t.Fatalf("Expected a call before any listing to be passed on, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		rec := postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+		if !strings.Contains(rec.Body.String(), "deploy") {
+			t.Fatalf("Expected the tool list to reach the client, got %s", rec.Body.String())
+		}
+
+		rec = postRPC(router, token, invalid)
+		var resp util.RPCErrorResponse
+		json.NewDecoder(rec.Body).Decode(&resp)
+		if rec.Code != http.StatusBadRequest || resp.Error == nil || resp.Error.Code != util.RPCErrorInvalidParams || resp.ID != float64(2) {
+			t.Errorf("stream=%v: expected invalid arguments to be rejected, got %d: %+v", stream, rec.Code, resp)
+		}
+
+		// Once listed, tools missing from the list are rejected
+		unlisted := `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"shutdown","arguments":{}}}`
+		if rec := postRPC(router, token, unlisted); rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "Unknown tool: shutdown") {
+			t.Errorf("stream=%v: expected an unlisted tool to be rejected, got %d: %s", stream, rec.Code, rec.Body.String())
+		}
+
+		valid := `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"staging"}}}`
+		if rec := postRPC(router, token, valid); rec.Code != http.StatusOK {
+			t.Errorf("stream=%v: expected valid arguments to be passed on, got %d", stream, rec.Code)
+		}
+		if got := atomic.LoadInt32(&calls); got != 2 {
+			t.Errorf("stream=%v: expected 2 calls to reach the server, got %d", stream, got)
+		}
+	}
+
+	if got := toolArgumentValidations.Value("", "deploy", "invalid"); got != 2 {
+		t.Errorf("Expected 2 invalid calls to be counted, got %v", got)
+	}
+	// Unlisted names come from the client and share one series
+	if got := toolArgumentValidations.Value("", "unlisted", "unlisted"); got != 2 {
+		t.Errorf("Expected 2 unlisted calls to be counted, got %v", got)
+	}
+	if got := toolArgumentValidations.Value("", "shutdown", "unlisted"); got != 0 {
+		t.Errorf("Expected no series for the unlisted name, got %v", got)
+	}
+}
+
+// sseUpstream is an MCP server of the SSE transport with one session. Replies
+// to the messages posted to it are sent on the event stream.
+type sseUpstream struct {
+	result  func(env util.RPCEnvelope) string
+	replies chan string
+	calls   int32
+}
+
+func newSSEUpstream(t *testing.T, result func(env util.RPCEnvelope) string) (*sseUpstream, *httptest.Server) {
+	t.Helper()
+	u := &sseUpstream{result: result, replies: make(chan string, 10)}
+	server := httptest.NewServer(u)
+	t.Cleanup(server.Close)
+	return u, server
+}
+
+func (u *sseUpstream) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "event: endpoint\ndata: /messages?session_id=sse-session\n\n")
+		w.(http.Flusher).Flush()
+		for {
+			select {
+			case reply := <-u.replies:
+				fmt.Fprintf(w, "event: message\ndata: %s\n\n", reply)
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}
+
+	var env util.RPCEnvelope
+	json.NewDecoder(r.Body).Decode(&env)
+	if env.Method == "tools/call" {
+		atomic.AddInt32(&u.calls, 1)
+	}
+	id, _ := json.Marshal(env.ID)
+	u.replies <- `{"jsonrpc":"2.0","id":` + string(id) + `,"result":` + u.result(env) + `}`
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sseClient is a client of an SSE session opened through the proxy
+type sseClient struct {
+	t        *testing.T
+	proxyURL string
+	token    string
+	endpoint string
+	events   *bufio.Scanner
+}
+
+func openSSE(t *testing.T, proxyURL, token string) *sseClient {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodGet, proxyURL+"/sse", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open the event stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	c := &sseClient{t: t, proxyURL: proxyURL, token: token, events: bufio.NewScanner(resp.Body)}
+	c.endpoint = c.next()
+	return c
+}
+
+// next returns the data of the next event on the stream
+func (c *sseClient) next() string {
+	c.t.Helper()
+	for c.events.Scan() {
+		if data, ok := strings.CutPrefix(c.events.Text(), "data: "); ok {
+			return data
+		}
+	}
+	c.t.Fatalf("The event stream ended: %v", c.events.Err())
+	return ""
+}
+
+// post sends a message to the session and returns the status and body of
+// the response to the POST
+func (c *sseClient) post(body string) (int, string) {
+	c.t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, c.proxyURL+c.endpoint, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		c.t.Fatalf("Failed to post a message: %v", err)
+	}
+	defer resp.Body.Close()
+	var reply strings.Builder
+	bufio.NewReader(resp.Body).WriteTo(&reply)
+	return resp.StatusCode, reply.String()
+}
+
+func TestToolArgumentValidationOnSSE(t *testing.T) {
+	sse, upstream := newSSEUpstream(t, func(env util.RPCEnvelope) string {
+		if env.Method == "tools/list" {
+			return deployTools
+		}
+		return `{}`
+	})
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("sse-tools-test", &key.PublicKey)
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           upstream.URL,
+		TimeoutSeconds:    5,
+		TransportMode:     config.SSETransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		Limits:            config.LimitsConfig{ValidateToolArguments: true},
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	proxy := httptest.NewServer(NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{}))
+	t.Cleanup(proxy.Close)
+
+	c := openSSE(t, proxy.URL, signTestToken(t, key, "sse-tools-test", "mcp"))
+	if c.endpoint != "/messages?session_id=sse-session" {
+		t.Fatalf("Unexpected endpoint %q", c.endpoint)
+	}
+
+	// Calls are passed on unchecked until the tools have been listed
+	invalid := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"prod; rm -rf /"}}}`
+	if status, body := c.post(invalid); status != http.StatusAccepted {
+		t.Fatalf("Expected a call before any listing to be passed on, got %d: %s", status, body)
+	}
+	if reply := c.next(); !strings.Contains(reply, `"id":2`) {
+		t.Fatalf("Expected the call result on the stream, got %s", reply)
+	}
+
+	// The tool list arrives on the event stream
+	if status, _ := c.post(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`); status != http.StatusAccepted {
+		t.Fatalf("Expected the tools/list message to be accepted, got %d", status)
+	}
+	if reply := c.next(); !strings.Contains(reply, "deploy") {
+		t.Fatalf("Expected the tool list on the stream, got %s", reply)
+	}
+
+	if status, body := c.post(invalid); status != http.StatusBadRequest || !strings.Contains(body, "Invalid arguments") {
+		t.Errorf("Expected invalid arguments to be rejected, got %d: %s", status, body)
+	}
+	if status, _ := c.post(`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"deploy","arguments":{"env":"staging"}}}`); status != http.StatusAccepted {
+		t.Errorf("Expected valid arguments to be passed on, got %d", status)
+	}
+	if reply := c.next(); !strings.Contains(reply, `"id":3`) {
+		t.Errorf("Expected the call result on the stream, got %s", reply)
+	}
+	if got := atomic.LoadInt32(&sse.calls); got != 2 {
+		t.Errorf("Expected 2 calls to reach the server, got %d", got)
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	cfg := &config.Config{
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           "http://mcp.test",
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		Metrics:           config.MetricsConfig{Enabled: true, Path: "/internal/metrics"},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/internal/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "# TYPE mcp_proxy_tool_argument_validations_total counter") {
+		t.Errorf("Expected the metrics to be served, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,230 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/jsonschema"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+const defaultMaxBodyBytes = 4 << 20
+
+// batchCutoverVersion is the first MCP protocol version without JSON-RPC batching
+const batchCutoverVersion = "2025-06-18"
+
+// assumedProtocolVersion applies to requests without an MCP-Protocol-Version header
+const assumedProtocolVersion = "2025-03-26"
+
+// invalidMessageError explains why a JSON-RPC message was rejected
+type invalidMessageError struct {
+	code    int
+	id      any
+	message string
+}
+
+func (e *invalidMessageError) Error() string {
+	return e.message
+}
+
+// validateMCPRequest enforces the request size limit and, when enabled, checks
+// that the body of an MCP POST is a well-formed JSON-RPC 2.0 message whose
+// params match the MCP schema. It returns false, after writing the rejection,
+// when the request must not be forwarded.
+func validateMCPRequest(w http.ResponseWriter, r *http.Request, cfg *config.Config) bool {
+	body, ok := limitRequestBody(w, r, cfg)
+	if !ok || body == nil {
+		return ok
+	}
+
+	if r.Method != http.MethodPost || !cfg.Limits.ValidateJSONRPC {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != "application/json" {
+		logger.Warn("Rejected %s: unsupported content type %q", r.URL.Path, r.Header.Get("Content-Type"))
+		http.Error(w, "Unsupported Media Type: MCP messages must be sent as application/json", http.StatusUnsupportedMediaType)
+		return false
+	}
+
+	if err := checkMessages(body, r.Header.Get("MCP-Protocol-Version"), cfg.Limits.ValidateParams); err != nil {
+		var invalid *invalidMessageError
+		if !errors.As(err, &invalid) {
+			invalid = &invalidMessageError{code: util.RPCErrorInvalidRequest, message: err.Error()}
+		}
+		logger.Warn("Rejected %s: %s", r.URL.Path, invalid.message)
+		status := http.StatusBadRequest
+		if cfg.JSONRPCErrors {
+			status = http.StatusOK
+		}
+		util.WriteRPCError(w, status, invalid.id, invalid.code, invalid.message, nil)
+		return false
+	}
+	return true
+}
+
+// limitRequestBody reads the request body, rejecting it when it exceeds the
+// configured limit, and leaves it in r.Body to be read again. It returns false
+// after writing the rejection, and a nil body when the request has none.
+func limitRequestBody(w http.ResponseWriter, r *http.Request, cfg *config.Config) ([]byte, bool) {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil, true
+	}
+
+	maxBytes := cfg.Limits.MaxBodyBytes
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+	if r.ContentLength > maxBytes {
+		logger.Warn("Rejected %s: body of %d bytes exceeds the limit of %d", r.URL.Path, r.ContentLength, maxBytes)
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBytes))
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			logger.Warn("Rejected %s: body exceeds the limit of %d bytes", r.URL.Path, maxBytes)
+			http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+			return nil, false
+		}
+		http.Error(w, "Bad Request: could not read the request body", http.StatusBadRequest)
+		return nil, false
+	}
+	return body, true
+}
+
+// withBodyLimit applies the request size limit before handing the request to
+// an endpoint of the proxy that is not an MCP path
+func withBodyLimit(cfg *config.Config, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := limitRequestBody(w, r, cfg); ok {
+			handler(w, r)
+		}
+	}
+}
+
+// checkMessages validates a JSON-RPC message or batch
+func checkMessages(body []byte, protocolVersion string, validateParams bool) error {
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return &invalidMessageError{code: util.RPCErrorParse, message: "Parse error: " + err.Error()}
+	}
+	if protocolVersion == "" {
+		protocolVersion = assumedProtocolVersion
+	}
+
+	batch, isBatch := v.([]any)
+	if !isBatch {
+		return checkMessage(v, protocolVersion, validateParams)
+	}
+	// Versions are dates, so they compare as strings
+	if protocolVersion >= batchCutoverVersion {
+		return &invalidMessageError{code: util.RPCErrorInvalidRequest, message: "Invalid request: batches are not supported in MCP " + protocolVersion}
+	}
+	if len(batch) == 0 {
+		return &invalidMessageError{code: util.RPCErrorInvalidRequest, message: "Invalid request: empty batch"}
+	}
+	for _, msg := range batch {
+		if err := checkMessage(msg, protocolVersion, validateParams); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMessage validates a single JSON-RPC request, notification or response
+func checkMessage(v any, protocolVersion string, validateParams bool) error {
+	msg, ok := v.(map[string]any)
+	if !ok {
+		return &invalidMessageError{code: util.RPCErrorInvalidRequest, message: "Invalid request: a message must be an object"}
+	}
+
+	id, hasID := msg["id"]
+	if hasID && !validID(id) {
+		return &invalidMessageError{code: util.RPCErrorInvalidRequest, message: "Invalid request: id must be a string or a number"}
+	}
+	invalid := func(format string, args ...any) error {
+		return &invalidMessageError{code: util.RPCErrorInvalidRequest, id: id, message: "Invalid request: " + fmt.Sprintf(format, args...)}
+	}
+
+	if msg["jsonrpc"] != "2.0" {
+		return invalid(`jsonrpc must be "2.0"`)
+	}
+
+	method, hasMethod := msg["method"]
+	if !hasMethod {
+		// A response to a request of the server
+		_, hasResult := msg["result"]
+		_, hasError := msg["error"]
+		if !hasID {
+			return invalid("a message must have a method or an id")
+		}
+		if hasResult == hasError {
+			return invalid("a response must have either a result or an error")
+		}
+		return nil
+	}
+
+	name, ok := method.(string)
+	if !ok || name == "" {
+		return invalid("method must be a non-empty string")
+	}
+	if hasID && id == nil {
+		return invalid("id must not be null")
+	}
+	params, hasParams := msg["params"]
+	if hasParams {
+		switch params.(type) {
+		case map[string]any, []any:
+		default:
+			return invalid("params must be an object or an array")
+		}
+	}
+
+	if !validateParams {
+		return nil
+	}
+	if name == "initialize" {
+		// The client proposes the protocol version it speaks
+		if p, ok := params.(map[string]any); ok {
+			if version, ok := p["protocolVersion"].(string); ok {
+				protocolVersion = version
+			}
+		}
+	}
+	schema, err := jsonschema.MCPMethodSchema(protocolVersion, name)
+	if err != nil {
+		logger.Error("Failed to load the MCP schema: %v", err)
+		return nil
+	}
+	if schema == nil {
+		// Unknown methods and protocol versions are passed on unchecked
+		return nil
+	}
+	if !hasParams {
+		params = map[string]any{}
+	}
+	if err := schema.Validate(params); err != nil {
+		return &invalidMessageError{code: util.RPCErrorInvalidParams, id: id, message: fmt.Sprintf("Invalid params for %s: %v", name, err)}
+	}
+	return nil
+}
+
+// validID reports whether a JSON-RPC id is a string, a number or null
+func validID(id any) bool {
+	switch id.(type) {
+	case nil, string, float64:
+		return true
+	}
+	return false
+}
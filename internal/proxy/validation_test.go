@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/authz"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/util"
+)
+
+func newValidationRouter(t *testing.T, limits config.LimitsConfig) (http.Handler, string, *int32) {
+	t.Helper()
+	var forwarded int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&forwarded, 1)
+		w.Write([]byte(`{"jsonrpc":"2.0","id":1,"result":{}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	util.AddPublicKey("validation-test", &key.PublicKey)
+
+	cfg := &config.Config{
+		ProxyBaseURL:      "http://proxy.test",
+		AuthServerBaseURL: "http://idp.test",
+		BaseURL:           upstream.URL,
+		TimeoutSeconds:    5,
+		TransportMode:     config.StreamableHTTPTransport,
+		Paths:             config.PathsConfig{StreamableHTTP: "/mcp"},
+		CORSConfig:        config.CORSConfig{AllowedOrigins: []string{"http://localhost:6274"}},
+		Limits:            limits,
+		ProtectedResourceMetadata: config.ProtectedResourceMetadata{
+			Audience:             "mcp",
+			AuthorizationServers: []string{"http://idp.test"},
+		},
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed: %v", err)
+	}
+	router := NewRouter(context.Background(), cfg, authz.NewDefaultProvider(cfg), &authz.ScopeValidator{})
+	return router, signTestToken(t, key, "validation-test", "mcp"), &forwarded
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	router, token, forwarded := newValidationRouter(t, config.LimitsConfig{MaxBodyBytes: 64})
+
+	rec := postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected a small request to be forwarded, got %d", rec.Code)
+	}
+
+	rec = postRPC(router, token, `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"`+strings.Repeat("x", 64)+`"}}`)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large body, got %d", rec.Code)
+	}
+
+	// Without a content length the limit applies while reading
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(strings.Repeat(" ", 100)))
+	req.ContentLength = -1
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large chunked body, got %d", rec.Code)
+	}
+	if got := atomic.LoadInt32(forwarded); got != 1 {
+		t.Errorf("Expected only the small request to be forwarded, got %d", got)
+	}
+}
+
+func TestRequestBodyLimitOnProxyEndpoints(t *testing.T) {
+	router, _, _ := newValidationRouter(t, config.LimitsConfig{MaxBodyBytes: 64})
+
+	// Auth server endpoints are limited before they are proxied
+	for _, path := range []string{"/token", "/register"} {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader("grant_type="+strings.Repeat("x", 100)))
+		req.ContentLength = -1
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Errorf("Expected 413 for a large body to %s, got %d", path, rec.Code)
+		}
+	}
+
+	// Endpoints the proxy serves itself are limited too
+	handler := withBodyLimit(&config.Config{Limits: config.LimitsConfig{MaxBodyBytes: 64}}, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/credentials/github", strings.NewReader(strings.Repeat("x", 100))))
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large body to the credentials API, got %d", rec.Code)
+	}
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest(http.MethodPost, "/credentials/github", strings.NewReader("{}")))
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("Expected a small body to be handled, got %d", rec.Code)
+	}
+}
+
+func TestJSONRPCValidation(t *testing.T) {
+	router, token, forwarded := newValidationRouter(t, config.LimitsConfig{ValidateJSONRPC: true, ValidateParams: true})
+
+	req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`))
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a non-JSON content type, got %d", rec.Code)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		code int
+		id   any
+	}{
+		{"parse error", `{"jsonrpc":`, util.RPCErrorParse, nil},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"ping"}`, util.RPCErrorInvalidRequest, float64(1)},
+		{"object id", `{"jsonrpc":"2.0","id":{},"method":"ping"}`, util.RPCErrorInvalidRequest, nil},
+		{"null id", `{"jsonrpc":"2.0","id":null,"method":"ping"}`, util.RPCErrorInvalidRequest, nil},
+		{"numeric method", `{"jsonrpc":"2.0","id":"a","method":1}`, util.RPCErrorInvalidRequest, "a"},
+		{"scalar params", `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":"x"}`, util.RPCErrorInvalidRequest, float64(2)},
+		{"result and error", `{"jsonrpc":"2.0","id":3,"result":{},"error":{"code":1,"message":"x"}}`, util.RPCErrorInvalidRequest, float64(3)},
+		{"batch", `[{"jsonrpc":"2.0","id":1,"method":"ping"}]`, util.RPCErrorInvalidRequest, nil},
+		{"missing tool name", `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"arguments":{}}}`, util.RPCErrorInvalidParams, float64(4)},
+		{"bad log level", `{"jsonrpc":"2.0","id":5,"method":"logging/setLevel","params":{"level":"loud"}}`, util.RPCErrorInvalidParams, float64(5)},
+	}
+	for _, tt := range tests {
+		rec := postRPC(router, token, tt.body)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", tt.name, rec.Code)
+			continue
+		}
+		var resp util.RPCErrorResponse
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil || resp.Error == nil {
+			t.Errorf("%s: expected a JSON-RPC error, got %v", tt.name, err)
+			continue
+		}
+		if resp.Error.Code != tt.code || resp.ID != tt.id {
+			t.Errorf("%s: expected code %d and id %v, got %+v", tt.name, tt.code, tt.id, resp)
+		}
+	}
+	if got := atomic.LoadInt32(forwarded); got != 0 {
+		t.Fatalf("Expected invalid messages not to be forwarded, got %d", got)
+	}
+
+	valid := []string{
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"search","arguments":{"q":"x"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":"s-1","result":{}}`,
+		`{"jsonrpc":"2.0","id":2,"method":"custom/method","params":{"anything":true}}`,
+	}
+	for _, body := range valid {
+		if rec := postRPC(router, token, body); rec.Code != http.StatusOK {
+			t.Errorf("Expected %s to be forwarded, got %d: %s", body, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestBatchesAllowedBeforeCutover(t *testing.T) {
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","method":"notifications/initialized"}]`
+	if err := checkMessages([]byte(batch), "2025-03-26", true); err != nil {
+		t.Errorf("Expected a batch to be valid in 2025-03-26, got %v", err)
+	}
+	if err := checkMessages([]byte(`[]`), "2025-03-26", true); err == nil {
+		t.Error("Expected an empty batch to be rejected")
+	}
+	bad := `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2}]`
+	if err := checkMessages([]byte(bad), "2024-11-05", true); err == nil {
+		t.Error("Expected an invalid batch element to be rejected")
+	}
+}
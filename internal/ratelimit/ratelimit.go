@@ -0,0 +1,338 @@
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+// Key dimensions that rules can be scoped by
+const (
+	KeySubject  = "subject"
+	KeyClientID = "client_id"
+	KeyIP       = "ip"
+	KeyMethod   = "method"
+	KeyTool     = "tool"
+)
+
+// Quota periods
+const (
+	PeriodDaily   = "daily"
+	PeriodMonthly = "monthly"
+)
+
+// maxBuckets bounds the number of token buckets. Bucket keys hold values that
+// callers choose, such as tool names, so buckets that are full again are
+// dropped first, and then the least recently used ones.
+const maxBuckets = 10000
+
+// Request describes the caller and the call being rate limited
+type Request struct {
+	Subject  string
+	ClientID string
+	IP       string
+	Method   string
+	Tool     string
+}
+
+// Budget is the remaining allowance under one rule
+type Budget struct {
+	Rule      string
+	Limit     int64
+	Remaining int64
+	Reset     time.Time
+}
+
+// Result is the outcome of Limiter.Allow. RateLimit and Quota hold the tightest
+// matching budgets, if any rule of that kind matched the request.
+type Result struct {
+	Allowed    bool
+	Rule       string
+	Message    string
+	RetryAfter time.Duration
+	RateLimit  *Budget
+	Quota      *Budget
+}
+
+// Limiter enforces token bucket rate limits and periodic quotas
+type Limiter struct {
+	mu         sync.Mutex
+	rules      []config.RateLimitRule
+	quotas     []config.QuotaRule
+	buckets    map[string]*list.Element
+	recent     *list.List // Buckets, most recently used first
+	maxBuckets int
+	store      store.Store
+	now        func() time.Time
+}
+
+type bucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+	burst  float64
+	rate   float64 // Tokens per second
+}
+
+// fullAt reports whether the bucket has refilled to its burst by now
+func (b *bucket) fullAt(now time.Time) bool {
+	return b.tokens+now.Sub(b.last).Seconds()*b.rate >= b.burst
+}
+
+type quotaCounter struct {
+	Count int64 `json:"count"`
+}
+
+// New builds a Limiter from configuration
+func New(cfg config.RateLimitConfig) (*Limiter, error) {
+	for _, rule := range cfg.Rules {
+		if rule.RequestsPerMinute <= 0 {
+			return nil, fmt.Errorf("rate limit rule %q: requests_per_minute must be positive", rule.Name)
+		}
+		if err := validateKeys(rule.Keys); err != nil {
+			return nil, fmt.Errorf("rate limit rule %q: %w", rule.Name, err)
+		}
+	}
+	for _, quota := range cfg.Quotas {
+		if quota.Period != PeriodDaily && quota.Period != PeriodMonthly {
+			return nil, fmt.Errorf("quota %q: period must be %q or %q", quota.Name, PeriodDaily, PeriodMonthly)
+		}
+		if quota.Limit <= 0 {
+			return nil, fmt.Errorf("quota %q: limit must be positive", quota.Name)
+		}
+		if err := validateKeys(quota.Keys); err != nil {
+			return nil, fmt.Errorf("quota %q: %w", quota.Name, err)
+		}
+	}
+
+	st, err := store.New(cfg.Store)
+	if err != nil {
+		return nil, fmt.Errorf("quota store: %w", err)
+	}
+
+	return &Limiter{
+		rules:      cfg.Rules,
+		quotas:     cfg.Quotas,
+		buckets:    make(map[string]*list.Element),
+		recent:     list.New(),
+		maxBuckets: maxBuckets,
+		store:      st,
+		now:        time.Now,
+	}, nil
+}
+
+// Close writes the quota counters the store has not saved yet
+func (l *Limiter) Close() error {
+	return store.Close(l.store)
+}
+
+// Allow checks every matching rule and quota, and consumes one unit from each
+// of them only if all of them allow the request.
+func (l *Limiter) Allow(req Request) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	result := Result{Allowed: true}
+
+	type pendingBucket struct {
+		b    *bucket
+		rule config.RateLimitRule
+	}
+	var takeBuckets []pendingBucket
+	for _, rule := range l.rules {
+		if !matches(rule.Method, rule.Tool, req) {
+			continue
+		}
+		b := l.refill(rule, req, now)
+		burst := burstOf(rule)
+		budget := &Budget{Rule: rule.Name, Limit: int64(burst), Remaining: int64(b.tokens) - 1}
+		if b.tokens < 1 {
+			wait := time.Duration((1 - b.tokens) / ratePerSecond(rule) * float64(time.Second))
+			return deny(rule.Name, "rate limit exceeded", wait, budget, nil)
+		}
+		if result.RateLimit == nil || budget.Remaining < result.RateLimit.Remaining {
+			result.RateLimit = budget
+		}
+		takeBuckets = append(takeBuckets, pendingBucket{b, rule})
+	}
+
+	type pendingQuota struct {
+		key     string
+		counter quotaCounter
+		reset   time.Time
+	}
+	var takeQuotas []pendingQuota
+	for _, quota := range l.quotas {
+		if !matches(quota.Method, quota.Tool, req) {
+			continue
+		}
+		window, reset := periodWindow(quota.Period, now)
+		key := "quota:" + quota.Name + ":" + window + ":" + keyFor(quota.Keys, req)
+
+		var counter quotaCounter
+		if _, err := l.store.Get(key, &counter); err != nil {
+			return deny(quota.Name, "quota store unavailable", time.Minute, nil, nil)
+		}
+		budget := &Budget{Rule: quota.Name, Limit: quota.Limit, Remaining: quota.Limit - counter.Count - 1, Reset: reset}
+		if counter.Count >= quota.Limit {
+			budget.Remaining = 0
+			return deny(quota.Name, "quota exceeded", reset.Sub(now), nil, budget)
+		}
+		if result.Quota == nil || budget.Remaining < result.Quota.Remaining {
+			result.Quota = budget
+		}
+		takeQuotas = append(takeQuotas, pendingQuota{key, counter, reset})
+	}
+
+	for _, t := range takeBuckets {
+		t.b.tokens--
+	}
+	for _, t := range takeQuotas {
+		t.counter.Count++
+		if err := l.store.Put(t.key, t.counter, t.reset.Sub(now)); err != nil {
+			return deny("", "quota store unavailable", time.Minute, nil, nil)
+		}
+	}
+
+	return result
+}
+
+// refill returns the bucket for the rule and request, topped up for the time elapsed
+func (l *Limiter) refill(rule config.RateLimitRule, req Request, now time.Time) *bucket {
+	key := rule.Name + "|" + keyFor(rule.Keys, req)
+	burst := float64(burstOf(rule))
+
+	elem, ok := l.buckets[key]
+	if !ok {
+		if len(l.buckets) >= l.maxBuckets {
+			l.evict(now)
+		}
+		b := &bucket{key: key, tokens: burst, last: now, burst: burst, rate: ratePerSecond(rule)}
+		l.buckets[key] = l.recent.PushFront(b)
+		return b
+	}
+
+	l.recent.MoveToFront(elem)
+	b := elem.Value.(*bucket)
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(burst, b.tokens+elapsed*ratePerSecond(rule))
+	b.last = now
+	return b
+}
+
+// evict makes room for a bucket. Buckets that are full again are dropped
+// first, since recreating them gives the same result; if none is, the least
+// recently used bucket goes.
+func (l *Limiter) evict(now time.Time) {
+	for elem := l.recent.Back(); elem != nil; {
+		prev := elem.Prev()
+		if b := elem.Value.(*bucket); b.fullAt(now) {
+			l.remove(elem)
+		}
+		elem = prev
+	}
+	if len(l.buckets) >= l.maxBuckets {
+		l.remove(l.recent.Back())
+	}
+}
+
+func (l *Limiter) remove(elem *list.Element) {
+	delete(l.buckets, elem.Value.(*bucket).key)
+	l.recent.Remove(elem)
+}
+
+func deny(rule, message string, retryAfter time.Duration, rate, quota *Budget) Result {
+	if retryAfter < time.Second {
+		retryAfter = time.Second
+	}
+	return Result{
+		Allowed:    false,
+		Rule:       rule,
+		Message:    message,
+		RetryAfter: retryAfter,
+		RateLimit:  rate,
+		Quota:      quota,
+	}
+}
+
+// ClientIP returns the address a request came from, for rules keyed by ip
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func matches(method, tool string, req Request) bool {
+	if method != "" && method != req.Method {
+		return false
+	}
+	if tool != "" && tool != req.Tool {
+		return false
+	}
+	return true
+}
+
+func keyFor(keys []string, req Request) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		var v string
+		switch k {
+		case KeySubject:
+			v = req.Subject
+		case KeyClientID:
+			v = req.ClientID
+		case KeyIP:
+			v = req.IP
+		case KeyMethod:
+			v = req.Method
+		case KeyTool:
+			v = req.Tool
+		}
+		parts = append(parts, k+"="+v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func validateKeys(keys []string) error {
+	for _, k := range keys {
+		switch k {
+		case KeySubject, KeyClientID, KeyIP, KeyMethod, KeyTool:
+		default:
+			return fmt.Errorf("unknown key %q", k)
+		}
+	}
+	return nil
+}
+
+func burstOf(rule config.RateLimitRule) int {
+	if rule.Burst > 0 {
+		return rule.Burst
+	}
+	return int(math.Max(1, math.Ceil(rule.RequestsPerMinute)))
+}
+
+func ratePerSecond(rule config.RateLimitRule) float64 {
+	return rule.RequestsPerMinute / 60
+}
+
+// periodWindow returns the identifier of the current quota window and when it ends
+func periodWindow(period string, now time.Time) (string, time.Time) {
+	now = now.UTC()
+	if period == PeriodMonthly {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start.Format("2006-01"), start.AddDate(0, 1, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start.Format("2006-01-02"), start.AddDate(0, 0, 1)
+}
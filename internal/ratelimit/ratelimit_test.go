@@ -0,0 +1,184 @@
+package ratelimit
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+func TestTokenBucketPerSubject(t *testing.T) {
+	limiter, err := New(config.RateLimitConfig{
+		Rules: []config.RateLimitRule{
+			{Name: "per-user", Keys: []string{KeySubject}, RequestsPerMinute: 60, Burst: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	alice := Request{Subject: "alice", Method: "tools/call"}
+	for i := 0; i < 2; i++ {
+		if res := limiter.Allow(alice); !res.Allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+	res := limiter.Allow(alice)
+	if res.Allowed {
+		t.Fatalf("Expected third request to be rate limited")
+	}
+	if res.RetryAfter != time.Second {
+		t.Errorf("Expected Retry-After of 1s, got %v", res.RetryAfter)
+	}
+
+	// Other subjects have their own bucket
+	if res := limiter.Allow(Request{Subject: "bob"}); !res.Allowed {
+		t.Errorf("Expected bob to be allowed")
+	}
+
+	// Tokens refill over time
+	now = now.Add(time.Second)
+	if res := limiter.Allow(alice); !res.Allowed {
+		t.Errorf("Expected alice to be allowed after refill")
+	}
+}
+
+func TestToolScopedRule(t *testing.T) {
+	limiter, err := New(config.RateLimitConfig{
+		Rules: []config.RateLimitRule{
+			{Name: "expensive", Keys: []string{KeySubject, KeyTool}, Tool: "expensive", RequestsPerMinute: 1, Burst: 1},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+
+	cheap := Request{Subject: "alice", Method: "tools/call", Tool: "cheap"}
+	for i := 0; i < 5; i++ {
+		if res := limiter.Allow(cheap); !res.Allowed {
+			t.Fatalf("Expected unmatched tool to be unlimited")
+		}
+	}
+
+	expensive := Request{Subject: "alice", Method: "tools/call", Tool: "expensive"}
+	if res := limiter.Allow(expensive); !res.Allowed || res.RateLimit == nil || res.RateLimit.Remaining != 0 {
+		t.Fatalf("Expected first expensive call allowed with 0 remaining, got %+v", res)
+	}
+	if res := limiter.Allow(expensive); res.Allowed || res.Rule != "expensive" {
+		t.Errorf("Expected second expensive call to be denied by rule 'expensive', got %+v", res)
+	}
+}
+
+func TestDailyQuota(t *testing.T) {
+	limiter, err := New(config.RateLimitConfig{
+		Quotas: []config.QuotaRule{
+			{Name: "daily", Keys: []string{KeyClientID}, Period: PeriodDaily, Limit: 2},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	now := time.Date(2025, 6, 1, 23, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+
+	req := Request{ClientID: "client-1"}
+	res := limiter.Allow(req)
+	if !res.Allowed || res.Quota == nil || res.Quota.Remaining != 1 {
+		t.Fatalf("Expected allowed with 1 remaining, got %+v", res)
+	}
+	limiter.Allow(req)
+
+	res = limiter.Allow(req)
+	if res.Allowed {
+		t.Fatalf("Expected quota to be exhausted")
+	}
+	if res.RetryAfter != time.Hour {
+		t.Errorf("Expected Retry-After until midnight (1h), got %v", res.RetryAfter)
+	}
+
+	// A new day resets the quota
+	now = now.Add(2 * time.Hour)
+	if res := limiter.Allow(req); !res.Allowed {
+		t.Errorf("Expected quota to reset on a new day")
+	}
+}
+
+func TestBucketsAreBounded(t *testing.T) {
+	limiter, err := New(config.RateLimitConfig{
+		Rules: []config.RateLimitRule{
+			{Name: "slow", Keys: []string{KeyTool}, RequestsPerMinute: 0.1, Burst: 10},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter.now = func() time.Time { return now }
+	limiter.maxBuckets = 3
+
+	// A bucket that is still refilling after an hour keeps its count
+	for i := 0; i < 10; i++ {
+		limiter.Allow(Request{Tool: "search"})
+	}
+	now = now.Add(time.Hour)
+	limiter.Allow(Request{Tool: "a"})
+	limiter.Allow(Request{Tool: "b"})
+	limiter.Allow(Request{Tool: "search"})
+	if res := limiter.Allow(Request{Tool: "c"}); !res.Allowed || len(limiter.buckets) != 3 {
+		t.Fatalf("Expected at most 3 buckets, got %d", len(limiter.buckets))
+	}
+	if _, ok := limiter.buckets["slow|tool=a"]; ok {
+		t.Error("Expected the least recently used bucket to be dropped")
+	}
+	if res := limiter.Allow(Request{Tool: "search"}); res.RateLimit == nil || res.RateLimit.Remaining > 5 {
+		t.Errorf("Expected the refilling bucket to be kept, got %+v", res.RateLimit)
+	}
+
+	// Buckets that are full again are dropped before used ones
+	now = now.Add(100 * time.Minute)
+	limiter.Allow(Request{Tool: "search"})
+	limiter.Allow(Request{Tool: "d"})
+	if _, ok := limiter.buckets["slow|tool=search"]; !ok || len(limiter.buckets) != 2 {
+		t.Errorf("Expected the full buckets to be dropped, got %d buckets", len(limiter.buckets))
+	}
+}
+
+func TestCloseSavesQuotaCounters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quotas.json")
+	limiter, err := New(config.RateLimitConfig{
+		Quotas: []config.QuotaRule{
+			{Name: "daily", Keys: []string{KeyClientID}, Period: PeriodDaily, Limit: 2},
+		},
+		Store: config.StoreConfig{Type: store.TypeFile, Path: path},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create limiter: %v", err)
+	}
+	limiter.Allow(Request{ClientID: "client-1"})
+	if err := limiter.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The counter is on disk before the deferred flush would have written it
+	st, err := store.NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	keys, _ := st.Keys("quota:daily:")
+	if len(keys) != 1 {
+		t.Errorf("Expected the quota counter to be saved, got %v", keys)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := New(config.RateLimitConfig{Rules: []config.RateLimitRule{{Name: "x", Keys: []string{"user"}, RequestsPerMinute: 1}}}); err == nil {
+		t.Errorf("Expected error for unknown key")
+	}
+	if _, err := New(config.RateLimitConfig{Quotas: []config.QuotaRule{{Name: "x", Period: "weekly", Limit: 1}}}); err == nil {
+		t.Errorf("Expected error for unknown period")
+	}
+}
@@ -0,0 +1,237 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+// flushDelay batches writes of expiring entries, such as rate-limit counters,
+// so that a busy store is not rewritten on every change
+const flushDelay = time.Second
+
+// FileStore is a MemoryStore that is written through to a JSON file, so that state
+// survives restarts and can be read by admin commands. Permanent entries and deletes
+// are written immediately; entries with a ttl are written within flushDelay. Changes
+// made to the file by other processes are merged in before it is written.
+type FileStore struct {
+	*MemoryStore
+	path string
+
+	// Serialises writes of the file
+	writeMu sync.Mutex
+	// Deferred write of expiring entries; guarded by mu
+	pending *time.Timer
+	// Keys changed since the file was last written; guarded by mu
+	dirty map[string]bool
+
+	// Identifies the file version last read or written, to notice changes by other processes
+	modTime time.Time
+	size    int64
+}
+
+// NewFileStore opens (or creates) the store file at path
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path, dirty: make(map[string]bool)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read store file: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &s.entries); err != nil {
+			return nil, fmt.Errorf("failed to parse store file %s: %w", path, err)
+		}
+	}
+	s.prune()
+	s.modTime, s.size = fileVersion(path)
+	return s, nil
+}
+
+// Reload re-reads the file when another process, such as an admin command,
+// has changed it since it was last read or written. Changes that have not
+// been written yet are kept.
+func (s *FileStore) Reload() error {
+	entries, modTime, size, err := s.readChanged()
+	if err != nil || entries == nil {
+		return err
+	}
+	s.mu.Lock()
+	s.merge(entries)
+	s.modTime, s.size = modTime, size
+	s.mu.Unlock()
+	return nil
+}
+
+// readChanged reads the file if it changed since it was last read or
+// written, and returns nil entries otherwise
+func (s *FileStore) readChanged() (map[string]entry, time.Time, int64, error) {
+	modTime, size := fileVersion(s.path)
+	s.mu.RLock()
+	unchanged := modTime.Equal(s.modTime) && size == s.size
+	s.mu.RUnlock()
+	if unchanged {
+		return nil, modTime, size, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, modTime, size, fmt.Errorf("failed to read store file: %w", err)
+	}
+	entries := make(map[string]entry)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, modTime, size, fmt.Errorf("failed to parse store file %s: %w", s.path, err)
+		}
+	}
+	return entries, modTime, size, nil
+}
+
+// merge replaces the entries with those read from the file, apart from the
+// keys changed here since the last write. Callers must hold the write lock.
+func (s *FileStore) merge(entries map[string]entry) {
+	for k := range s.dirty {
+		if e, ok := s.entries[k]; ok {
+			entries[k] = e
+		} else {
+			delete(entries, k)
+		}
+	}
+	s.entries = entries
+	s.prune()
+}
+
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+func (s *FileStore) Put(key string, v any, ttl time.Duration) error {
+	if err := s.MemoryStore.Put(key, v, ttl); err != nil {
+		return err
+	}
+	s.markDirty(key)
+	if ttl > 0 {
+		s.scheduleFlush()
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *FileStore) Delete(key string) error {
+	if err := s.MemoryStore.Delete(key); err != nil {
+		return err
+	}
+	s.markDirty(key)
+	return s.flush()
+}
+
+func (s *FileStore) markDirty(key string) {
+	s.mu.Lock()
+	s.dirty[key] = true
+	s.mu.Unlock()
+}
+
+// Close writes any changes that are waiting for a deferred flush
+func (s *FileStore) Close() error {
+	s.mu.RLock()
+	pending := s.pending != nil
+	s.mu.RUnlock()
+	if !pending {
+		return nil
+	}
+	return s.flush()
+}
+
+func (s *FileStore) scheduleFlush() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending != nil {
+		return
+	}
+	s.pending = time.AfterFunc(flushDelay, func() {
+		if err := s.flush(); err != nil {
+			logger.Warn("Failed to write store file %s: %v", s.path, err)
+		}
+	})
+}
+
+// flush writes all live entries to a temporary file and renames it into place.
+// Changes made to the file by other processes since it was last read are
+// merged in first. The write lock is held throughout so that concurrent
+// flushes cannot interleave.
+func (s *FileStore) flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	entries, _, _, err := s.readChanged()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if s.pending != nil {
+		s.pending.Stop()
+		s.pending = nil
+	}
+	if entries != nil {
+		s.merge(entries)
+	} else {
+		s.prune()
+	}
+	data, err := json.MarshalIndent(s.entries, "", "  ")
+	written := s.dirty
+	s.dirty = make(map[string]bool)
+	s.mu.Unlock()
+	if err != nil {
+		err = fmt.Errorf("failed to encode store: %w", err)
+	} else {
+		err = s.write(data)
+	}
+	if err != nil {
+		// The changes are written with the next flush
+		s.mu.Lock()
+		for k := range written {
+			s.dirty[k] = true
+		}
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// write replaces the file with data
+func (s *FileStore) write(data []byte) error {
+	dir := filepath.Dir(s.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create store directory: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to write store file: %w", err)
+	}
+	modTime, size := fileVersion(s.path)
+	s.mu.Lock()
+	s.modTime, s.size = modTime, size
+	s.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,141 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// Store types
+const (
+	TypeMemory = "memory"
+	TypeFile   = "file"
+)
+
+// Store is a small key/value store for proxy state such as quotas and registrations.
+// Values are JSON encoded; a zero ttl means the entry never expires.
+type Store interface {
+	Get(key string, v any) (bool, error)
+	Put(key string, v any, ttl time.Duration) error
+	Delete(key string) error
+	Keys(prefix string) ([]string, error)
+}
+
+// Close writes the changes a store has not saved yet, if it defers any
+func Close(s Store) error {
+	if c, ok := s.(interface{ Close() error }); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// New creates the store described by the configuration
+func New(cfg config.StoreConfig) (Store, error) {
+	switch cfg.Type {
+	case "", TypeMemory:
+		return NewMemoryStore(), nil
+	case TypeFile:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("store path is required for the file store")
+		}
+		return NewFileStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unsupported store type: %s", cfg.Type)
+	}
+}
+
+type entry struct {
+	Value     json.RawMessage `json:"value"`
+	ExpiresAt time.Time       `json:"expires_at,omitempty"`
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && now.After(e.ExpiresAt)
+}
+
+// pruneInterval is how often Put sweeps expired entries out of memory
+const pruneInterval = time.Minute
+
+// MemoryStore keeps entries in process memory
+type MemoryStore struct {
+	mu      sync.RWMutex
+	entries map[string]entry
+
+	// When expired entries were last swept
+	pruned time.Time
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]entry)}
+}
+
+func (s *MemoryStore) Get(key string, v any) (bool, error) {
+	s.mu.RLock()
+	e, ok := s.entries[key]
+	s.mu.RUnlock()
+	if !ok || e.expired(time.Now()) {
+		return false, nil
+	}
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return false, fmt.Errorf("failed to decode %s: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *MemoryStore) Put(key string, v any, ttl time.Duration) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", key, err)
+	}
+	e := entry{Value: data}
+	if ttl > 0 {
+		e.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	s.entries[key] = e
+	if time.Since(s.pruned) >= pruneInterval {
+		s.prune()
+	}
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) error {
+	s.mu.Lock()
+	delete(s.entries, key)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *MemoryStore) Keys(prefix string) ([]string, error) {
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var keys []string
+	for k, e := range s.entries {
+		if strings.HasPrefix(k, prefix) && !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// prune drops expired entries; callers must hold the write lock
+func (s *MemoryStore) prune() {
+	now := time.Now()
+	s.pruned = now
+	for k, e := range s.entries {
+		if e.expired(now) {
+			delete(s.entries, k)
+		}
+	}
+}
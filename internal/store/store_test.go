@@ -0,0 +1,211 @@
+package store
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	s := NewMemoryStore()
+	if err := s.Put("a", 1, time.Millisecond); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put("b", 2, 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	var v int
+	if found, _ := s.Get("a", &v); found {
+		t.Errorf("Expected expired entry to be missing")
+	}
+	if found, _ := s.Get("b", &v); !found || v != 2 {
+		t.Errorf("Expected b=2, got found=%v v=%d", found, v)
+	}
+}
+
+func TestMemoryStorePrunesOnPut(t *testing.T) {
+	s := NewMemoryStore()
+	s.Put("a", 1, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	s.mu.Lock()
+	s.pruned = time.Time{}
+	s.mu.Unlock()
+	s.Put("b", 2, 0)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if _, ok := s.entries["a"]; ok {
+		t.Errorf("Expected the expired entry to be dropped")
+	}
+}
+
+func TestFileStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "store.json")
+
+	s, err := New(config.StoreConfig{Type: TypeFile, Path: path})
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	if err := s.Put("quota:alice", map[string]int{"count": 3}, time.Hour); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Put("quota:bob", map[string]int{"count": 1}, 0); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if err := s.Delete("quota:bob"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	var v map[string]int
+	if found, err := reopened.Get("quota:alice", &v); err != nil || !found || v["count"] != 3 {
+		t.Errorf("Expected persisted count=3, got found=%v v=%v err=%v", found, v, err)
+	}
+	keys, _ := reopened.Keys("quota:")
+	if len(keys) != 1 {
+		t.Errorf("Expected 1 key after delete, got %v", keys)
+	}
+}
+
+func TestFileStoreReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	proxy, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	proxy.Put("pin:a", "v1", 0)
+
+	// Another process changes the file
+	admin, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	admin.Put("pin:b", "approved", 0)
+
+	var v string
+	if found, _ := proxy.Get("pin:b", &v); found {
+		t.Fatal("Expected the change not to be seen before reloading")
+	}
+	if err := proxy.Reload(); err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if found, _ := proxy.Get("pin:b", &v); !found || v != "approved" {
+		t.Errorf("Expected the reloaded entry, got found=%v v=%q", found, v)
+	}
+	if found, _ := proxy.Get("pin:a", &v); !found || v != "v1" {
+		t.Errorf("Expected the existing entry to be kept, got found=%v v=%q", found, v)
+	}
+}
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := s.Put(fmt.Sprintf("client:%d", i), i, 0); err != nil {
+				t.Errorf("Put failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	if keys, _ := reopened.Keys("client:"); len(keys) != 20 {
+		t.Errorf("Expected 20 persisted keys, got %d", len(keys))
+	}
+	if matches, _ := filepath.Glob(path + ".*.tmp"); len(matches) != 0 {
+		t.Errorf("Expected no leftover temporary files, got %v", matches)
+	}
+}
+
+func TestFileStoreDefersExpiringEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	s, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	s.Put("quota:alice", 1, time.Hour)
+
+	var v int
+	if before, _ := NewFileStore(path); before != nil {
+		if found, _ := before.Get("quota:alice", &v); found {
+			t.Fatal("Expected the expiring entry not to be written immediately")
+		}
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	after, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	if found, _ := after.Get("quota:alice", &v); !found || v != 1 {
+		t.Errorf("Expected the entry after Close, got found=%v v=%d", found, v)
+	}
+}
+
+func TestNewUnsupportedType(t *testing.T) {
+	if _, err := New(config.StoreConfig{Type: "redis"}); err == nil {
+		t.Errorf("Expected error for unsupported store type")
+	}
+}
+
+func TestFileStoreMergesChangesOfOtherProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "store.json")
+	proxy, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	proxy.Put("pin:a", "pending", 0)
+	proxy.Put("quota:alice", 1, time.Hour)
+
+	// An admin command approves a tool while the proxy runs
+	admin, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to open file store: %v", err)
+	}
+	admin.Put("pin:b", "approved", 0)
+	admin.Delete("pin:a")
+
+	// The proxy writes without having reloaded the file
+	proxy.Put("pin:c", "pending", 0)
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen file store: %v", err)
+	}
+	var v string
+	if found, _ := reopened.Get("pin:b", &v); !found || v != "approved" {
+		t.Errorf("Expected the admin's change to be kept, got found=%v v=%q", found, v)
+	}
+	if found, _ := reopened.Get("pin:a", &v); found {
+		t.Error("Expected the admin's delete to be kept")
+	}
+	if found, _ := reopened.Get("pin:c", &v); !found {
+		t.Error("Expected the proxy's change to be written")
+	}
+	var n int
+	if found, _ := reopened.Get("quota:alice", &n); !found || n != 1 {
+		t.Errorf("Expected the deferred entry to be written, got found=%v n=%d", found, n)
+	}
+}
@@ -74,6 +74,12 @@ func (m *Manager) SetShutdownDelay(duration time.Duration) {
 
 // Start launches a subprocess based on the configuration
 func (m *Manager) Start(cfg *config.Config) error {
+	return m.StartWithEnv(cfg, nil)
+}
+
+// StartWithEnv launches a subprocess with additional environment variables,
+// which take precedence over those of the configuration
+func (m *Manager) StartWithEnv(cfg *config.Config, env []string) error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -108,8 +114,8 @@ func (m *Manager) Start(cfg *config.Config) error {
 	}
 
 	// Set environment variables if specified
-	if len(cfg.Stdio.Env) > 0 {
-		cmd.Env = append(os.Environ(), cfg.Stdio.Env...)
+	if len(cfg.Stdio.Env) > 0 || len(env) > 0 {
+		cmd.Env = append(append(os.Environ(), cfg.Stdio.Env...), env...)
 	}
 
 	// Capture stdout/stderr
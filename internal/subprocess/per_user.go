@@ -0,0 +1,233 @@
+package subprocess
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const (
+	defaultIdleTimeout  = 15 * time.Minute
+	defaultMaxProcesses = 20
+	// How long a new subprocess may take to accept connections
+	startTimeout = time.Minute
+)
+
+// userProcess is the MCP server subprocess of one user
+type userProcess struct {
+	manager *Manager
+	baseURL *url.URL
+	// Hash of the environment it was started with
+	env [sha256.Size]byte
+	// Closed once the subprocess accepts connections or failed to
+	ready chan struct{}
+	err   error
+	// Requests using the subprocess; guarded by UserProcesses.mu
+	active   int
+	lastUsed time.Time
+}
+
+// UserProcesses runs a subprocess for each user, so that every user's MCP
+// server has their own credentials in its environment
+type UserProcesses struct {
+	cfg  *config.Config
+	idle time.Duration
+	max  int
+
+	mu    sync.Mutex
+	procs map[string]*userProcess
+}
+
+// NewUserProcesses creates the per-user subprocesses of an MCP server; they
+// are started on first use
+func NewUserProcesses(cfg *config.Config) *UserProcesses {
+	idle := defaultIdleTimeout
+	if cfg.Stdio.IdleTimeoutSeconds > 0 {
+		idle = time.Duration(cfg.Stdio.IdleTimeoutSeconds) * time.Second
+	}
+	max := defaultMaxProcesses
+	if cfg.Stdio.MaxProcesses > 0 {
+		max = cfg.Stdio.MaxProcesses
+	}
+	return &UserProcesses{
+		cfg:   cfg,
+		idle:  idle,
+		max:   max,
+		procs: make(map[string]*userProcess),
+	}
+}
+
+// Acquire returns the base URL of the subject's subprocess, starting it with
+// env when it is not running. A subprocess started with other credentials is
+// restarted once nobody uses it. The release function must be called when
+// the request is done.
+func (u *UserProcesses) Acquire(subject string, env []string) (*url.URL, func(), error) {
+	envHash := sha256.Sum256([]byte(strings.Join(env, "\x00")))
+
+	u.mu.Lock()
+	proc := u.procs[subject]
+	if proc != nil && proc.active == 0 && (proc.env != envHash || !proc.running()) {
+		delete(u.procs, subject)
+		go proc.manager.Shutdown()
+		proc = nil
+	}
+	if proc == nil {
+		if len(u.procs) >= u.max {
+			u.mu.Unlock()
+			return nil, nil, fmt.Errorf("%d per-user subprocesses are already running", u.max)
+		}
+		var err error
+		if proc, err = u.start(env, envHash); err != nil {
+			u.mu.Unlock()
+			return nil, nil, err
+		}
+		u.procs[subject] = proc
+	}
+	proc.active++
+	proc.lastUsed = time.Now()
+	u.mu.Unlock()
+
+	release := func() {
+		u.mu.Lock()
+		proc.active--
+		proc.lastUsed = time.Now()
+		u.mu.Unlock()
+	}
+
+	<-proc.ready
+	if proc.err != nil {
+		release()
+		u.mu.Lock()
+		if u.procs[subject] == proc {
+			delete(u.procs, subject)
+		}
+		u.mu.Unlock()
+		return nil, nil, proc.err
+	}
+	return proc.baseURL, release, nil
+}
+
+// start launches a subprocess on a free port; callers must hold mu
+func (u *UserProcesses) start(env []string, envHash [sha256.Size]byte) (*userProcess, error) {
+	port, err := freePort()
+	if err != nil {
+		return nil, fmt.Errorf("no free port for a per-user subprocess: %w", err)
+	}
+	cfg := *u.cfg
+	cfg.Port = port
+	cfg.BaseURL = fmt.Sprintf("http://localhost:%d", port)
+	baseURL, _ := url.Parse(cfg.BaseURL)
+
+	proc := &userProcess{manager: NewManager(), baseURL: baseURL, env: envHash, ready: make(chan struct{})}
+	if err := proc.manager.StartWithEnv(&cfg, env); err != nil {
+		return nil, err
+	}
+	go func() {
+		proc.err = waitForPort(proc.manager, port, startTimeout)
+		if proc.err != nil {
+			proc.manager.Shutdown()
+		}
+		close(proc.ready)
+	}()
+	return proc, nil
+}
+
+// running reports whether the subprocess is starting or running
+func (p *userProcess) running() bool {
+	select {
+	case <-p.ready:
+		return p.err == nil && p.manager.IsRunning()
+	default:
+		return true
+	}
+}
+
+// StartJanitor periodically stops subprocesses that have not been used for
+// the idle timeout, until ctx is done
+func (u *UserProcesses) StartJanitor(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(u.idle / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				u.stopIdle()
+			}
+		}
+	}()
+}
+
+func (u *UserProcesses) stopIdle() {
+	var idle []*userProcess
+	u.mu.Lock()
+	for subject, proc := range u.procs {
+		if proc.active == 0 && time.Since(proc.lastUsed) >= u.idle {
+			delete(u.procs, subject)
+			idle = append(idle, proc)
+		}
+	}
+	u.mu.Unlock()
+
+	for _, proc := range idle {
+		proc.manager.Shutdown()
+	}
+}
+
+// Shutdown stops all subprocesses
+func (u *UserProcesses) Shutdown() {
+	u.mu.Lock()
+	procs := u.procs
+	u.procs = make(map[string]*userProcess)
+	u.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, proc := range procs {
+		wg.Add(1)
+		go func(proc *userProcess) {
+			defer wg.Done()
+			proc.manager.Shutdown()
+		}(proc)
+	}
+	wg.Wait()
+}
+
+// freePort asks the system for a port that is not in use
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForPort waits until the subprocess accepts connections on the local port
+func waitForPort(m *Manager, port int, timeout time.Duration) error {
+	address := fmt.Sprintf("127.0.0.1:%d", port)
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.DialTimeout("tcp", address, time.Second)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		if !m.IsRunning() {
+			return fmt.Errorf("subprocess exited before listening on port %d", port)
+		}
+		if time.Now().After(deadline) {
+			logger.Warn("Per-user subprocess did not listen on port %d: %v", port, err)
+			return fmt.Errorf("subprocess did not start within %s", timeout)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+}
@@ -0,0 +1,151 @@
+package tlsserver
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+// writeCertificate writes a fresh self-signed certificate and key to dir
+func writeCertificate(t *testing.T, dir, commonName string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(key)
+
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatalf("Failed to parse certificate: %v", err)
+	}
+	return parsed.Subject.CommonName
+}
+
+func TestCertReloaderPicksUpReplacedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := writeCertificate(t, dir, "first")
+
+	reloader, err := NewCertReloader(certFile, keyFile, time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCertReloader failed: %v", err)
+	}
+	cert, _ := reloader.GetCertificate(nil)
+	if got := commonName(t, cert); got != "first" {
+		t.Fatalf("Expected the first certificate, got %s", got)
+	}
+
+	writeCertificate(t, dir, "second")
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, future, future)
+	time.Sleep(5 * time.Millisecond)
+
+	cert, _ = reloader.GetCertificate(nil)
+	if got := commonName(t, cert); got != "second" {
+		t.Errorf("Expected the replaced certificate, got %s", got)
+	}
+
+	// A broken replacement keeps the current certificate
+	os.WriteFile(keyFile, []byte("not a key"), 0600)
+	later := future.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	time.Sleep(5 * time.Millisecond)
+
+	cert, _ = reloader.GetCertificate(nil)
+	if got := commonName(t, cert); got != "second" {
+		t.Errorf("Expected the current certificate to be kept, got %s", got)
+	}
+}
+
+func TestNewConfig(t *testing.T) {
+	certFile, keyFile := writeCertificate(t, t.TempDir(), "proxy")
+
+	tlsConfig, err := NewConfig(config.ListenerTLSConfig{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		MinVersion:   "1.3",
+		ClientAuth:   ClientAuthRequire,
+		ClientCAFile: certFile,
+	})
+	if err != nil {
+		t.Fatalf("NewConfig failed: %v", err)
+	}
+	if tlsConfig.MinVersion != tls.VersionTLS13 {
+		t.Errorf("Expected TLS 1.3 minimum, got %x", tlsConfig.MinVersion)
+	}
+	if tlsConfig.ClientAuth != tls.RequireAndVerifyClientCert || tlsConfig.ClientCAs == nil {
+		t.Errorf("Expected client certificates to be required and verified")
+	}
+
+	invalid := []config.ListenerTLSConfig{
+		{CertFile: certFile},
+		{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.0"},
+		{CertFile: certFile, KeyFile: keyFile, ClientAuth: "sometimes"},
+		{CertFile: certFile, KeyFile: keyFile, ClientAuth: ClientAuthOptional},
+	}
+	for _, cfg := range invalid {
+		if _, err := NewConfig(cfg); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		host     string
+		port     int
+		expected string
+	}{
+		{"example.com", 443, "https://example.com/sse?x=1"},
+		{"example.com:8080", 8443, "https://example.com:8443/sse?x=1"},
+		{"[::1]:8080", 8443, "https://[::1]:8443/sse?x=1"},
+	}
+	for _, tc := range tests {
+		req := httptest.NewRequest(http.MethodGet, "http://"+tc.host+"/sse?x=1", nil)
+		rec := httptest.NewRecorder()
+		RedirectHandler(tc.port).ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusPermanentRedirect {
+			t.Errorf("Expected 308 for %s, got %d", tc.host, rec.Code)
+		}
+		if got := rec.Header().Get("Location"); got != tc.expected {
+			t.Errorf("Expected redirect to %s, got %s", tc.expected, got)
+		}
+	}
+}
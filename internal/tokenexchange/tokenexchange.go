@@ -0,0 +1,262 @@
+// Package tokenexchange exchanges the tokens clients present to the proxy for
+// downstream tokens at the IdP (RFC 8693), so that the MCP server receives a
+// credential issued for its own audience.
+package tokenexchange
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const (
+	grantType           = "urn:ietf:params:oauth:grant-type:token-exchange"
+	tokenTypeAccess     = "urn:ietf:params:oauth:token-type:access_token"
+	authMethodBasic     = "client_secret_basic"
+	authMethodPost      = "client_secret_post"
+	defaultExpiresIn    = 5 * time.Minute
+	expiryMargin        = 30 * time.Second
+	maxErrorBodyLength  = 512
+	maxTokenResponseLen = 1 << 20
+)
+
+// Error is an unsuccessful token exchange response from the IdP
+type Error struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *Error) Error() string {
+	if e.Description != "" {
+		return fmt.Sprintf("token exchange failed (%d): %s: %s", e.Status, e.Code, e.Description)
+	}
+	return fmt.Sprintf("token exchange failed (%d): %s", e.Status, e.Code)
+}
+
+type cachedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+// inflightExchange lets concurrent requests with the same subject token share one exchange
+type inflightExchange struct {
+	sync.Mutex
+	// Requests holding or waiting for the lock; guarded by Exchanger.mu
+	refs int
+}
+
+// Exchanger exchanges subject tokens and caches the results per subject token
+type Exchanger struct {
+	cfg      config.TokenExchangeConfig
+	endpoint string
+	client   *http.Client
+	now      func() time.Time
+
+	mu       sync.Mutex
+	cache    map[string]*cachedToken
+	inflight map[string]*inflightExchange
+}
+
+// New creates an Exchanger. defaultEndpoint is used when no token endpoint is configured.
+func New(cfg config.TokenExchangeConfig, defaultEndpoint string) (*Exchanger, error) {
+	endpoint := cfg.TokenEndpoint
+	if endpoint == "" {
+		endpoint = defaultEndpoint
+	}
+	if endpoint == "" {
+		return nil, fmt.Errorf("token_exchange.token_endpoint is required")
+	}
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("token_exchange.client_id is required")
+	}
+	switch cfg.AuthMethod {
+	case "", authMethodBasic, authMethodPost:
+	default:
+		return nil, fmt.Errorf("unsupported token_exchange.auth_method %q", cfg.AuthMethod)
+	}
+
+	return &Exchanger{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   httpclient.Client(httpclient.DestinationIdP),
+		now:      time.Now,
+		cache:    make(map[string]*cachedToken),
+		inflight: make(map[string]*inflightExchange),
+	}, nil
+}
+
+// Token returns a downstream token for the subject token, exchanging it at the
+// IdP unless a cached token for the same subject token is still valid. The
+// result never outlives the subject token. Callers must have verified the
+// subject token, whose claims are only read for its expiry.
+func (e *Exchanger) Token(subjectToken string, claims jwt.MapClaims) (string, error) {
+	key := cacheKey(subjectToken)
+
+	lock := e.acquire(key)
+	defer e.release(key, lock)
+
+	if token := e.cached(key); token != "" {
+		return token, nil
+	}
+
+	token, expiresIn, err := e.exchange(subjectToken)
+	if err != nil {
+		return "", err
+	}
+
+	expiresAt := e.now().Add(expiresIn - expiryMargin)
+	if exp, ok := claims["exp"].(float64); ok {
+		if subjectExpiry := time.Unix(int64(exp), 0); subjectExpiry.Before(expiresAt) {
+			expiresAt = subjectExpiry
+		}
+	}
+
+	e.mu.Lock()
+	e.pruneExpired()
+	e.cache[key] = &cachedToken{token: token, expiresAt: expiresAt}
+	e.mu.Unlock()
+	return token, nil
+}
+
+func (e *Exchanger) cached(key string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.cache[key]; ok && e.now().Before(c.expiresAt) {
+		return c.token
+	}
+	return ""
+}
+
+// acquire locks the exchange for a subject token
+func (e *Exchanger) acquire(key string) *inflightExchange {
+	e.mu.Lock()
+	lock, ok := e.inflight[key]
+	if !ok {
+		lock = &inflightExchange{}
+		e.inflight[key] = lock
+	}
+	lock.refs++
+	e.mu.Unlock()
+
+	lock.Lock()
+	return lock
+}
+
+// release unlocks the exchange and forgets the lock once nobody holds or waits for it
+func (e *Exchanger) release(key string, lock *inflightExchange) {
+	lock.Unlock()
+
+	e.mu.Lock()
+	lock.refs--
+	if lock.refs == 0 {
+		delete(e.inflight, key)
+	}
+	e.mu.Unlock()
+}
+
+// pruneExpired drops expired tokens; callers must hold mu
+func (e *Exchanger) pruneExpired() {
+	now := e.now()
+	for key, c := range e.cache {
+		if !now.Before(c.expiresAt) {
+			delete(e.cache, key)
+		}
+	}
+}
+
+// exchange performs the token exchange request
+func (e *Exchanger) exchange(subjectToken string) (string, time.Duration, error) {
+	form := url.Values{
+		"grant_type":         {grantType},
+		"subject_token":      {subjectToken},
+		"subject_token_type": {tokenTypeAccess},
+	}
+	requested := e.cfg.RequestedTokenType
+	if requested == "" {
+		requested = tokenTypeAccess
+	}
+	form.Set("requested_token_type", requested)
+	if e.cfg.Audience != "" {
+		form.Set("audience", e.cfg.Audience)
+	}
+	if e.cfg.Resource != "" {
+		form.Set("resource", e.cfg.Resource)
+	}
+	if len(e.cfg.Scopes) > 0 {
+		form.Set("scope", strings.Join(e.cfg.Scopes, " "))
+	}
+	if e.cfg.AuthMethod == authMethodPost {
+		form.Set("client_id", e.cfg.ClientID)
+		form.Set("client_secret", e.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, e.endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", 0, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.cfg.AuthMethod != authMethodPost {
+		req.SetBasicAuth(url.QueryEscape(e.cfg.ClientID), url.QueryEscape(e.cfg.ClientSecret))
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("token exchange request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodyLength))
+		var oauthErr struct {
+			Error            string `json:"error"`
+			ErrorDescription string `json:"error_description"`
+		}
+		if json.Unmarshal(body, &oauthErr) != nil || oauthErr.Error == "" {
+			oauthErr.Error = strings.TrimSpace(string(body))
+		}
+		return "", 0, &Error{Status: resp.StatusCode, Code: oauthErr.Error, Description: oauthErr.ErrorDescription}
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		TokenType   string `json:"token_type"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxTokenResponseLen)).Decode(&result); err != nil {
+		return "", 0, fmt.Errorf("failed to parse token exchange response: %w", err)
+	}
+	if result.AccessToken == "" {
+		return "", 0, fmt.Errorf("token exchange response has no access_token")
+	}
+	if result.TokenType != "" && !strings.EqualFold(result.TokenType, "Bearer") && !strings.EqualFold(result.TokenType, "N_A") {
+		logger.Warn("Token exchange returned token type %q; forwarding it as a bearer token", result.TokenType)
+	}
+
+	expiresIn := defaultExpiresIn
+	if result.ExpiresIn > 0 {
+		expiresIn = time.Duration(result.ExpiresIn) * time.Second
+	}
+	return result.AccessToken, expiresIn, nil
+}
+
+// cacheKey identifies a subject token by its hash. Tokens are not keyed by
+// their sub claim, as a token minted for the same subject elsewhere must not
+// be handed another token's exchange result.
+func cacheKey(subjectToken string) string {
+	sum := sha256.Sum256([]byte(subjectToken))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,148 @@
+package tokenexchange
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+)
+
+func newTestIdP(t *testing.T, calls *int32, check func(r *http.Request)) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(calls, 1)
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("Failed to parse form: %v", err)
+		}
+		if check != nil {
+			check(r)
+		}
+		if r.PostForm.Get("subject_token") == "denied" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_target", "error_description": "audience not allowed"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":      "downstream-" + r.PostForm.Get("subject_token") + "-" + string(rune('0'+n)),
+			"issued_token_type": tokenTypeAccess,
+			"token_type":        "Bearer",
+			"expires_in":        3600,
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestTokenSendsExchangeRequest(t *testing.T) {
+	var calls int32
+	server := newTestIdP(t, &calls, func(r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "proxy" || pass != "secret" {
+			t.Errorf("Expected basic client authentication, got %q/%q", user, pass)
+		}
+		expected := map[string]string{
+			"grant_type":           grantType,
+			"subject_token":        "incoming",
+			"subject_token_type":   tokenTypeAccess,
+			"requested_token_type": tokenTypeAccess,
+			"audience":             "https://api.example.com",
+			"scope":                "read write",
+		}
+		for k, v := range expected {
+			if got := r.PostForm.Get(k); got != v {
+				t.Errorf("Expected %s=%q, got %q", k, v, got)
+			}
+		}
+	})
+
+	exchanger, err := New(config.TokenExchangeConfig{
+		ClientID:     "proxy",
+		ClientSecret: "secret",
+		Audience:     "https://api.example.com",
+		Scopes:       []string{"read", "write"},
+	}, server.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	token, err := exchanger.Token("incoming", jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if token != "downstream-incoming-1" {
+		t.Errorf("Unexpected downstream token %q", token)
+	}
+}
+
+func TestTokenCachesPerSubject(t *testing.T) {
+	var calls int32
+	server := newTestIdP(t, &calls, nil)
+	exchanger, err := New(config.TokenExchangeConfig{ClientID: "proxy", AuthMethod: "client_secret_post"}, server.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	now := time.Now()
+	exchanger.now = func() time.Time { return now }
+	exp := float64(now.Add(10 * time.Minute).Unix())
+
+	first, _ := exchanger.Token("incoming", jwt.MapClaims{"sub": "alice", "exp": exp})
+	second, _ := exchanger.Token("incoming", jwt.MapClaims{"sub": "alice", "exp": exp})
+	if len(exchanger.inflight) != 0 {
+		t.Errorf("Expected no exchange locks to be left behind, got %d", len(exchanger.inflight))
+	}
+	if first != second || atomic.LoadInt32(&calls) != 1 {
+		t.Errorf("Expected the cached token to be reused, got %q and %q after %d calls", first, second, atomic.LoadInt32(&calls))
+	}
+
+	// Another token is exchanged on its own, even when it claims the same subject
+	if _, err := exchanger.Token("forged", jwt.MapClaims{"sub": "alice", "exp": exp}); err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Expected a separate exchange for another token, got %d calls", atomic.LoadInt32(&calls))
+	}
+
+	// The downstream token never outlives the subject token
+	now = now.Add(11 * time.Minute)
+	if _, err := exchanger.Token("incoming", jwt.MapClaims{"sub": "alice"}); err != nil {
+		t.Fatalf("Token failed: %v", err)
+	}
+	if atomic.LoadInt32(&calls) != 3 {
+		t.Errorf("Expected a new exchange after the subject token expired, got %d calls", atomic.LoadInt32(&calls))
+	}
+}
+
+func TestTokenReportsDeniedExchange(t *testing.T) {
+	var calls int32
+	server := newTestIdP(t, &calls, nil)
+	exchanger, err := New(config.TokenExchangeConfig{ClientID: "proxy"}, server.URL)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	_, err = exchanger.Token("denied", jwt.MapClaims{"sub": "alice"})
+	var exchangeErr *Error
+	if !errors.As(err, &exchangeErr) || exchangeErr.Status != http.StatusBadRequest || exchangeErr.Code != "invalid_target" {
+		t.Errorf("Expected an invalid_target error, got %v", err)
+	}
+}
+
+func TestNewValidatesConfig(t *testing.T) {
+	invalid := []config.TokenExchangeConfig{
+		{ClientID: "proxy"},
+		{TokenEndpoint: "https://idp.example.com/token"},
+		{TokenEndpoint: "https://idp.example.com/token", ClientID: "proxy", AuthMethod: "private_key_jwt"},
+	}
+	for _, cfg := range invalid {
+		if _, err := New(cfg, ""); err == nil {
+			t.Errorf("Expected %+v to be rejected", cfg)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package toolpin
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+	"github.com/wso2/open-mcp-auth-proxy/internal/metrics"
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+// Status is how a listed tool definition compares with the approved one
+type Status int
+
+const (
+	// Approved definitions match their fingerprint
+	Approved Status = iota
+	// Changed definitions differ from the approved one
+	Changed
+	// Unapproved tools have never been approved
+	Unapproved
+)
+
+var definitionChanges = metrics.NewCounter(
+	"mcp_proxy_tool_definition_changes_total",
+	"Tool definitions listed by an MCP server that do not match the approved fingerprint.",
+	"server", "tool", "action",
+)
+
+// Manager applies tool pinning to the tools of one MCP server
+type Manager struct {
+	server          string
+	action          string
+	requireApproval bool
+	pins            *Pins
+	now             func() time.Time
+}
+
+// New creates the manager for the named server. Pins of all servers share the store.
+func New(server string, cfg config.ToolPinningConfig, st store.Store) *Manager {
+	if server == "" {
+		server = DefaultServer
+	}
+	return &Manager{
+		server:          server,
+		action:          cfg.Action,
+		requireApproval: cfg.RequireApproval,
+		pins:            Open(st),
+		now:             time.Now,
+	}
+}
+
+// Check compares a listed tool definition with the approved one. Tools seen
+// for the first time are approved unless approval is required; definitions
+// that are not approved are recorded for review.
+func (m *Manager) Check(tool string, definition json.RawMessage) (Status, *Record, error) {
+	fingerprint, err := Fingerprint(definition)
+	if err != nil {
+		return Unapproved, nil, err
+	}
+	m.pins.mu.Lock()
+	defer m.pins.mu.Unlock()
+
+	approved, err := m.pins.Approved(m.server, tool)
+	if err != nil {
+		return Unapproved, nil, err
+	}
+	seen := Record{Server: m.server, Tool: tool, Fingerprint: fingerprint, Definition: definition, Time: m.now()}
+
+	if approved == nil && !m.requireApproval {
+		logger.Info("Pinned tool %s of server %s (%s)", tool, m.server, fingerprint)
+		if err := m.pins.store.Put(key(approvedPrefix, m.server, tool), seen, 0); err != nil {
+			return Approved, nil, err
+		}
+		return Approved, nil, m.pins.store.Delete(key(pendingPrefix, m.server, tool))
+	}
+	if approved != nil && approved.Fingerprint == fingerprint {
+		// A server that reverts to the approved definition has nothing left to review
+		return Approved, approved, m.pins.store.Delete(key(pendingPrefix, m.server, tool))
+	}
+
+	status := Unapproved
+	if approved != nil {
+		status = Changed
+	}
+	pending, err := m.pins.Pending(m.server, tool)
+	if err != nil || (pending != nil && pending.Fingerprint == fingerprint) {
+		// Already recorded and reported
+		return status, approved, err
+	}
+	if status == Changed {
+		logger.Warn("Tool %s of server %s changed since it was approved (%s -> %s); action: %s",
+			tool, m.server, approved.Fingerprint, fingerprint, m.action)
+	} else {
+		logger.Warn("Tool %s of server %s awaits approval (%s); action: %s", tool, m.server, fingerprint, m.action)
+	}
+	definitionChanges.Inc(m.server, tool, m.action)
+	return status, approved, m.pins.store.Put(key(pendingPrefix, m.server, tool), seen, 0)
+}
+
+// FilterList applies the configured action to the tools in a tools/list
+// result. It returns the result to send to the client, or nil when it is
+// unchanged.
+func (m *Manager) FilterList(result json.RawMessage) (json.RawMessage, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(result, &fields); err != nil {
+		return nil, err
+	}
+	var tools []json.RawMessage
+	if err := json.Unmarshal(fields["tools"], &tools); err != nil {
+		return nil, err
+	}
+	if err := m.pins.Reload(); err != nil {
+		logger.Warn("Failed to reload tool pins: %v", err)
+	}
+
+	modified := false
+	kept := make([]json.RawMessage, 0, len(tools))
+	for _, definition := range tools {
+		var tool struct {
+			Name string `json:"name"`
+		}
+		if json.Unmarshal(definition, &tool) != nil || tool.Name == "" {
+			kept = append(kept, definition)
+			continue
+		}
+		status, approved, err := m.Check(tool.Name, definition)
+		if err != nil {
+			logger.Error("Failed to check tool %s against its pin: %v", tool.Name, err)
+		}
+
+		switch {
+		case status == Approved || m.action == config.ToolPinAlert:
+			kept = append(kept, definition)
+		case m.action == config.ToolPinBlock && approved != nil:
+			// The client keeps seeing what was reviewed
+			kept = append(kept, approved.Definition)
+			modified = true
+		default:
+			modified = true
+		}
+	}
+	if !modified {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(kept)
+	if err != nil {
+		return nil, err
+	}
+	fields["tools"] = data
+	return json.Marshal(fields)
+}
+
+// Blocked reports whether calls to a tool are rejected because its current
+// definition has not been approved
+func (m *Manager) Blocked(tool string) bool {
+	if m.action == config.ToolPinAlert {
+		return false
+	}
+	if !m.unapproved(tool) {
+		return false
+	}
+	// The definition may have been approved since the store was last read
+	if err := m.pins.Reload(); err != nil {
+		logger.Warn("Failed to reload tool pins: %v", err)
+	}
+	return m.unapproved(tool)
+}
+
+func (m *Manager) unapproved(tool string) bool {
+	if pending, _ := m.pins.Pending(m.server, tool); pending != nil {
+		return true
+	}
+	if m.requireApproval {
+		approved, _ := m.pins.Approved(m.server, tool)
+		return approved == nil
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+// Package toolpin fingerprints the tool definitions an MCP server lists and
+// compares them with approved fingerprints, so that a server cannot silently
+// change what a tool claims to do after it was reviewed.
+package toolpin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/store"
+)
+
+const (
+	approvedPrefix = "tool-pins/approved/"
+	pendingPrefix  = "tool-pins/pending/"
+)
+
+// DefaultServer names the MCP server outside gateway mode
+const DefaultServer = "default"
+
+// Record is a fingerprinted tool definition
+type Record struct {
+	Server      string          `json:"server"`
+	Tool        string          `json:"tool"`
+	Fingerprint string          `json:"fingerprint"`
+	Definition  json.RawMessage `json:"definition"`
+	// When the definition was approved, or first seen while it awaits approval
+	Time time.Time `json:"time"`
+}
+
+// Fingerprint hashes a tool definition. Keys are sorted and _meta is left
+// out, so only changes to what the tool is and does produce a new fingerprint.
+func Fingerprint(definition json.RawMessage) (string, error) {
+	var v any
+	if err := json.Unmarshal(definition, &v); err != nil {
+		return "", fmt.Errorf("invalid tool definition: %w", err)
+	}
+	if obj, ok := v.(map[string]any); ok {
+		delete(obj, "_meta")
+	}
+	canonical, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Pins reads and changes the approved and pending tool definitions in a store
+type Pins struct {
+	store store.Store
+	mu    sync.Mutex // Serializes read-modify-write sequences
+}
+
+// Open wraps a store holding tool pins
+func Open(st store.Store) *Pins {
+	return &Pins{store: st}
+}
+
+func key(prefix, server, tool string) string {
+	return prefix + server + "/" + tool
+}
+
+// Reload picks up changes made by other processes, such as the pins command
+func (p *Pins) Reload() error {
+	if r, ok := p.store.(interface{ Reload() error }); ok {
+		return r.Reload()
+	}
+	return nil
+}
+
+// Approved returns the approved definition of a tool, or nil
+func (p *Pins) Approved(server, tool string) (*Record, error) {
+	return p.get(key(approvedPrefix, server, tool))
+}
+
+// Pending returns the definition of a tool that awaits approval, or nil
+func (p *Pins) Pending(server, tool string) (*Record, error) {
+	return p.get(key(pendingPrefix, server, tool))
+}
+
+func (p *Pins) get(k string) (*Record, error) {
+	var rec Record
+	found, err := p.store.Get(k, &rec)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &rec, nil
+}
+
+// List returns all approved and pending definitions, sorted by server and tool
+func (p *Pins) List() (approved, pending []Record, err error) {
+	if approved, err = p.list(approvedPrefix); err != nil {
+		return nil, nil, err
+	}
+	if pending, err = p.list(pendingPrefix); err != nil {
+		return nil, nil, err
+	}
+	return approved, pending, nil
+}
+
+func (p *Pins) list(prefix string) ([]Record, error) {
+	keys, err := p.store.Keys(prefix)
+	if err != nil {
+		return nil, err
+	}
+	records := make([]Record, 0, len(keys))
+	for _, k := range keys {
+		rec, err := p.get(k)
+		if err != nil {
+			return nil, err
+		}
+		if rec != nil {
+			records = append(records, *rec)
+		}
+	}
+	return records, nil
+}
+
+// Approve makes the pending definition of a tool the approved one
+func (p *Pins) Approve(server, tool string) (*Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, err := p.Pending(server, tool)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("no pending definition of tool %s on server %s", tool, server)
+	}
+	rec.Time = time.Now()
+	if err := p.store.Put(key(approvedPrefix, server, tool), rec, 0); err != nil {
+		return nil, err
+	}
+	return rec, p.store.Delete(key(pendingPrefix, server, tool))
+}
+
+// Revoke forgets the approved definition of a tool, so that the next definition listed is treated as a new tool
+func (p *Pins) Revoke(server, tool string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rec, err := p.Approved(server, tool)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return fmt.Errorf("tool %s on server %s has no approved definition", tool, server)
+	}
+	return p.store.Delete(key(approvedPrefix, server, tool))
+}
@@ -0,0 +1,180 @@
+// Package toolschema remembers the tools that an MCP server listed for each
+// session and validates tool call arguments against their input schemas.
+// Sessions that have not listed the tools fall back to the latest listing
+// of any session, and calls are not checked before any session listed them.
+package toolschema
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/wso2/open-mcp-auth-proxy/internal/jsonschema"
+	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
+)
+
+const defaultTTL = time.Hour
+
+// Result is the outcome of validating tool call arguments
+type Result int
+
+const (
+	// Unknown means the tool cannot be checked: its schema cannot be
+	// compiled, or no tools have been listed yet
+	Unknown Result = iota
+	// Valid arguments match the tool's input schema
+	Valid
+	// Invalid arguments do not match the tool's input schema
+	Invalid
+	// Unlisted means the tool is missing from the tools the server listed
+	Unlisted
+)
+
+func (r Result) String() string {
+	switch r {
+	case Valid:
+		return "valid"
+	case Invalid:
+		return "invalid"
+	case Unlisted:
+		return "unlisted"
+	}
+	return "unknown"
+}
+
+// Cache holds the tool input schemas of sessions. Sessions that are not used
+// for the TTL are forgotten.
+type Cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mu       sync.Mutex
+	sessions map[string]*session
+	// latest holds the most recent listing of each tool in any session
+	latest map[string]*jsonschema.Schema
+}
+
+type session struct {
+	// tools maps the listed tools to their schemas, which are nil when they
+	// cannot be checked
+	tools   map[string]*jsonschema.Schema
+	expires time.Time
+}
+
+// listResult is the result of a tools/list request
+type listResult struct {
+	Tools []struct {
+		Name        string          `json:"name"`
+		InputSchema json.RawMessage `json:"inputSchema"`
+	} `json:"tools"`
+}
+
+// New creates a cache. A zero TTL uses the default of one hour.
+func New(ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = defaultTTL
+	}
+	return &Cache{ttl: ttl, now: time.Now, sessions: make(map[string]*session), latest: make(map[string]*jsonschema.Schema)}
+}
+
+// Store records the tools of a tools/list result for the session. The first
+// page replaces what was known; later pages, requested with a cursor, add to it.
+func (c *Cache) Store(key string, result json.RawMessage, firstPage bool) error {
+	var list listResult
+	if err := json.Unmarshal(result, &list); err != nil {
+		return err
+	}
+
+	tools := make(map[string]*jsonschema.Schema, len(list.Tools))
+	for _, tool := range list.Tools {
+		if tool.Name == "" {
+			continue
+		}
+		if len(tool.InputSchema) == 0 {
+			tools[tool.Name] = nil
+			continue
+		}
+		schema, err := jsonschema.Compile(tool.InputSchema)
+		if err != nil {
+			// Calls to the tool are passed on unchecked
+			logger.Warn("Cannot validate arguments of tool %s: %v", tool.Name, err)
+			tools[tool.Name] = nil
+			continue
+		}
+		for _, ignored := range schema.Ignored {
+			logger.Warn("Not checking %s in the input schema of tool %s", ignored, tool.Name)
+		}
+		tools[tool.Name] = schema
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	c.sweep(now)
+	s, ok := c.sessions[key]
+	if !ok || firstPage {
+		s = &session{tools: tools}
+		c.sessions[key] = s
+	} else {
+		for name, schema := range tools {
+			s.tools[name] = schema
+		}
+	}
+	s.expires = now.Add(c.ttl)
+	for name, schema := range tools {
+		c.latest[name] = schema
+	}
+	return nil
+}
+
+// Validate checks the arguments of a call to a tool listed in the session.
+// Sessions that have not listed the tools use the latest listing of the tool
+// in any session. Calls are Unknown while no session has listed any tools,
+// such as after a restart, and Unlisted when the tool is missing from them.
+func (c *Cache) Validate(key, tool string, arguments any) (Result, error) {
+	c.mu.Lock()
+	now := c.now()
+	tools := c.latest
+	hasList := len(c.latest) > 0
+	if s, ok := c.sessions[key]; ok && now.Before(s.expires) {
+		tools = s.tools
+		hasList = true
+		s.expires = now.Add(c.ttl)
+	}
+	schema, listed := tools[tool]
+	c.mu.Unlock()
+
+	if !hasList {
+		return Unknown, nil
+	}
+	if !listed {
+		return Unlisted, nil
+	}
+	if schema == nil {
+		return Unknown, nil
+	}
+	if arguments == nil {
+		// Arguments are optional in tools/call and default to an empty object
+		arguments = map[string]any{}
+	}
+	if err := schema.Validate(arguments); err != nil {
+		return Invalid, err
+	}
+	return Valid, nil
+}
+
+// Forget drops the tools of an ended session
+func (c *Cache) Forget(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.sessions, key)
+}
+
+// sweep drops expired sessions. It must be called with the lock held.
+func (c *Cache) sweep(now time.Time) {
+	for key, s := range c.sessions {
+		if !now.Before(s.expires) {
+			delete(c.sessions, key)
+		}
+	}
+}
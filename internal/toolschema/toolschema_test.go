@@ -0,0 +1,102 @@
+package toolschema
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+const searchTools = `{"tools": [
+	{"name": "search", "inputSchema": {"type": "object", "properties": {"q": {"type": "string"}}, "required": ["q"]}},
+	{"name": "broken", "inputSchema": {"$ref": "#/definitions/Missing"}}
+]}`
+
+func args(t *testing.T, s string) any {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatalf("Invalid test JSON: %v", err)
+	}
+	return v
+}
+
+func TestCacheValidatesListedTools(t *testing.T) {
+	c := New(0)
+	// Nothing is checked before the tools have been listed
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": 1}`)); res != Unknown {
+		t.Errorf("Expected calls before any listing to be unknown, got %s", res)
+	}
+	if err := c.Store("s1", json.RawMessage(searchTools), true); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if res, err := c.Validate("s1", "search", args(t, `{"q": "mcp"}`)); res != Valid || err != nil {
+		t.Errorf("Expected valid arguments, got %s: %v", res, err)
+	}
+	if res, err := c.Validate("s1", "search", args(t, `{"q": 1}`)); res != Invalid || err == nil {
+		t.Errorf("Expected invalid arguments, got %s", res)
+	}
+	if res, _ := c.Validate("s1", "search", nil); res != Invalid {
+		t.Errorf("Expected missing arguments to be checked as an empty object, got %s", res)
+	}
+	// Tools with schemas that cannot be compiled are not checked
+	if res, _ := c.Validate("s1", "broken", args(t, `{}`)); res != Unknown {
+		t.Errorf("Expected broken to be unknown, got %s", res)
+	}
+	if res, _ := c.Validate("s1", "other", args(t, `{}`)); res != Unlisted {
+		t.Errorf("Expected other to be unlisted, got %s", res)
+	}
+	// Sessions that have not listed the tools use the latest listing
+	if res, _ := c.Validate("s2", "search", args(t, `{}`)); res != Invalid {
+		t.Errorf("Expected search in s2 to be checked against the latest listing, got %s", res)
+	}
+	if res, _ := c.Validate("", "search", args(t, `{"q": "x"}`)); res != Valid {
+		t.Errorf("Expected search without a session to be checked against the latest listing, got %s", res)
+	}
+
+	// Later pages add to the first
+	c.Store("s1", json.RawMessage(`{"tools": [{"name": "fetch", "inputSchema": {"type": "object"}}]}`), false)
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Valid {
+		t.Errorf("Expected the first page to be kept, got %s", res)
+	}
+	if res, _ := c.Validate("s1", "fetch", args(t, `{}`)); res != Valid {
+		t.Errorf("Expected the second page to be added, got %s", res)
+	}
+	// A new first page replaces the list
+	c.Store("s1", json.RawMessage(`{"tools": []}`), true)
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Unlisted {
+		t.Errorf("Expected a new listing to replace the tools, got %s", res)
+	}
+
+	c.Forget("s1")
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Valid {
+		t.Errorf("Expected a forgotten session to use the latest listing, got %s", res)
+	}
+}
+
+func TestCacheExpiresIdleSessions(t *testing.T) {
+	c := New(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	c.Store("s0", json.RawMessage(searchTools), true)
+	c.Store("s1", json.RawMessage(`{"tools": []}`), true)
+
+	now = now.Add(50 * time.Second)
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Unlisted {
+		t.Fatalf("Expected the session to be cached, got %s", res)
+	}
+	// Use extends the session
+	now = now.Add(50 * time.Second)
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Unlisted {
+		t.Fatalf("Expected use to extend the session, got %s", res)
+	}
+	now = now.Add(2 * time.Minute)
+	if res, _ := c.Validate("s1", "search", args(t, `{"q": "x"}`)); res != Valid {
+		t.Errorf("Expected an idle session to expire and use the latest listing, got %s", res)
+	}
+
+	c.Store("s2", json.RawMessage(searchTools), true)
+	if _, ok := c.sessions["s1"]; ok {
+		t.Error("Expected expired sessions to be swept")
+	}
+}
@@ -0,0 +1,37 @@
+package util
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"net/http"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// CertificateThumbprint returns the RFC 8705 x5t#S256 thumbprint of a certificate
+func CertificateThumbprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// VerifyCertificateBinding checks that the token's cnf claim is bound to the
+// client certificate presented on the request's TLS connection
+func VerifyCertificateBinding(r *http.Request, claims jwt.MapClaims) error {
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf["x5t#S256"].(string)
+	if thumbprint == "" {
+		return errors.New("access token is not bound to a client certificate")
+	}
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return errors.New("certificate-bound access token used without a client certificate")
+	}
+
+	presented := CertificateThumbprint(r.TLS.PeerCertificates[0])
+	if subtle.ConstantTimeCompare([]byte(presented), []byte(thumbprint)) != 1 {
+		return errors.New("access token is bound to a different client certificate")
+	}
+	return nil
+}
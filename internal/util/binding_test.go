@@ -0,0 +1,43 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestVerifyCertificateBinding(t *testing.T) {
+	cert := &x509.Certificate{Raw: []byte("client certificate")}
+	other := &x509.Certificate{Raw: []byte("another certificate")}
+	bound := jwt.MapClaims{"cnf": map[string]interface{}{"x5t#S256": CertificateThumbprint(cert)}}
+
+	withCert := func(c *x509.Certificate) *tls.ConnectionState {
+		return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{c}}
+	}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		tls     *tls.ConnectionState
+		wantErr bool
+	}{
+		{"matching certificate", bound, withCert(cert), false},
+		{"different certificate", bound, withCert(other), true},
+		{"no client certificate", bound, &tls.ConnectionState{}, true},
+		{"plain HTTP", bound, nil, true},
+		{"unbound token", jwt.MapClaims{"sub": "alice"}, withCert(cert), true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/mcp", nil)
+			req.TLS = tc.tls
+			err := VerifyCertificateBinding(req, tc.claims)
+			if (err != nil) != tc.wantErr {
+				t.Errorf("VerifyCertificateBinding() error = %v, wantErr %v", err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -6,11 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
-	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/golang-jwt/jwt/v4"
 	"github.com/wso2/open-mcp-auth-proxy/internal/config"
+	"github.com/wso2/open-mcp-auth-proxy/internal/httpclient"
 	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
 )
 
@@ -22,11 +23,14 @@ type JWKS struct {
 	Keys []json.RawMessage `json:"keys"`
 }
 
-var publicKeys map[string]*rsa.PublicKey
+var (
+	publicKeys map[string]*rsa.PublicKey
+	keysMu     sync.RWMutex
+)
 
 // FetchJWKS downloads JWKS and stores in a package‐level map
 func FetchJWKS(jwksURL string) error {
-	resp, err := http.Get(jwksURL)
+	resp, err := httpclient.Client(httpclient.DestinationJWKS).Get(jwksURL)
 	if err != nil {
 		return err
 	}
@@ -37,7 +41,7 @@ func FetchJWKS(jwksURL string) error {
 		return err
 	}
 
-	publicKeys = make(map[string]*rsa.PublicKey, len(jwks.Keys))
+	keys := make(map[string]*rsa.PublicKey, len(jwks.Keys))
 	for _, keyData := range jwks.Keys {
 		var parsed struct {
 			Kid string `json:"kid"`
@@ -53,13 +57,28 @@ func FetchJWKS(jwksURL string) error {
 		}
 		pubKey, err := parseRSAPublicKey(parsed.N, parsed.E)
 		if err == nil {
-			publicKeys[parsed.Kid] = pubKey
+			keys[parsed.Kid] = pubKey
 		}
 	}
-	logger.Info("Loaded %d public keys.", len(publicKeys))
+
+	keysMu.Lock()
+	publicKeys = keys
+	keysMu.Unlock()
+	logger.Info("Loaded %d public keys.", len(keys))
 	return nil
 }
 
+// AddPublicKey registers a locally held verification key, e.g. one generated by
+// the embedded authorization server, alongside keys loaded from JWKS.
+func AddPublicKey(kid string, key *rsa.PublicKey) {
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	if publicKeys == nil {
+		publicKeys = make(map[string]*rsa.PublicKey)
+	}
+	publicKeys[kid] = key
+}
+
 func parseRSAPublicKey(nStr, eStr string) (*rsa.PublicKey, error) {
 	nBytes, err := jwt.DecodeSegment(nStr)
 	if err != nil {
@@ -95,7 +114,9 @@ func ValidateJWT(
 		if !ok {
 			return nil, errors.New("kid header not found")
 		}
+		keysMu.RLock()
 		key, ok := publicKeys[kid]
+		keysMu.RUnlock()
 		if !ok {
 			return nil, fmt.Errorf("key not found for kid: %s", kid)
 		}
@@ -162,6 +183,14 @@ func ParseJWT(tokenStr string) (jwt.MapClaims, error) {
 
 // Process the required scopes
 func GetRequiredScopes(cfg *config.Config, requestBody *RPCEnvelope) []string {
+	scopes, _ := RequiredScopeRule(cfg, requestBody)
+	return scopes
+}
+
+// RequiredScopeRule returns the required scopes along with the scopes_supported
+// key that matched: the method for a method-level rule, or "method:tool" for
+// a tool-level one
+func RequiredScopeRule(cfg *config.Config, requestBody *RPCEnvelope) ([]string, string) {
 
 	var scopeObj interface{}
 	found := false
@@ -173,12 +202,12 @@ func GetRequiredScopes(cfg *config.Config, requestBody *RPCEnvelope) []string {
 		}
 	}
 	if !found {
-		return nil
+		return nil, ""
 	}
 
 	switch v := scopeObj.(type) {
 	case string:
-		return []string{v}
+		return []string{v}, requestBody.Method
 	case []any:
 		if requestBody.Params != nil {
 			if paramsMap, ok := requestBody.Params.(map[string]any); ok {
@@ -187,8 +216,9 @@ func GetRequiredScopes(cfg *config.Config, requestBody *RPCEnvelope) []string {
 					for _, item := range v {
 						if scopeMap, ok := item.(map[interface{}]interface{}); ok {
 							if scopeVal, exists := scopeMap[name]; exists {
+								rule := requestBody.Method + ":" + name
 								if scopeStr, ok := scopeVal.(string); ok {
-									return []string{scopeStr}
+									return []string{scopeStr}, rule
 								}
 								if scopeArr, ok := scopeVal.([]any); ok {
 									var scopes []string
@@ -197,7 +227,7 @@ func GetRequiredScopes(cfg *config.Config, requestBody *RPCEnvelope) []string {
 											scopes = append(scopes, str)
 										}
 									}
-									return scopes
+									return scopes, rule
 								}
 							}
 						}
@@ -207,21 +237,28 @@ func GetRequiredScopes(cfg *config.Config, requestBody *RPCEnvelope) []string {
 		}
 	}
 
-	return nil
+	return nil, ""
 }
 
-// Extracts the Bearer token from the Authorization header
+// Extracts the access token from a Bearer or DPoP Authorization header
 func ExtractAccessToken(authHeader string) (string, error) {
 	if authHeader == "" {
 		return "", errors.New("empty authorization header")
 	}
-	if !strings.HasPrefix(authHeader, "Bearer ") {
+
+	var tokenStr string
+	switch {
+	case strings.HasPrefix(authHeader, "Bearer "):
+		tokenStr = strings.TrimPrefix(authHeader, "Bearer ")
+	case strings.HasPrefix(authHeader, "DPoP "):
+		tokenStr = strings.TrimPrefix(authHeader, "DPoP ")
+	default:
 		return "", fmt.Errorf("invalid authorization header format: %s", authHeader)
 	}
 
-	tokenStr := strings.TrimSpace(strings.TrimPrefix(authHeader, "Bearer "))
+	tokenStr = strings.TrimSpace(tokenStr)
 	if tokenStr == "" {
-		return "", errors.New("empty bearer token")
+		return "", errors.New("empty access token")
 	}
 
 	return tokenStr, nil
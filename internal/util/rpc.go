@@ -9,12 +9,53 @@ import (
 	logger "github.com/wso2/open-mcp-auth-proxy/internal/logging"
 )
 
+// JSON-RPC error codes returned by the proxy. Codes in the -32000 to -32099
+// range are reserved by JSON-RPC 2.0 for implementation-defined server errors.
+const (
+	RPCErrorParse          = -32700
+	RPCErrorInvalidRequest = -32600
+	RPCErrorInvalidParams  = -32602
+	RPCErrorAccessDenied   = -32003
+	RPCErrorRateLimited    = -32029
+	// The MCP server is down, timed out or its circuit breaker is open
+	RPCErrorUpstreamUnavailable = -32030
+	// A tool result was withheld because it contains sensitive content
+	RPCErrorContentBlocked = -32031
+)
+
 type RPCEnvelope struct {
 	Method string `json:"method"`
 	Params any    `json:"params"`
 	ID     any    `json:"id"`
 }
 
+// ToolName returns params.name of a tools/call request, or "" for other requests
+func (e *RPCEnvelope) ToolName() string {
+	if e == nil || e.Method != "tools/call" {
+		return ""
+	}
+	if params, ok := e.Params.(map[string]any); ok {
+		if name, ok := params["name"].(string); ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// RPCError is the error member of a JSON-RPC 2.0 response
+type RPCError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// RPCErrorResponse is a JSON-RPC 2.0 response carrying an error
+type RPCErrorResponse struct {
+	JSONRPC string    `json:"jsonrpc"`
+	ID      any       `json:"id"`
+	Error   *RPCError `json:"error"`
+}
+
 // This function parses a JSON-RPC request from an HTTP request body
 func ParseRPCRequest(r *http.Request) (*RPCEnvelope, error) {
 	bodyBytes, err := io.ReadAll(r.Body)
@@ -36,3 +77,22 @@ func ParseRPCRequest(r *http.Request) (*RPCEnvelope, error) {
 
 	return &env, nil
 }
+
+// WriteRPCError writes a JSON-RPC 2.0 error object that echoes the request id
+func WriteRPCError(w http.ResponseWriter, status int, id any, code int, message string, data any) {
+	resp := RPCErrorResponse{
+		JSONRPC: "2.0",
+		ID:      id,
+		Error: &RPCError{
+			Code:    code,
+			Message: message,
+			Data:    data,
+		},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		logger.Error("Error encoding JSON-RPC error response: %v", err)
+	}
+}
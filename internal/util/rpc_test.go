@@ -0,0 +1,41 @@
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWriteRPCError(t *testing.T) {
+	w := httptest.NewRecorder()
+	WriteRPCError(w, http.StatusOK, float64(7), RPCErrorAccessDenied, "Forbidden", map[string]string{"rule": "initialize"})
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status OK, got %v", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected Content-Type: application/json, got %s", ct)
+	}
+
+	var resp struct {
+		JSONRPC string         `json:"jsonrpc"`
+		ID      any            `json:"id"`
+		Error   map[string]any `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response JSON: %v", err)
+	}
+	if resp.JSONRPC != "2.0" {
+		t.Errorf("Expected jsonrpc=2.0, got %s", resp.JSONRPC)
+	}
+	if resp.ID != float64(7) {
+		t.Errorf("Expected id=7, got %v", resp.ID)
+	}
+	if resp.Error["code"] != float64(RPCErrorAccessDenied) {
+		t.Errorf("Expected code=%d, got %v", RPCErrorAccessDenied, resp.Error["code"])
+	}
+	if data, ok := resp.Error["data"].(map[string]any); !ok || data["rule"] != "initialize" {
+		t.Errorf("Expected data.rule=initialize, got %v", resp.Error["data"])
+	}
+}